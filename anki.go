@@ -89,6 +89,8 @@ func main() {
 	}
 	anki.API = api.NewApi(&cfg, log)
   anki.Log = log
+	// the commands report their errors with the logger of the io streams
+	anki.IO.Log = log
 
 	// Run anki-cli
 	var root = root.NewRootCmd(anki)
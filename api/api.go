@@ -38,6 +38,19 @@ type Api interface {
 	RenameDeck(nameOrId string, newName string) error
 	// Create a deck
 	CreateDeck(name string) error
+	// DeleteDeck removes a deck and its children. The cards of the decks are deleted with
+	// the notes left without cards unless they are moved to the moveCardsTo deck
+	DeleteDeck(name string, moveCardsTo string) (models.DeleteResult, error)
+	// MoveDeck moves a deck and its children under a parent deck, or to the top level when
+	// the parent is empty, and returns the new name of the deck
+	MoveDeck(name string, parent string) (string, error)
+	// CreateFilteredDeck creates a filtered deck with the cards matching the terms
+	// and returns the number of cards moved into it
+	CreateFilteredDeck(name string, terms []models.FilterTerm, reschedule bool) (int, error)
+	// RebuildFilteredDeck gathers the cards of a filtered deck again and returns their number
+	RebuildFilteredDeck(name string) (int, error)
+	// EmptyFilteredDeck returns the cards of a filtered deck to their home deck
+	EmptyFilteredDeck(name string) error
 	// Get multiple cards. To return all cards pass -1 for the limit
 	Cards(qs string, limit int) ([]models.Card, error)
 	// Get a deck study option
@@ -55,8 +68,65 @@ type Api interface {
 	CreateCard(note models.Note, model models.NoteType, deckName string) (models.Card, error)
 	// Tags returns a list of tags cached in the collection
 	Tags() ([]string, error)
-	// StudyReview will create a study session for a given set of cards
-	StudyReview(log *zerolog.Logger, deckName string, cardQAs []*models.CardQA, stats models.DeckStudyStats) error
+	// StudyReview will create a study session for a deck and its children. The cards are given one
+	// at a time by the scheduler and rendered with the render func. Their notes are edited with the edit func
+	// and their images and sounds are found and played with media
+	StudyReview(log *zerolog.Logger, deckName string, render func(models.Card) (models.CardQA, error), edit models.EditNoteFunc, media models.StudyMedia) error
+	// CustomStudy extends the limits of today of a deck or gathers the cards of a custom study
+	// session in a filtered deck and returns the number of gathered cards
+	CustomStudy(deckName string, study models.CustomStudy) (int, error)
+	// Sync exchanges the changes made to the collection with the sync server
+	Sync() (models.SyncStatus, error)
+	// FullUpload replaces the collection on the sync server with the local collection
+	FullUpload() error
+	// FullDownload replaces the local collection with the collection on the sync server
+	FullDownload() error
+	// MediaFiles lists the files in the media folder of the collection
+	MediaFiles() ([]models.MediaFile, error)
+	// CheckMedia finds the media referenced by notes but missing from the media folder
+	// and the media files that are not referenced by any note
+	CheckMedia() (models.MediaCheck, error)
+	// AddMedia copies a file into the media folder and returns the name to reference in notes
+	AddMedia(path string) (string, error)
+	// RemoveMedia deletes a file from the media folder
+	RemoveMedia(name string) error
+	// SyncMedia exchanges the media files with the sync server
+	SyncMedia() (models.SyncStatus, error)
+	// ImportPackage adds the notes, cards and media of a deck package (.apkg) to the collection
+	ImportPackage(path string) (models.ImportResult, error)
+	// ExportPackage writes a deck and its subdecks to a deck package (.apkg)
+	ExportPackage(deckName string, path string, opts models.ExportOptions) (models.ExportResult, error)
+	// CreateNotes adds the notes and their cards in a single transaction
+	CreateNotes(notes []models.CreateNote) ([]models.ID, error)
+	// SyncNotes creates or replaces the notes using their globally unique id and removes the notes of the removed ids.
+	// The rows without id create new notes and the ids of the new notes are reported in the results
+	SyncNotes(rows []models.NoteRow, removed []string) ([]models.NoteRowResult, error)
+	// UpdateNote replaces the fields and the tags of a note and creates the cards of the templates
+	// that are no longer empty. The number of new cards is reported in the result
+	UpdateNote(id models.ID, fields map[string]string, tags []string) (models.NoteRowResult, error)
+	// DeleteCards removes the cards and the notes left without cards.
+	// The deletions are sent to the sync server on the next sync
+	DeleteCards(ids []models.ID) (models.DeleteResult, error)
+	// DeleteNotes removes the notes with all their cards.
+	// The deletions are sent to the sync server on the next sync
+	DeleteNotes(ids []models.ID) (models.DeleteResult, error)
+	// ImportNotes adds the notes read from a text file (ie: csv) and reports what happened to each row
+	ImportNotes(rows []models.NoteRow, duplicates models.DuplicateMode) ([]models.NoteRowResult, error)
+	// Backup copies the collection to a collection package (.colpkg) in the backup directory
+	Backup(withMedia bool) (models.Backup, error)
+	// Backups lists the backups with the most recent backup first
+	Backups() ([]models.Backup, error)
+	// RestoreBackup replaces the collection with a backup given its name or path
+	RestoreBackup(name string) error
+	// AutoBackup backs up the collection before it is modified when the last backup is too old
+	AutoBackup() error
+	// OptimizeFSRS fits the parameters of FSRS to the reviews of a deck and its children and saves them in the
+	// options of the deck. Without a deck name the reviews of the collection are used and all the options are saved
+	OptimizeFSRS(deckName string) (models.FSRSOptimization, error)
+	// Undo reverts the last operation made on the collection outside of a study session and returns its name
+	Undo() (string, error)
+	// Redo applies again the last operation undone and returns its name
+	Redo() (string, error)
 }
 
 type ApiConfig struct {
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/aerex/go-anki/api"
 	"github.com/aerex/go-anki/internal/config"
@@ -135,6 +136,56 @@ func (a RestApi) RenameDeck(nameOrId, newName string) error {
 	return errors.New("could not rename deck")
 }
 
+func (a RestApi) DeleteDeck(name string, moveCardsTo string) (models.DeleteResult, error) {
+	if a.Config.API.Endpoint != "" {
+		result := &models.DeleteResult{}
+		errorResponse := &ErrorResponse{}
+		req := a.Client.R()
+		req.SetResult(result)
+		req.SetError(errorResponse)
+		req.SetPathParam("deckNameorId", name)
+		if moveCardsTo != "" {
+			req.SetQueryParam("moveCardsTo", moveCardsTo)
+		}
+
+		resp, err := req.Delete(fmt.Sprintf("%s/{deckNameorId}", DECKS_URI))
+		if err != nil {
+			return models.DeleteResult{}, err
+		}
+		if resp.IsError() {
+			return models.DeleteResult{}, errors.New(errorResponse.Message)
+		}
+		return *result, nil
+	}
+
+	return models.DeleteResult{}, errors.New("could not delete deck")
+}
+
+// MoveDeck renames the deck to its name under the parent
+func (a RestApi) MoveDeck(name string, parent string) (string, error) {
+	parts := strings.Split(name, "::")
+	newName := parts[len(parts)-1]
+	if parent != "" {
+		newName = parent + "::" + newName
+	}
+	if err := a.RenameDeck(name, newName); err != nil {
+		return "", err
+	}
+	return newName, nil
+}
+
+func (a RestApi) CreateFilteredDeck(name string, terms []models.FilterTerm, reschedule bool) (int, error) {
+	return 0, unsupported("CreateFilteredDeck")
+}
+
+func (a RestApi) RebuildFilteredDeck(name string) (int, error) {
+	return 0, unsupported("RebuildFilteredDeck")
+}
+
+func (a RestApi) EmptyFilteredDeck(name string) error {
+	return unsupported("EmptyFilteredDeck")
+}
+
 func (a RestApi) CreateDeck(name string) error {
 	if a.Config.API.Endpoint != "" {
 		createdDeck := &models.Deck{}
@@ -265,9 +316,13 @@ func (a RestApi) Tags() ([]string, error) {
 	panic("unimplemented")
 }
 
-func (a RestApi) StudyReview(log *zerolog.Logger, deckName string, cardQAs []*models.CardQA, stats models.DeckStudyStats) error {
+func (a RestApi) StudyReview(log *zerolog.Logger, deckName string, render func(models.Card) (models.CardQA, error), edit models.EditNoteFunc, media models.StudyMedia) error {
 	panic("unimplemented")
 }
+func (a RestApi) CustomStudy(deckName string, study models.CustomStudy) (int, error) {
+	return 0, unsupported("CustomStudy")
+}
+
 func (a RestApi) NoteTypes() (models.NoteTypes, error) {
 	if a.Config.API.Endpoint != "" {
 		mdls := &models.NoteTypes{}
@@ -281,3 +336,101 @@ func (a RestApi) NoteTypes() (models.NoteTypes, error) {
 	}
 	return models.NoteTypes{}, errors.New("could not find note type")
 }
+
+func (a RestApi) Sync() (models.SyncStatus, error) {
+	return "", unsupported("Sync")
+}
+
+func (a RestApi) FullUpload() error {
+	return unsupported("FullUpload")
+}
+
+func (a RestApi) FullDownload() error {
+	return unsupported("FullDownload")
+}
+
+func (a RestApi) MediaFiles() ([]models.MediaFile, error) {
+	return nil, unsupported("MediaFiles")
+}
+
+func (a RestApi) CheckMedia() (models.MediaCheck, error) {
+	return models.MediaCheck{}, unsupported("CheckMedia")
+}
+
+func (a RestApi) AddMedia(path string) (string, error) {
+	return "", unsupported("AddMedia")
+}
+
+func (a RestApi) RemoveMedia(name string) error {
+	return unsupported("RemoveMedia")
+}
+
+func (a RestApi) SyncMedia() (models.SyncStatus, error) {
+	return "", unsupported("SyncMedia")
+}
+
+func (a RestApi) ImportPackage(path string) (models.ImportResult, error) {
+	return models.ImportResult{}, unsupported("ImportPackage")
+}
+
+func (a RestApi) ExportPackage(deckName string, path string, opts models.ExportOptions) (models.ExportResult, error) {
+	return models.ExportResult{}, unsupported("ExportPackage")
+}
+
+func (a RestApi) CreateNotes(notes []models.CreateNote) ([]models.ID, error) {
+	return nil, unsupported("CreateNotes")
+}
+
+func (a RestApi) SyncNotes(rows []models.NoteRow, removed []string) ([]models.NoteRowResult, error) {
+	return nil, unsupported("SyncNotes")
+}
+
+func (a RestApi) UpdateNote(id models.ID, fields map[string]string, tags []string) (models.NoteRowResult, error) {
+	return models.NoteRowResult{}, unsupported("UpdateNote")
+}
+
+func (a RestApi) DeleteCards(ids []models.ID) (models.DeleteResult, error) {
+	return models.DeleteResult{}, unsupported("DeleteCards")
+}
+
+func (a RestApi) DeleteNotes(ids []models.ID) (models.DeleteResult, error) {
+	return models.DeleteResult{}, unsupported("DeleteNotes")
+}
+
+func (a RestApi) ImportNotes(rows []models.NoteRow, duplicates models.DuplicateMode) ([]models.NoteRowResult, error) {
+	return nil, unsupported("ImportNotes")
+}
+
+func (a RestApi) Backup(withMedia bool) (models.Backup, error) {
+	return models.Backup{}, unsupported("Backup")
+}
+
+func (a RestApi) Backups() ([]models.Backup, error) {
+	return nil, unsupported("Backups")
+}
+
+func (a RestApi) RestoreBackup(name string) error {
+	return unsupported("RestoreBackup")
+}
+
+func (a RestApi) OptimizeFSRS(deckName string) (models.FSRSOptimization, error) {
+	return models.FSRSOptimization{}, unsupported("OptimizeFSRS")
+}
+
+func (a RestApi) Undo() (string, error) {
+	return "", unsupported("Undo")
+}
+
+func (a RestApi) Redo() (string, error) {
+	return "", unsupported("Redo")
+}
+
+// AutoBackup does nothing since the collection is stored by the server
+func (a RestApi) AutoBackup() error {
+	return nil
+}
+
+// unsupported returns the error of an operation the REST backend does not implement
+func unsupported(operation string) error {
+	return fmt.Errorf("%s is not supported by the REST backend", operation)
+}
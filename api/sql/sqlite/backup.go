@@ -0,0 +1,208 @@
+package sqlite
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aerex/go-anki/internal/config"
+	"github.com/aerex/go-anki/pkg/apkg"
+	"github.com/aerex/go-anki/pkg/models"
+)
+
+const (
+	backupExt        = ".colpkg"
+	backupTimeFormat = "2006-01-02-15.04.05"
+)
+
+// backupDir returns the directory where the backups are stored
+func (a *SqliteApi) backupDir() string {
+	if a.Config.Backup.Dir != "" {
+		return a.Config.Backup.Dir
+	}
+	return filepath.Join(filepath.Dir(a.Config.DB.File), "backups")
+}
+
+// Backup copies the collection into a collection package (.colpkg) in the backup directory
+// and removes the oldest backups exceeding the number of backups to keep
+func (a *SqliteApi) Backup(withMedia bool) (models.Backup, error) {
+	dir := a.backupDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return models.Backup{}, err
+	}
+	tmp, err := os.MkdirTemp(dir, ".backup-*")
+	if err != nil {
+		return models.Backup{}, err
+	}
+	defer os.RemoveAll(tmp)
+
+	colPath := filepath.Join(tmp, apkg.CollectionFile)
+	if err := a.ColService.Snapshot(colPath); err != nil {
+		return models.Backup{}, fmt.Errorf("could not copy collection: %w", err)
+	}
+	files := make(map[string]string)
+	if withMedia {
+		manager, err := a.mediaManager()
+		if err != nil {
+			return models.Backup{}, err
+		}
+		mediaFiles, err := manager.Files()
+		if err != nil {
+			return models.Backup{}, err
+		}
+		for _, f := range mediaFiles {
+			files[f.Name] = filepath.Join(manager.Dir, f.Name)
+		}
+	}
+
+	name := "backup-" + time.Now().Format(backupTimeFormat)
+	path := filepath.Join(dir, name+backupExt)
+	for idx := 1; fileExists(path); idx++ {
+		path = filepath.Join(dir, fmt.Sprintf("%s-%d%s", name, idx, backupExt))
+	}
+	// the package is written in the temporary directory so a partial backup is never listed
+	partial := filepath.Join(tmp, filepath.Base(path))
+	if err := apkg.Write(partial, colPath, files); err != nil {
+		return models.Backup{}, err
+	}
+	if err := os.Rename(partial, path); err != nil {
+		return models.Backup{}, err
+	}
+	if err := a.rotateBackups(); err != nil {
+		return models.Backup{}, err
+	}
+	return backupInfo(path)
+}
+
+// Backups lists the backups with the most recent backup first
+func (a *SqliteApi) Backups() ([]models.Backup, error) {
+	backups := []models.Backup{}
+	entries, err := os.ReadDir(a.backupDir())
+	if os.IsNotExist(err) {
+		return backups, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || filepath.Ext(entry.Name()) != backupExt {
+			continue
+		}
+		backup, err := backupInfo(filepath.Join(a.backupDir(), entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, backup)
+	}
+	sort.SliceStable(backups, func(i, j int) bool {
+		if backups[i].Created.Equal(backups[j].Created) {
+			return backups[i].Name > backups[j].Name
+		}
+		return backups[i].Created.After(backups[j].Created)
+	})
+	return backups, nil
+}
+
+// AutoBackup backs up the collection before it is modified unless the automatic
+// backups are disabled or the last backup is more recent than the backup interval
+func (a *SqliteApi) AutoBackup() error {
+	if a.Config.Backup.Disabled {
+		return nil
+	}
+	backups, err := a.Backups()
+	if err != nil {
+		return err
+	}
+	interval := a.Config.Backup.Interval
+	if interval <= 0 {
+		interval = config.DEFAULT_BACKUP_INTERVAL
+	}
+	if len(backups) > 0 && time.Since(backups[0].Created) < time.Duration(interval)*time.Minute {
+		return nil
+	}
+	_, err = a.Backup(false)
+	return err
+}
+
+// RestoreBackup replaces the collection with a backup given its name or path.
+// The current collection is backed up first and the next sync will require a full sync
+func (a *SqliteApi) RestoreBackup(name string) error {
+	path := name
+	if !fileExists(path) {
+		path = filepath.Join(a.backupDir(), name)
+		if !fileExists(path) {
+			path += backupExt
+		}
+	}
+	if !fileExists(path) {
+		return fmt.Errorf("backup %s does not exist", name)
+	}
+
+	// extracted next to the collection so the file can be moved in place
+	tmp, err := os.MkdirTemp(filepath.Dir(a.Config.DB.File), ".restore-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	pkg, err := apkg.Extract(path, tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := a.Backup(false); err != nil {
+		return fmt.Errorf("could not back up the collection before restoring: %w", err)
+	}
+	if err := a.replaceCollection(pkg.Collection); err != nil {
+		return err
+	}
+	if len(pkg.Media) > 0 {
+		manager, err := a.mediaManager()
+		if err != nil {
+			return err
+		}
+		for name, file := range pkg.Media {
+			if err := manager.Replace(file, name); err != nil {
+				return err
+			}
+		}
+	}
+	return a.ColService.ForceFullSync()
+}
+
+// rotateBackups removes the oldest backups exceeding the number of backups to keep
+func (a *SqliteApi) rotateBackups() error {
+	keep := a.Config.Backup.Keep
+	if keep <= 0 {
+		keep = config.DEFAULT_BACKUP_KEEP
+	}
+	backups, err := a.Backups()
+	if err != nil {
+		return err
+	}
+	for idx := keep; idx < len(backups); idx++ {
+		if err := os.Remove(backups[idx].Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func backupInfo(path string) (models.Backup, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return models.Backup{}, err
+	}
+	return models.Backup{
+		Name:    info.Name(),
+		Path:    path,
+		Size:    info.Size(),
+		Created: info.ModTime(),
+	}, nil
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
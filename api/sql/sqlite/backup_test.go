@@ -0,0 +1,109 @@
+package sqlite
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aerex/go-anki/internal/config"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestBackupApi(t *testing.T, backup config.Backup) *SqliteApi {
+	dir := t.TempDir()
+	colPath := filepath.Join(dir, "collection.anki2")
+	copyFixture(t, colPath)
+	cfg := &config.Config{
+		DB:     config.DB{Driver: "sqlite3", File: colPath},
+		Backup: backup,
+	}
+	return NewApi(cfg, nil).(*SqliteApi)
+}
+
+func TestBackup(t *testing.T) {
+	a := newTestBackupApi(t, config.Backup{})
+
+	backup, err := a.Backup(false)
+
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(filepath.Dir(a.Config.DB.File), "backups", backup.Name), backup.Path)
+	assert.FileExists(t, backup.Path)
+	backups, err := a.Backups()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{backup.Name}, backupNames(backups))
+}
+
+func TestBackupRemovesOldestBackups(t *testing.T) {
+	a := newTestBackupApi(t, config.Backup{Keep: 2, Dir: t.TempDir()})
+
+	var names []string
+	for i := 0; i < 3; i++ {
+		backup, err := a.Backup(false)
+		assert.NoError(t, err)
+		names = append(names, backup.Name)
+	}
+
+	backups, err := a.Backups()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{names[2], names[1]}, backupNames(backups))
+}
+
+func TestAutoBackupSkipsRecentBackup(t *testing.T) {
+	a := newTestBackupApi(t, config.Backup{Interval: 30})
+
+	assert.NoError(t, a.AutoBackup())
+	assert.NoError(t, a.AutoBackup())
+
+	backups, err := a.Backups()
+	assert.NoError(t, err)
+	assert.Len(t, backups, 1)
+}
+
+func TestAutoBackupDisabled(t *testing.T) {
+	a := newTestBackupApi(t, config.Backup{Disabled: true})
+
+	assert.NoError(t, a.AutoBackup())
+
+	backups, err := a.Backups()
+	assert.NoError(t, err)
+	assert.Empty(t, backups)
+}
+
+func TestRestoreBackup(t *testing.T) {
+	a := newTestBackupApi(t, config.Backup{})
+	backup, err := a.Backup(false)
+	assert.NoError(t, err)
+	var scm int64
+	assert.NoError(t, a.db.Get(&scm, "SELECT scm FROM col"))
+	a.db.MustExec("DELETE FROM cards")
+
+	assert.NoError(t, a.RestoreBackup(backup.Name))
+
+	cards, err := a.Cards("", -1)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, cards)
+	var restoredScm int64
+	assert.NoError(t, a.db.Get(&restoredScm, "SELECT scm FROM col"))
+	assert.Greater(t, restoredScm, scm, "a full sync should be required after restoring")
+	backups, err := a.Backups()
+	assert.NoError(t, err)
+	assert.Len(t, backups, 2, "the collection should be backed up before restoring")
+}
+
+func TestRestoreMissingBackup(t *testing.T) {
+	a := newTestBackupApi(t, config.Backup{})
+
+	err := a.RestoreBackup("missing")
+
+	assert.EqualError(t, err, "backup missing does not exist")
+	_, err = os.Stat(a.backupDir())
+	assert.True(t, os.IsNotExist(err))
+}
+
+func backupNames(backups []models.Backup) (names []string) {
+	for _, backup := range backups {
+		names = append(names, backup.Name)
+	}
+	return
+}
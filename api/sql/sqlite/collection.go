@@ -0,0 +1,72 @@
+package sqlite
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aerex/go-anki/internal/config"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog"
+	sqldblogger "github.com/simukti/sqldb-logger"
+	"github.com/simukti/sqldb-logger/logadapter/zerologadapter"
+)
+
+// openDB connects to the collection file set in the config
+func openDB(config *config.Config, log *zerolog.Logger) (*sqlx.DB, error) {
+	db, err := sqlx.Connect(strings.ToLower(config.DB.Driver), config.DB.File)
+	if err != nil {
+		return nil, err
+	}
+	// enable sql logging
+	if config.Logger.Sql {
+		db.DB = sqldblogger.OpenDriver(config.DB.File, db.Driver(), zerologadapter.New(*log))
+	}
+	return db, nil
+}
+
+// checkCollection verifies the file is a valid collection before it replaces the local collection
+// (ie: after a full download or when restoring a backup)
+func checkCollection(driver string, path string) error {
+	db, err := sqlx.Connect(strings.ToLower(driver), path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	var res string
+	if err := db.Get(&res, "PRAGMA integrity_check"); err != nil {
+		return fmt.Errorf("collection %s is corrupt: %w", path, err)
+	}
+	if res != "ok" {
+		return fmt.Errorf("collection %s is corrupt: %s", path, res)
+	}
+	var count int
+	if err := db.Get(&count, "SELECT COUNT() FROM col"); err != nil || count == 0 {
+		return fmt.Errorf("%s is not an anki collection", path)
+	}
+	return nil
+}
+
+// replaceCollection atomically replaces the collection file with src and reopens
+// the connection in place so the repositories holding it use the new collection
+func (a *SqliteApi) replaceCollection(src string) error {
+	if err := checkCollection(a.Config.DB.Driver, src); err != nil {
+		return err
+	}
+	if err := a.db.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(src, a.Config.DB.File); err != nil {
+		// keep using the previous collection
+		if db, openErr := openDB(a.Config, a.log); openErr == nil {
+			*a.db = *db
+		}
+		return err
+	}
+	db, err := openDB(a.Config, a.log)
+	if err != nil {
+		return err
+	}
+	*a.db = *db
+	return nil
+}
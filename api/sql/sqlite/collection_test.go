@@ -0,0 +1,154 @@
+package sqlite
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	repos "github.com/aerex/go-anki/api/sql/sqlite/repositories"
+	"github.com/aerex/go-anki/api/sync/synctest"
+	"github.com/aerex/go-anki/internal/config"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func copyFixture(t *testing.T, dst string) {
+	_, fileName, _, _ := runtime.Caller(0)
+	src := filepath.Join(filepath.Dir(fileName), "services/fixtures/db/collection.anki2")
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatalf("could not read fixture: %v", err)
+	}
+	if err := os.WriteFile(dst, data, 0600); err != nil {
+		t.Fatalf("could not copy fixture: %v", err)
+	}
+}
+
+func TestFullDownload(t *testing.T) {
+	dir := t.TempDir()
+	colPath := filepath.Join(dir, "collection.anki2")
+	copyFixture(t, colPath)
+
+	// the server collection has no cards
+	remotePath := filepath.Join(dir, "remote.anki2")
+	copyFixture(t, remotePath)
+	remote := sqlx.MustConnect("sqlite3", remotePath)
+	remote.MustExec("DELETE FROM cards")
+	remote.Close()
+	server := synctest.NewServer()
+	defer server.Close()
+	data, err := os.ReadFile(remotePath)
+	assert.NoError(t, err)
+	server.Collection = data
+
+	cfg := &config.Config{
+		DB:   config.DB{Driver: "sqlite3", File: colPath},
+		Sync: config.Sync{Endpoint: server.URL, HostKey: "hkey"},
+	}
+	a := NewApi(cfg, nil).(*SqliteApi)
+
+	cards, err := a.Cards("", -1)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, cards)
+
+	assert.NoError(t, a.FullDownload())
+
+	// the repositories use the downloaded collection
+	cards, err = a.Cards("", -1)
+	assert.NoError(t, err)
+	assert.Empty(t, cards)
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestFullDownloadRejectsInvalidCollection(t *testing.T) {
+	dir := t.TempDir()
+	colPath := filepath.Join(dir, "collection.anki2")
+	copyFixture(t, colPath)
+	server := synctest.NewServer()
+	defer server.Close()
+	server.Collection = []byte("upgradeRequired")
+
+	cfg := &config.Config{
+		DB:   config.DB{Driver: "sqlite3", File: colPath},
+		Sync: config.Sync{Endpoint: server.URL, HostKey: "hkey"},
+	}
+	a := NewApi(cfg, nil).(*SqliteApi)
+
+	assert.Error(t, a.FullDownload())
+	cards, err := a.Cards("", -1)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, cards)
+}
+
+func TestSyncFailedKeepsLocalChanges(t *testing.T) {
+	dir := t.TempDir()
+	colPath := filepath.Join(dir, "collection.anki2")
+	copyFixture(t, colPath)
+	server := synctest.NewServer()
+	defer server.Close()
+	server.Meta = models.SyncMeta{Mod: 1543557600000, Scm: 1543553566030, USN: 200, Cont: true}
+	server.SanityStatus = "bad"
+
+	cfg := &config.Config{
+		DB:   config.DB{Driver: "sqlite3", File: colPath},
+		Sync: config.Sync{Endpoint: server.URL, HostKey: "hkey"},
+	}
+	a := NewApi(cfg, nil).(*SqliteApi)
+	a.db.MustExec("UPDATE cards SET usn = -1 WHERE id = 1512792261946")
+	a.db.MustExec("INSERT INTO graves (usn, oid, type) VALUES (-1, 42, ?)", models.GraveTypeNote)
+	a.db.MustExec(`UPDATE col SET tags = '{"verbs": -1}'`)
+
+	status, err := a.Sync()
+
+	assert.Error(t, err)
+	assert.Equal(t, models.SyncSanityCheckFailed, status)
+	assert.True(t, server.Aborted)
+	assert.Len(t, server.ReceivedChunks, 1, "the card should have been sent")
+	// the changes are sent again on the next sync
+	var count int
+	assert.NoError(t, a.db.Get(&count, "SELECT COUNT() FROM cards WHERE usn = -1"))
+	assert.Equal(t, 1, count)
+	assert.NoError(t, a.db.Get(&count, "SELECT COUNT() FROM graves WHERE usn = -1"))
+	assert.Equal(t, 1, count)
+	var tags string
+	assert.NoError(t, a.db.Get(&tags, "SELECT tags FROM col"))
+	assert.JSONEq(t, `{"verbs": -1}`, tags)
+}
+
+func TestImportPackageCanBeUndone(t *testing.T) {
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "source.anki2")
+	copyFixture(t, srcPath)
+	src := NewApi(&config.Config{DB: config.DB{Driver: "sqlite3", File: srcPath}}, nil).(*SqliteApi)
+	path := filepath.Join(dir, "deck.apkg")
+	_, err := src.ExportPackage("Investment Terms", path, models.ExportOptions{})
+	assert.NoError(t, err)
+
+	colPath := filepath.Join(t.TempDir(), "collection.anki2")
+	col := sqlx.MustConnect("sqlite3", colPath)
+	assert.NoError(t, repos.CreateCollection(col))
+	col.Close()
+	a := NewApi(&config.Config{DB: config.DB{Driver: "sqlite3", File: colPath}}, nil).(*SqliteApi)
+
+	res, err := a.ImportPackage(path)
+
+	assert.NoError(t, err)
+	assert.NotZero(t, res.Notes)
+	var notes int
+	assert.NoError(t, a.db.Get(&notes, "SELECT COUNT() FROM notes"))
+	assert.Equal(t, res.Notes, notes)
+	name, err := a.Undo()
+	assert.NoError(t, err)
+	assert.Equal(t, "Import", name)
+	assert.NoError(t, a.db.Get(&notes, "SELECT COUNT() FROM notes"))
+	assert.Zero(t, notes)
+	decks, err := a.Decks("")
+	assert.NoError(t, err)
+	for _, deck := range decks {
+		assert.NotEqual(t, "Investment Terms", deck.Name)
+	}
+}
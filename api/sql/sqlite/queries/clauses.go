@@ -6,11 +6,10 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/exp/slices"
 
-	fanki "github.com/flimzy/anki"
-
 	"github.com/aerex/go-anki/api/sql/sqlite/repositories"
 	"github.com/aerex/go-anki/internal/utils"
 	"github.com/aerex/go-anki/pkg/models"
@@ -70,9 +69,9 @@ func (c *clause) template() string {
 			if normTmpl == strings.ToLower(c.val) {
 				if m.Type == models.ClozeCardType {
 					// apply limit if model is cloze
-					limits = append(limits, fmt.Sprintf("(n.mid = %d)", m.ID))
+					limits = append(limits, fmt.Sprintf("(note.mid = %d)", m.ID))
 				} else {
-					limits = append(limits, fmt.Sprintf("(n.mid = %d and c.ord = %d)", m.ID, tmpl.Ordinal))
+					limits = append(limits, fmt.Sprintf("(note.mid = %d and c.ord = %d)", m.ID, tmpl.Ordinal))
 				}
 			}
 		}
@@ -203,14 +202,14 @@ func (c *clause) mid() string {
 	if MODEL_ID_REGEX.MatchString(c.val) {
 		return ""
 	}
-	return fmt.Sprintf("n.mid = %s", c.val)
+	return fmt.Sprintf("note.mid = %s", c.val)
 }
 
 func (c *clause) nid() string {
 	if NOTE_ID_REGEX.MatchString(c.val) {
 		return ""
 	}
-	return fmt.Sprintf("n.id in (%s)", c.val)
+	return fmt.Sprintf("note.id in (%s)", c.val)
 }
 
 func (c *clause) cid() string {
@@ -240,7 +239,7 @@ func (c *clause) note() string {
 		return ""
 	}
 
-	return fmt.Sprintf("n.mid in (%s)", strings.Join(sids, ", "))
+	return fmt.Sprintf("note.mid in (%s)", strings.Join(sids, ", "))
 }
 
 func (c *clause) prop() string {
@@ -248,13 +247,13 @@ func (c *clause) prop() string {
 		return ""
 	}
 	groups := PROP_REGEX.FindStringSubmatch(c.val)
-	if len(groups) < 3 {
+	if len(groups) < 4 {
 		// TODO: Need to log if there is an error
 		return ""
 	}
-	prop := strings.ToLower(groups[0])
-	cmp := groups[1]
-	sval := groups[2]
+	prop := strings.ToLower(groups[1])
+	cmp := groups[2]
+	sval := groups[3]
 
 	var val int64
 	if prop == "ease" {
@@ -309,7 +308,7 @@ func (c *clause) rated() string {
 func (c *clause) tag() string {
 	val := c.val
 	if c.val == "none" {
-		return "n.tags = \"\""
+		return "note.tags = \"\""
 	}
 	val = strings.ReplaceAll(val, "*", "%")
 	if !strings.HasPrefix(val, "%") {
@@ -318,7 +317,8 @@ func (c *clause) tag() string {
 	if !strings.HasSuffix(val, "%") || strings.HasSuffix(val, "\\%") {
 		val += " %"
 	}
-	return ""
+	c.args = append(c.args, val)
+	return "note.tags like ? escape \"\\\""
 }
 
 func (c *clause) dupes() string {
@@ -337,31 +337,31 @@ func (c *clause) dupes() string {
 		var note models.Note
 		notes.Scan(&note)
 		if utils.StripHTMLMedia(note.Fields[0]) == val {
-			noteIds = append(noteIds, string(note.ID))
+			noteIds = append(noteIds, fmt.Sprint(note.ID))
 		}
 	}
-	return fmt.Sprintf("n.id in (%s)", strings.Join(noteIds, ","))
+	return fmt.Sprintf("note.id in (%s)", strings.Join(noteIds, ","))
 }
 
 func (c *clause) cardState() string {
-	var cardType models.CardType
 	if READY_CARD_STATE_REGEX.MatchString(c.val) {
 		switch c.val {
 		case "review":
-			cardType = models.CardTypeReview
-			break
+			return fmt.Sprintf("c.type in (%d, %d)", models.CardTypeReview, models.CardTypeRelearning)
 		case "new":
-			cardType = models.CardTypeNew
+			return fmt.Sprintf("c.type = %d", models.CardTypeNew)
 		default:
-			return fmt.Sprintf("queue in (1, %d)", models.CardQueueRelearning)
+			return fmt.Sprintf("c.queue in (%d, %d)", models.CardQueueLearning, models.CardQueueRelearning)
 		}
-		return "type = " + string(cardType)
 	} else if c.val == "suspended" {
 		return fmt.Sprintf("c.queue = %d", models.CardQueueSuspended)
 	} else if c.val == "buried" {
 		return fmt.Sprintf("c.queue in (%d, %d)", models.CardQueueBuried, models.CardQueueSBuried)
 	} else if c.val == "due" {
-		return fmt.Sprintf("(c.queue in (%d, %d) and c.due <= %d", fanki.CardQueueReview, fanki.CardQueueRelearning, c.colRepo.SchedToday())
+		// the reviews are due in days and the learning cards are due in seconds
+		return fmt.Sprintf("(c.queue in (%d, %d) and c.due <= %d) or (c.queue = %d and c.due <= %d)",
+			models.CardQueueReview, models.CardQueueRelearning, c.colRepo.SchedToday(),
+			models.CardQueueLearning, time.Now().Unix())
 	}
 	return ""
 }
@@ -384,7 +384,7 @@ func (c *clause) field() string {
 			}
 			if strings.ToLower(c.cmd) == fieldName {
 				if _, exists := modelToOrderMap[noteType.ID]; !exists {
-					modelIds = append(modelIds, string(noteType.ID))
+					modelIds = append(modelIds, fmt.Sprint(noteType.ID))
 				}
 				modelToOrderMap[noteType.ID] = mapOrd{nt: *noteType, o: fld.Ordinal}
 			}
@@ -398,7 +398,7 @@ func (c *clause) field() string {
 
 	jsVal := strings.ReplaceAll(regexp.QuoteMeta(val), "_", ".")
 	jsVal = strings.ReplaceAll(jsVal, regexp.QuoteMeta("%"), ".*")
-	jsValReg, err := regexp.Compile(fmt.Sprintf("(?si)^%s%", jsVal))
+	jsValReg, err := regexp.Compile(fmt.Sprintf("(?si)^%s$", jsVal))
 	if err != nil {
 		return ""
 	}
@@ -412,13 +412,13 @@ func (c *clause) field() string {
 			return ""
 		}
 		if jsValReg.MatchString(note.Fields[modelToOrd.o]) {
-			noteIds = append(noteIds, string(note.ID))
+			noteIds = append(noteIds, fmt.Sprint(note.ID))
 		}
 	}
 	if len(noteIds) == 0 {
 		return "0"
 	}
-	return fmt.Sprintf("n.id in (%s)", strings.Join(noteIds, ","))
+	return fmt.Sprintf("note.id in (%s)", strings.Join(noteIds, ","))
 }
 
 func (c *clause) text(token string) string {
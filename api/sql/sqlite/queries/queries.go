@@ -54,22 +54,22 @@ func (s *queryState) add(query string, wrap bool) {
 	if s.isJoin {
 		if s.isOr {
 			s.cls.WriteString(" or ")
-			s.isJoin = false
+			s.isOr = false
 		} else {
 			s.cls.WriteString(" and ")
 		}
-
-		s.cls.WriteString(query)
-		s.isJoin = true
 	}
 
 	if s.isNot {
-		s.cls.WriteString(" not ")
+		s.cls.WriteString("not ")
 		s.isNot = false
 	}
 
 	if wrap {
 		s.cls.WriteString(fmt.Sprintf("(%s)", query))
+		s.isJoin = true
+	} else {
+		s.cls.WriteString(query)
 	}
 }
 
@@ -100,7 +100,8 @@ func (b *builder) Query() (cls string, args []string, err error) {
 			state.cls.WriteString(")")
 			// commands
 		} else if strings.Contains(token, ":") {
-			parts := strings.Split(token, ":")
+			// the value may contain colons like deck:School::Math or rated:1:3
+			parts := strings.SplitN(token, ":", 2)
 			if len(parts) < 2 {
 				return "", []string{}, fmt.Errorf("expected clause to be in format 'cmd:value' but received %s", token)
 			}
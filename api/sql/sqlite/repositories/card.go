@@ -26,12 +26,30 @@ var RESTORE_QUEUE_SNIPPET = fmt.Sprintf("queue = (CASE WHEN type IN (1, %d) THEN
 	" END)", models.CardTypeRelearning, models.CardQueueRelearning)
 
 var RESTORE_QUEUE_WHEN_EMPTYING_SNIPPET = fmt.Sprintf("queue = (CASE WHEN queue < 0 THEN queue "+
-	"WHEN type IN (1, %s) THEN "+
+	"WHEN type IN (1, %d) THEN "+
 	"(CASE WHEN (CASE WHEN odue THEN odue ELSE due END) > 1000000000 THEN 1 ELSE "+
-	"%s end)", models.CardTypeRelearning, models.CardQueueRelearning) +
+	"%d end)", models.CardTypeRelearning, models.CardQueueRelearning) +
 	" ELSE " +
 	"type end)"
 
+// the sql ordering the cards gathered in a filtered deck
+var FILTER_ORDER_SNIPPETS = map[models.FilterOrder]string{
+	models.FilterOrderOldestSeen:   "(SELECT max(id) FROM revlog WHERE cid = c.id)",
+	models.FilterOrderRandom:       "random()",
+	models.FilterOrderIntervalAsc:  "c.ivl",
+	models.FilterOrderIntervalDesc: "c.ivl DESC",
+	models.FilterOrderLapses:       "c.lapses DESC",
+	models.FilterOrderAdded:        "note.id, c.ord",
+	models.FilterOrderDue:          "c.due, c.ord",
+	models.FilterOrderAddedDesc:    "note.id DESC, c.ord",
+	models.FilterOrderRelativeOverdue: fmt.Sprintf("(CASE WHEN c.queue = %d AND c.due <= (%s) "+
+		"THEN (c.ivl / CAST((%s) - c.due + 0.001 AS REAL)) ELSE 100000 + c.due END)",
+		models.CardQueueReview, TODAY_SNIPPET, TODAY_SNIPPET),
+}
+
+// the number of days since the collection was created
+var TODAY_SNIPPET = "SELECT (strftime('%s', 'now') - crt) / 86400 FROM col"
+
 type CardRepo interface {
 	List(cls string, args []string) (cards []models.Card, err error)
 	Exists(cardID int64) (err error, exists bool)
@@ -42,13 +60,23 @@ type CardRepo interface {
 	CardsNewForDeck(deckID models.ID, limit int) (count int, err error)
 	CardsReviewForDeck(deckLimit string, reportLimit int, reviewLimit int, today int) (count int, err error)
 	UnburyCards() (err error)
-	BuriedCards(noteID models.ID, cardID models.ID) (cards []models.Card, err error)
-	BuryCards(cardIDs []models.ID, usn int) error
+	BuriedCards(noteID models.ID, cardID models.ID, today int64) (cards []models.Card, err error)
+	BuryCards(cardIDs []models.ID, queue models.CardQue, usn int) error
+	RestoreQueue(cardIDs []models.ID, queue models.CardQue, usn int) error
+	SetFlag(cardIDs []models.ID, flag int, usn int) error
 	RecoverOrphans(deckLimit string) (err error)
-	LearningCount(deckLimit string, lrnCutoff int64) (count int, err error)
-	Revisions(deckLimit string, limit int) (count int, err error)
+	LearningCount(deckLimit string, lrnCutoff int64, today int64) (count int, err error)
+	Revisions(deckLimit string, limit int, today int64) (count int, err error)
+	LearningQueue(deckLimit string, cutoff int64, limit int) (cards []models.Card, err error)
+	DayLearningQueue(deckID models.ID, today int64, limit int) (ids []models.ID, err error)
+	ReviewQueue(deckLimit string, today int64, limit int) (ids []models.ID, err error)
+	NewQueue(deckID models.ID, limit int) (ids []models.ID, err error)
 	NewCardsCount(deckID models.ID, limit int) (count int, err error)
 	EmptyDyn(limitQuery string, usn int) error
+	IDsOfNotes(noteIDs []models.ID) (ids []models.ID, err error)
+	Delete(ids []models.ID) error
+	MoveDecks(deckIDs []models.ID, did models.ID, usn int) error
+	MoveToFiltered(cls string, args []string, order models.FilterOrder, limit int, did models.ID, resched bool, usn int) (count int, err error)
 }
 
 func NewCardRepository(conn *sqlx.DB) CardRepo {
@@ -67,7 +95,7 @@ func (c cardRepo) List(cls string, args []string) ([]models.Card, error) {
 	for i, d := range args {
 		iargs[i] = d
 	}
-	baseQuery := "SELECT c.*, note.flds \"note.flds\", note.mid \"note.mid\" FROM cards \"c\"" +
+	baseQuery := "SELECT c.*, note.flds \"note.flds\", note.mid \"note.mid\", note.tags \"note.tags\" FROM cards \"c\"" +
 		" JOIN notes note ON note.id = c.nid"
 	var rows *sqlx.Rows
 	if cls != "" {
@@ -76,13 +104,13 @@ func (c cardRepo) List(cls string, args []string) ([]models.Card, error) {
 			return cards, err
 		}
 		query = c.Conn.Rebind(query)
-		rows, err = c.Conn.Queryx(query, arglist...)
+		rows, err = ankisql.Reader(c.Conn).Queryx(query, arglist...)
 		if err != nil {
 			return cards, err
 		}
 	} else {
 		var err error
-		rows, err = c.Conn.Queryx(baseQuery)
+		rows, err = ankisql.Reader(c.Conn).Queryx(baseQuery)
 		if err != nil {
 			return cards, err
 		}
@@ -101,7 +129,7 @@ func (c cardRepo) List(cls string, args []string) ([]models.Card, error) {
 func (c cardRepo) Exists(cardId int64) (err error, exists bool) {
 	var card models.Card
 	query := "SELECT id FROM cards WHERE id = ?"
-	err = c.Conn.Get(&card, query, cardId)
+	err = sqlx.Get(ankisql.Reader(c.Conn), &card, query, cardId)
 	if err == dbsql.ErrNoRows {
 		return nil, false
 	}
@@ -119,7 +147,7 @@ func (c cardRepo) CardsDueForDeck(deckId int64, due int64, limit int) (count int
 	} else {
 		query = query + ")"
 	}
-	row := c.Conn.QueryRow(query, deckId, due)
+	row := ankisql.Reader(c.Conn).QueryRowx(query, deckId, due)
 	err = row.Scan(&count)
 	if err != nil {
 		return
@@ -129,7 +157,7 @@ func (c cardRepo) CardsDueForDeck(deckId int64, due int64, limit int) (count int
 func (c cardRepo) CardsReviewForDeck(deckLimit string, reportLimit int, reviewLimit int, today int) (count int, err error) {
 	lim := sint.Min(reportLimit, reviewLimit)
 	query := fmt.Sprintf("SELECT COUNT() FROM (SELECT 1 FROM cards WHERE did IN %s AND queue = %d AND due <= ? LIMIT ?)", deckLimit, models.CardTypeReview)
-	row := c.Conn.QueryRow(query, today, lim)
+	row := ankisql.Reader(c.Conn).QueryRowx(query, today, lim)
 	err = row.Scan(&count)
 	if err != nil {
 		return
@@ -139,7 +167,7 @@ func (c cardRepo) CardsReviewForDeck(deckLimit string, reportLimit int, reviewLi
 
 func (c cardRepo) CardsNewForDeck(deckID models.ID, limit int) (count int, err error) {
 	query := fmt.Sprintf("SELECT COUNT() FROM (SELECT 1 FROM cards WHERE did = ?  AND queue = %d LIMIT ?)", models.CardTypeNew)
-	row := c.Conn.QueryRow(query, deckID, limit)
+	row := ankisql.Reader(c.Conn).QueryRowx(query, deckID, limit)
 	err = row.Scan(&count)
 	if err != nil {
 		return
@@ -148,8 +176,8 @@ func (c cardRepo) CardsNewForDeck(deckID models.ID, limit int) (count int, err e
 }
 
 func (c cardRepo) CardsLearnedForDeck(deckId int64, due int64, today int64, limit int) (count int, err error) {
-	query := fmt.Sprintf("SELECT COUNT() FROM (SELECT NULL FROM cards WHERE did = ? AND queue = %d AND due < ? limit ?)", models.CardTypeNew)
-	row := c.Conn.QueryRow(query, deckId, due, limit)
+	query := fmt.Sprintf("SELECT COUNT() FROM (SELECT NULL FROM cards WHERE did = ? AND queue = %d AND due < ? limit ?)", models.CardQueueLearning)
+	row := ankisql.Reader(c.Conn).QueryRowx(query, deckId, due, limit)
 	err = row.Scan(&count)
 	if err != nil {
 		return
@@ -157,9 +185,10 @@ func (c cardRepo) CardsLearnedForDeck(deckId int64, due int64, today int64, limi
 
 	var relearn int
 	query = fmt.Sprintf("SELECT COUNT() FROM (SELECT NULL FROM cards WHERE did = ? AND queue = %d AND due <= ? limit ?)", models.CardQueueRelearning)
-	row = c.Conn.QueryRow(query, deckId, today, limit)
+	row = ankisql.Reader(c.Conn).QueryRowx(query, deckId, today, limit)
 	err = row.Scan(&relearn)
 	if err != nil {
+		return
 	}
 	count += relearn
 
@@ -201,23 +230,21 @@ func (c cardRepo) Create(card models.Card) (err error) {
 func (c cardRepo) Update(card models.Card) (err error) {
 	return ankisql.Tx(c.Tx, func(tx *sqlx.Tx) error {
 		query := `UPDATE cards SET mod=?, usn=?, type=?, queue=?, due=?, ivl=?, factor=?, reps=?,
-    lapses=?, left=?, odue=?, odid=?, did=? where id = ?`
+    lapses=?, left=?, odue=?, odid=?, did=?, data=? where id = ?`
 		if _, err := tx.Exec(query, card.Mod, card.USN, card.Type, card.Queue, card.Due, card.Interval, card.Factor,
-			card.Reps, card.Lapses, card.ReviewsLeft, card.OriginalDue, card.OriginalDeckID, card.DeckID, card.ID); err != nil {
+			card.Reps, card.Lapses, card.ReviewsLeft, card.OriginalDue, card.OriginalDeckID, card.DeckID, card.Data, card.ID); err != nil {
 			return err
 		}
 		return nil
 	})
 }
 
-func (c cardRepo) LearningCount(deckLimit string, lrnCutoff int64) (lrnCnt int, err error) {
+func (c cardRepo) LearningCount(deckLimit string, lrnCutoff int64, today int64) (lrnCnt int, err error) {
 	var count int
 	// subday
-	query := fmt.Sprintf("SELECT SUM(left/1000) FROM (SELECT left FROM cards WHERE did IN %s AND queue = %d AND due > ? LIMIT ",
+	query := fmt.Sprintf("SELECT COUNT() FROM cards WHERE did IN %s AND queue = %d AND due < ?",
 		deckLimit, models.CardQueueLearning)
-	row := c.Conn.QueryRow(query, lrnCutoff)
-	err = row.Scan(&count)
-	if err != nil {
+	if err = sqlx.Get(ankisql.Reader(c.Conn), &count, query, lrnCutoff); err != nil {
 		return
 	}
 	lrnCnt += count
@@ -225,19 +252,14 @@ func (c cardRepo) LearningCount(deckLimit string, lrnCutoff int64) (lrnCnt int,
 	// day
 	query = fmt.Sprintf("SELECT COUNT() FROM cards WHERE did IN %s AND queue = %d AND due <= ?",
 		deckLimit, models.CardQueueRelearning)
-	today := time.Now().Unix()
-	row = c.Conn.QueryRow(query, today)
-	err = row.Scan(&count)
-	if err != nil {
+	if err = sqlx.Get(ankisql.Reader(c.Conn), &count, query, today); err != nil {
 		return
 	}
 	lrnCnt += count
 
 	// previews
-	query = fmt.Sprintf("SELECT COUNT() FROM cards WHERE did IN %s AND queue = %d", deckLimit, models.CardQueueReview)
-	row = c.Conn.QueryRow(query)
-	err = row.Scan(&count)
-	if err != nil {
+	query = fmt.Sprintf("SELECT COUNT() FROM cards WHERE did IN %s AND queue = %d", deckLimit, models.CardQueuePreview)
+	if err = sqlx.Get(ankisql.Reader(c.Conn), &count, query); err != nil {
 		return
 	}
 	lrnCnt += count
@@ -245,11 +267,11 @@ func (c cardRepo) LearningCount(deckLimit string, lrnCutoff int64) (lrnCnt int,
 	return
 }
 
-func (c cardRepo) Revisions(deckLimit string, limit int) (count int, err error) {
+func (c cardRepo) Revisions(deckLimit string, limit int, today int64) (count int, err error) {
 	query := fmt.Sprintf("SELECT COUNT() FROM "+
 		"(SELECT ID FROM cards WHERE did IN %s AND queue = %d AND due <= ? limit ?)",
-		deckLimit, models.CardTypeReview)
-	row := c.Conn.QueryRow(query, time.Now().Unix(), limit)
+		deckLimit, models.CardQueueReview)
+	row := ankisql.Reader(c.Conn).QueryRowx(query, today, limit)
 	err = row.Scan(&count)
 	if err != nil {
 		return
@@ -257,9 +279,39 @@ func (c cardRepo) Revisions(deckLimit string, limit int) (count int, err error)
 	return
 }
 
+// LearningQueue returns the id and the due time of the learning and previewed cards due before the cutoff
+func (c cardRepo) LearningQueue(deckLimit string, cutoff int64, limit int) (cards []models.Card, err error) {
+	query := fmt.Sprintf("SELECT id, due FROM cards WHERE did IN %s AND queue IN (%d, %d) AND due < ? LIMIT ?",
+		deckLimit, models.CardQueueLearning, models.CardQueuePreview)
+	err = sqlx.Select(ankisql.Reader(c.Conn), &cards, query, cutoff, limit)
+	return
+}
+
+// DayLearningQueue returns the ids of the cards of a deck in learning for more than a day that are due today
+func (c cardRepo) DayLearningQueue(deckID models.ID, today int64, limit int) (ids []models.ID, err error) {
+	query := fmt.Sprintf("SELECT id FROM cards WHERE did = ? AND queue = %d AND due <= ? LIMIT ?", models.CardQueueRelearning)
+	err = sqlx.Select(ankisql.Reader(c.Conn), &ids, query, deckID, today, limit)
+	return
+}
+
+// ReviewQueue returns the ids of the reviews due today with the most overdue first
+func (c cardRepo) ReviewQueue(deckLimit string, today int64, limit int) (ids []models.ID, err error) {
+	query := fmt.Sprintf("SELECT id FROM cards WHERE did IN %s AND queue = %d AND due <= ? ORDER BY due, random() LIMIT ?",
+		deckLimit, models.CardQueueReview)
+	err = sqlx.Select(ankisql.Reader(c.Conn), &ids, query, today, limit)
+	return
+}
+
+// NewQueue returns the ids of the new cards of a deck in the order they were added
+func (c cardRepo) NewQueue(deckID models.ID, limit int) (ids []models.ID, err error) {
+	query := fmt.Sprintf("SELECT id FROM cards WHERE did = ? AND queue = %d ORDER BY due, ord LIMIT ?", models.CardQueueNew)
+	err = sqlx.Select(ankisql.Reader(c.Conn), &ids, query, deckID, limit)
+	return
+}
+
 func (c cardRepo) NewCardsCount(deckID models.ID, deckLimit int) (count int, err error) {
 	query := fmt.Sprintf("SELECT COUNT() FROM (SELECT 1 FROM cards WHERE did = ? AND queue = %d LIMIT ?", models.CardTypeNew)
-	row := c.Conn.QueryRow(query, deckID, deckLimit)
+	row := ankisql.Reader(c.Conn).QueryRowx(query, deckID, deckLimit)
 	err = row.Scan(&count)
 	if err != nil {
 		return
@@ -267,23 +319,11 @@ func (c cardRepo) NewCardsCount(deckID models.ID, deckLimit int) (count int, err
 	return
 }
 
-func (c cardRepo) BuriedCards(noteID models.ID, cardID models.ID) (cards []models.Card, err error) {
-	query := "SELECT id, queue FROM cards WHERE nid=? and id!=? AND " +
-		"(queue=0 OR (queue=2 AND due <=?))"
-	query = c.Conn.Rebind(query)
-	today := time.Now().Unix()
-	rows, err := c.Conn.Queryx(query, noteID, cardID, today)
-	if err != nil {
-		return
-	}
-
-	for rows.Next() {
-		var card models.Card
-		rows.StructScan(&card)
-		cards = append(cards, card)
-	}
-	err = rows.Err()
-
+// BuriedCards returns the new cards and the reviews due today of a note which are buried with the answered card
+func (c cardRepo) BuriedCards(noteID models.ID, cardID models.ID, today int64) (cards []models.Card, err error) {
+	query := fmt.Sprintf("SELECT id, queue FROM cards WHERE nid = ? AND id != ? AND "+
+		"(queue = %d OR (queue = %d AND due <= ?))", models.CardQueueNew, models.CardQueueReview)
+	err = sqlx.Select(ankisql.Reader(c.Conn), &cards, query, noteID, cardID, today)
 	return
 }
 
@@ -299,9 +339,9 @@ func (c cardRepo) EmptyDyn(limitQuery string, usn int) error {
 	})
 }
 
-func (c cardRepo) BuryCards(cardIDs []models.ID, usn int) error {
+// BuryCards moves the cards to the queue of the cards buried by the user or of the buried siblings
+func (c cardRepo) BuryCards(cardIDs []models.ID, queue models.CardQue, usn int) error {
 	return ankisql.Tx(c.Tx, func(tx *sqlx.Tx) error {
-		queue := fmt.Sprintf("manual AND %s OR %s", models.CardQueueBuried, models.CardQueueSBuried)
 		query := "UPDATE cards SET queue = ?, mod = ?, usn = ? WHERE id IN " +
 			ankisql.InClauseFromIDs(cardIDs)
 
@@ -312,3 +352,114 @@ func (c cardRepo) BuryCards(cardIDs []models.ID, usn int) error {
 		return nil
 	})
 }
+
+// RestoreQueue moves the cards of the queue back to the queue of their type (ie: when unsuspending)
+func (c cardRepo) RestoreQueue(cardIDs []models.ID, queue models.CardQue, usn int) error {
+	return ankisql.Tx(c.Tx, func(tx *sqlx.Tx) error {
+		query := "UPDATE cards SET " + RESTORE_QUEUE_SNIPPET + ", mod = ?, usn = ? WHERE queue = ? AND id IN " +
+			ankisql.InClauseFromIDs(cardIDs)
+		if _, err := tx.Exec(query, time.Now().Unix(), usn, queue); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// SetFlag replaces the flag of the cards, 0 removes the flag
+func (c cardRepo) SetFlag(cardIDs []models.ID, flag int, usn int) error {
+	return ankisql.Tx(c.Tx, func(tx *sqlx.Tx) error {
+		query := "UPDATE cards SET flags = (flags & ~7) | ?, mod = ?, usn = ? WHERE id IN " +
+			ankisql.InClauseFromIDs(cardIDs)
+		if _, err := tx.Exec(query, flag, time.Now().Unix(), usn); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// IDsOfNotes returns the ids of the cards of the notes
+func (c cardRepo) IDsOfNotes(noteIDs []models.ID) (ids []models.ID, err error) {
+	if len(noteIDs) == 0 {
+		return
+	}
+	query := "SELECT id FROM cards WHERE nid IN " + ankisql.InClauseFromIDs(noteIDs)
+	err = sqlx.Select(ankisql.Reader(c.Conn), &ids, query)
+	return
+}
+
+// Delete removes the cards. The review history of the cards is kept
+func (c cardRepo) Delete(ids []models.ID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return ankisql.Tx(c.Tx, func(tx *sqlx.Tx) error {
+		if _, err := tx.Exec("DELETE FROM cards WHERE id IN " + ankisql.InClauseFromIDs(ids)); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// MoveDecks moves the cards of the decks to another deck.
+// The cards of the decks that are in a filtered deck get the deck as their home deck
+func (c cardRepo) MoveDecks(deckIDs []models.ID, did models.ID, usn int) error {
+	if len(deckIDs) == 0 {
+		return nil
+	}
+	return ankisql.Tx(c.Tx, func(tx *sqlx.Tx) error {
+		decks := ankisql.InClauseFromIDs(deckIDs)
+		mod := time.Now().Unix()
+		if _, err := tx.Exec("UPDATE cards SET did = ?, mod = ?, usn = ? WHERE did IN "+decks, did, mod, usn); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE cards SET odid = ?, mod = ?, usn = ? WHERE odid IN "+decks, did, mod, usn); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// MoveToFiltered gathers the cards matching the search clause in the filtered deck did and returns
+// how many were moved. The cards keep their home deck and due in odid and odue.
+// The suspended and buried cards and the cards already in a filtered deck are skipped
+func (c cardRepo) MoveToFiltered(cls string, args []string, order models.FilterOrder, limit int, did models.ID, resched bool, usn int) (count int, err error) {
+	orderBy, exists := FILTER_ORDER_SNIPPETS[order]
+	if !exists {
+		return 0, fmt.Errorf("unknown filter order %d", order)
+	}
+	var iargs []interface{}
+	for _, arg := range args {
+		iargs = append(iargs, arg)
+	}
+	where := "c.odid = 0 AND c.queue >= 0"
+	if cls != "" {
+		where = "(" + cls + ") AND " + where
+	}
+	// the cards are selected with the transaction to see the cards emptied before a rebuild
+	query := "SELECT c.id FROM cards c JOIN notes note ON note.id = c.nid WHERE " + where +
+		" ORDER BY " + orderBy + " LIMIT ?"
+	iargs = append(iargs, limit)
+	err = ankisql.Tx(c.Tx, func(tx *sqlx.Tx) error {
+		var ids []models.ID
+		if err := tx.Select(&ids, tx.Rebind(query), iargs...); err != nil {
+			return err
+		}
+		// without rescheduling the cards are previewed as reviews
+		queue := ""
+		if !resched {
+			queue = fmt.Sprintf(", queue = %d", models.CardQueueReview)
+		}
+		update := "UPDATE cards SET odid = did, odue = due, did = ?, " +
+			"due = (CASE WHEN due <= 0 THEN due ELSE ? END), mod = ?, usn = ?" + queue + " WHERE id = ?"
+		mod := time.Now().Unix()
+		for idx, id := range ids {
+			// the cards are shown in the order they were gathered
+			if _, err := tx.Exec(update, did, -100000+idx, mod, usn, id); err != nil {
+				return err
+			}
+		}
+		count = len(ids)
+		return nil
+	})
+	return
+}
@@ -1,6 +1,7 @@
 package repositories
 
 import (
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -33,6 +34,21 @@ type ColRepo interface {
 	DayCutoff() int64
 	Tags() (tags []string, err error)
 	NoteTypes() (noteTypes models.NoteTypes, err error)
+	Meta() (col models.Collection, err error)
+	RawConf() (conf json.RawMessage, err error)
+	SaveConf(conf json.RawMessage) error
+	SaveCreatedTime(crt models.UnixTime) error
+	SaveNoteTypes(noteTypes models.NoteTypes) error
+	TagCache() (tags models.TagCache, err error)
+	SaveTags(tags models.TagCache) error
+	FinishSync(mod int64, usn int) error
+	ModSchema() error
+	SetLastSync(ls int64) error
+	CopyTo(path string) error
+	SaveNextPos(pos int) error
+	SaveCurrentDeck(did models.ID) error
+	SaveActiveDecks(dids []models.ID) error
+	SaveLastUnburied(today int64) error
 }
 
 func NewColRepository(conn *sqlx.DB) ColRepo {
@@ -45,7 +61,7 @@ func NewColRepository(conn *sqlx.DB) ColRepo {
 }
 func (c colRepo) UpdateMod() (err error) {
 	return ankisql.Tx(c.Tx, func(tx *sqlx.Tx) error {
-		query := fmt.Sprintf("UPDATE col SET mod = %d WHERE ID = 1", time.Now().Unix())
+		query := fmt.Sprintf("UPDATE col SET mod = %d WHERE ID = 1", time.Now().UnixMilli())
 		if _, err := tx.Exec(query); err != nil {
 			return err
 		}
@@ -55,7 +71,7 @@ func (c colRepo) UpdateMod() (err error) {
 
 func (c colRepo) CreatedTime() (crt models.UnixTime, err error) {
 	query := `SELECT crt FROM col`
-	if err = c.Conn.Get(&crt, query); err != nil {
+	if err = sqlx.Get(ankisql.Reader(c.Conn), &crt, query); err != nil {
 		return
 	}
 	return
@@ -64,7 +80,7 @@ func (c colRepo) CreatedTime() (crt models.UnixTime, err error) {
 func (c colRepo) Conf() (conf models.CollectionConf, err error) {
 	var col models.Collection
 	query := `SELECT conf FROM col`
-	if err = c.Conn.Get(&col, query); err != nil {
+	if err = sqlx.Get(ankisql.Reader(c.Conn), &col, query); err != nil {
 		return
 	}
 	conf = col.Conf
@@ -85,7 +101,7 @@ func (c colRepo) NextDue() (due int64, err error) {
 func (c colRepo) DeckConf(deckId models.ID) (deckConf models.DeckConfig, err error) {
 	var deckConfs models.DeckConfigs
 	query := "SELECT dconf FROM col LIMIT 1"
-	if err = c.Conn.QueryRowx(query).Scan(&deckConfs); err != nil {
+	if err = ankisql.Reader(c.Conn).QueryRowx(query).Scan(&deckConfs); err != nil {
 		fmt.Printf("query: %s", err.Error())
 		return
 	}
@@ -99,7 +115,7 @@ func (c colRepo) USN(server bool) (usn int, err error) {
 	if server {
 		var col models.Collection
 		query := `SELECT usn FROM col`
-		if err = c.Conn.Get(&col, query); err != nil {
+		if err = sqlx.Get(ankisql.Reader(c.Conn), &col, query); err != nil {
 			return
 		}
 		usn = col.USN
@@ -115,13 +131,15 @@ func (c colRepo) Rollover() int {
 	return 4
 }
 
+// SchedToday returns the number of days that passed since the collection was created
+// which is the day the reviews are due
 func (c colRepo) SchedToday() int64 {
 	query := `SELECT crt FROM col`
 	var crt int64
-	if err := c.Conn.Select(crt, query); err != nil {
-		return time.Now().Unix()
+	if err := sqlx.Get(ankisql.Reader(c.Conn), &crt, query); err != nil {
+		return 0
 	}
-	return time.Now().Unix() - crt
+	return (time.Now().Unix() - crt) / 86400
 }
 
 func (c colRepo) DayCutoff() int64 {
@@ -130,7 +148,7 @@ func (c colRepo) DayCutoff() int64 {
 		rolloverTime = 24 + rolloverTime
 	}
 	date := time.Now()
-	date = time.Date(date.Year(), date.Month(), 0, rolloverTime, 0, 0, 0, date.Location())
+	date = time.Date(date.Year(), date.Month(), date.Day(), rolloverTime, 0, 0, 0, date.Location())
 	if date.Before(time.Now()) {
 		date = date.Add(time.Hour * 24)
 	}
@@ -139,7 +157,7 @@ func (c colRepo) DayCutoff() int64 {
 
 func (c colRepo) NoteTypes() (noteTypes models.NoteTypes, err error) {
 	query := `SELECT models FROM col LIMIT 1`
-	if err = c.Conn.QueryRowx(query).Scan(&noteTypes); err != nil {
+	if err = ankisql.Reader(c.Conn).QueryRowx(query).Scan(&noteTypes); err != nil {
 		return
 	}
 	return
@@ -148,10 +166,149 @@ func (c colRepo) NoteTypes() (noteTypes models.NoteTypes, err error) {
 func (c colRepo) Tags() (tags []string, err error) {
 	var tagCache models.TagCache
 	query := `SELECT tags From col LIMIT 1`
-	if err = c.Conn.QueryRowx(query).Scan(&tagCache); err != nil {
+	if err = ankisql.Reader(c.Conn).QueryRowx(query).Scan(&tagCache); err != nil {
 		return
 	}
 	tags = maps.Keys(tagCache)
 
 	return
 }
+
+// Meta retrieves the timestamps and update sequence number of the collection
+// used to decide what needs to be synced
+func (c colRepo) Meta() (col models.Collection, err error) {
+	query := `SELECT id, crt, mod, scm, usn, ls FROM col LIMIT 1`
+	if err = sqlx.Get(ankisql.Reader(c.Conn), &col, query); err != nil {
+		return
+	}
+	return
+}
+
+// RawConf retrieves the collection configuration without decoding it
+func (c colRepo) RawConf() (conf json.RawMessage, err error) {
+	var blob string
+	query := `SELECT conf FROM col LIMIT 1`
+	if err = sqlx.Get(ankisql.Reader(c.Conn), &blob, query); err != nil {
+		return
+	}
+	conf = json.RawMessage(blob)
+	return
+}
+
+func (c colRepo) SaveConf(conf json.RawMessage) error {
+	return c.update("conf", string(conf))
+}
+
+func (c colRepo) SaveCreatedTime(crt models.UnixTime) error {
+	return c.update("crt", crt)
+}
+
+func (c colRepo) SaveNoteTypes(noteTypes models.NoteTypes) error {
+	blob, err := json.Marshal(noteTypes)
+	if err != nil {
+		return err
+	}
+	return c.update("models", string(blob))
+}
+
+func (c colRepo) TagCache() (tags models.TagCache, err error) {
+	query := `SELECT tags From col LIMIT 1`
+	if err = ankisql.Reader(c.Conn).QueryRowx(query).Scan(&tags); err != nil {
+		return
+	}
+	return
+}
+
+func (c colRepo) SaveTags(tags models.TagCache) error {
+	blob, err := json.Marshal(tags)
+	if err != nil {
+		return err
+	}
+	return c.update("tags", string(blob))
+}
+
+// FinishSync records a successful sync by setting the last sync time to the
+// modified time returned by the server and bumping the update sequence number
+func (c colRepo) FinishSync(mod int64, usn int) error {
+	return ankisql.Tx(c.Tx, func(tx *sqlx.Tx) error {
+		query := "UPDATE col SET mod = ?, ls = ?, usn = ?"
+		if _, err := tx.Exec(query, mod, mod, usn); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// ModSchema marks the schema as modified which forces a full sync on the next sync
+func (c colRepo) ModSchema() error {
+	return ankisql.Tx(c.Tx, func(tx *sqlx.Tx) error {
+		now := time.Now().UnixMilli()
+		if _, err := tx.Exec("UPDATE col SET scm = ?, mod = ?", now, now); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+func (c colRepo) SetLastSync(ls int64) error {
+	return c.update("ls", ls)
+}
+
+// CopyTo writes a consistent copy of the collection to a new file
+func (c colRepo) CopyTo(path string) error {
+	_, err := c.Conn.Exec("VACUUM INTO ?", path)
+	return err
+}
+
+// SaveNextPos sets the due position of the next new card without touching
+// the other settings of col.conf, including the ones unknown to this client
+func (c colRepo) SaveNextPos(pos int) error {
+	return c.saveConfKey("nextPos", pos)
+}
+
+// SaveCurrentDeck sets the deck selected in the collection configuration
+func (c colRepo) SaveCurrentDeck(did models.ID) error {
+	return c.saveConfKey("curDeck", did)
+}
+
+// SaveActiveDecks sets the decks whose cards are studied, the current deck and its children
+func (c colRepo) SaveActiveDecks(dids []models.ID) error {
+	return c.saveConfKey("activeDecks", dids)
+}
+
+// SaveLastUnburied sets the day when the buried cards were last restored
+func (c colRepo) SaveLastUnburied(today int64) error {
+	return c.saveConfKey("lastUnburied", today)
+}
+
+// saveConfKey replaces a key of the collection configuration keeping the other keys untouched
+func (c colRepo) saveConfKey(key string, value interface{}) error {
+	blob, err := c.RawConf()
+	if err != nil {
+		return err
+	}
+	conf := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(blob, &conf); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	conf[key] = raw
+	updated, err := json.Marshal(conf)
+	if err != nil {
+		return err
+	}
+	return c.SaveConf(updated)
+}
+
+func (c colRepo) update(column string, value interface{}) error {
+	return ankisql.Tx(c.Tx, func(tx *sqlx.Tx) error {
+		query := fmt.Sprintf("UPDATE col SET %s = ?", column)
+		if _, err := tx.Exec(query, value); err != nil {
+			return err
+		}
+		return nil
+	})
+}
@@ -30,11 +30,14 @@ type DeckRepo interface {
 	DeckNameMap() (deckNames map[string]models.Deck, err error)
 	ChildrenDeckIDs(did models.ID) (ids []models.ID, err error)
 	Save(deck *models.Deck) error
+	SaveAll(decks models.Decks) error
+	SaveConfs(deckConfs models.DeckConfigs) error
 	Conf(deckID models.ID) (models.DeckConfig, error)
 	Confs() (deckConfs models.DeckConfigs, err error)
 	Parents(deckID models.ID) (decks []models.Deck, err error)
 	FixDecks(decks models.Decks, usn int) error
 	DeckWithParents(deckID models.ID) ([]models.Deck, error)
+	EnsureParentsExist(decks models.Decks, name string, usn int) string
 }
 
 func NewDeckRepository(conn *sqlx.DB) DeckRepo {
@@ -56,7 +59,7 @@ func (d deckRepo) ChildrenDeckIDs(did models.ID) (ids []models.ID, err error) {
 	}
 
 	for _, dk := range decks {
-		if strings.HasPrefix(dk.Name, fmt.Sprintf("%s:", deck.Name)) {
+		if strings.HasPrefix(dk.Name, deck.Name+"::") {
 			ids = append(ids, dk.ID)
 		}
 	}
@@ -83,10 +86,38 @@ func (d deckRepo) Save(deck *models.Deck) error {
 	})
 }
 
+// SaveAll replaces all the decks in a collection
+func (d deckRepo) SaveAll(decks models.Decks) error {
+	return ankisql.Tx(d.Tx, func(tx *sqlx.Tx) error {
+		blob, err := json.Marshal(decks)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE col SET decks = ?", string(blob)); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// SaveConfs replaces all the deck configurations in a collection
+func (d deckRepo) SaveConfs(deckConfs models.DeckConfigs) error {
+	return ankisql.Tx(d.Tx, func(tx *sqlx.Tx) error {
+		blob, err := json.Marshal(deckConfs)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE col SET dconf = ?", string(blob)); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
 // Decks will retrieve the decks from col
 func (d deckRepo) Decks() (decks models.Decks, err error) {
 	query := `SELECT decks FROM col LIMIT 1`
-	if err = d.Conn.QueryRowx(query).Scan(&decks); err != nil {
+	if err = ankisql.Reader(d.Conn).QueryRowx(query).Scan(&decks); err != nil {
 		return
 	}
 	return
@@ -95,8 +126,16 @@ func (d deckRepo) Decks() (decks models.Decks, err error) {
 func (d deckRepo) Conf(deckID models.ID) (deckConf models.DeckConfig, err error) {
 	var deckConfs models.DeckConfigs
 	deckConfs, err = d.Confs()
-
-	deckConf = *deckConfs[deckID]
+	if err != nil {
+		return
+	}
+	// filtered decks do not have a configuration
+	conf, exists := deckConfs[deckID]
+	if !exists {
+		err = fmt.Errorf("could not find deck configuration %d", deckID)
+		return
+	}
+	deckConf = *conf
 
 	return
 }
@@ -119,7 +158,7 @@ func (d deckRepo) DeckNameMap() (deckNames map[string]models.Deck, err error) {
 func (d deckRepo) Confs() (deckConfs models.DeckConfigs, err error) {
 	var col models.Collection
 	query := `SELECT dconf from col`
-	if err = d.Conn.Get(&col, query); err != nil {
+	if err = sqlx.Get(ankisql.Reader(d.Conn), &col, query); err != nil {
 		return
 	}
 	deckConfs = col.DeckConfs
@@ -185,31 +224,39 @@ func (d deckRepo) DeckWithParents(deckID models.ID) ([]models.Deck, error) {
 
 }
 
-func (d deckRepo) ensureParentsExist(immediateParents string, usn int) (string, error) {
-	dbDecks, err := d.DeckNameMap()
-	if err != nil {
-		return "", err
+// EnsureParentsExist adds the missing parents of a deck name to the decks and returns the name
+// spelled like the existing parents (ie: school::Math becomes School::Math when School exists).
+// The new parents are not saved
+func (d deckRepo) EnsureParentsExist(decks models.Decks, name string, usn int) string {
+	names := make(map[string]*models.Deck, len(decks))
+	for _, deck := range decks {
+		names[strings.ToLower(deck.Name)] = deck
 	}
-	parts := strings.Split(immediateParents, "::")
-	var s string
-	for _, p := range parts {
-		if s != "" {
-			s += p
-		} else {
-			s += "::" + p
+	parts := strings.Split(name, "::")
+	parent := ""
+	for _, part := range parts[:len(parts)-1] {
+		deckName := part
+		if parent != "" {
+			deckName = parent + "::" + part
 		}
-		// check if deck exists
-		deck, exists := dbDecks[s]
-		if exists {
-			s = deck.Name
-		} else {
-			newDeckID := models.ID(time.Now().Unix())
-			if err := d.Save(&models.Deck{Name: s, ID: newDeckID}); err != nil {
-				return "", err
-			}
+		if deck, exists := names[strings.ToLower(deckName)]; exists {
+			parent = deck.Name
+			continue
 		}
+		id := models.ID(time.Now().Unix())
+		for decks[id] != nil {
+			id++
+		}
+		mod := models.UnixTime(time.Now().Unix())
+		deck := &models.Deck{ID: id, Name: deckName, USN: usn, Mod: &mod, Conf: 1}
+		decks[id] = deck
+		names[strings.ToLower(deckName)] = deck
+		parent = deckName
+	}
+	if parent == "" {
+		return name
 	}
-	return s + "::" + parts[len(parts)-1], nil
+	return parent + "::" + parts[len(parts)-1]
 }
 
 func (d deckRepo) FixDecks(decks models.Decks, usn int) error {
@@ -244,11 +291,7 @@ func (d deckRepo) FixDecks(decks models.Decks, usn int) error {
 				immediateParent := strings.Join(imDeckParts, "::")
 				if !slices.Contains(deckNames, immediateParent) {
 					// TODO: log fix deck with missing parent deck.Name
-					dbName, err := d.ensureParentsExist(updateDeck.Name, usn)
-					if err != nil {
-						return err
-					}
-					updateDeck.Name = dbName
+					updateDeck.Name = d.EnsureParentsExist(decks, updateDeck.Name, usn)
 					deckNames = append(deckNames, immediateParent)
 				}
 			}
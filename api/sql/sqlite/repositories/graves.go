@@ -0,0 +1,83 @@
+package repositories
+
+import (
+	ankisql "github.com/aerex/go-anki/api/sql"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/jmoiron/sqlx"
+)
+
+type graveRepo struct {
+	Conn *sqlx.DB
+	Tx   ankisql.TxOpts
+}
+
+// GraveRepo keeps track of the cards, notes and decks that were deleted
+// so the deletions can be sent to the server on the next sync
+type GraveRepo interface {
+	Add(ids []models.ID, graveType models.GraveType, usn int) error
+	Pending() (graves models.Graves, err error)
+	Mark(usn int) error
+	Count() (count int, err error)
+}
+
+func NewGraveRepository(conn *sqlx.DB) GraveRepo {
+	return graveRepo{
+		Conn: conn,
+		Tx: ankisql.TxOpts{
+			DB: conn,
+		},
+	}
+}
+
+// Add records the deleted ids for the given grave type
+func (g graveRepo) Add(ids []models.ID, graveType models.GraveType, usn int) error {
+	return ankisql.Tx(g.Tx, func(tx *sqlx.Tx) error {
+		query := "INSERT INTO graves (usn, oid, type) VALUES (?,?,?)"
+		for _, id := range ids {
+			if _, err := tx.Exec(query, usn, id, graveType); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Pending retrieves the graves that have not been sent to the server yet
+func (g graveRepo) Pending() (graves models.Graves, err error) {
+	var rows []struct {
+		OID  models.ID        `db:"oid"`
+		Type models.GraveType `db:"type"`
+	}
+	query := "SELECT oid, type FROM graves WHERE usn = -1"
+	if err = sqlx.Select(ankisql.Reader(g.Conn), &rows, query); err != nil {
+		return
+	}
+	graves = models.Graves{Cards: []models.ID{}, Notes: []models.ID{}, Decks: []models.ID{}}
+	for _, row := range rows {
+		switch row.Type {
+		case models.GraveTypeCard:
+			graves.Cards = append(graves.Cards, row.OID)
+		case models.GraveTypeNote:
+			graves.Notes = append(graves.Notes, row.OID)
+		case models.GraveTypeDeck:
+			graves.Decks = append(graves.Decks, row.OID)
+		}
+	}
+	return
+}
+
+// Mark sets the update sequence number of the pending graves once they are sent to the server
+func (g graveRepo) Mark(usn int) error {
+	return ankisql.Tx(g.Tx, func(tx *sqlx.Tx) error {
+		if _, err := tx.Exec("UPDATE graves SET usn = ? WHERE usn = -1", usn); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// Count returns the number of graves in the collection
+func (g graveRepo) Count() (count int, err error) {
+	err = sqlx.Get(ankisql.Reader(g.Conn), &count, "SELECT COUNT() FROM graves")
+	return
+}
@@ -23,6 +23,12 @@ type NoteRepo interface {
 	FindById(id string) (note fanki.Note, err error)
 	Create(note models.Note) (err error)
 	Exists(id models.ID, stringTags string, fields string) (err error, exists bool)
+	FieldsWithMedia() (fields []string, err error)
+	FindByFirstField(mid models.ID, csum uint64) (notes []models.Note, err error)
+	LastID() (id models.ID, err error)
+	FindByGUID(guid string) (note models.Note, exists bool, err error)
+	Find(id models.ID) (note models.Note, exists bool, err error)
+	Delete(ids []models.ID) error
 }
 
 func NewNoteRepository(conn *sqlx.DB) NoteRepo {
@@ -36,7 +42,7 @@ func NewNoteRepository(conn *sqlx.DB) NoteRepo {
 
 func (n noteRepo) FindById(id string) (note fanki.Note, err error) {
 	query := `SELECT * FROM notes WHERE id=? LIMIT 1`
-	if err = n.Conn.Get(&note, query, id); err != nil {
+	if err = sqlx.Get(ankisql.Reader(n.Conn), &note, query, id); err != nil {
 		return
 	}
 	return
@@ -44,7 +50,7 @@ func (n noteRepo) FindById(id string) (note fanki.Note, err error) {
 
 func (n noteRepo) FindByChecksum(mid, csum string) (notes fanki.Notes, err error) {
 	query := `SELECT id, flds FROM notes WHERE mid=? and csum=?`
-	if err = n.Conn.Select(notes, query, mid, csum); err != nil {
+	if err = sqlx.Select(ankisql.Reader(n.Conn), notes, query, mid, csum); err != nil {
 		return
 	}
 	return
@@ -53,7 +59,7 @@ func (n noteRepo) FindByChecksum(mid, csum string) (notes fanki.Notes, err error
 func (n noteRepo) FindByModelIdsField(field string, mids []string) (notes fanki.Notes, err error) {
 	query := fmt.Sprintf("SELECT id, mid, flds FROM notes WHERE mid in (%s) and flds like ? escape '\\'", strings.Join(mids, ","))
 	query = query + " and flds like ? escape '\\'"
-	if err = n.Conn.Select(notes, query, "%"+field+"%"); err != nil {
+	if err = sqlx.Select(ankisql.Reader(n.Conn), notes, query, "%"+field+"%"); err != nil {
 		return
 	}
 	return
@@ -62,7 +68,7 @@ func (n noteRepo) FindByModelIdsField(field string, mids []string) (notes fanki.
 func (n noteRepo) Exists(id models.ID, stringTags string, fields string) (err error, exists bool) {
 	var note models.Note
 	query := "SELECT 1 from notes WHERE ID = ? AND tags = ? AND flds = ?"
-	err = n.Conn.Get(&note, query, id, stringTags, fields)
+	err = sqlx.Get(ankisql.Reader(n.Conn), &note, query, id, stringTags, fields)
 	if err == sql.ErrNoRows {
 		return nil, false
 	}
@@ -83,3 +89,56 @@ func (n noteRepo) Create(note models.Note) (err error) {
 		return nil
 	})
 }
+
+// FieldsWithMedia returns the fields of the notes that may reference media files or LaTeX images
+func (n noteRepo) FieldsWithMedia() (fields []string, err error) {
+	query := `SELECT flds FROM notes WHERE flds LIKE '%<img%' OR flds LIKE '%[sound:%' OR flds LIKE '%[latex]%' OR flds LIKE '%[$%'`
+	err = sqlx.Select(ankisql.Reader(n.Conn), &fields, query)
+	return
+}
+
+// FindByFirstField returns the notes of a note type whose first field has the checksum
+func (n noteRepo) FindByFirstField(mid models.ID, csum uint64) (notes []models.Note, err error) {
+	query := `SELECT id, guid, mid, mod, usn, tags, flds, sfld, csum, flags FROM notes WHERE mid = ? AND csum = ?`
+	err = sqlx.Select(ankisql.Reader(n.Conn), &notes, query, mid, csum)
+	return
+}
+
+// LastID returns the highest note id or 0 when the collection has no notes
+func (n noteRepo) LastID() (id models.ID, err error) {
+	err = sqlx.Get(ankisql.Reader(n.Conn), &id, `SELECT COALESCE(MAX(id), 0) FROM notes`)
+	return
+}
+
+// FindByGUID returns the note with the globally unique id
+func (n noteRepo) FindByGUID(guid string) (note models.Note, exists bool, err error) {
+	query := `SELECT id, guid, mid, mod, usn, tags, flds, sfld, csum, flags FROM notes WHERE guid = ?`
+	err = sqlx.Get(ankisql.Reader(n.Conn), &note, query, guid)
+	if err == sql.ErrNoRows {
+		return note, false, nil
+	}
+	return note, err == nil, err
+}
+
+// Find returns the note with the id
+func (n noteRepo) Find(id models.ID) (note models.Note, exists bool, err error) {
+	query := `SELECT id, guid, mid, mod, usn, tags, flds, sfld, csum, flags FROM notes WHERE id = ?`
+	err = sqlx.Get(ankisql.Reader(n.Conn), &note, query, id)
+	if err == sql.ErrNoRows {
+		return note, false, nil
+	}
+	return note, err == nil, err
+}
+
+// Delete removes the notes without their cards
+func (n noteRepo) Delete(ids []models.ID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return ankisql.Tx(n.Tx, func(tx *sqlx.Tx) error {
+		if _, err := tx.Exec("DELETE FROM notes WHERE id IN " + ankisql.InClauseFromIDs(ids)); err != nil {
+			return err
+		}
+		return nil
+	})
+}
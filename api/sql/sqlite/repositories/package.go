@@ -0,0 +1,173 @@
+package repositories
+
+import (
+	"fmt"
+	"strings"
+
+	ankisql "github.com/aerex/go-anki/api/sql"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// Column indexes of the raw rows of the notes, cards and revlog tables
+const (
+	NoteIDColumn     = 0
+	NoteGUIDColumn   = 1
+	NoteMIDColumn    = 2
+	NoteModColumn    = 3
+	NoteUSNColumn    = 4
+	NoteTagsColumn   = 5
+	NoteFieldsColumn = 6
+
+	CardIDColumn     = 0
+	CardNIDColumn    = 1
+	CardDIDColumn    = 2
+	CardOrdColumn    = 3
+	CardModColumn    = 4
+	CardUSNColumn    = 5
+	CardTypeColumn   = 6
+	CardQueueColumn  = 7
+	CardDueColumn    = 8
+	CardIvlColumn    = 9
+	CardFactorColumn = 10
+	CardRepsColumn   = 11
+	CardLapsesColumn = 12
+	CardLeftColumn   = 13
+	CardODueColumn   = 14
+	CardODIDColumn   = 15
+
+	RevlogCIDColumn = 1
+	RevlogUSNColumn = 2
+)
+
+// NoteGUID identifies an existing note when importing notes shared by another collection
+type NoteGUID struct {
+	ID      models.ID `db:"id"`
+	ModelID models.ID `db:"mid"`
+	Mod     int64     `db:"mod"`
+}
+
+type packageRepo struct {
+	Conn *sqlx.DB
+	Tx   ankisql.TxOpts
+}
+
+// PackageRepo copies the raw table rows between a collection and a deck package
+type PackageRepo interface {
+	Rows(table string, column string, ids []models.ID) (rows []models.SyncRow, err error)
+	InsertRows(table string, rows []models.SyncRow) error
+	IDs(table string) (ids map[models.ID]bool, err error)
+	NotesByGUID() (notes map[string]NoteGUID, err error)
+	CardOrds() (ords map[models.ID][]int, err error)
+}
+
+func NewPackageRepository(conn *sqlx.DB) PackageRepo {
+	return packageRepo{
+		Conn: conn,
+		Tx: ankisql.TxOpts{
+			DB: conn,
+		},
+	}
+}
+
+// Rows retrieves the rows of a table where the column matches one of the ids
+func (p packageRepo) Rows(table string, column string, ids []models.ID) (rows []models.SyncRow, err error) {
+	if _, err = lookupSyncTable(table); err != nil {
+		return
+	}
+	if len(ids) == 0 {
+		return
+	}
+	query := fmt.Sprintf("SELECT * FROM %s WHERE %s IN %s ORDER BY id", table, column, ankisql.InClauseFromIDs(ids))
+	res, err := ankisql.Reader(p.Conn).Queryx(query)
+	if err != nil {
+		return
+	}
+	defer res.Close()
+	for res.Next() {
+		row, err := scanRow(res)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	err = res.Err()
+	return
+}
+
+// InsertRows inserts the rows and replaces the existing rows with the same id
+func (p packageRepo) InsertRows(table string, rows []models.SyncRow) error {
+	t, err := lookupSyncTable(table)
+	if err != nil {
+		return err
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", t.columns), ",")
+	return ankisql.Tx(p.Tx, func(tx *sqlx.Tx) error {
+		insert := fmt.Sprintf("INSERT OR REPLACE INTO %s VALUES (%s)", table, placeholders)
+		for _, row := range rows {
+			if len(row) != t.columns {
+				return fmt.Errorf("expected %d columns for table %s but got %d", t.columns, table, len(row))
+			}
+			if _, err := tx.Exec(insert, row...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// IDs returns the ids used in a table
+func (p packageRepo) IDs(table string) (ids map[models.ID]bool, err error) {
+	if _, err = lookupSyncTable(table); err != nil {
+		return
+	}
+	var list []models.ID
+	if err = sqlx.Select(ankisql.Reader(p.Conn), &list, fmt.Sprintf("SELECT id FROM %s", table)); err != nil {
+		return
+	}
+	ids = make(map[models.ID]bool, len(list))
+	for _, id := range list {
+		ids[id] = true
+	}
+	return
+}
+
+// NotesByGUID maps the globally unique id of the notes to their local id
+func (p packageRepo) NotesByGUID() (notes map[string]NoteGUID, err error) {
+	res, err := ankisql.Reader(p.Conn).Queryx("SELECT guid, id, mid, mod FROM notes")
+	if err != nil {
+		return
+	}
+	defer res.Close()
+	notes = make(map[string]NoteGUID)
+	for res.Next() {
+		var guid string
+		var note NoteGUID
+		if err = res.Scan(&guid, &note.ID, &note.ModelID, &note.Mod); err != nil {
+			return
+		}
+		notes[guid] = note
+	}
+	err = res.Err()
+	return
+}
+
+// CardOrds maps the notes to the template ordinals of their cards
+func (p packageRepo) CardOrds() (ords map[models.ID][]int, err error) {
+	res, err := ankisql.Reader(p.Conn).Queryx("SELECT nid, ord FROM cards")
+	if err != nil {
+		return
+	}
+	defer res.Close()
+	ords = make(map[models.ID][]int)
+	for res.Next() {
+		var nid models.ID
+		var ord int
+		if err = res.Scan(&nid, &ord); err != nil {
+			return
+		}
+		ords[nid] = append(ords[nid], ord)
+	}
+	err = res.Err()
+	return
+}
@@ -12,6 +12,8 @@ type RevLogRepo interface {
 	TodayStats(dayCutoff int64) (stats models.StudiedToday, err error)
 	MaturedCards(dayCutoff int64) (stats models.MaturedToday, err error)
 	Create(card models.Card, usn int, ease models.Ease, delay int64, lastInterval int64, timeTaken int64, revLogType models.ReviewLogType) (err error)
+	// History returns the reviews of the cards matching the clause sorted by card and time
+	History(cardClause string) (logs []models.ReviewLog, err error)
 }
 
 type revLogRepo struct {
@@ -29,15 +31,16 @@ func NewRevLogRepository(conn *sqlx.DB) RevLogRepo {
 }
 
 func (r revLogRepo) TodayStats(dayCutoff int64) (stats models.StudiedToday, err error) {
-	query := `SELECT COUNT() "cards", SUM(time)/1000 "time",
-    SUM(CASE WHEN ease = 1 THEN 1 ELSE 0 END) "failed",
-    SUM(CASE WHEN type = 0 THEN 1 ELSE 0 END) "learning",
-    SUM(CASE WHEN type = 1 THEN 1 ELSE 0 END) "review",
-    SUM(CASE WHEN type = 2 THEN 1 ELSE 0 END) "relearned,
-    SUM(CASE WHEN type = 3 THEN 1 ELSE 0 END) "filter"
-      FROM revlog WHERE id > ?`
+	// the cards rescheduled by hand were not studied
+	query := `SELECT COUNT() "cards", IFNULL(SUM(time), 0)/1000 "time",
+    IFNULL(SUM(CASE WHEN ease = 1 THEN 1 ELSE 0 END), 0) "failed",
+    IFNULL(SUM(CASE WHEN type = 0 THEN 1 ELSE 0 END), 0) "learning",
+    IFNULL(SUM(CASE WHEN type = 1 THEN 1 ELSE 0 END), 0) "review",
+    IFNULL(SUM(CASE WHEN type = 2 THEN 1 ELSE 0 END), 0) "relearned",
+    IFNULL(SUM(CASE WHEN type = 3 THEN 1 ELSE 0 END), 0) "filter"
+      FROM revlog WHERE id > ? AND type != 4`
 
-	if err = r.Conn.Get(&stats, query, cutoff(dayCutoff)); err != nil {
+	if err = sqlx.Get(ankisql.Reader(r.Conn), &stats, query, cutoff(dayCutoff)); err != nil {
 		return
 	}
 	return
@@ -48,7 +51,7 @@ func (r revLogRepo) MaturedCards(dayCutoff int64) (stats models.MaturedToday, er
               SUM(CASE WHEN ease = 1 THEN 0 ELSE 1 END) FROM revlog
                 WHERE lastIvl >= 21 AND id > ?`
 
-	if err = r.Conn.Get(&stats, query, cutoff(dayCutoff)); err != nil {
+	if err = sqlx.Get(ankisql.Reader(r.Conn), &stats, query, cutoff(dayCutoff)); err != nil {
 		return
 	}
 	return
@@ -56,9 +59,11 @@ func (r revLogRepo) MaturedCards(dayCutoff int64) (stats models.MaturedToday, er
 
 func (r revLogRepo) Create(card models.Card, usn int, ease models.Ease, delay int64, lastInterval int64, timeTaken int64, revLogType models.ReviewLogType) (err error) {
 	return ankisql.Tx(r.Tx, func(tx *sqlx.Tx) error {
-		query := "INSERT into revlog VALUES (?,?,?,?,?,?,?,?,?)"
+		// the id of a review is the time it was answered in milliseconds, moved after the last
+		// review when several cards are answered within the same millisecond
+		query := "INSERT into revlog VALUES ((SELECT MAX(?, IFNULL(MAX(id), 0) + 1) FROM revlog),?,?,?,?,?,?,?,?)"
 		query = r.Conn.Rebind(query)
-		now := time.Now().Unix()
+		now := time.Now().UnixMilli()
 		if _, err = tx.Exec(query, now, card.ID, usn, int(ease), delay, lastInterval, card.Factor, timeTaken, revLogType); err != nil {
 			return err
 		}
@@ -66,6 +71,14 @@ func (r revLogRepo) Create(card models.Card, usn int, ease models.Ease, delay in
 	})
 }
 
+func (r revLogRepo) History(cardClause string) (logs []models.ReviewLog, err error) {
+	query := "SELECT r.* FROM revlog r JOIN cards c ON c.id = r.cid WHERE " + cardClause + " ORDER BY r.cid, r.id"
+	if err = sqlx.Select(ankisql.Reader(r.Conn), &logs, query); err != nil {
+		return
+	}
+	return
+}
+
 func cutoff(dayCutoff int64) int64 {
 	return (dayCutoff - 86400) * 1000
 }
@@ -0,0 +1,107 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// The collection schema (version 11) used by the anki 2.1 clients
+// See https://github.com/ankitects/anki/blob/2.1.15/anki/storage.py
+const schema = `
+CREATE TABLE IF NOT EXISTS col (
+    id              integer primary key,
+    crt             integer not null,
+    mod             integer not null,
+    scm             integer not null,
+    ver             integer not null,
+    dty             integer not null,
+    usn             integer not null,
+    ls              integer not null,
+    conf            text not null,
+    models          text not null,
+    decks           text not null,
+    dconf           text not null,
+    tags            text not null
+);
+CREATE TABLE IF NOT EXISTS notes (
+    id              integer primary key,
+    guid            text not null,
+    mid             integer not null,
+    mod             integer not null,
+    usn             integer not null,
+    tags            text not null,
+    flds            text not null,
+    sfld            integer not null,
+    csum            integer not null,
+    flags           integer not null,
+    data            text not null
+);
+CREATE TABLE IF NOT EXISTS cards (
+    id              integer primary key,
+    nid             integer not null,
+    did             integer not null,
+    ord             integer not null,
+    mod             integer not null,
+    usn             integer not null,
+    type            integer not null,
+    queue           integer not null,
+    due             integer not null,
+    ivl             integer not null,
+    factor          integer not null,
+    reps            integer not null,
+    lapses          integer not null,
+    left            integer not null,
+    odue            integer not null,
+    odid            integer not null,
+    flags           integer not null,
+    data            text not null
+);
+CREATE TABLE IF NOT EXISTS revlog (
+    id              integer primary key,
+    cid             integer not null,
+    usn             integer not null,
+    ease            integer not null,
+    ivl             integer not null,
+    lastIvl         integer not null,
+    factor          integer not null,
+    time            integer not null,
+    type            integer not null
+);
+CREATE TABLE IF NOT EXISTS graves (
+    usn             integer not null,
+    oid             integer not null,
+    type            integer not null
+);
+CREATE INDEX IF NOT EXISTS ix_notes_usn on notes (usn);
+CREATE INDEX IF NOT EXISTS ix_cards_usn on cards (usn);
+CREATE INDEX IF NOT EXISTS ix_revlog_usn on revlog (usn);
+CREATE INDEX IF NOT EXISTS ix_cards_nid on cards (nid);
+CREATE INDEX IF NOT EXISTS ix_cards_sched on cards (did, queue, due);
+CREATE INDEX IF NOT EXISTS ix_revlog_cid on revlog (cid);
+CREATE INDEX IF NOT EXISTS ix_notes_csum on notes (csum);
+`
+
+const (
+	SchemaVersion  = 11
+	defaultColConf = `{"nextPos": 1, "estTimes": true, "activeDecks": [1], "sortType": "noteFld", "timeLim": 0, ` +
+		`"sortBackwards": false, "addToCur": true, "curDeck": 1, "newBury": true, "newSpread": 0, ` +
+		`"dueCounts": true, "curModel": null, "collapseTime": 1200}`
+)
+
+// CreateCollection creates the tables of an empty collection.
+// The note types, decks and deck configurations are left empty for the caller to fill
+func CreateCollection(conn *sqlx.DB) error {
+	if _, err := conn.Exec(schema); err != nil {
+		return err
+	}
+	now := time.Now()
+	// the creation time is set to the start of the day the collection is created
+	crt := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).Unix()
+	query := `INSERT INTO col VALUES (1, ?, ?, ?, ?, 0, 0, 0, ?, '{}', '{}', '{}', '{}')`
+	if _, err := conn.Exec(query, crt, now.UnixMilli(), now.UnixMilli(), SchemaVersion, defaultColConf); err != nil {
+		return fmt.Errorf("could not create collection: %w", err)
+	}
+	return nil
+}
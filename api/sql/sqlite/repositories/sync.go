@@ -0,0 +1,225 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	ankisql "github.com/aerex/go-anki/api/sql"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// The tables exchanged in chunks during a sync.
+// modIdx is the index of the mod column or -1 if the rows are never updated
+type syncTable struct {
+	columns int
+	modIdx  int
+}
+
+var syncTables = map[string]syncTable{
+	"revlog": {columns: 9, modIdx: -1},
+	"cards":  {columns: 18, modIdx: 4},
+	"notes":  {columns: 11, modIdx: 3},
+}
+
+type syncRepo struct {
+	Conn *sqlx.DB
+	Tx   ankisql.TxOpts
+}
+
+// SyncRepo reads and writes the raw table rows exchanged with the sync server
+type SyncRepo interface {
+	PendingRows(table string, limit int, usn int) (rows []models.SyncRow, err error)
+	MergeRows(table string, rows []models.SyncRow) error
+	Remove(table string, ids []models.ID) error
+	Count(table string) (count int, err error)
+	ResetUSN() error
+	Vacuum() error
+}
+
+func NewSyncRepository(conn *sqlx.DB) SyncRepo {
+	return syncRepo{
+		Conn: conn,
+		Tx: ankisql.TxOpts{
+			DB: conn,
+		},
+	}
+}
+
+func lookupSyncTable(table string) (syncTable, error) {
+	t, exists := syncTables[table]
+	if !exists {
+		return t, fmt.Errorf("table %s cannot be synced", table)
+	}
+	return t, nil
+}
+
+// PendingRows retrieves up to limit rows of the table that were modified locally (usn = -1)
+// and marks them with the provided usn so they are not sent twice.
+// The marks must be rolled back when the server does not finish the sync
+func (s syncRepo) PendingRows(table string, limit int, usn int) (rows []models.SyncRow, err error) {
+	if _, err = lookupSyncTable(table); err != nil {
+		return
+	}
+	err = ankisql.Tx(s.Tx, func(tx *sqlx.Tx) error {
+		query := fmt.Sprintf("SELECT * FROM %s WHERE usn = -1 LIMIT ?", table)
+		res, err := tx.Queryx(query, limit)
+		if err != nil {
+			return err
+		}
+		defer res.Close()
+		cols, err := res.Columns()
+		if err != nil {
+			return err
+		}
+		var ids []models.ID
+		for res.Next() {
+			row, err := scanRow(res)
+			if err != nil {
+				return err
+			}
+			for idx, name := range cols {
+				if name == "usn" {
+					row[idx] = usn
+				}
+			}
+			id, ok := row[0].(int64)
+			if !ok {
+				return fmt.Errorf("unexpected id %v in table %s", row[0], table)
+			}
+			ids = append(ids, models.ID(id))
+			rows = append(rows, row)
+		}
+		if err := res.Err(); err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		update := fmt.Sprintf("UPDATE %s SET usn = ? WHERE id IN %s", table, ankisql.InClauseFromIDs(ids))
+		if _, err := tx.Exec(update, usn); err != nil {
+			return err
+		}
+		return nil
+	})
+	return
+}
+
+// MergeRows inserts the rows received from the server.
+// Existing rows are only replaced when the server row was modified more recently
+func (s syncRepo) MergeRows(table string, rows []models.SyncRow) error {
+	t, err := lookupSyncTable(table)
+	if err != nil {
+		return err
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", t.columns), ",")
+	return ankisql.Tx(s.Tx, func(tx *sqlx.Tx) error {
+		insert := fmt.Sprintf("INSERT OR REPLACE INTO %s VALUES (%s)", table, placeholders)
+		if t.modIdx == -1 {
+			insert = fmt.Sprintf("INSERT OR IGNORE INTO %s VALUES (%s)", table, placeholders)
+		}
+		for _, row := range rows {
+			if len(row) != t.columns {
+				return fmt.Errorf("expected %d columns for table %s but got %d", t.columns, table, len(row))
+			}
+			if t.modIdx != -1 {
+				var mod int64
+				query := fmt.Sprintf("SELECT mod FROM %s WHERE id = ?", table)
+				err := tx.Get(&mod, query, row[0])
+				if err != nil && err != sql.ErrNoRows {
+					return err
+				}
+				if err == nil && mod >= toInt64(row[t.modIdx]) {
+					continue
+				}
+			}
+			if _, err := tx.Exec(insert, row...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Remove deletes the rows of a table by id
+func (s syncRepo) Remove(table string, ids []models.ID) error {
+	if _, err := lookupSyncTable(table); err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return ankisql.Tx(s.Tx, func(tx *sqlx.Tx) error {
+		query := fmt.Sprintf("DELETE FROM %s WHERE id IN %s", table, ankisql.InClauseFromIDs(ids))
+		if _, err := tx.Exec(query); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// Count returns the number of rows in a table
+func (s syncRepo) Count(table string) (count int, err error) {
+	if _, err = lookupSyncTable(table); err != nil {
+		return
+	}
+	err = sqlx.Get(ankisql.Reader(s.Conn), &count, fmt.Sprintf("SELECT COUNT() FROM %s", table))
+	return
+}
+
+// ResetUSN marks the pending rows as synced and removes the graves before a full upload
+// since the server collection will be replaced by the local one
+func (s syncRepo) ResetUSN() error {
+	return ankisql.Tx(s.Tx, func(tx *sqlx.Tx) error {
+		for _, table := range []string{"notes", "cards", "revlog"} {
+			if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET usn = 0 WHERE usn = -1", table)); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec("DELETE FROM graves"); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// Vacuum compacts the database file
+func (s syncRepo) Vacuum() error {
+	if _, err := s.Conn.Exec("VACUUM"); err != nil {
+		return err
+	}
+	_, err := s.Conn.Exec("ANALYZE")
+	return err
+}
+
+// scanRow reads the columns of the current row as generic values
+func scanRow(res *sqlx.Rows) (models.SyncRow, error) {
+	row, err := res.SliceScan()
+	if err != nil {
+		return nil, err
+	}
+	for idx, col := range row {
+		// text columns are returned as bytes which would be encoded as base64
+		if b, ok := col.([]byte); ok {
+			row[idx] = string(b)
+		}
+	}
+	return models.SyncRow(row), nil
+}
+
+func toInt64(val interface{}) int64 {
+	switch v := val.(type) {
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case float64:
+		return int64(v)
+	case json.Number:
+		i, _ := v.Int64()
+		return i
+	}
+	return 0
+}
@@ -0,0 +1,161 @@
+package repositories
+
+import (
+	"fmt"
+	"strings"
+
+	ankisql "github.com/aerex/go-anki/api/sql"
+	"github.com/jmoiron/sqlx"
+)
+
+type undoRepo struct {
+	Conn *sqlx.DB
+	Tx   ankisql.TxOpts
+}
+
+// UndoRepo records the changes made to the collection as the statements that revert them
+type UndoRepo interface {
+	Record(cb func() error) (statements []string, err error)
+	Exec(statements []string) error
+	Stamp() (stamp string, err error)
+}
+
+func NewUndoRepository(conn *sqlx.DB) UndoRepo {
+	return undoRepo{
+		Conn: conn,
+		Tx: ankisql.TxOpts{
+			DB: conn,
+		},
+	}
+}
+
+// Record runs cb in a single transaction and returns the statements reverting its changes in the
+// order they must be executed. The changes are logged by temporary triggers that only fire on the
+// connection of the transaction. A call made while recording returns no statements since the
+// changes are part of the outer recording
+func (u undoRepo) Record(cb func() error) (statements []string, err error) {
+	err = ankisql.Batch(u.Conn, func() error {
+		return ankisql.Tx(u.Tx, func(tx *sqlx.Tx) error {
+			var recording int
+			if err := tx.Get(&recording, "SELECT COUNT() FROM temp.sqlite_master WHERE name = 'undo_log'"); err != nil {
+				return err
+			}
+			if recording > 0 {
+				return cb()
+			}
+			triggers, err := armUndoLog(tx)
+			if err != nil {
+				return err
+			}
+			if err := cb(); err != nil {
+				return err
+			}
+			if err := tx.Select(&statements, "SELECT sql FROM temp.undo_log ORDER BY seq DESC"); err != nil {
+				return err
+			}
+			return disarmUndoLog(tx, triggers)
+		})
+	})
+	return
+}
+
+// Exec runs the statements returned by Record
+func (u undoRepo) Exec(statements []string) error {
+	return ankisql.Tx(u.Tx, func(tx *sqlx.Tx) error {
+		for _, statement := range statements {
+			if _, err := tx.Exec(statement); err != nil {
+				return fmt.Errorf("could not revert change %s: %w", statement, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Stamp identifies the state of the collection to detect the changes made since a change was recorded
+func (u undoRepo) Stamp() (stamp string, err error) {
+	query := `SELECT (SELECT mod FROM col) || ':' ||
+		(SELECT IFNULL(MAX(mod), 0) || ':' || COUNT() FROM cards) || ':' ||
+		(SELECT IFNULL(MAX(mod), 0) || ':' || COUNT() FROM notes) || ':' ||
+		(SELECT IFNULL(MAX(id), 0) FROM revlog) || ':' ||
+		(SELECT COUNT() FROM graves)`
+	err = sqlx.Get(ankisql.Reader(u.Conn), &stamp, query)
+	return
+}
+
+// armUndoLog creates the log and the triggers writing to it the statements reverting each
+// insert, update and delete made on the tables of the collection
+func armUndoLog(tx *sqlx.Tx) (triggers []string, err error) {
+	// a replaced row fires the delete triggers
+	if _, err = tx.Exec("PRAGMA recursive_triggers = ON"); err != nil {
+		return
+	}
+	if _, err = tx.Exec("CREATE TEMP TABLE undo_log (seq INTEGER PRIMARY KEY, sql TEXT NOT NULL)"); err != nil {
+		return
+	}
+	var tables []string
+	query := "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'"
+	if err = tx.Select(&tables, query); err != nil {
+		return
+	}
+	for _, table := range tables {
+		var columns []string
+		if err = tx.Select(&columns, "SELECT name FROM pragma_table_info(?)", table); err != nil {
+			return
+		}
+		for event, body := range undoTriggers(table, columns) {
+			name := fmt.Sprintf("undo_%s_%s", table, strings.ToLower(strings.Fields(event)[1]))
+			trigger := fmt.Sprintf("CREATE TEMP TRIGGER %s %s ON main.%s BEGIN %s; END",
+				quoteIdent(name), event, quoteIdent(table), body)
+			if _, err = tx.Exec(trigger); err != nil {
+				return
+			}
+			triggers = append(triggers, name)
+		}
+	}
+	return
+}
+
+func disarmUndoLog(tx *sqlx.Tx, triggers []string) error {
+	for _, name := range triggers {
+		if _, err := tx.Exec("DROP TRIGGER temp." + quoteIdent(name)); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("DROP TABLE temp.undo_log"); err != nil {
+		return err
+	}
+	_, err := tx.Exec("PRAGMA recursive_triggers = OFF")
+	return err
+}
+
+// undoTriggers returns the body of the triggers logging the statement reverting each change by event.
+// An update only restores the columns it changed
+func undoTriggers(table string, columns []string) map[string]string {
+	ident := quoteLiteral(quoteIdent(table))
+	var names, values, changed, restored []string
+	for _, column := range columns {
+		c := quoteIdent(column)
+		names = append(names, c)
+		values = append(values, fmt.Sprintf("quote(OLD.%s)", c))
+		changed = append(changed, fmt.Sprintf("OLD.%s IS NOT NEW.%s", c, c))
+		restored = append(restored, fmt.Sprintf("CASE WHEN OLD.%s IS NOT NEW.%s THEN %s || quote(OLD.%s) ELSE '' END",
+			c, c, quoteLiteral(","+c+"="), c))
+	}
+	insert := fmt.Sprintf("'INSERT INTO ' || %s || %s || quote(OLD.rowid) || ',' || %s || ')'",
+		ident, quoteLiteral("(rowid,"+strings.Join(names, ",")+") VALUES ("), strings.Join(values, " || ',' || "))
+	update := fmt.Sprintf("'UPDATE ' || %s || ' SET ' || substr(%s, 2) || ' WHERE rowid = ' || NEW.rowid",
+		ident, strings.Join(restored, " || "))
+	return map[string]string{
+		"AFTER INSERT":  fmt.Sprintf("INSERT INTO undo_log (sql) VALUES ('DELETE FROM ' || %s || ' WHERE rowid = ' || NEW.rowid)", ident),
+		"AFTER UPDATE":  fmt.Sprintf("INSERT INTO undo_log (sql) SELECT %s WHERE %s", update, strings.Join(changed, " OR ")),
+		"BEFORE DELETE": fmt.Sprintf("INSERT INTO undo_log (sql) VALUES (%s)", insert),
+	}
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
-	"strconv"
 	"strings"
 	"time"
 
@@ -62,8 +61,13 @@ func (c *CardService) Find(qs string) (cards []models.Card, err error) {
 	return
 }
 
-// Create will create a note and attach to new card to the given deck using the provided card type (model)
-func (c *CardService) Create(card models.Card, note models.Note, noteType models.NoteType, tmpl models.CardTemplate, deckName string) error {
+// Create will create a note and attach its new cards to the given deck using the provided card type (model).
+// A card is created for each template whose front is not empty or for each cloze number of a cloze note
+func (c *CardService) Create(note models.Note, noteType models.NoteType, deckName string) (created []models.Card, err error) {
+	ords := cardOrds(noteType, note.Fields)
+	if len(ords) == 0 {
+		return nil, fmt.Errorf("no cloze deletions in %s", noteType.Name)
+	}
 	decks, err := c.deckRepo.Decks()
 	var deckId models.ID
 	for _, deck := range decks {
@@ -73,106 +77,179 @@ func (c *CardService) Create(card models.Card, note models.Note, noteType models
 		}
 	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 	noteId, err := c.fetchNewId()
 	if err != nil {
-		return err
-	}
-	cardId, err := c.fetchNewId()
-	if err != nil {
-		return err
+		return nil, err
 	}
 
 	usn, err := c.colRepo.USN(false)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	note.ID = models.ID(noteId)
 	note.GUID = utils.GUID64()
 	note.ModelID = noteType.ID
 	note.USN = usn
 
-	// 1. Check scm to see if we need to do a full sync (use assert?)
-	note.SortField = utils.StripHTMLMedia(note.Fields[noteType.SortField])
-	csumStr := utils.FieldChecksum(note.Fields[0])
-	csum, parseErr := strconv.ParseUint(csumStr[0:8], 16, 64)
-	if parseErr != nil {
-		return parseErr
-	}
-	note.Checksum = csum
-	card.ID = models.ID(cardId)
-	card.NoteID = note.ID
-
-	if card.DeckID == 0 {
-		if tmpl.DeckOverride != 0 && decks[tmpl.DeckOverride] != nil {
-			card.DeckID = tmpl.DeckOverride
-		} else if deckId != 0 {
-			card.DeckID = deckId
-		}
-	}
-
-	deck, exists := decks[card.DeckID]
-	if !exists {
-		return fmt.Errorf("could not find deck for new card")
+	// 1. Adding fields or templates to a note type changes the schema of the collection
+	// so the next sync will require a full sync
+	if err := c.saveNoteTypeSchema(noteType); err != nil {
+		return nil, err
 	}
-
-	if deck.Dyn {
-		card.DeckID = 1
-	}
-	due, err := c.colRepo.NextDue()
-	dconf, err := c.deckRepo.Conf(deck.ID)
+	note.SortField = utils.StripHTMLMedia(note.Fields[noteType.SortField])
+	csum, err := noteChecksum(note.Fields[0])
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if dconf.New.Order == models.NewCardsDue {
-		card.Due = models.UnixTime(due)
-	} else {
-		// PERF: Some precision lost converting between int64 - float64
-		rand.Seed(int64(due))
-		due = int64(math.Max(float64(due), 1000))
-		card.Due = models.UnixTime(due)
-	}
-
+	note.Checksum = csum
 	now := time.Now().Unix()
-	card.Mod = models.UnixTime(now)
-
-	card.USN = usn
 
 	// 2. Check if note exists
 	fields := utils.JoinFields(note.Fields)
 	err, noteExists := c.noteRepo.Exists(note.ID, note.StringTags, fields)
 	if note.Mod == 0 && noteExists {
-		return fmt.Errorf("Note %d already exists with tags %s and fields %s",
+		return nil, fmt.Errorf("Note %d already exists with tags %s and fields %s",
 			note.ID, note.StringTags, strings.Join(note.Fields, ","))
 	}
 	if note.Mod == 0 {
-		note.Mod = card.Mod
+		note.Mod = models.UnixTime(now)
 	}
 	if createNoteErr := c.noteRepo.Create(note); createNoteErr != nil {
-		return createNoteErr
+		return nil, createNoteErr
 	}
 
-	if createCardErr := c.cardRepo.Create(card); createCardErr != nil {
-		return createCardErr
+	due, err := c.colRepo.NextDue()
+	if err != nil {
+		return nil, err
+	}
+	for _, ord := range ords {
+		card := models.Card{
+			NoteID: note.ID,
+			Ord:    ord,
+			DeckID: deckId,
+			Mod:    models.UnixTime(now),
+			USN:    usn,
+		}
+		if noteType.Type != models.ClozeCardType {
+			for _, tmpl := range noteType.Templates {
+				if tmpl.Ordinal == ord && tmpl.DeckOverride != 0 && decks[tmpl.DeckOverride] != nil {
+					card.DeckID = tmpl.DeckOverride
+				}
+			}
+		}
+		deck, exists := decks[card.DeckID]
+		if !exists {
+			return nil, fmt.Errorf("could not find deck for new card")
+		}
+		// the cards added to a filtered deck go to the default deck
+		if deck.Dyn {
+			card.DeckID = 1
+		}
+		dconf, err := c.deckRepo.Conf(card.DeckID)
+		if err != nil {
+			return nil, err
+		}
+		if dconf.New.Order == models.NewCardsDue {
+			card.Due = models.UnixTime(due)
+		} else {
+			// PERF: Some precision lost converting between int64 - float64
+			rand.Seed(int64(due))
+			card.Due = models.UnixTime(math.Max(float64(due), 1000))
+		}
+		cardId, err := c.fetchNewId()
+		if err != nil {
+			return nil, err
+		}
+		card.ID = models.ID(cardId)
+		if createCardErr := c.cardRepo.Create(card); createCardErr != nil {
+			return nil, createCardErr
+		}
+		created = append(created, card)
+	}
+	return created, c.colRepo.UpdateMod()
+}
+
+// saveNoteTypeSchema adds the fields and the templates of the note type missing from the note type
+// of the collection and marks the schema as modified when it does.
+// The rest of the note type of the collection (ie: css) is kept
+func (c *CardService) saveNoteTypeSchema(noteType models.NoteType) error {
+	noteTypes, err := c.colRepo.NoteTypes()
+	if err != nil {
+		return err
+	}
+	stored, exists := noteTypes[noteType.ID]
+	if !exists {
+		return fmt.Errorf("could not find note type %s", noteType.Name)
+	}
+	changed := false
+	fields := make(map[string]bool, len(stored.Fields))
+	for _, field := range stored.Fields {
+		fields[field.Name] = true
 	}
-	return nil
+	for _, field := range noteType.Fields {
+		if fields[field.Name] {
+			continue
+		}
+		added := *field
+		added.Ordinal = len(stored.Fields)
+		stored.Fields = append(stored.Fields, &added)
+		changed = true
+	}
+	templates := make(map[string]bool, len(stored.Templates))
+	for _, tmpl := range stored.Templates {
+		templates[tmpl.Name] = true
+	}
+	for _, tmpl := range noteType.Templates {
+		if templates[tmpl.Name] {
+			continue
+		}
+		added := *tmpl
+		added.Ordinal = len(stored.Templates)
+		stored.Templates = append(stored.Templates, &added)
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	stored.Mod = models.UnixTime(time.Now().Unix())
+	stored.USN = -1
+	if err := c.colRepo.SaveNoteTypes(noteTypes); err != nil {
+		return err
+	}
+	return c.colRepo.ModSchema()
 }
 
 func (c *CardService) fetchNewId() (models.ID, error) {
 	id := time.Now()
 	// continue to check if new card id exists
-	// if so add 1sec and try again
+	// if so add 1ms and try again
 	for {
 		err, exists := c.cardRepo.Exists(id.UnixMilli())
 		if err != nil {
 			return -1, err
 		}
 		if exists {
-			id.Add(time.Second)
+			id = id.Add(time.Millisecond)
 		} else {
 			break
 		}
 	}
 	return models.ID(id.UnixMilli()), nil
 }
+
+// SetFlag sets the flag of the cards (1-7) or removes it with 0
+func (c *CardService) SetFlag(ids []models.ID, flag int) error {
+	if flag < 0 || flag > 7 {
+		return fmt.Errorf("invalid flag %d, expected a flag between 0 and 7", flag)
+	}
+	usn, err := c.colRepo.USN(false)
+	if err != nil {
+		return err
+	}
+	if err := c.cardRepo.SetFlag(ids, flag, usn); err != nil {
+		return err
+	}
+	return c.colRepo.UpdateMod()
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"testing"
+
+	repos "github.com/aerex/go-anki/api/sql/sqlite/repositories"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateCards(t *testing.T) {
+	tests := []struct {
+		name     string
+		noteType string
+		fields   models.NoteFields
+		ords     []int
+		isError  bool
+	}{
+		{name: "Basic note", noteType: "Basic", fields: models.NoteFields{"go", "went"}, ords: []int{0}},
+		{name: "Reversed note", noteType: "Basic (and reversed card)", fields: models.NoteFields{"eat", "ate"}, ords: []int{0, 1}},
+		{name: "Cloze note with a card per cloze number", noteType: "Cloze", fields: models.NoteFields{"{{c1::run}} {{c3::ran}} {{c1::run}}", ""}, ords: []int{0, 2}},
+		{name: "Cloze note without clozes", noteType: "Cloze", fields: models.NoteFields{"run", ""}, isError: true},
+		{name: "Cloze note with a cloze of several numbers", noteType: "Cloze", fields: models.NoteFields{"{{c1,2::run}} {{c3::{{c4::ran}}}}", ""}, ords: []int{0, 1, 2, 3}},
+		{name: "Cloze note with clozes outside the cloze field", noteType: "Cloze", fields: models.NoteFields{"{{c1::run}}", "{{c2::ran}}"}, ords: []int{0}},
+	}
+
+	for _, tt := range tests {
+		db := setupSyncDB(t)
+		svc := NewCardService(repos.NewCardRepository(db), repos.NewColRepository(db), repos.NewDeckRepository(db), repos.NewNoteRepository(db))
+		noteTypes, err := repos.NewColRepository(db).NoteTypes()
+		assert.NoError(t, err, tt.name)
+		var noteType models.NoteType
+		for _, nt := range noteTypes {
+			if nt.Name == tt.noteType {
+				noteType = *nt
+			}
+		}
+
+		cards, err := svc.Create(models.Note{Fields: tt.fields}, noteType, "Default")
+		if tt.isError {
+			assert.Error(t, err, tt.name)
+			continue
+		}
+		assert.NoError(t, err, tt.name)
+		var ords []int
+		assert.NoError(t, db.Select(&ords, "SELECT ord FROM cards WHERE nid = ? ORDER BY ord", cards[0].NoteID), tt.name)
+		assert.Equal(t, tt.ords, ords, tt.name)
+		var notes int
+		assert.NoError(t, db.Get(&notes, "SELECT COUNT() FROM notes WHERE id = ?", cards[0].NoteID), tt.name)
+		assert.Equal(t, 1, notes, tt.name)
+	}
+}
+
+func TestCreateCardsMergesNoteTypeSchema(t *testing.T) {
+	db := setupSyncDB(t)
+	colRepo := repos.NewColRepository(db)
+	svc := NewCardService(repos.NewCardRepository(db), colRepo, repos.NewDeckRepository(db), repos.NewNoteRepository(db))
+	noteTypes, err := colRepo.NoteTypes()
+	assert.NoError(t, err)
+	var noteType models.NoteType
+	for _, nt := range noteTypes {
+		if nt.Name == "Basic" {
+			noteType = *nt
+		}
+	}
+	css := noteType.CSS
+	before, err := colRepo.Meta()
+	assert.NoError(t, err)
+	// the copy of the caller has a new field and other changes
+	noteType.Fields = append(noteType.Fields, &models.CardField{Name: "Example", Ordinal: 5})
+	noteType.CSS = ".card {}"
+
+	_, err = svc.Create(models.Note{Fields: models.NoteFields{"go", "went", "I went"}}, noteType, "Default")
+
+	assert.NoError(t, err)
+	noteTypes, err = colRepo.NoteTypes()
+	assert.NoError(t, err)
+	stored := noteTypes[noteType.ID]
+	assert.Len(t, stored.Fields, 3)
+	assert.Equal(t, "Example", stored.Fields[2].Name)
+	assert.Equal(t, 2, stored.Fields[2].Ordinal)
+	assert.Equal(t, css, stored.CSS)
+	assert.Equal(t, -1, stored.USN)
+	after, err := colRepo.Meta()
+	assert.NoError(t, err)
+	assert.Greater(t, after.Scm, before.Scm)
+}
+
+func TestCreateCardsInFilteredDeck(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := NewCardService(repos.NewCardRepository(db), repos.NewColRepository(db), repos.NewDeckRepository(db), repos.NewNoteRepository(db))
+	terms := []models.FilterTerm{{Search: "deck:Vocabulary", Limit: 10, Order: models.FilterOrderAdded}}
+	decks := newTestDeckService(db)
+	_, err := decks.CreateFiltered("Filtered", terms, false)
+	assert.NoError(t, err)
+	noteTypes, err := repos.NewColRepository(db).NoteTypes()
+	assert.NoError(t, err)
+	var noteType models.NoteType
+	for _, nt := range noteTypes {
+		if nt.Name == "Basic" {
+			noteType = *nt
+		}
+	}
+
+	cards, err := svc.Create(models.Note{Fields: models.NoteFields{"go", "went"}}, noteType, "Filtered")
+
+	assert.NoError(t, err)
+	assert.Len(t, cards, 1)
+	// the card goes to the default deck
+	assert.Equal(t, models.ID(1), cards[0].DeckID)
+}
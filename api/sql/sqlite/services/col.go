@@ -50,3 +50,14 @@ func (c *ColService) Tags() ([]string, error) {
 func (c *ColService) Conf() (models.CollectionConf, error) {
 	return c.colRepo.Conf()
 }
+
+// Snapshot writes a copy of the collection to path
+func (c *ColService) Snapshot(path string) error {
+	return c.colRepo.CopyTo(path)
+}
+
+// ForceFullSync marks the schema as modified so the next sync replaces the collection
+// on one side instead of merging the changes
+func (c *ColService) ForceFullSync() error {
+	return c.colRepo.ModSchema()
+}
@@ -3,23 +3,43 @@ package services
 import (
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 
 	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 
+	ankisql "github.com/aerex/go-anki/api/sql"
+	"github.com/aerex/go-anki/api/sql/sqlite/queries"
 	repos "github.com/aerex/go-anki/api/sql/sqlite/repositories"
+	"github.com/aerex/go-anki/internal/utils"
 	"github.com/aerex/go-anki/pkg/models"
 )
 
+const (
+	// The id of the Default deck that cannot be deleted or moved
+	defaultDeckID = models.ID(1)
+	// The filtered deck of the custom study sessions
+	customStudyDeck = "Custom Study Session"
+	// The number of cards gathered by a custom study session
+	customStudyLimit = 99999
+)
+
 type DeckService struct {
-	deckRepo repos.DeckRepo
-	colRepo  repos.ColRepo
+	deckRepo  repos.DeckRepo
+	colRepo   repos.ColRepo
+	cardRepo  repos.CardRepo
+	graveRepo repos.GraveRepo
+	noteRepo  repos.NoteRepo
 }
 
-func NewDeckService(d repos.DeckRepo, c repos.ColRepo) DeckService {
+func NewDeckService(d repos.DeckRepo, c repos.ColRepo, card repos.CardRepo, grave repos.GraveRepo, note repos.NoteRepo) DeckService {
 	return DeckService{
-		deckRepo: d,
-		colRepo:  c,
+		deckRepo:  d,
+		colRepo:   c,
+		cardRepo:  card,
+		graveRepo: grave,
+		noteRepo:  note,
 	}
 }
 
@@ -75,6 +95,441 @@ func (d *DeckService) Rename(name, newName string) error {
 	return d.Save(&deck)
 }
 
+// Delete removes a deck and its children and records the deletions for the next sync.
+// The cards of the decks are moved to the moveTo deck when it is set. Otherwise the ids of
+// the cards are returned to be deleted with their notes.
+// The cards of the filtered decks return to their home deck
+func (d *DeckService) Delete(name string, moveTo string) (deckIDs []models.ID, cardIDs []models.ID, err error) {
+	decks, err := d.deckRepo.Decks()
+	if err != nil {
+		return
+	}
+	deck, err := findDeck(decks, name)
+	if err != nil {
+		return
+	}
+	if deck.ID == defaultDeckID {
+		return nil, nil, fmt.Errorf("the Default deck cannot be deleted")
+	}
+	children, err := d.deckRepo.ChildrenDeckIDs(deck.ID)
+	if err != nil {
+		return
+	}
+	deckIDs = append([]models.ID{deck.ID}, children...)
+	usn, err := d.colRepo.USN(false)
+	if err != nil {
+		return
+	}
+
+	var filtered, normal []models.ID
+	for _, id := range deckIDs {
+		if bool(decks[id].Dyn) {
+			filtered = append(filtered, id)
+		} else {
+			normal = append(normal, id)
+		}
+	}
+	if len(filtered) > 0 {
+		if err = d.cardRepo.EmptyDyn("did IN "+ankisql.InClauseFromIDs(filtered), usn); err != nil {
+			return
+		}
+	}
+	if moveTo != "" {
+		target, err := findDeck(decks, moveTo)
+		if err != nil {
+			return nil, nil, err
+		}
+		if slices.Contains(deckIDs, target.ID) {
+			return nil, nil, fmt.Errorf("cannot move the cards to %s which is deleted", target.Name)
+		}
+		if bool(target.Dyn) {
+			return nil, nil, fmt.Errorf("cannot move the cards to filtered deck %s", target.Name)
+		}
+		if err = d.cardRepo.MoveDecks(normal, target.ID, usn); err != nil {
+			return nil, nil, err
+		}
+	} else if len(normal) > 0 {
+		ids := ankisql.InClauseFromIDs(normal)
+		cards, err := d.cardRepo.List("c.did IN "+ids+" OR c.odid IN "+ids, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, card := range cards {
+			cardIDs = append(cardIDs, card.ID)
+		}
+	}
+
+	for _, id := range deckIDs {
+		delete(decks, id)
+	}
+	if err = d.deckRepo.SaveAll(decks); err != nil {
+		return
+	}
+	if err = d.graveRepo.Add(deckIDs, models.GraveTypeDeck, usn); err != nil {
+		return
+	}
+	conf, err := d.colRepo.Conf()
+	if err != nil {
+		return
+	}
+	if slices.Contains(deckIDs, conf.CurrentDeck) {
+		if err = d.colRepo.SaveCurrentDeck(defaultDeckID); err != nil {
+			return
+		}
+	}
+	return deckIDs, cardIDs, d.colRepo.UpdateMod()
+}
+
+// Move moves a deck and its children under a parent deck or to the top level when the parent is empty.
+// The missing parents are created and the new name of the deck is returned
+func (d *DeckService) Move(name string, parent string) (newName string, err error) {
+	decks, err := d.deckRepo.Decks()
+	if err != nil {
+		return
+	}
+	deck, err := findDeck(decks, name)
+	if err != nil {
+		return
+	}
+	if deck.ID == defaultDeckID {
+		return "", fmt.Errorf("the Default deck cannot be moved")
+	}
+	parts := strings.Split(deck.Name, "::")
+	newName = parts[len(parts)-1]
+	if parent != "" {
+		if utils.MissingParents(parent) {
+			return "", fmt.Errorf("invalid deck name %s", parent)
+		}
+		lowerParent, lowerName := strings.ToLower(parent), strings.ToLower(deck.Name)
+		if lowerParent == lowerName || strings.HasPrefix(lowerParent, lowerName+"::") {
+			return "", fmt.Errorf("cannot move %s under itself", deck.Name)
+		}
+		newName = parent + "::" + newName
+	}
+	if existing, err := findDeck(decks, newName); err == nil {
+		if existing.ID == deck.ID {
+			return deck.Name, nil
+		}
+		return "", fmt.Errorf("deck %s already exists", existing.Name)
+	}
+	usn, err := d.colRepo.USN(false)
+	if err != nil {
+		return
+	}
+	// the parents are resolved with the decks before the move
+	// so the moved deck is never its own parent
+	newName = d.deckRepo.EnsureParentsExist(decks, newName, usn)
+	for _, parentDeck := range decks {
+		if strings.HasPrefix(strings.ToLower(newName), strings.ToLower(parentDeck.Name)+"::") && bool(parentDeck.Dyn) {
+			return "", fmt.Errorf("cannot move %s under filtered deck %s", deck.Name, parentDeck.Name)
+		}
+	}
+
+	mod := models.UnixTime(time.Now().Unix())
+	oldName := deck.Name
+	for _, dk := range decks {
+		if dk.Name == oldName || strings.HasPrefix(dk.Name, oldName+"::") {
+			dk.Name = newName + strings.TrimPrefix(dk.Name, oldName)
+			dk.Mod = &mod
+			dk.USN = usn
+		}
+	}
+	if err = d.deckRepo.SaveAll(decks); err != nil {
+		return
+	}
+	return newName, d.colRepo.UpdateMod()
+}
+
+// CreateFiltered creates a filtered deck and moves the cards matching its terms into it.
+// The number of gathered cards is returned
+func (d *DeckService) CreateFiltered(name string, terms []models.FilterTerm, resched bool) (count int, err error) {
+	decks, err := d.deckRepo.Decks()
+	if err != nil {
+		return
+	}
+	usn, err := d.colRepo.USN(false)
+	if err != nil {
+		return
+	}
+	if _, count, err = d.createFiltered(decks, name, terms, resched, usn); err != nil {
+		return
+	}
+	return count, d.colRepo.UpdateMod()
+}
+
+func (d *DeckService) createFiltered(decks models.Decks, name string, terms []models.FilterTerm, resched bool, usn int) (deck *models.Deck, count int, err error) {
+	if len(terms) == 0 {
+		return nil, 0, fmt.Errorf("a filtered deck needs a search")
+	}
+	if utils.MissingParents(name) {
+		return nil, 0, fmt.Errorf("invalid deck name %s", name)
+	}
+	if existing, err := findDeck(decks, name); err == nil {
+		return nil, 0, fmt.Errorf("deck %s already exists", existing.Name)
+	}
+	name = d.deckRepo.EnsureParentsExist(decks, name, usn)
+	for _, parent := range decks {
+		if strings.HasPrefix(strings.ToLower(name), strings.ToLower(parent.Name)+"::") && bool(parent.Dyn) {
+			return nil, 0, fmt.Errorf("cannot create %s under filtered deck %s", name, parent.Name)
+		}
+	}
+	mod := models.UnixTime(time.Now().Unix())
+	deck = &models.Deck{
+		ID:      models.ID(d.fetchNewId(decks).Unix()),
+		Name:    name,
+		Dyn:     true,
+		Terms:   terms,
+		Resched: resched,
+		Mod:     &mod,
+		USN:     usn,
+	}
+	decks[deck.ID] = deck
+	if err = d.deckRepo.SaveAll(decks); err != nil {
+		return
+	}
+	count, err = d.fill(deck, usn)
+	return
+}
+
+// Rebuild returns the cards of a filtered deck to their home deck and gathers the cards
+// matching its terms again. The number of gathered cards is returned
+func (d *DeckService) Rebuild(name string) (count int, err error) {
+	deck, usn, err := d.findFiltered(name)
+	if err != nil {
+		return
+	}
+	if err = d.cardRepo.EmptyDyn(fmt.Sprintf("did = %d", deck.ID), usn); err != nil {
+		return
+	}
+	if count, err = d.fill(deck, usn); err != nil {
+		return
+	}
+	return count, d.colRepo.UpdateMod()
+}
+
+// Empty returns the cards of a filtered deck to their home deck
+func (d *DeckService) Empty(name string) error {
+	deck, usn, err := d.findFiltered(name)
+	if err != nil {
+		return err
+	}
+	if err = d.cardRepo.EmptyDyn(fmt.Sprintf("did = %d", deck.ID), usn); err != nil {
+		return err
+	}
+	return d.colRepo.UpdateMod()
+}
+
+func (d *DeckService) findFiltered(name string) (deck *models.Deck, usn int, err error) {
+	decks, err := d.deckRepo.Decks()
+	if err != nil {
+		return
+	}
+	if deck, err = findDeck(decks, name); err != nil {
+		return
+	}
+	if !bool(deck.Dyn) {
+		return nil, 0, fmt.Errorf("%s is not a filtered deck", deck.Name)
+	}
+	usn, err = d.colRepo.USN(false)
+	return
+}
+
+// fill moves the cards matching the terms of a filtered deck into it
+func (d *DeckService) fill(deck *models.Deck, usn int) (count int, err error) {
+	for _, term := range deck.Terms {
+		var cls string
+		var args []string
+		if term.Search != "" {
+			bld := queries.NewBuilder(term.Search, d.colRepo, d.deckRepo, d.noteRepo)
+			if cls, args, err = bld.Query(); err != nil {
+				return
+			}
+		}
+		moved, err := d.cardRepo.MoveToFiltered(cls, args, term.Order, term.Limit, deck.ID, deck.Resched, usn)
+		if err != nil {
+			return 0, err
+		}
+		count += moved
+	}
+	return
+}
+
+// CustomStudy gathers the cards of a custom study session of a deck in the Custom Study Session
+// filtered deck which is selected as the current deck. The session replaces the previous one.
+// The limits of the deck are extended with the scheduler instead
+func (d *DeckService) CustomStudy(name string, study models.CustomStudy) (count int, err error) {
+	decks, err := d.deckRepo.Decks()
+	if err != nil {
+		return
+	}
+	deck, err := findDeck(decks, name)
+	if err != nil {
+		return
+	}
+	if bool(deck.Dyn) {
+		return 0, fmt.Errorf("custom study is not available for filtered deck %s", deck.Name)
+	}
+	term, resched, err := customStudyTerm(deck.Name, study)
+	if err != nil {
+		return
+	}
+	usn, err := d.colRepo.USN(false)
+	if err != nil {
+		return
+	}
+
+	session, err := findDeck(decks, customStudyDeck)
+	if err == nil {
+		if !bool(session.Dyn) {
+			return 0, fmt.Errorf("rename the existing %s deck first", session.Name)
+		}
+		if err = d.cardRepo.EmptyDyn(fmt.Sprintf("did = %d", session.ID), usn); err != nil {
+			return
+		}
+		mod := models.UnixTime(time.Now().Unix())
+		session.Terms = []models.FilterTerm{term}
+		session.Resched = resched
+		session.Mod = &mod
+		session.USN = usn
+		if err = d.deckRepo.SaveAll(decks); err != nil {
+			return
+		}
+		count, err = d.fill(session, usn)
+	} else {
+		session, count, err = d.createFiltered(decks, customStudyDeck, []models.FilterTerm{term}, resched, usn)
+	}
+	if err != nil {
+		return
+	}
+	if count == 0 {
+		return 0, fmt.Errorf("no cards matched the criteria")
+	}
+	if err = d.selectDeck(decks, session); err != nil {
+		return
+	}
+	return count, d.colRepo.UpdateMod()
+}
+
+// customStudyTerm returns the search of a custom study session like the custom study dialog of anki
+// and whether the answers reschedule the cards
+func customStudyTerm(name string, study models.CustomStudy) (term models.FilterTerm, resched bool, err error) {
+	if study.Value <= 0 && study.Type != models.CustomStudyTags {
+		return term, false, fmt.Errorf("the number of days must be greater than 0")
+	}
+	term.Limit = customStudyLimit
+	var search string
+	switch study.Type {
+	case models.CustomStudyForgotten:
+		search = fmt.Sprintf("rated:%d:1", study.Value)
+		term.Order = models.FilterOrderRandom
+	case models.CustomStudyReviewAhead:
+		search = fmt.Sprintf("prop:due<=%d", study.Value)
+		term.Order = models.FilterOrderDue
+		resched = true
+	case models.CustomStudyPreviewNew:
+		search = fmt.Sprintf("is:new added:%d", study.Value)
+		term.Order = models.FilterOrderOldestSeen
+	case models.CustomStudyTags:
+		if study.Limit <= 0 {
+			return term, false, fmt.Errorf("the limit must be greater than 0")
+		}
+		term.Limit = study.Limit
+		resched = true
+		switch study.CardState {
+		case "new":
+			search = "is:new"
+			term.Order = models.FilterOrderAdded
+		case "due":
+			search = "is:due"
+			term.Order = models.FilterOrderDue
+		case "review":
+			search = "-is:new"
+			term.Order = models.FilterOrderRandom
+		case "", "all":
+			term.Order = models.FilterOrderRandom
+			resched = false
+		default:
+			return term, false, fmt.Errorf("unknown card state %s", study.CardState)
+		}
+		var include, exclude []string
+		for _, tag := range study.Tags {
+			if strings.HasPrefix(tag, "-") {
+				exclude = append(exclude, "-tag:"+strings.TrimPrefix(tag, "-"))
+			} else {
+				include = append(include, "tag:"+tag)
+			}
+		}
+		if len(include) > 0 {
+			search += " (" + strings.Join(include, " or ") + ")"
+		}
+		if len(exclude) > 0 {
+			search += " " + strings.Join(exclude, " ")
+		}
+	default:
+		return term, false, fmt.Errorf("unknown custom study %d", study.Type)
+	}
+	term.Search = strings.TrimSpace(fmt.Sprintf("deck:\"%s\" %s", name, search))
+	return
+}
+
+// Find returns the deck with the name ignoring the case
+func (d *DeckService) Find(name string) (models.Deck, error) {
+	decks, err := d.deckRepo.Decks()
+	if err != nil {
+		return models.Deck{}, err
+	}
+	deck, err := findDeck(decks, name)
+	if err != nil {
+		return models.Deck{}, err
+	}
+	return *deck, nil
+}
+
+// Select makes the deck the current deck and studies its cards with the cards of its children
+func (d *DeckService) Select(name string) (models.Deck, error) {
+	decks, err := d.deckRepo.Decks()
+	if err != nil {
+		return models.Deck{}, err
+	}
+	deck, err := findDeck(decks, name)
+	if err != nil {
+		return models.Deck{}, err
+	}
+	if err := d.selectDeck(decks, deck); err != nil {
+		return models.Deck{}, err
+	}
+	return *deck, nil
+}
+
+// selectDeck sets the current deck and the active decks, the deck followed by its children by name
+func (d *DeckService) selectDeck(decks models.Decks, deck *models.Deck) error {
+	var children []*models.Deck
+	for _, dk := range decks {
+		if strings.HasPrefix(dk.Name, deck.Name+"::") {
+			children = append(children, dk)
+		}
+	}
+	sort.Sort(repos.ByDeckName(children))
+	active := []models.ID{deck.ID}
+	for _, child := range children {
+		active = append(active, child.ID)
+	}
+	if err := d.colRepo.SaveCurrentDeck(deck.ID); err != nil {
+		return err
+	}
+	return d.colRepo.SaveActiveDecks(active)
+}
+
+// findDeck returns the deck with the name ignoring the case like anki
+func findDeck(decks models.Decks, name string) (*models.Deck, error) {
+	for _, deck := range decks {
+		if strings.EqualFold(deck.Name, name) {
+			return deck, nil
+		}
+	}
+	return nil, fmt.Errorf("could not find Deck %s", name)
+}
+
 func (d *DeckService) Confs() (models.DeckConfigs, error) {
 	return d.deckRepo.Confs()
 }
@@ -95,5 +550,5 @@ func (d *DeckService) Save(deck *models.Deck) error {
 		return err
 	}
 
-	return nil
+	return d.colRepo.UpdateMod()
 }
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"testing"
+
+	repos "github.com/aerex/go-anki/api/sql/sqlite/repositories"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	vocabularyDeckID = models.ID(1512971773018)
+	verbsDeckID      = models.ID(1523223263377)
+)
+
+func newTestDeckService(db *sqlx.DB) DeckService {
+	return NewDeckService(repos.NewDeckRepository(db), repos.NewColRepository(db),
+		repos.NewCardRepository(db), repos.NewGraveRepository(db), repos.NewNoteRepository(db))
+}
+
+func deckNames(t *testing.T, db *sqlx.DB) (names []string) {
+	decks, err := repos.NewDeckRepository(db).Decks()
+	assert.NoError(t, err)
+	for _, deck := range decks {
+		names = append(names, deck.Name)
+	}
+	return
+}
+
+func TestMoveDeck(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestDeckService(db)
+
+	name, err := svc.Move("Vocabulary", "Japanese::Words")
+	assert.NoError(t, err)
+	assert.Equal(t, "Japanese::Words::Vocabulary", name)
+	assert.Contains(t, deckNames(t, db), "Japanese::Words")
+	name, err = svc.Move("verbs (kanji)", "japanese::words::vocabulary")
+	assert.NoError(t, err)
+	// the names of the existing parents are kept
+	assert.Equal(t, "Japanese::Words::Vocabulary::Verbs (Kanji)", name)
+
+	// the children follow their parent
+	name, err = svc.Move("Japanese::Words::Vocabulary", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "Vocabulary", name)
+	decks, err := repos.NewDeckRepository(db).Decks()
+	assert.NoError(t, err)
+	assert.Equal(t, "Vocabulary::Verbs (Kanji)", decks[verbsDeckID].Name)
+	assert.Equal(t, -1, decks[verbsDeckID].USN)
+}
+
+func TestMoveDeckInvalid(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestDeckService(db)
+	_, err := svc.Move("Vocabulary", "Sentences")
+	assert.NoError(t, err)
+	assert.NoError(t, svc.Create(&models.Deck{Name: "Vocabulary"}))
+
+	_, err = svc.Move("Default", "Sentences")
+	assert.EqualError(t, err, "the Default deck cannot be moved")
+	_, err = svc.Move("Sentences", "Sentences::Vocabulary")
+	assert.EqualError(t, err, "cannot move Sentences under itself")
+	_, err = svc.Move("Missing", "Sentences")
+	assert.EqualError(t, err, "could not find Deck Missing")
+	_, err = svc.Move("Sentences::Vocabulary", "")
+	assert.EqualError(t, err, "deck Vocabulary already exists")
+}
+
+func TestDeleteDeck(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestDeckService(db)
+	_, err := svc.Move("Verbs (Kanji)", "Vocabulary")
+	assert.NoError(t, err)
+
+	deckIDs, cardIDs, err := svc.Delete("Vocabulary", "")
+
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []models.ID{vocabularyDeckID, verbsDeckID}, deckIDs)
+	assert.Len(t, cardIDs, 111)
+	decks, err := repos.NewDeckRepository(db).Decks()
+	assert.NoError(t, err)
+	assert.NotContains(t, decks, vocabularyDeckID)
+	assert.NotContains(t, decks, verbsDeckID)
+	var graves int
+	assert.NoError(t, db.Get(&graves, "SELECT COUNT() FROM graves WHERE type = ?", models.GraveTypeDeck))
+	assert.Equal(t, 2, graves)
+}
+
+func TestDeleteDeckKeepCards(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestDeckService(db)
+
+	_, cardIDs, err := svc.Delete("Sentences", "Vocabulary")
+
+	assert.NoError(t, err)
+	assert.Empty(t, cardIDs)
+	var count int
+	assert.NoError(t, db.Get(&count, "SELECT COUNT() FROM cards WHERE did = ?", vocabularyDeckID))
+	assert.Equal(t, 107+94, count)
+	// the current deck was deleted
+	conf, err := repos.NewColRepository(db).Conf()
+	assert.NoError(t, err)
+	assert.Equal(t, models.ID(1), conf.CurrentDeck)
+}
+
+func TestDeleteDeckInvalid(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestDeckService(db)
+
+	_, _, err := svc.Delete("Default", "")
+	assert.EqualError(t, err, "the Default deck cannot be deleted")
+	_, _, err = svc.Delete("Sentences", "sentences")
+	assert.EqualError(t, err, "cannot move the cards to Sentences which is deleted")
+	_, _, err = svc.Delete("Sentences", "Missing")
+	assert.EqualError(t, err, "could not find Deck Missing")
+}
+
+func TestCreateFilteredDeck(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestDeckService(db)
+	terms := []models.FilterTerm{{Search: "deck:Vocabulary", Limit: 10, Order: models.FilterOrderAdded}}
+
+	count, err := svc.CreateFiltered("Filtered::Vocabulary", terms, false)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 10, count)
+	decks, err := repos.NewDeckRepository(db).Decks()
+	assert.NoError(t, err)
+	deck, err := findDeck(decks, "Filtered::Vocabulary")
+	assert.NoError(t, err)
+	assert.True(t, bool(deck.Dyn))
+	assert.Equal(t, terms, deck.Terms)
+	assert.Contains(t, deckNames(t, db), "Filtered")
+	var cards []models.Card
+	assert.NoError(t, db.Select(&cards, "SELECT * FROM cards WHERE did = ? ORDER BY due", deck.ID))
+	assert.Len(t, cards, 10)
+	for idx, card := range cards {
+		assert.Equal(t, vocabularyDeckID, card.OriginalDeckID)
+		// the cards are previewed without rescheduling
+		assert.Equal(t, models.CardQueueReview, card.Queue)
+		assert.Equal(t, models.UnixTime(-100000+idx), card.Due)
+	}
+}
+
+func TestRebuildFilteredDeck(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestDeckService(db)
+	terms := []models.FilterTerm{{Search: "is:due tag:verb -is:learn", Limit: 100, Order: models.FilterOrderDue}}
+	var due int
+	assert.NoError(t, db.Get(&due, "SELECT SUM(due) FROM cards"))
+	count, err := svc.CreateFiltered("Verbs", terms, true)
+	assert.NoError(t, err)
+	assert.Greater(t, count, 0)
+
+	// the cards in a filtered deck are not gathered twice
+	other, err := svc.CreateFiltered("Other", terms, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, other)
+
+	rebuilt, err := svc.Rebuild("verbs")
+	assert.NoError(t, err)
+	assert.Equal(t, count, rebuilt)
+
+	assert.NoError(t, svc.Empty("Verbs"))
+	var moved, restored int
+	assert.NoError(t, db.Get(&moved, "SELECT COUNT() FROM cards WHERE odid != 0"))
+	assert.Equal(t, 0, moved)
+	assert.NoError(t, db.Get(&restored, "SELECT SUM(due) FROM cards"))
+	assert.Equal(t, due, restored)
+}
+
+func TestFilteredDeckInvalid(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestDeckService(db)
+	terms := []models.FilterTerm{{Search: "is:new", Limit: 10, Order: models.FilterOrderRandom}}
+
+	_, err := svc.CreateFiltered("sentences", terms, false)
+	assert.EqualError(t, err, "deck Sentences already exists")
+	_, err = svc.CreateFiltered("New", nil, false)
+	assert.EqualError(t, err, "a filtered deck needs a search")
+	_, err = svc.CreateFiltered("New", terms, false)
+	assert.NoError(t, err)
+	_, err = svc.CreateFiltered("New::Child", terms, false)
+	assert.EqualError(t, err, "cannot create New::Child under filtered deck New")
+	_, err = svc.Rebuild("Sentences")
+	assert.EqualError(t, err, "Sentences is not a filtered deck")
+	assert.EqualError(t, svc.Empty("Missing"), "could not find Deck Missing")
+}
+
+func TestCustomStudy(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestDeckService(db)
+
+	count, err := svc.CustomStudy("vocabulary", models.CustomStudy{Type: models.CustomStudyReviewAhead, Value: 3650})
+	assert.NoError(t, err)
+	assert.Equal(t, 107, count)
+	session, err := svc.Find("Custom Study Session")
+	assert.NoError(t, err)
+	assert.True(t, session.Resched)
+	conf, err := repos.NewColRepository(db).Conf()
+	assert.NoError(t, err)
+	assert.Equal(t, session.ID, conf.CurrentDeck)
+
+	// the new session replaces the previous one
+	count, err = svc.CustomStudy("Verbs (Kanji)", models.CustomStudy{Type: models.CustomStudyTags, CardState: "all", Limit: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	var moved int
+	assert.NoError(t, db.Get(&moved, "SELECT COUNT() FROM cards WHERE odid != 0"))
+	assert.Equal(t, 2, moved)
+	session, err = svc.Find("Custom Study Session")
+	assert.NoError(t, err)
+	assert.False(t, session.Resched)
+	assert.Equal(t, []models.FilterTerm{{Search: `deck:"Verbs (Kanji)"`, Limit: 2, Order: models.FilterOrderRandom}}, session.Terms)
+
+	_, err = svc.CustomStudy("Vocabulary", models.CustomStudy{Type: models.CustomStudyForgotten, Value: 1})
+	assert.EqualError(t, err, "no cards matched the criteria")
+	_, err = svc.CustomStudy("Custom Study Session", models.CustomStudy{Type: models.CustomStudyForgotten, Value: 1})
+	assert.EqualError(t, err, "custom study is not available for filtered deck Custom Study Session")
+}
+
+func TestCustomStudyTerm(t *testing.T) {
+	tests := []struct {
+		study   models.CustomStudy
+		term    models.FilterTerm
+		resched bool
+	}{
+		{
+			study: models.CustomStudy{Type: models.CustomStudyForgotten, Value: 3},
+			term:  models.FilterTerm{Search: `deck:"A::B" rated:3:1`, Limit: customStudyLimit, Order: models.FilterOrderRandom},
+		},
+		{
+			study:   models.CustomStudy{Type: models.CustomStudyReviewAhead, Value: 2},
+			term:    models.FilterTerm{Search: `deck:"A::B" prop:due<=2`, Limit: customStudyLimit, Order: models.FilterOrderDue},
+			resched: true,
+		},
+		{
+			study: models.CustomStudy{Type: models.CustomStudyPreviewNew, Value: 1},
+			term:  models.FilterTerm{Search: `deck:"A::B" is:new added:1`, Limit: customStudyLimit, Order: models.FilterOrderOldestSeen},
+		},
+		{
+			study:   models.CustomStudy{Type: models.CustomStudyTags, Tags: []string{"verbs", "nouns", "-hard"}, CardState: "new", Limit: 20},
+			term:    models.FilterTerm{Search: `deck:"A::B" is:new (tag:verbs or tag:nouns) -tag:hard`, Limit: 20, Order: models.FilterOrderAdded},
+			resched: true,
+		},
+	}
+	for _, test := range tests {
+		term, resched, err := customStudyTerm("A::B", test.study)
+		assert.NoError(t, err)
+		assert.Equal(t, test.term, term)
+		assert.Equal(t, test.resched, resched)
+	}
+	_, _, err := customStudyTerm("A", models.CustomStudy{Type: models.CustomStudyTags, CardState: "old", Limit: 1})
+	assert.EqualError(t, err, "unknown card state old")
+}
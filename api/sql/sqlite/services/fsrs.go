@@ -0,0 +1,97 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	ankisql "github.com/aerex/go-anki/api/sql"
+	repos "github.com/aerex/go-anki/api/sql/sqlite/repositories"
+	"github.com/aerex/go-anki/api/sql/sqlite/services/sched"
+	"github.com/aerex/go-anki/api/sql/sqlite/services/sched/fsrs"
+	"github.com/aerex/go-anki/pkg/models"
+)
+
+type FSRSService struct {
+	deckRepo   repos.DeckRepo
+	colRepo    repos.ColRepo
+	revLogRepo repos.RevLogRepo
+}
+
+func NewFSRSService(d repos.DeckRepo, c repos.ColRepo, r repos.RevLogRepo) FSRSService {
+	return FSRSService{
+		deckRepo:   d,
+		colRepo:    c,
+		revLogRepo: r,
+	}
+}
+
+// Optimize fits the parameters of FSRS to the reviews of a deck and its children and saves them in the
+// options of the deck. Without a deck name the reviews of the collection are used and all the options are saved
+func (f *FSRSService) Optimize(deckName string) (models.FSRSOptimization, error) {
+	var optimization models.FSRSOptimization
+	decks, err := f.deckRepo.Decks()
+	if err != nil {
+		return optimization, err
+	}
+	confs, err := f.deckRepo.Confs()
+	if err != nil {
+		return optimization, err
+	}
+	// the options receiving the parameters, all the options are saved
+	selected := confs
+	cardClause := "1"
+	if deckName != "" {
+		deck, err := findDeck(decks, deckName)
+		if err != nil {
+			return optimization, err
+		}
+		if bool(deck.Dyn) {
+			return optimization, fmt.Errorf("filtered deck %s does not have options", deck.Name)
+		}
+		conf, exists := confs[models.ID(deck.Conf)]
+		if !exists {
+			return optimization, fmt.Errorf("could not find the options of deck %s", deck.Name)
+		}
+		selected = models.DeckConfigs{conf.ID: conf}
+		children, err := f.deckRepo.ChildrenDeckIDs(deck.ID)
+		if err != nil {
+			return optimization, err
+		}
+		inClause := ankisql.InClauseFromIDs(append([]models.ID{deck.ID}, children...))
+		cardClause = fmt.Sprintf("(c.did IN %s OR c.odid IN %s)", inClause, inClause)
+	}
+	logs, err := f.revLogRepo.History(cardClause)
+	if err != nil {
+		return optimization, err
+	}
+	_, dayCutoff, err := sched.Today(f.colRepo, false)
+	if err != nil {
+		return optimization, err
+	}
+	result, err := fsrs.Optimize(fsrs.Histories(logs, dayCutoff))
+	if err != nil {
+		return optimization, err
+	}
+	optimization.Parameters = result.Parameters
+	optimization.Reviews = result.Reviews
+	optimization.DefaultLoss = result.DefaultLoss
+	optimization.Loss = result.Loss
+
+	usn, err := f.colRepo.USN(false)
+	if err != nil {
+		return optimization, err
+	}
+	mod := models.UnixTime(time.Now().Unix())
+	for _, conf := range selected {
+		conf.FSRSWeights = result.Parameters
+		conf.Mod = mod
+		conf.USN = usn
+		optimization.Configs = append(optimization.Configs, conf.Name)
+	}
+	sort.Strings(optimization.Configs)
+	if err := f.deckRepo.SaveConfs(confs); err != nil {
+		return optimization, err
+	}
+	return optimization, f.colRepo.UpdateMod()
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"testing"
+
+	repos "github.com/aerex/go-anki/api/sql/sqlite/repositories"
+	"github.com/aerex/go-anki/api/sql/sqlite/services/sched/fsrs"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestFSRSService(db *sqlx.DB) FSRSService {
+	return NewFSRSService(repos.NewDeckRepository(db), repos.NewColRepository(db), repos.NewRevLogRepository(db))
+}
+
+func TestOptimizeFSRS(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestFSRSService(db)
+
+	result, err := svc.Optimize("")
+	assert.NoError(t, err)
+	assert.Len(t, result.Parameters, len(fsrs.DefaultParameters))
+	assert.GreaterOrEqual(t, result.Reviews, fsrs.MinReviews)
+	assert.Less(t, result.Loss, result.DefaultLoss)
+	confs, err := repos.NewDeckRepository(db).Confs()
+	assert.NoError(t, err)
+	for _, conf := range confs {
+		assert.Equal(t, result.Parameters, conf.FSRSWeights)
+		assert.Equal(t, -1, conf.USN)
+		assert.Contains(t, result.Configs, conf.Name)
+	}
+
+	// the same reviews give the same parameters
+	again, err := svc.Optimize("")
+	assert.NoError(t, err)
+	assert.Equal(t, result.Parameters, again.Parameters)
+}
+
+func TestOptimizeFSRSDeck(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestFSRSService(db)
+	deckRepo := repos.NewDeckRepository(db)
+	confs, err := deckRepo.Confs()
+	assert.NoError(t, err)
+	other := *confs[1]
+	other.ID = 2
+	other.Name = "Other"
+	confs[other.ID] = &other
+	assert.NoError(t, deckRepo.SaveConfs(confs))
+
+	result, err := svc.Optimize("Noun (Hirugana)")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Default"}, result.Configs)
+	confs, err = deckRepo.Confs()
+	assert.NoError(t, err)
+	// the other options are kept without the parameters
+	assert.Len(t, confs, 2)
+	assert.Equal(t, result.Parameters, confs[1].FSRSWeights)
+	assert.Equal(t, "Other", confs[2].Name)
+	assert.Equal(t, other.FSRSWeights, confs[2].FSRSWeights)
+}
+
+func TestOptimizeFSRSInvalid(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestFSRSService(db)
+	_, err := svc.Optimize("Unknown")
+	assert.Error(t, err)
+	// a deck without enough reviews
+	_, err = svc.Optimize("Investment Terms")
+	assert.ErrorIs(t, err, fsrs.ErrNotEnoughReviews)
+}
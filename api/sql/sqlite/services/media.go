@@ -0,0 +1,76 @@
+package services
+
+import (
+	"strings"
+
+	repos "github.com/aerex/go-anki/api/sql/sqlite/repositories"
+	"github.com/aerex/go-anki/internal/utils"
+	"github.com/aerex/go-anki/pkg/media"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/aerex/go-anki/pkg/template"
+)
+
+type MediaService struct {
+	noteRepo repos.NoteRepo
+}
+
+func NewMediaService(n repos.NoteRepo) MediaService {
+	return MediaService{
+		noteRepo: n,
+	}
+}
+
+// References returns the media files referenced by the notes of the collection
+func (m *MediaService) References() (refs []string, err error) {
+	fields, err := m.noteRepo.FieldsWithMedia()
+	if err != nil {
+		return
+	}
+	for _, flds := range fields {
+		refs = append(refs, utils.MediaReferences(flds)...)
+	}
+	return
+}
+
+// LatexImages returns the images of the LaTeX of the notes of the collection. The images are only
+// in the media folder once they are rendered
+func (m *MediaService) LatexImages() (images map[string]bool, err error) {
+	fields, err := m.noteRepo.FieldsWithMedia()
+	if err != nil {
+		return
+	}
+	images = make(map[string]bool)
+	for _, flds := range fields {
+		for _, field := range strings.Split(flds, "\x1f") {
+			for _, latex := range template.ExtractLatex(field) {
+				images[latex.File] = true
+			}
+		}
+	}
+	return
+}
+
+// Check finds the media missing from the media folder and the media no longer used by notes.
+// The LaTeX images rendered are used by their notes
+func (m *MediaService) Check(manager *media.Manager) (models.MediaCheck, error) {
+	refs, err := m.References()
+	if err != nil {
+		return models.MediaCheck{}, err
+	}
+	check, err := manager.Check(refs)
+	if err != nil {
+		return check, err
+	}
+	images, err := m.LatexImages()
+	if err != nil {
+		return check, err
+	}
+	unused := []string{}
+	for _, file := range check.Unused {
+		if !images[file] {
+			unused = append(unused, file)
+		}
+	}
+	check.Unused = unused
+	return check, nil
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	repos "github.com/aerex/go-anki/api/sql/sqlite/repositories"
+	"github.com/aerex/go-anki/pkg/media"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMediaReferences(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := NewMediaService(repos.NewNoteRepository(db))
+
+	refs, err := svc.References()
+
+	assert.NoError(t, err)
+	assert.Len(t, refs, 7)
+	assert.Contains(t, refs, "google-df39cf0e-f0c32950-5fcb659e-a664e071-8ba56fe2.mp3")
+}
+
+func TestCheckMedia(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := NewMediaService(repos.NewNoteRepository(db))
+	manager, err := media.NewManager(filepath.Join(t.TempDir(), "collection.anki2"))
+	assert.NoError(t, err)
+	defer manager.Close()
+	os.WriteFile(filepath.Join(manager.Dir, "google-df39cf0e-f0c32950-5fcb659e-a664e071-8ba56fe2.mp3"), []byte("audio"), 0644)
+	os.WriteFile(filepath.Join(manager.Dir, "unused.png"), []byte("image"), 0644)
+
+	check, err := svc.Check(manager)
+
+	assert.NoError(t, err)
+	assert.Len(t, check.Missing, 6)
+	assert.Equal(t, []string{"unused.png"}, check.Unused)
+}
+
+func TestCheckMediaWithLatex(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := NewMediaService(repos.NewNoteRepository(db))
+	_, err := db.Exec("UPDATE notes SET flds = '[$]x^2[/$]' || flds WHERE id = (SELECT MIN(id) FROM notes)")
+	assert.NoError(t, err)
+	manager, err := media.NewManager(filepath.Join(t.TempDir(), "collection.anki2"))
+	assert.NoError(t, err)
+	defer manager.Close()
+	os.WriteFile(filepath.Join(manager.Dir, "latex-026326cda34d40679435c991e5a4711df27dff8f.png"), []byte("image"), 0644)
+	os.WriteFile(filepath.Join(manager.Dir, "latex-unused.png"), []byte("image"), 0644)
+
+	check, err := svc.Check(manager)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"latex-unused.png"}, check.Unused)
+}
@@ -0,0 +1,755 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	ankisql "github.com/aerex/go-anki/api/sql"
+	repos "github.com/aerex/go-anki/api/sql/sqlite/repositories"
+	"github.com/aerex/go-anki/internal/utils"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/aerex/go-anki/pkg/template"
+)
+
+type NoteService struct {
+	cardRepo  repos.CardRepo
+	colRepo   repos.ColRepo
+	deckRepo  repos.DeckRepo
+	graveRepo repos.GraveRepo
+	noteRepo  repos.NoteRepo
+}
+
+func NewNoteService(card repos.CardRepo, col repos.ColRepo, deck repos.DeckRepo, grave repos.GraveRepo, note repos.NoteRepo) NoteService {
+	return NoteService{
+		cardRepo:  card,
+		colRepo:   col,
+		deckRepo:  deck,
+		graveRepo: grave,
+		noteRepo:  note,
+	}
+}
+
+// noteImporter holds the state shared by the rows of an import
+type noteImporter struct {
+	NoteService
+	mode      models.DuplicateMode
+	noteTypes map[string]*models.NoteType
+	decks     map[string]models.Deck
+	deckIDs   map[models.ID]bool
+	tags      models.TagCache
+	usn       int
+	nextID    models.ID
+	nextPos   int
+	now       models.UnixTime
+	// the notes added by the import keyed by note type and first field
+	added map[string]*models.Note
+}
+
+// Import adds the notes read from the rows of a text file and creates their cards.
+// A note is a duplicate when a note of the same type has the same first field.
+// Rows that cannot be imported are reported as failed without stopping the import
+func (n *NoteService) Import(rows []models.NoteRow, mode models.DuplicateMode) (results []models.NoteRowResult, err error) {
+	imp, err := n.newImporter(mode)
+	if err != nil {
+		return
+	}
+	for _, row := range rows {
+		res, err := imp.importRow(row)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, res)
+	}
+	return results, imp.finish()
+}
+
+// Sync creates or replaces the notes of the rows using their globally unique id
+// and deletes the notes of the removed ids.
+// A row without id creates a new note and the id of the note is reported in its result
+func (n *NoteService) Sync(rows []models.NoteRow, removed []string) (results []models.NoteRowResult, err error) {
+	imp, err := n.newImporter(models.DuplicateAllow)
+	if err != nil {
+		return
+	}
+	for _, row := range rows {
+		var res models.NoteRowResult
+		note, exists := models.Note{}, false
+		if row.GUID != "" {
+			if note, exists, err = n.noteRepo.FindByGUID(row.GUID); err != nil {
+				return
+			}
+		}
+		if exists {
+			res, err = imp.replaceNote(note, row)
+		} else {
+			res, err = imp.importRow(row)
+		}
+		if err != nil {
+			return
+		}
+		results = append(results, res)
+	}
+
+	var ids []models.ID
+	for _, guid := range removed {
+		note, exists, err := n.noteRepo.FindByGUID(guid)
+		if err != nil {
+			return results, err
+		}
+		if exists {
+			ids = append(ids, note.ID)
+			results = append(results, models.NoteRowResult{Status: models.NoteRowRemoved, NoteID: note.ID, GUID: guid})
+		}
+	}
+	if _, err = n.Delete(ids); err != nil {
+		return
+	}
+	return results, imp.finish()
+}
+
+func (n *NoteService) newImporter(mode models.DuplicateMode) (imp *noteImporter, err error) {
+	imp = &noteImporter{
+		NoteService: *n,
+		mode:        mode,
+		noteTypes:   make(map[string]*models.NoteType),
+		added:       make(map[string]*models.Note),
+		now:         models.UnixTime(time.Now().Unix()),
+	}
+	noteTypes, err := n.colRepo.NoteTypes()
+	if err != nil {
+		return
+	}
+	for _, noteType := range noteTypes {
+		imp.noteTypes[noteType.Name] = noteType
+	}
+	if imp.decks, err = n.deckRepo.DeckNameMap(); err != nil {
+		return
+	}
+	imp.deckIDs = make(map[models.ID]bool, len(imp.decks))
+	for _, deck := range imp.decks {
+		imp.deckIDs[deck.ID] = true
+	}
+	if imp.tags, err = n.colRepo.TagCache(); err != nil {
+		return
+	}
+	if imp.tags == nil {
+		imp.tags = make(models.TagCache)
+	}
+	if imp.usn, err = n.colRepo.USN(false); err != nil {
+		return
+	}
+	lastID, err := n.noteRepo.LastID()
+	if err != nil {
+		return
+	}
+	// note ids are creation times in milliseconds
+	imp.nextID = models.ID(utils.MaxInt64(time.Now().UnixMilli(), int64(lastID)+1))
+	conf, err := n.colRepo.Conf()
+	if err != nil {
+		return
+	}
+	imp.nextPos = conf.NextPos
+	if imp.nextPos < 1 {
+		imp.nextPos = 1
+	}
+	return
+}
+
+// finish saves the new tags and the position of the next new card
+func (i *noteImporter) finish() error {
+	if err := i.colRepo.SaveTags(i.tags); err != nil {
+		return err
+	}
+	if err := i.colRepo.SaveNextPos(i.nextPos); err != nil {
+		return err
+	}
+	return i.colRepo.UpdateMod()
+}
+
+// Delete removes the notes with their cards and records the deletions for the next sync
+func (n *NoteService) Delete(ids []models.ID) (res models.DeleteResult, err error) {
+	if len(ids) == 0 {
+		return
+	}
+	cardIDs, err := n.cardRepo.IDsOfNotes(ids)
+	if err != nil {
+		return
+	}
+	return n.remove(cardIDs, ids)
+}
+
+// DeleteCards removes the cards and the notes left without cards
+// and records the deletions for the next sync
+func (n *NoteService) DeleteCards(ids []models.ID) (res models.DeleteResult, err error) {
+	if len(ids) == 0 {
+		return
+	}
+	cards, err := n.cardRepo.List("c.id IN "+ankisql.InClauseFromIDs(ids), nil)
+	if err != nil || len(cards) == 0 {
+		return
+	}
+	deleted := make(map[models.ID]bool, len(cards))
+	noteIDs := make(map[models.ID]bool)
+	for _, card := range cards {
+		deleted[card.ID] = true
+		noteIDs[card.NoteID] = true
+	}
+	siblings, err := n.cardRepo.List("c.nid IN "+ankisql.InClauseFromIDs(sortedIDs(noteIDs)), nil)
+	if err != nil {
+		return
+	}
+	for _, card := range siblings {
+		if !deleted[card.ID] {
+			delete(noteIDs, card.NoteID)
+		}
+	}
+	return n.remove(sortedIDs(deleted), sortedIDs(noteIDs))
+}
+
+// remove deletes the cards and the notes and adds them to the graves
+func (n *NoteService) remove(cardIDs []models.ID, noteIDs []models.ID) (res models.DeleteResult, err error) {
+	usn, err := n.colRepo.USN(false)
+	if err != nil {
+		return
+	}
+	if err = n.cardRepo.Delete(cardIDs); err != nil {
+		return
+	}
+	if err = n.noteRepo.Delete(noteIDs); err != nil {
+		return
+	}
+	if err = n.graveRepo.Add(cardIDs, models.GraveTypeCard, usn); err != nil {
+		return
+	}
+	if err = n.graveRepo.Add(noteIDs, models.GraveTypeNote, usn); err != nil {
+		return
+	}
+	return models.DeleteResult{Cards: len(cardIDs), Notes: len(noteIDs)}, n.colRepo.UpdateMod()
+}
+
+// Update replaces the fields and the tags of a note and creates the cards of the templates
+// that are no longer empty. The fields missing from the map are emptied
+func (n *NoteService) Update(id models.ID, fields map[string]string, tags []string) (res models.NoteRowResult, err error) {
+	note, exists, err := n.noteRepo.Find(id)
+	if err != nil {
+		return
+	}
+	if !exists {
+		return res, fmt.Errorf("note %d does not exist", id)
+	}
+	imp, err := n.newImporter(models.DuplicateAllow)
+	if err != nil {
+		return
+	}
+	var noteType *models.NoteType
+	for _, nt := range imp.noteTypes {
+		if nt.ID == note.ModelID {
+			noteType = nt
+		}
+	}
+	if noteType == nil {
+		return res, fmt.Errorf("note type %d of note %d does not exist", note.ModelID, id)
+	}
+	cards, err := n.cardRepo.List("c.nid = ?", []string{strconv.FormatInt(int64(id), 10)})
+	if err != nil {
+		return
+	}
+
+	res, err = imp.replaceNote(note, models.NoteRow{NoteType: noteType.Name, Fields: fields, Tags: tags})
+	if err != nil {
+		return
+	}
+	if res.Status == models.NoteRowFailed {
+		return res, errors.New(res.Reason)
+	}
+	if res.Status == models.NoteRowSkipped {
+		return res, nil
+	}
+	values := make([]string, len(noteType.Fields))
+	for idx, field := range noteType.Fields {
+		values[idx] = fields[field.Name]
+	}
+	if res.Cards, err = imp.addMissingCards(noteType, id, values, cards); err != nil {
+		return
+	}
+	return res, imp.finish()
+}
+
+// ToggleMark adds the marked tag to the note or removes it when the note is already marked
+func (n *NoteService) ToggleMark(id models.ID) (marked bool, err error) {
+	note, exists, err := n.noteRepo.Find(id)
+	if err != nil {
+		return
+	}
+	if !exists {
+		return false, fmt.Errorf("note %d does not exist", id)
+	}
+	imp, err := n.newImporter(models.DuplicateAllow)
+	if err != nil {
+		return
+	}
+	var tags []string
+	marked = true
+	for _, tag := range strings.Fields(note.StringTags) {
+		if strings.EqualFold(tag, models.MarkedTag) {
+			marked = false
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	if marked {
+		tags = append(tags, models.MarkedTag)
+	}
+	note.StringTags = imp.joinTags(tags)
+	note.Mod = imp.now
+	note.USN = imp.usn
+	if err = n.noteRepo.Create(note); err != nil {
+		return
+	}
+	return marked, imp.finish()
+}
+
+// addMissingCards creates the cards of the ordinals generated by the fields
+// that the note does not have yet. The new cards are added to the deck of the existing cards
+func (i *noteImporter) addMissingCards(noteType *models.NoteType, nid models.ID, fields []string, cards []models.Card) (added int, err error) {
+	existing := make(map[int]bool)
+	deckID := models.ID(1)
+	for idx, card := range cards {
+		existing[card.Ord] = true
+		if idx == 0 {
+			deckID = card.DeckID
+			if card.OriginalDeckID != 0 {
+				deckID = card.OriginalDeckID
+			}
+		}
+	}
+	for _, ord := range cardOrds(*noteType, fields) {
+		if existing[ord] {
+			continue
+		}
+		card := models.Card{
+			NoteID: nid,
+			DeckID: deckID,
+			Ord:    ord,
+			Mod:    i.now,
+			USN:    i.usn,
+			Type:   models.CardTypeNew,
+			Queue:  models.CardQueueNew,
+			Due:    models.UnixTime(i.nextPos),
+		}
+		if noteType.Type == models.StandardCardType {
+			for _, tmpl := range noteType.Templates {
+				if tmpl.Ordinal == ord && i.deckIDs[tmpl.DeckOverride] {
+					card.DeckID = tmpl.DeckOverride
+				}
+			}
+		}
+		if err = i.cardRepo.Create(card); err != nil {
+			return
+		}
+		added++
+	}
+	if added > 0 {
+		i.nextPos++
+	}
+	return
+}
+
+// Create adds the notes and their cards.
+// The fields of a note are given in the order of the fields of its note type
+func (n *NoteService) Create(notes []models.CreateNote) (ids []models.ID, err error) {
+	noteTypes, err := n.colRepo.NoteTypes()
+	if err != nil {
+		return
+	}
+	fieldNames := make(map[string][]string)
+	for _, noteType := range noteTypes {
+		for _, field := range noteType.Fields {
+			fieldNames[noteType.Name] = append(fieldNames[noteType.Name], field.Name)
+		}
+	}
+	rows := make([]models.NoteRow, len(notes))
+	for idx, note := range notes {
+		names, exists := fieldNames[note.Type]
+		if !exists {
+			return nil, fmt.Errorf("note %d: note type %q does not exist", idx+1, note.Type)
+		}
+		if len(note.Fields) > len(names) {
+			return nil, fmt.Errorf("note %d: expected at most %d fields for %s but got %d", idx+1, len(names), note.Type, len(note.Fields))
+		}
+		rows[idx] = models.NoteRow{
+			Line:     idx + 1,
+			NoteType: note.Type,
+			Deck:     note.Deck,
+			Fields:   make(map[string]string),
+			Tags:     note.Tags,
+		}
+		for fieldIdx, value := range note.Fields {
+			rows[idx].Fields[names[fieldIdx]] = value
+		}
+	}
+	results, err := n.Import(rows, models.DuplicateAllow)
+	if err != nil {
+		return
+	}
+	for _, res := range results {
+		if res.Status == models.NoteRowFailed {
+			return nil, fmt.Errorf("note %d: %s", res.Line, res.Reason)
+		}
+		ids = append(ids, res.NoteID)
+	}
+	return
+}
+
+func (i *noteImporter) importRow(row models.NoteRow) (models.NoteRowResult, error) {
+	res := models.NoteRowResult{Line: row.Line}
+	fail := func(format string, args ...interface{}) (models.NoteRowResult, error) {
+		res.Status = models.NoteRowFailed
+		res.Reason = fmt.Sprintf(format, args...)
+		return res, nil
+	}
+
+	noteType, exists := i.noteTypes[row.NoteType]
+	if !exists {
+		return fail("note type %q does not exist", row.NoteType)
+	}
+	deck, exists := i.decks[row.Deck]
+	if !exists {
+		return fail("deck %q does not exist", row.Deck)
+	}
+	if bool(deck.Dyn) {
+		return fail("cannot add notes to filtered deck %s", deck.Name)
+	}
+	fields := make([]string, len(noteType.Fields))
+	known := make(map[string]int)
+	for idx, field := range noteType.Fields {
+		known[field.Name] = idx
+	}
+	for name, value := range row.Fields {
+		idx, exists := known[name]
+		if !exists {
+			return fail("field %q is not defined in %s", name, noteType.Name)
+		}
+		fields[idx] = value
+	}
+	if strings.TrimSpace(utils.StripHTMLMedia(fields[0])) == "" {
+		return fail("first field %s is empty", noteType.Fields[0].Name)
+	}
+	csum, err := noteChecksum(fields[0])
+	if err != nil {
+		return res, err
+	}
+
+	dupe, err := i.findDuplicate(noteType.ID, csum, fields[0])
+	if err != nil {
+		return res, err
+	}
+	if dupe != nil && i.mode != models.DuplicateAllow {
+		res.NoteID = dupe.ID
+		res.GUID = dupe.GUID
+		if i.mode == models.DuplicateUpdate {
+			return i.updateNote(res, dupe, noteType, row)
+		}
+		res.Status = models.NoteRowSkipped
+		res.Reason = "a note with the same first field exists"
+		return res, nil
+	}
+
+	ords := cardOrds(*noteType, fields)
+	if len(ords) == 0 {
+		return fail("no cloze deletions in %s", noteType.Name)
+	}
+	note := models.Note{
+		ID:         i.nextID,
+		GUID:       row.GUID,
+		ModelID:    noteType.ID,
+		Mod:        i.now,
+		USN:        i.usn,
+		Fields:     fields,
+		SortField:  utils.StripHTMLMedia(fields[noteType.SortField]),
+		Checksum:   csum,
+		StringTags: i.joinTags(row.Tags),
+	}
+	if note.GUID == "" {
+		note.GUID = utils.GUID64()
+	}
+	i.nextID++
+	if err := i.noteRepo.Create(note); err != nil {
+		return res, err
+	}
+	overrides := make(map[int]models.ID)
+	if noteType.Type == models.StandardCardType {
+		for _, tmpl := range noteType.Templates {
+			if i.deckIDs[tmpl.DeckOverride] {
+				overrides[tmpl.Ordinal] = tmpl.DeckOverride
+			}
+		}
+	}
+	for _, ord := range ords {
+		card := models.Card{
+			NoteID: note.ID,
+			DeckID: deck.ID,
+			Ord:    ord,
+			Mod:    i.now,
+			USN:    i.usn,
+			Type:   models.CardTypeNew,
+			Queue:  models.CardQueueNew,
+			Due:    models.UnixTime(i.nextPos),
+		}
+		if did, exists := overrides[ord]; exists {
+			card.DeckID = did
+		}
+		if err := i.cardRepo.Create(card); err != nil {
+			return res, err
+		}
+	}
+	i.nextPos++
+	i.added[duplicateKey(noteType.ID, fields[0])] = &note
+	res.Status = models.NoteRowAdded
+	if dupe != nil {
+		res.Status = models.NoteRowDuplicate
+	}
+	res.NoteID = note.ID
+	res.GUID = note.GUID
+	res.Cards = len(ords)
+	return res, nil
+}
+
+// findDuplicate returns the first note of the note type with the same first field
+// since the checksum only covers the first 8 hex digits of the hash
+func (i *noteImporter) findDuplicate(mid models.ID, csum uint64, field string) (*models.Note, error) {
+	// the notes added by the import may not be visible to the queries yet
+	if note, exists := i.added[duplicateKey(mid, field)]; exists {
+		return note, nil
+	}
+	notes, err := i.noteRepo.FindByFirstField(mid, csum)
+	if err != nil {
+		return nil, err
+	}
+	stripped := utils.StripHTMLMedia(field)
+	for idx := range notes {
+		if len(notes[idx].Fields) > 0 && utils.StripHTMLMedia(notes[idx].Fields[0]) == stripped {
+			return &notes[idx], nil
+		}
+	}
+	return nil, nil
+}
+
+// updateNote replaces the fields of an existing note with the fields of the row,
+// adds the tags of the row and creates the cards of the templates that are no longer empty
+func (i *noteImporter) updateNote(res models.NoteRowResult, note *models.Note, noteType *models.NoteType, row models.NoteRow) (models.NoteRowResult, error) {
+	fields := make([]string, len(noteType.Fields))
+	copy(fields, note.Fields)
+	for idx, field := range noteType.Fields {
+		if value, exists := row.Fields[field.Name]; exists {
+			fields[idx] = value
+		}
+	}
+	tags := i.joinTags(append(strings.Fields(note.StringTags), row.Tags...))
+	if utils.JoinFields(fields) == utils.JoinFields(note.Fields) && tags == note.StringTags {
+		res.Status = models.NoteRowSkipped
+		res.Reason = "the note is up to date"
+		return res, nil
+	}
+	csum, err := noteChecksum(fields[0])
+	if err != nil {
+		return res, err
+	}
+	cards, err := i.cardRepo.List("c.nid = ?", []string{strconv.FormatInt(int64(note.ID), 10)})
+	if err != nil {
+		return res, err
+	}
+	note.Fields = fields
+	note.StringTags = tags
+	note.SortField = utils.StripHTMLMedia(fields[noteType.SortField])
+	note.Checksum = csum
+	note.Mod = i.now
+	note.USN = i.usn
+	if err := i.noteRepo.Create(*note); err != nil {
+		return res, err
+	}
+	if res.Cards, err = i.addMissingCards(noteType, note.ID, fields, cards); err != nil {
+		return res, err
+	}
+	res.Status = models.NoteRowUpdated
+	return res, nil
+}
+
+// replaceNote replaces the fields and the tags of a note with the fields and the tags of the row.
+// The fields missing from the row are emptied
+func (i *noteImporter) replaceNote(note models.Note, row models.NoteRow) (models.NoteRowResult, error) {
+	res := models.NoteRowResult{Line: row.Line, NoteID: note.ID, GUID: note.GUID}
+	noteType, exists := i.noteTypes[row.NoteType]
+	if !exists {
+		res.Status = models.NoteRowFailed
+		res.Reason = fmt.Sprintf("note type %q does not exist", row.NoteType)
+		return res, nil
+	}
+	if noteType.ID != note.ModelID {
+		res.Status = models.NoteRowFailed
+		res.Reason = fmt.Sprintf("note %d is not a %s note", note.ID, noteType.Name)
+		return res, nil
+	}
+	fields := make([]string, len(noteType.Fields))
+	known := make(map[string]bool)
+	for idx, field := range noteType.Fields {
+		fields[idx] = row.Fields[field.Name]
+		known[field.Name] = true
+	}
+	for name := range row.Fields {
+		if !known[name] {
+			res.Status = models.NoteRowFailed
+			res.Reason = fmt.Sprintf("field %q is not defined in %s", name, noteType.Name)
+			return res, nil
+		}
+	}
+	if strings.TrimSpace(utils.StripHTMLMedia(fields[0])) == "" {
+		res.Status = models.NoteRowFailed
+		res.Reason = fmt.Sprintf("first field %s is empty", noteType.Fields[0].Name)
+		return res, nil
+	}
+	tags := i.joinTags(row.Tags)
+	if utils.JoinFields(fields) == utils.JoinFields(note.Fields) && tags == note.StringTags {
+		res.Status = models.NoteRowSkipped
+		res.Reason = "the note is up to date"
+		return res, nil
+	}
+	csum, err := noteChecksum(fields[0])
+	if err != nil {
+		return res, err
+	}
+	note.Fields = fields
+	note.StringTags = tags
+	note.SortField = utils.StripHTMLMedia(fields[noteType.SortField])
+	note.Checksum = csum
+	note.Mod = i.now
+	note.USN = i.usn
+	if err := i.noteRepo.Create(note); err != nil {
+		return res, err
+	}
+	res.Status = models.NoteRowUpdated
+	return res, nil
+}
+
+// joinTags formats the tags as stored in a note and registers the new tags
+func (i *noteImporter) joinTags(tags []string) string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, tag := range tags {
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		unique = append(unique, tag)
+		if _, exists := i.tags[tag]; !exists {
+			i.tags[tag] = i.usn
+		}
+	}
+	if len(unique) == 0 {
+		return ""
+	}
+	return " " + strings.Join(unique, " ") + " "
+}
+
+func duplicateKey(mid models.ID, field string) string {
+	return fmt.Sprintf("%d\x1f%s", mid, utils.StripHTMLMedia(field))
+}
+
+// cardOrds returns the ordinals of the cards generated for a note.
+// A standard note has a card per template whose front is not empty (or the first template
+// when all the fronts are empty) and a cloze note has a card per cloze number
+func cardOrds(noteType models.NoteType, fields []string) (ords []int) {
+	if noteType.Type != models.ClozeCardType {
+		nonEmpty := make(map[string]bool)
+		for idx, field := range noteType.Fields {
+			nonEmpty[field.Name] = idx < len(fields) && !template.FieldIsEmpty(fields[idx])
+		}
+		for _, tmpl := range noteType.Templates {
+			if templateNonEmpty(tmpl.QuestionFormat, nonEmpty) {
+				ords = append(ords, tmpl.Ordinal)
+			}
+		}
+		if len(ords) == 0 && len(noteType.Templates) > 0 {
+			ords = append(ords, noteType.Templates[0].Ordinal)
+		}
+		return
+	}
+	used := clozeFields(noteType)
+	seen := make(map[int]bool)
+	for idx, field := range noteType.Fields {
+		if idx >= len(fields) || !used[field.Name] {
+			continue
+		}
+		for _, num := range template.ClozeOrdinals(fields[idx]) {
+			if num < 1 || seen[num-1] {
+				continue
+			}
+			seen[num-1] = true
+			ords = append(ords, num-1)
+		}
+	}
+	sort.Ints(ords)
+	return
+}
+
+// clozeFields returns the names of the fields shown with the cloze filter on the front of the templates
+func clozeFields(noteType models.NoteType) map[string]bool {
+	fields := make(map[string]bool)
+	var find func(nodes []template.Node)
+	find = func(nodes []template.Node) {
+		for _, node := range nodes {
+			switch node := node.(type) {
+			case template.ReplacementNode:
+				for _, filter := range node.Filters {
+					if filter == "cloze" {
+						fields[node.Field] = true
+					}
+				}
+			case template.ConditionalNode:
+				find(node.Children)
+			}
+		}
+	}
+	for _, tmpl := range noteType.Templates {
+		if nodes, err := template.Parse(tmpl.QuestionFormat); err == nil {
+			find(nodes)
+		}
+	}
+	return fields
+}
+
+// templateNonEmpty reports if the front of a template shows a non-empty field.
+// The fields inside a {{#Field}} or {{^Field}} section only count when the section is shown
+func templateNonEmpty(qfmt string, nonEmpty map[string]bool) bool {
+	nodes, err := template.Parse(qfmt)
+	if err != nil {
+		return false
+	}
+	return nodesNonEmpty(nodes, nonEmpty)
+}
+
+func nodesNonEmpty(nodes []template.Node, nonEmpty map[string]bool) bool {
+	for _, node := range nodes {
+		switch node := node.(type) {
+		case template.ReplacementNode:
+			if nonEmpty[node.Field] {
+				return true
+			}
+		case template.ConditionalNode:
+			if nonEmpty[node.Field] != node.Negated && nodesNonEmpty(node.Children, nonEmpty) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// noteChecksum computes the checksum of the first field used to find duplicates
+func noteChecksum(field string) (uint64, error) {
+	csum := utils.FieldChecksum(field)
+	return strconv.ParseUint(csum[0:8], 16, 64)
+}
@@ -0,0 +1,431 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	ankisql "github.com/aerex/go-anki/api/sql"
+	repos "github.com/aerex/go-anki/api/sql/sqlite/repositories"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/aerex/go-anki/pkg/textimport"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestNoteService(db *sqlx.DB) NoteService {
+	return NewNoteService(repos.NewCardRepository(db), repos.NewColRepository(db),
+		repos.NewDeckRepository(db), repos.NewGraveRepository(db), repos.NewNoteRepository(db))
+}
+
+func basicRow(line int, front, back string, tags ...string) models.NoteRow {
+	return models.NoteRow{
+		Line:     line,
+		NoteType: "Basic",
+		Deck:     "Default",
+		Fields:   map[string]string{"Front": front, "Back": back},
+		Tags:     tags,
+	}
+}
+
+func TestImportNotes(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestNoteService(db)
+	rows := []models.NoteRow{
+		basicRow(1, "go", "went", "verbs"),
+		{Line: 2, NoteType: "Basic (and reversed card)", Deck: "Vocabulary", Fields: map[string]string{"Front": "eat", "Back": "ate"}},
+		{Line: 3, NoteType: "Cloze", Deck: "Default", Fields: map[string]string{"Text": "{{c1::run}} {{c2::ran}} {{c1::run}}"}},
+		{Line: 4, NoteType: "Cloze", Deck: "Default", Fields: map[string]string{"Text": "no cloze"}},
+		{Line: 5, NoteType: "Missing", Deck: "Default"},
+		{Line: 6, NoteType: "Basic", Deck: "Missing"},
+		{Line: 7, NoteType: "Basic", Deck: "Default", Fields: map[string]string{"Missing": "value"}},
+		basicRow(8, "", "empty"),
+	}
+
+	results, err := svc.Import(rows, models.DuplicateSkip)
+
+	assert.NoError(t, err)
+	assert.Len(t, results, len(rows))
+	assert.Equal(t, models.NoteRowAdded, results[0].Status)
+	assert.Equal(t, 1, results[0].Cards)
+	assert.Equal(t, models.NoteRowAdded, results[1].Status)
+	assert.Equal(t, 2, results[1].Cards)
+	assert.Equal(t, models.NoteRowAdded, results[2].Status)
+	assert.Equal(t, 2, results[2].Cards)
+	assert.Equal(t, models.NoteRowResult{Line: 4, Status: models.NoteRowFailed, Reason: "no cloze deletions in Cloze"}, results[3])
+	assert.Equal(t, "note type \"Missing\" does not exist", results[4].Reason)
+	assert.Equal(t, "deck \"Missing\" does not exist", results[5].Reason)
+	assert.Equal(t, "field \"Missing\" is not defined in Basic", results[6].Reason)
+	assert.Equal(t, "first field Front is empty", results[7].Reason)
+
+	var note models.Note
+	assert.NoError(t, db.Get(&note, "SELECT id, flds, tags, usn FROM notes WHERE id = ?", results[0].NoteID))
+	assert.Equal(t, models.NoteFields{"go", "went"}, note.Fields)
+	assert.Equal(t, " verbs ", note.StringTags)
+	assert.Equal(t, -1, note.USN)
+	var ords []int
+	assert.NoError(t, db.Select(&ords, "SELECT ord FROM cards WHERE nid = ? ORDER BY ord", results[2].NoteID))
+	assert.Equal(t, []int{0, 1}, ords)
+	var dues []int64
+	assert.NoError(t, db.Select(&dues, "SELECT due FROM cards WHERE nid IN (?, ?) ORDER BY due", results[0].NoteID, results[1].NoteID))
+	assert.Equal(t, []int64{496, 497, 497}, dues)
+	conf, err := repos.NewColRepository(db).Conf()
+	assert.NoError(t, err)
+	assert.Equal(t, 499, conf.NextPos)
+	tags, err := repos.NewColRepository(db).TagCache()
+	assert.NoError(t, err)
+	assert.Contains(t, tags, "verbs")
+}
+
+func TestImportNotesDuplicates(t *testing.T) {
+	tests := map[models.DuplicateMode]struct {
+		status models.NoteRowStatus
+		notes  int
+		back   string
+		tags   string
+	}{
+		models.DuplicateSkip:   {status: models.NoteRowSkipped, notes: 1, back: "went", tags: " verbs "},
+		models.DuplicateUpdate: {status: models.NoteRowUpdated, notes: 1, back: "gone", tags: " verbs irregular "},
+		models.DuplicateAllow:  {status: models.NoteRowDuplicate, notes: 2, back: "went", tags: " verbs "},
+	}
+	for mode, test := range tests {
+		t.Run(string(mode), func(t *testing.T) {
+			db := setupSyncDB(t)
+			svc := newTestNoteService(db)
+			first, err := svc.Import([]models.NoteRow{basicRow(1, "<b>go</b>", "went", "verbs")}, mode)
+			assert.NoError(t, err)
+
+			results, err := svc.Import([]models.NoteRow{basicRow(1, "go", "gone", "irregular")}, mode)
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.status, results[0].Status)
+			var notes []models.Note
+			assert.NoError(t, db.Select(&notes, "SELECT id, flds, tags FROM notes WHERE sfld = 'go' ORDER BY id"))
+			assert.Len(t, notes, test.notes)
+			assert.Equal(t, first[0].NoteID, notes[0].ID)
+			assert.Equal(t, test.back, notes[0].Fields[1])
+			assert.Equal(t, test.tags, notes[0].StringTags)
+		})
+	}
+}
+
+func TestImportNotesUpdateAddsCards(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestNoteService(db)
+	row := models.NoteRow{
+		Line:     1,
+		NoteType: "Basic (optional reversed card)",
+		Deck:     "Default",
+		Fields:   map[string]string{"Front": "<b>go</b>", "Back": "went"},
+	}
+	first, err := svc.Import([]models.NoteRow{row}, models.DuplicateAllow)
+	assert.NoError(t, err)
+
+	row.Fields = map[string]string{"Front": "go", "Add Reverse": "y"}
+	results, err := svc.Import([]models.NoteRow{row}, models.DuplicateUpdate)
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.NoteRowUpdated, results[0].Status)
+	assert.Equal(t, first[0].NoteID, results[0].NoteID)
+	assert.Equal(t, 1, results[0].Cards)
+	var ords []int
+	assert.NoError(t, db.Select(&ords, "SELECT ord FROM cards WHERE nid = ? ORDER BY ord", results[0].NoteID))
+	assert.Equal(t, []int{0, 1}, ords)
+	var note models.Note
+	assert.NoError(t, db.Get(&note, "SELECT sfld, csum FROM notes WHERE id = ?", results[0].NoteID))
+	csum, err := noteChecksum("go")
+	assert.NoError(t, err)
+	assert.Equal(t, csum, note.Checksum)
+	assert.Equal(t, "go", note.SortField)
+}
+
+func TestCreateNotes(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestNoteService(db)
+
+	ids, err := svc.Create([]models.CreateNote{
+		{Type: "Basic", Deck: "Default", Fields: []string{"go", "went"}, Tags: []string{"verbs"}},
+		{Type: "Basic", Deck: "Default", Fields: []string{"go"}},
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, ids, 2)
+	assert.Equal(t, ids[0]+1, ids[1])
+	var notes []models.Note
+	assert.NoError(t, db.Select(&notes, "SELECT id, flds FROM notes WHERE id IN (?, ?) ORDER BY id", ids[0], ids[1]))
+	assert.Equal(t, models.NoteFields{"go", "went"}, notes[0].Fields)
+	assert.Equal(t, models.NoteFields{"go", ""}, notes[1].Fields)
+}
+
+func TestCreateNotesInvalid(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestNoteService(db)
+
+	_, err := svc.Create([]models.CreateNote{{Type: "Basic", Fields: []string{"a", "b", "c"}}})
+	assert.EqualError(t, err, "note 1: expected at most 2 fields for Basic but got 3")
+
+	_, err = svc.Create([]models.CreateNote{{Type: "Missing"}})
+	assert.EqualError(t, err, "note 1: note type \"Missing\" does not exist")
+
+	_, err = svc.Create([]models.CreateNote{{Type: "Basic", Deck: "Default"}})
+	assert.EqualError(t, err, "note 1: first field Front is empty")
+}
+
+func TestCreateNotesInBatch(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestNoteService(db)
+	var before int
+	assert.NoError(t, db.Get(&before, "SELECT COUNT() FROM notes"))
+
+	err := ankisql.Batch(db, func() error {
+		_, err := svc.Create([]models.CreateNote{
+			{Type: "Basic", Deck: "Default", Fields: []string{"go", "went"}},
+			{Type: "Basic", Deck: "Missing", Fields: []string{"eat", "ate"}},
+		})
+		return err
+	})
+
+	assert.EqualError(t, err, "note 2: deck \"Missing\" does not exist")
+	var after int
+	assert.NoError(t, db.Get(&after, "SELECT COUNT() FROM notes"))
+	assert.Equal(t, before, after, "the notes should not be added when a note is invalid")
+}
+
+// the duplicates are looked up while the batch holds the lock of the database
+func TestImportLargeCSVInBatch(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestNoteService(db)
+	var csv strings.Builder
+	csv.WriteString("#separator:Comma\n")
+	for idx := 0; idx < 5000; idx++ {
+		fmt.Fprintf(&csv, "word %d,%s\n", idx, strings.Repeat("meaning ", 20))
+	}
+	file, err := textimport.Parse(strings.NewReader(csv.String()))
+	assert.NoError(t, err)
+	var rows []models.NoteRow
+	for _, row := range file.Rows {
+		rows = append(rows, basicRow(row.Line, row.Column(1), row.Column(2)))
+	}
+	var before int
+	assert.NoError(t, db.Get(&before, "SELECT COUNT() FROM notes"))
+
+	var results []models.NoteRowResult
+	err = ankisql.Batch(db, func() (err error) {
+		results, err = svc.Import(rows, models.DuplicateSkip)
+		return
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, results, 5000)
+	var after int
+	assert.NoError(t, db.Get(&after, "SELECT COUNT() FROM notes"))
+	assert.Equal(t, before+5000, after)
+}
+
+func TestSyncNotes(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestNoteService(db)
+	created, err := svc.Sync([]models.NoteRow{
+		basicRow(1, "go", "went"),
+		basicRow(2, "eat", "ate"),
+	}, nil)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, created[0].GUID)
+
+	known := basicRow(1, "go", "gone", "irregular")
+	known.GUID = created[0].GUID
+	unchanged := basicRow(2, "eat", "ate")
+	unchanged.GUID = created[1].GUID
+	missing := basicRow(3, "run", "ran")
+	missing.GUID = "restored"
+	results, err := svc.Sync([]models.NoteRow{known, unchanged, missing}, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.NoteRowUpdated, results[0].Status)
+	assert.Equal(t, created[0].NoteID, results[0].NoteID)
+	assert.Equal(t, models.NoteRowSkipped, results[1].Status)
+	assert.Equal(t, models.NoteRowAdded, results[2].Status)
+	assert.Equal(t, "restored", results[2].GUID)
+	var note models.Note
+	assert.NoError(t, db.Get(&note, "SELECT flds, tags FROM notes WHERE id = ?", created[0].NoteID))
+	assert.Equal(t, models.NoteFields{"go", "gone"}, note.Fields)
+	assert.Equal(t, " irregular ", note.StringTags)
+
+	results, err = svc.Sync(nil, []string{created[1].GUID, "unknown"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []models.NoteRowResult{{Status: models.NoteRowRemoved, NoteID: created[1].NoteID, GUID: created[1].GUID}}, results)
+	var cards int
+	assert.NoError(t, db.Get(&cards, "SELECT COUNT() FROM cards WHERE nid = ?", created[1].NoteID))
+	assert.Zero(t, cards)
+	graves, err := repos.NewGraveRepository(db).Pending()
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ID{created[1].NoteID}, graves.Notes)
+	assert.Len(t, graves.Cards, 1)
+}
+
+func TestUpdateNote(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestNoteService(db)
+	results, err := svc.Import([]models.NoteRow{
+		{Line: 1, NoteType: "Basic (and reversed card)", Deck: "Vocabulary", Fields: map[string]string{"Front": "eat"}},
+	}, models.DuplicateAllow)
+	assert.NoError(t, err)
+	// the reverse card is not created while the back is empty
+	assert.Equal(t, 1, results[0].Cards)
+	nid := results[0].NoteID
+
+	res, err := svc.Update(nid, map[string]string{"Front": "<b>eat</b>", "Back": "ate"}, []string{"verbs"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.NoteRowUpdated, res.Status)
+	assert.Equal(t, 1, res.Cards)
+	var note models.Note
+	assert.NoError(t, db.Get(&note, "SELECT flds, tags, sfld, csum, usn FROM notes WHERE id = ?", nid))
+	assert.Equal(t, models.NoteFields{"<b>eat</b>", "ate"}, note.Fields)
+	assert.Equal(t, " verbs ", note.StringTags)
+	assert.Equal(t, "eat", note.SortField)
+	csum, err := noteChecksum("<b>eat</b>")
+	assert.NoError(t, err)
+	assert.Equal(t, csum, note.Checksum)
+	assert.Equal(t, -1, note.USN)
+	var dids []models.ID
+	assert.NoError(t, db.Select(&dids, "SELECT did FROM cards WHERE nid = ? ORDER BY ord", nid))
+	assert.Len(t, dids, 2)
+	assert.Equal(t, dids[0], dids[1])
+
+	res, err = svc.Update(nid, map[string]string{"Front": "<b>eat</b>", "Back": "ate"}, []string{"verbs"})
+	assert.NoError(t, err)
+	assert.Equal(t, models.NoteRowSkipped, res.Status)
+}
+
+func TestUpdateNoteInvalid(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestNoteService(db)
+	results, err := svc.Import([]models.NoteRow{basicRow(1, "go", "went")}, models.DuplicateAllow)
+	assert.NoError(t, err)
+	nid := results[0].NoteID
+
+	_, err = svc.Update(nid, map[string]string{"Front": "go", "Missing": "value"}, nil)
+	assert.EqualError(t, err, "field \"Missing\" is not defined in Basic")
+	_, err = svc.Update(nid, map[string]string{"Back": "went"}, nil)
+	assert.EqualError(t, err, "first field Front is empty")
+	_, err = svc.Update(1, map[string]string{"Front": "go"}, nil)
+	assert.EqualError(t, err, "note 1 does not exist")
+}
+
+func TestUpdateClozeNote(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestNoteService(db)
+	results, err := svc.Import([]models.NoteRow{
+		{Line: 1, NoteType: "Cloze", Deck: "Default", Fields: map[string]string{"Text": "{{c1::run}}"}},
+	}, models.DuplicateAllow)
+	assert.NoError(t, err)
+
+	res, err := svc.Update(results[0].NoteID, map[string]string{"Text": "{{c1::run}} {{c3::ran}}"}, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, res.Cards)
+	var ords []int
+	assert.NoError(t, db.Select(&ords, "SELECT ord FROM cards WHERE nid = ? ORDER BY ord", results[0].NoteID))
+	assert.Equal(t, []int{0, 2}, ords)
+}
+
+func TestTemplateNonEmpty(t *testing.T) {
+	nonEmpty := map[string]bool{"Front": true, "Back": false}
+	tests := map[string]bool{
+		"{{Front}}":                    true,
+		"{{Back}}":                     false,
+		"{{text:Front}}":               true,
+		"{{#Back}}{{Front}}{{/Back}}":  false,
+		"{{^Back}}{{Front}}{{/Back}}":  true,
+		"{{#Front}}{{Back}}{{/Front}}": false,
+		"{{FrontSide}}<hr>{{ Front }}": true,
+		"no fields":                    false,
+		"{{#Front}}":                   false,
+		"{{^Back}}{{#Front}}{{Front}}{{/Front}}{{/Back}}":  true,
+		"{{^Front}}{{#Back}}x{{/Back}}{{Front}}{{/Front}}": false,
+	}
+	for qfmt, expected := range tests {
+		assert.Equal(t, expected, templateNonEmpty(qfmt, nonEmpty), qfmt)
+	}
+}
+
+func TestDeleteCards(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestNoteService(db)
+	results, err := svc.Import([]models.NoteRow{
+		{Line: 1, NoteType: "Basic (and reversed card)", Deck: "Default", Fields: map[string]string{"Front": "eat", "Back": "ate"}},
+	}, models.DuplicateAllow)
+	assert.NoError(t, err)
+	nid := results[0].NoteID
+	var cids []models.ID
+	assert.NoError(t, db.Select(&cids, "SELECT id FROM cards WHERE nid = ? ORDER BY ord", nid))
+	assert.Len(t, cids, 2)
+
+	// the note keeps its other card
+	res, err := svc.DeleteCards(cids[:1])
+	assert.NoError(t, err)
+	assert.Equal(t, models.DeleteResult{Cards: 1}, res)
+	var notes int
+	assert.NoError(t, db.Get(&notes, "SELECT COUNT() FROM notes WHERE id = ?", nid))
+	assert.Equal(t, 1, notes)
+
+	res, err = svc.DeleteCards(cids[1:])
+	assert.NoError(t, err)
+	assert.Equal(t, models.DeleteResult{Cards: 1, Notes: 1}, res)
+	assert.NoError(t, db.Get(&notes, "SELECT COUNT() FROM notes WHERE id = ?", nid))
+	assert.Equal(t, 0, notes)
+	var graves []int
+	assert.NoError(t, db.Select(&graves, "SELECT type FROM graves WHERE oid IN (?, ?, ?) ORDER BY type", cids[0], cids[1], nid))
+	assert.Equal(t, []int{int(models.GraveTypeCard), int(models.GraveTypeCard), int(models.GraveTypeNote)}, graves)
+}
+
+func TestDeleteNotes(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestNoteService(db)
+	results, err := svc.Import([]models.NoteRow{
+		{Line: 1, NoteType: "Basic (and reversed card)", Deck: "Default", Fields: map[string]string{"Front": "eat", "Back": "ate"}},
+	}, models.DuplicateAllow)
+	assert.NoError(t, err)
+	nid := results[0].NoteID
+
+	res, err := svc.Delete([]models.ID{nid})
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.DeleteResult{Cards: 2, Notes: 1}, res)
+	var cards int
+	assert.NoError(t, db.Get(&cards, "SELECT COUNT() FROM cards WHERE nid = ?", nid))
+	assert.Equal(t, 0, cards)
+	var graves int
+	assert.NoError(t, db.Get(&graves, "SELECT COUNT() FROM graves WHERE usn = -1"))
+	assert.Equal(t, 3, graves)
+}
+
+func TestToggleMark(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestNoteService(db)
+	results, err := svc.Import([]models.NoteRow{basicRow(1, "eat", "ate", "verbs", "Marked")}, models.DuplicateAllow)
+	assert.NoError(t, err)
+	nid := results[0].NoteID
+	tags := func() (tags string) {
+		assert.NoError(t, db.Get(&tags, "SELECT tags FROM notes WHERE id = ?", nid))
+		return
+	}
+
+	// the tag is matched ignoring the case
+	marked, err := svc.ToggleMark(nid)
+	assert.NoError(t, err)
+	assert.False(t, marked)
+	assert.Equal(t, " verbs ", tags())
+	marked, err = svc.ToggleMark(nid)
+	assert.NoError(t, err)
+	assert.True(t, marked)
+	assert.Equal(t, " verbs marked ", tags())
+	cache, err := repos.NewColRepository(db).TagCache()
+	assert.NoError(t, err)
+	assert.Contains(t, cache, models.MarkedTag)
+
+	_, err = svc.ToggleMark(1)
+	assert.Error(t, err)
+}
@@ -0,0 +1,796 @@
+package services
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	repos "github.com/aerex/go-anki/api/sql/sqlite/repositories"
+	"github.com/aerex/go-anki/internal/utils"
+	"github.com/aerex/go-anki/pkg/apkg"
+	"github.com/aerex/go-anki/pkg/media"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/aerex/go-anki/pkg/template"
+	"github.com/jmoiron/sqlx"
+)
+
+// The ease factor given to cards exported without scheduling
+const startingFactor = 2500
+
+type PackageService struct {
+	colRepo     repos.ColRepo
+	deckRepo    repos.DeckRepo
+	packageRepo repos.PackageRepo
+}
+
+func NewPackageService(c repos.ColRepo, d repos.DeckRepo, p repos.PackageRepo) PackageService {
+	return PackageService{
+		colRepo:     c,
+		deckRepo:    d,
+		packageRepo: p,
+	}
+}
+
+// collectionRepos are the repositories of the collection stored in a package
+type collectionRepos struct {
+	conn        *sqlx.DB
+	colRepo     repos.ColRepo
+	deckRepo    repos.DeckRepo
+	packageRepo repos.PackageRepo
+}
+
+func openPackageCollection(path string) (*collectionRepos, error) {
+	conn, err := sqlx.Connect("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	return &collectionRepos{
+		conn:        conn,
+		colRepo:     repos.NewColRepository(conn),
+		deckRepo:    repos.NewDeckRepository(conn),
+		packageRepo: repos.NewPackageRepository(conn),
+	}, nil
+}
+
+// Export writes the deck, its children and their cards in a deck package (.apkg)
+// See AnkiExporter in https://github.com/ankitects/anki/blob/2.1.15/anki/exporting.py
+func (p *PackageService) Export(deckName string, path string, opts models.ExportOptions, manager *media.Manager) (res models.ExportResult, err error) {
+	decksByName, err := p.deckRepo.DeckNameMap()
+	if err != nil {
+		return
+	}
+	deck, exists := decksByName[deckName]
+	if !exists {
+		return res, fmt.Errorf("deck %s does not exist", deckName)
+	}
+	children, err := p.deckRepo.ChildrenDeckIDs(deck.ID)
+	if err != nil {
+		return
+	}
+	deckIDs := append([]models.ID{deck.ID}, children...)
+
+	cards, err := p.exportedCards(deckIDs)
+	if err != nil {
+		return
+	}
+	var cardIDs, noteIDs []models.ID
+	seenNotes := make(map[models.ID]bool)
+	for _, card := range cards {
+		cardIDs = append(cardIDs, rowID(card, repos.CardIDColumn))
+		nid := rowID(card, repos.CardNIDColumn)
+		if !seenNotes[nid] {
+			seenNotes[nid] = true
+			noteIDs = append(noteIDs, nid)
+		}
+	}
+	notes, err := p.packageRepo.Rows("notes", "id", noteIDs)
+	if err != nil {
+		return
+	}
+	var revlog []models.SyncRow
+	if opts.WithScheduling {
+		if revlog, err = p.packageRepo.Rows("revlog", "cid", cardIDs); err != nil {
+			return
+		}
+	} else {
+		resetScheduling(cards, notes)
+	}
+	for _, rows := range [][]models.SyncRow{notes, cards, revlog} {
+		setUSN(rows, 0)
+	}
+
+	tmp, err := os.MkdirTemp("", "go-anki-export-*")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(tmp)
+	colPath := filepath.Join(tmp, apkg.CollectionFile)
+	dst, err := openPackageCollection(colPath)
+	if err != nil {
+		return
+	}
+	defer dst.conn.Close()
+	if err = repos.CreateCollection(dst.conn); err != nil {
+		return
+	}
+	if err = p.exportCol(dst, deck, deckIDs, notes, opts); err != nil {
+		return
+	}
+	for table, rows := range map[string][]models.SyncRow{"notes": notes, "cards": cards, "revlog": revlog} {
+		if err = dst.packageRepo.InsertRows(table, rows); err != nil {
+			return
+		}
+	}
+	if err = dst.conn.Close(); err != nil {
+		return
+	}
+
+	files := make(map[string]string)
+	if opts.WithMedia && manager != nil {
+		for _, note := range notes {
+			for _, ref := range utils.MediaReferences(rowString(note, repos.NoteFieldsColumn)) {
+				file := filepath.Join(manager.Dir, ref)
+				if _, err := os.Stat(file); err == nil {
+					files[ref] = file
+				}
+			}
+		}
+	}
+	if opts.WithLatex && manager != nil {
+		if err = p.exportLatex(notes, manager.Dir, files); err != nil {
+			return
+		}
+	}
+	if err = apkg.Write(path, colPath, files); err != nil {
+		return
+	}
+	return models.ExportResult{Notes: len(notes), Cards: len(cards), Media: len(files)}, nil
+}
+
+// exportLatex adds the images of the LaTeX of the notes to the files of the package. The images missing
+// from the media folder are rendered with the preamble and the postamble of the note type of the note
+func (p *PackageService) exportLatex(notes []models.SyncRow, mediaDir string, files map[string]string) error {
+	noteTypes, err := p.colRepo.NoteTypes()
+	if err != nil {
+		return err
+	}
+	for _, note := range notes {
+		noteType, exists := noteTypes[rowID(note, repos.NoteMIDColumn)]
+		if !exists {
+			continue
+		}
+		for _, field := range strings.Split(rowString(note, repos.NoteFieldsColumn), "\x1f") {
+			images, err := template.RenderLatexImages(field, *noteType, mediaDir)
+			if err != nil {
+				return err
+			}
+			for _, image := range images {
+				files[image] = filepath.Join(mediaDir, image)
+			}
+		}
+	}
+	return nil
+}
+
+// exportedCards retrieves the cards of the decks including the cards moved to a filtered deck.
+// The cards in a filtered deck are returned to their home deck
+func (p *PackageService) exportedCards(deckIDs []models.ID) (cards []models.SyncRow, err error) {
+	homeCards, err := p.packageRepo.Rows("cards", "did", deckIDs)
+	if err != nil {
+		return
+	}
+	filteredCards, err := p.packageRepo.Rows("cards", "odid", deckIDs)
+	if err != nil {
+		return
+	}
+	seen := make(map[models.ID]bool)
+	for _, card := range append(homeCards, filteredCards...) {
+		id := rowID(card, repos.CardIDColumn)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		removeFromFilteredDeck(card)
+		cards = append(cards, card)
+	}
+	return
+}
+
+// exportCol saves the note types, decks and deck configurations used by the exported cards
+func (p *PackageService) exportCol(dst *collectionRepos, deck models.Deck, deckIDs []models.ID, notes []models.SyncRow, opts models.ExportOptions) error {
+	crt, err := p.colRepo.CreatedTime()
+	if err != nil {
+		return err
+	}
+	// the due date of review cards is relative to the creation time of the collection
+	if err := dst.colRepo.SaveCreatedTime(crt); err != nil {
+		return err
+	}
+
+	noteTypes, err := p.colRepo.NoteTypes()
+	if err != nil {
+		return err
+	}
+	exportedTypes := make(models.NoteTypes)
+	tags := make(models.TagCache)
+	for _, note := range notes {
+		mid := rowID(note, repos.NoteMIDColumn)
+		noteType, exists := noteTypes[mid]
+		if !exists {
+			return fmt.Errorf("note type %d of note %d does not exist", mid, rowID(note, repos.NoteIDColumn))
+		}
+		noteType.USN = 0
+		exportedTypes[mid] = noteType
+		for _, tag := range strings.Fields(rowString(note, repos.NoteTagsColumn)) {
+			tags[tag] = 0
+		}
+	}
+	if err := dst.colRepo.SaveNoteTypes(exportedTypes); err != nil {
+		return err
+	}
+	if err := dst.colRepo.SaveTags(tags); err != nil {
+		return err
+	}
+
+	allDecks, err := p.deckRepo.Decks()
+	if err != nil {
+		return err
+	}
+	parents, err := p.deckRepo.Parents(deck.ID)
+	if err != nil {
+		return err
+	}
+	ids := append([]models.ID{}, deckIDs...)
+	for _, parent := range parents {
+		ids = append(ids, parent.ID)
+	}
+	confs, err := p.deckRepo.Confs()
+	if err != nil {
+		return err
+	}
+	exportedDecks := make(models.Decks)
+	exportedConfs := make(models.DeckConfigs)
+	for _, id := range ids {
+		d, exists := allDecks[id]
+		if !exists || bool(d.Dyn) {
+			continue
+		}
+		d.USN = 0
+		if !opts.WithScheduling {
+			// the deck options are personal so the default options are used instead
+			d.Conf = 1
+		}
+		if conf, exists := confs[models.ID(d.Conf)]; exists {
+			exportedConfs[conf.ID] = conf
+		}
+		exportedDecks[id] = d
+	}
+	if err := dst.deckRepo.SaveAll(exportedDecks); err != nil {
+		return err
+	}
+	return dst.deckRepo.SaveConfs(exportedConfs)
+}
+
+// Import adds the notes, cards and media of a deck package (.apkg) to the collection.
+// Notes are matched with the notes of the collection by their guid and are only
+// updated when the package has a more recent version of the note.
+// The changes of the collection are made inside tx and the media files are only
+// copied to the media folder once tx succeeds so a failed import leaves no files behind
+// See Anki2Importer in https://github.com/ankitects/anki/blob/2.1.15/anki/importing/anki2.py
+func (p *PackageService) Import(path string, manager *media.Manager, tx func(func() error) error) (res models.ImportResult, err error) {
+	tmp, err := os.MkdirTemp("", "go-anki-import-*")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(tmp)
+	pkg, err := apkg.Extract(path, tmp)
+	if err != nil {
+		return
+	}
+	src, err := openPackageCollection(pkg.Collection)
+	if err != nil {
+		return
+	}
+	defer src.conn.Close()
+
+	// files are renamed when a different file with the same name is in the media folder
+	renamed := make(map[string]string)
+	// the files of the package to copy keyed by their name in the media folder
+	files := make(map[string]string)
+	if manager != nil {
+		for name, file := range pkg.Media {
+			added, exists, err := manager.NameOf(file, name)
+			if err != nil {
+				return res, err
+			}
+			if added != name {
+				renamed[name] = added
+			}
+			if !exists {
+				files[added] = file
+			}
+		}
+	}
+
+	err = tx(func() error {
+		imp := &importer{PackageService: p, src: src, res: &res, renamed: renamed}
+		if err := imp.importNoteTypes(); err != nil {
+			return err
+		}
+		if err := imp.prepareDecks(); err != nil {
+			return err
+		}
+		if err := imp.importNotes(); err != nil {
+			return err
+		}
+		if err := imp.importCards(); err != nil {
+			return err
+		}
+		if imp.decksChanged {
+			if err := p.deckRepo.SaveAll(imp.dstDecks); err != nil {
+				return err
+			}
+			if err := p.deckRepo.SaveConfs(imp.dstConfs); err != nil {
+				return err
+			}
+		}
+		return p.colRepo.UpdateMod()
+	})
+	if err != nil {
+		return
+	}
+	for name, file := range files {
+		if err = manager.Replace(file, name); err != nil {
+			return
+		}
+	}
+	if manager != nil {
+		res.Media = len(pkg.Media)
+	}
+	return
+}
+
+// importer holds the state of an import which maps the ids of the package to the ids of the collection
+type importer struct {
+	*PackageService
+	src     *collectionRepos
+	res     *models.ImportResult
+	renamed map[string]string
+
+	midMap  map[models.ID]models.ID
+	noteMap map[models.ID]models.ID
+	didMap  map[models.ID]models.ID
+
+	srcDecks     models.Decks
+	srcConfs     models.DeckConfigs
+	dstDecks     models.Decks
+	dstConfs     models.DeckConfigs
+	decksChanged bool
+}
+
+// importNoteTypes adds the note types of the package that are missing from the collection.
+// A note type with the same id but different fields or templates is added with a new id
+func (i *importer) importNoteTypes() error {
+	srcTypes, err := i.src.colRepo.NoteTypes()
+	if err != nil {
+		return err
+	}
+	dstTypes, err := i.colRepo.NoteTypes()
+	if err != nil {
+		return err
+	}
+	i.midMap = make(map[models.ID]models.ID)
+	changed := false
+	for _, mid := range sortedIDs(srcTypes) {
+		noteType := srcTypes[mid]
+		id := mid
+		for {
+			existing, exists := dstTypes[id]
+			if !exists {
+				noteType.ID = id
+				noteType.USN = -1
+				noteType.Mod = models.UnixTime(time.Now().Unix())
+				dstTypes[id] = noteType
+				changed = true
+				break
+			}
+			if sameSchema(existing, noteType) {
+				break
+			}
+			id++
+		}
+		i.midMap[mid] = id
+	}
+	if !changed {
+		return nil
+	}
+	return i.colRepo.SaveNoteTypes(dstTypes)
+}
+
+// sameSchema returns true if both note types have the same fields and templates
+func sameSchema(a, b *models.NoteType) bool {
+	if len(a.Fields) != len(b.Fields) || len(a.Templates) != len(b.Templates) {
+		return false
+	}
+	for idx := range a.Fields {
+		if a.Fields[idx].Name != b.Fields[idx].Name {
+			return false
+		}
+	}
+	for idx := range a.Templates {
+		if a.Templates[idx].Name != b.Templates[idx].Name {
+			return false
+		}
+	}
+	return true
+}
+
+func (i *importer) prepareDecks() (err error) {
+	if i.srcDecks, err = i.src.deckRepo.Decks(); err != nil {
+		return
+	}
+	if i.srcConfs, err = i.src.deckRepo.Confs(); err != nil {
+		return
+	}
+	if i.dstDecks, err = i.deckRepo.Decks(); err != nil {
+		return
+	}
+	if i.dstConfs, err = i.deckRepo.Confs(); err != nil {
+		return
+	}
+	i.didMap = make(map[models.ID]models.ID)
+	return
+}
+
+// importDeck returns the id of the deck with the same name in the collection.
+// Missing decks are created along with their parents
+func (i *importer) importDeck(srcID models.ID) (models.ID, error) {
+	if id, exists := i.didMap[srcID]; exists {
+		return id, nil
+	}
+	srcDeck, exists := i.srcDecks[srcID]
+	if !exists {
+		return 0, fmt.Errorf("deck %d does not exist in package", srcID)
+	}
+	dstByName := make(map[string]*models.Deck)
+	for _, deck := range i.dstDecks {
+		dstByName[deck.Name] = deck
+	}
+	srcByName := make(map[string]*models.Deck)
+	for _, deck := range i.srcDecks {
+		srcByName[deck.Name] = deck
+	}
+
+	var id models.ID
+	parts := strings.Split(srcDeck.Name, "::")
+	for idx := range parts {
+		name := strings.Join(parts[:idx+1], "::")
+		if existing, exists := dstByName[name]; exists {
+			id = existing.ID
+			continue
+		}
+		deck := models.Deck{Name: name, Conf: 1}
+		if template, exists := srcByName[name]; exists {
+			deck = *template
+		}
+		id = deck.ID
+		if id == 0 || i.dstDecks[id] != nil {
+			id = models.ID(time.Now().UnixMilli())
+			for i.dstDecks[id] != nil {
+				id++
+			}
+		}
+		now := models.UnixTime(time.Now().Unix())
+		deck.ID = id
+		deck.USN = -1
+		deck.Mod = &now
+		i.importDeckConf(&deck)
+		i.dstDecks[id] = &deck
+		dstByName[name] = &deck
+		i.decksChanged = true
+	}
+	i.didMap[srcID] = id
+	return id, nil
+}
+
+// importDeckConf copies the options of the deck unless the collection already has them
+func (i *importer) importDeckConf(deck *models.Deck) {
+	confID := models.ID(deck.Conf)
+	if _, exists := i.dstConfs[confID]; exists {
+		return
+	}
+	conf, exists := i.srcConfs[confID]
+	if !exists {
+		deck.Conf = 1
+		return
+	}
+	conf.USN = -1
+	i.dstConfs[confID] = conf
+}
+
+func (i *importer) importNotes() error {
+	srcIDs, err := i.src.packageRepo.IDs("notes")
+	if err != nil {
+		return err
+	}
+	notes, err := i.src.packageRepo.Rows("notes", "id", sortedIDs(srcIDs))
+	if err != nil {
+		return err
+	}
+	byGUID, err := i.packageRepo.NotesByGUID()
+	if err != nil {
+		return err
+	}
+	usedIDs, err := i.packageRepo.IDs("notes")
+	if err != nil {
+		return err
+	}
+	tags, err := i.colRepo.TagCache()
+	if err != nil {
+		return err
+	}
+	if tags == nil {
+		tags = make(models.TagCache)
+	}
+
+	i.noteMap = make(map[models.ID]models.ID)
+	var rows []models.SyncRow
+	for _, note := range notes {
+		srcID := rowID(note, repos.NoteIDColumn)
+		mid, exists := i.midMap[rowID(note, repos.NoteMIDColumn)]
+		if !exists {
+			return fmt.Errorf("note type of note %d does not exist in package", srcID)
+		}
+		note[repos.NoteMIDColumn] = int64(mid)
+		// notes created by older clients may not have a globally unique id
+		if rowString(note, repos.NoteGUIDColumn) == "" {
+			note[repos.NoteGUIDColumn] = utils.GUID64()
+		}
+
+		if existing, exists := byGUID[rowString(note, repos.NoteGUIDColumn)]; exists {
+			if existing.ModelID != mid {
+				i.res.Duplicates++
+				continue
+			}
+			i.noteMap[srcID] = existing.ID
+			if existing.Mod >= int64(rowID(note, repos.NoteModColumn)) {
+				i.res.Duplicates++
+				continue
+			}
+			note[repos.NoteIDColumn] = int64(existing.ID)
+			i.res.Updated++
+		} else {
+			id := srcID
+			for usedIDs[id] {
+				id++
+			}
+			usedIDs[id] = true
+			note[repos.NoteIDColumn] = int64(id)
+			i.noteMap[srcID] = id
+			i.res.Notes++
+		}
+		note[repos.NoteUSNColumn] = int64(-1)
+		note[repos.NoteFieldsColumn] = renameMedia(rowString(note, repos.NoteFieldsColumn), i.renamed)
+		for _, tag := range strings.Fields(rowString(note, repos.NoteTagsColumn)) {
+			if _, exists := tags[tag]; !exists {
+				tags[tag] = -1
+			}
+		}
+		rows = append(rows, note)
+	}
+	if err := i.packageRepo.InsertRows("notes", rows); err != nil {
+		return err
+	}
+	return i.colRepo.SaveTags(tags)
+}
+
+// importCards adds the cards of the imported notes that are missing from the collection
+// along with their review history
+func (i *importer) importCards() error {
+	srcIDs, err := i.src.packageRepo.IDs("cards")
+	if err != nil {
+		return err
+	}
+	cards, err := i.src.packageRepo.Rows("cards", "id", sortedIDs(srcIDs))
+	if err != nil {
+		return err
+	}
+	ords, err := i.packageRepo.CardOrds()
+	if err != nil {
+		return err
+	}
+	usedIDs, err := i.packageRepo.IDs("cards")
+	if err != nil {
+		return err
+	}
+	srcCrt, err := i.src.colRepo.CreatedTime()
+	if err != nil {
+		return err
+	}
+	dstCrt, err := i.colRepo.CreatedTime()
+	if err != nil {
+		return err
+	}
+	// review cards are due a number of days after the creation of the collection
+	dayOffset := (int64(srcCrt) - int64(dstCrt)) / 86400
+
+	cardMap := make(map[models.ID]models.ID)
+	var rows []models.SyncRow
+	for _, card := range cards {
+		srcID := rowID(card, repos.CardIDColumn)
+		nid, exists := i.noteMap[rowID(card, repos.CardNIDColumn)]
+		if !exists {
+			continue
+		}
+		ord := int(rowID(card, repos.CardOrdColumn))
+		if hasOrd(ords[nid], ord) {
+			continue
+		}
+		ords[nid] = append(ords[nid], ord)
+		removeFromFilteredDeck(card)
+		did, err := i.importDeck(rowID(card, repos.CardDIDColumn))
+		if err != nil {
+			return err
+		}
+		id := srcID
+		for usedIDs[id] {
+			id++
+		}
+		usedIDs[id] = true
+		cardMap[srcID] = id
+
+		card[repos.CardIDColumn] = int64(id)
+		card[repos.CardNIDColumn] = int64(nid)
+		card[repos.CardDIDColumn] = int64(did)
+		card[repos.CardUSNColumn] = int64(-1)
+		if cardType := models.CardType(rowID(card, repos.CardTypeColumn)); cardType == models.CardTypeReview || cardType == models.CardTypeRelearning {
+			card[repos.CardDueColumn] = int64(rowID(card, repos.CardDueColumn)) + dayOffset
+		}
+		rows = append(rows, card)
+		i.res.Cards++
+	}
+	if err := i.packageRepo.InsertRows("cards", rows); err != nil {
+		return err
+	}
+
+	revlog, err := i.src.packageRepo.Rows("revlog", "cid", sortedIDs(cardMap))
+	if err != nil {
+		return err
+	}
+	usedRevlog, err := i.packageRepo.IDs("revlog")
+	if err != nil {
+		return err
+	}
+	var revRows []models.SyncRow
+	for _, rev := range revlog {
+		if usedRevlog[rowID(rev, 0)] {
+			continue
+		}
+		rev[repos.RevlogCIDColumn] = int64(cardMap[rowID(rev, repos.RevlogCIDColumn)])
+		rev[repos.RevlogUSNColumn] = int64(-1)
+		revRows = append(revRows, rev)
+	}
+	return i.packageRepo.InsertRows("revlog", revRows)
+}
+
+// resetScheduling turns the cards into new cards and removes the tags added by the scheduler
+func resetScheduling(cards []models.SyncRow, notes []models.SyncRow) {
+	for idx, card := range cards {
+		card[repos.CardTypeColumn] = int64(models.CardTypeNew)
+		card[repos.CardQueueColumn] = int64(models.CardQueueNew)
+		card[repos.CardDueColumn] = int64(idx + 1)
+		card[repos.CardIvlColumn] = int64(0)
+		card[repos.CardFactorColumn] = int64(startingFactor)
+		card[repos.CardRepsColumn] = int64(0)
+		card[repos.CardLapsesColumn] = int64(0)
+		card[repos.CardLeftColumn] = int64(0)
+	}
+	for _, note := range notes {
+		var tags []string
+		for _, tag := range strings.Fields(rowString(note, repos.NoteTagsColumn)) {
+			if lower := strings.ToLower(tag); lower != "marked" && lower != "leech" {
+				tags = append(tags, tag)
+			}
+		}
+		if len(tags) == 0 {
+			note[repos.NoteTagsColumn] = ""
+		} else {
+			note[repos.NoteTagsColumn] = " " + strings.Join(tags, " ") + " "
+		}
+	}
+}
+
+// removeFromFilteredDeck moves a card in a filtered deck back to its home deck
+func removeFromFilteredDeck(card models.SyncRow) {
+	odid := rowID(card, repos.CardODIDColumn)
+	if odid == 0 {
+		return
+	}
+	card[repos.CardDIDColumn] = int64(odid)
+	card[repos.CardDueColumn] = int64(rowID(card, repos.CardODueColumn))
+	card[repos.CardODIDColumn] = int64(0)
+	card[repos.CardODueColumn] = int64(0)
+}
+
+// renameMedia updates the references to the media files renamed during the import.
+// Only the whole names of the images (ie: src="a.png") and of the sounds (ie: [sound:a.mp3]) are replaced
+func renameMedia(fields string, renamed map[string]string) string {
+	if len(renamed) == 0 {
+		return fields
+	}
+	for _, re := range []*regexp.Regexp{utils.MEDIA_IMG_REGEX, utils.MEDIA_SOUND_REGEX} {
+		var out strings.Builder
+		last := 0
+		for _, match := range re.FindAllStringSubmatchIndex(fields, -1) {
+			start, end := match[2], match[3]
+			name, exists := renamed[fields[start:end]]
+			if !exists {
+				// the names are escaped in the html of the fields
+				if name, exists = renamed[html.UnescapeString(fields[start:end])]; exists {
+					name = html.EscapeString(name)
+				}
+			}
+			if !exists {
+				continue
+			}
+			out.WriteString(fields[last:start])
+			out.WriteString(name)
+			last = end
+		}
+		out.WriteString(fields[last:])
+		fields = out.String()
+	}
+	return fields
+}
+
+func setUSN(rows []models.SyncRow, usn int) {
+	for _, row := range rows {
+		// the usn is the third column of the revlog and the fifth of notes and cards
+		switch len(row) {
+		case 9:
+			row[repos.RevlogUSNColumn] = int64(usn)
+		case 11:
+			row[repos.NoteUSNColumn] = int64(usn)
+		case 18:
+			row[repos.CardUSNColumn] = int64(usn)
+		}
+	}
+}
+
+func hasOrd(ords []int, ord int) bool {
+	for _, o := range ords {
+		if o == ord {
+			return true
+		}
+	}
+	return false
+}
+
+func rowID(row models.SyncRow, idx int) models.ID {
+	switch v := row[idx].(type) {
+	case int64:
+		return models.ID(v)
+	case float64:
+		return models.ID(v)
+	}
+	return 0
+}
+
+func rowString(row models.SyncRow, idx int) string {
+	s, _ := row[idx].(string)
+	return s
+}
+
+func sortedIDs[T any](m map[models.ID]T) []models.ID {
+	ids := make([]models.ID, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(a, b int) bool { return ids[a] < ids[b] })
+	return ids
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	repos "github.com/aerex/go-anki/api/sql/sqlite/repositories"
+	"github.com/aerex/go-anki/pkg/apkg"
+	"github.com/aerex/go-anki/pkg/media"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/aerex/go-anki/pkg/template"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+const exportedDeck = "Investment Terms"
+
+func newTestPackageService(db *sqlx.DB) PackageService {
+	return NewPackageService(repos.NewColRepository(db), repos.NewDeckRepository(db), repos.NewPackageRepository(db))
+}
+
+// runTx runs the changes of an import without a transaction
+func runTx(cb func() error) error {
+	return cb()
+}
+
+func exportTestDeck(t *testing.T, opts models.ExportOptions) string {
+	svc := newTestPackageService(setupSyncDB(t))
+	path := filepath.Join(t.TempDir(), "deck.apkg")
+	if _, err := svc.Export(exportedDeck, path, opts, nil); err != nil {
+		t.Fatalf("could not export deck: %v", err)
+	}
+	return path
+}
+
+func openPackage(t *testing.T, path string) *sqlx.DB {
+	pkg, err := apkg.Extract(path, t.TempDir())
+	if err != nil {
+		t.Fatalf("could not extract package: %v", err)
+	}
+	db := sqlx.MustConnect("sqlite3", pkg.Collection)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func emptyCollection(t *testing.T) *sqlx.DB {
+	db := sqlx.MustConnect("sqlite3", filepath.Join(t.TempDir(), "collection.anki2"))
+	t.Cleanup(func() { db.Close() })
+	if err := repos.CreateCollection(db); err != nil {
+		t.Fatalf("could not create collection: %v", err)
+	}
+	return db
+}
+
+func TestExportPackage(t *testing.T) {
+	svc := newTestPackageService(setupSyncDB(t))
+	path := filepath.Join(t.TempDir(), "deck.apkg")
+
+	res, err := svc.Export(exportedDeck, path, models.ExportOptions{}, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.ExportResult{Notes: 7, Cards: 13}, res)
+	db := openPackage(t, path)
+	var newCards, revlog, pending int
+	db.Get(&newCards, "SELECT count() FROM cards WHERE type = 0 AND queue = 0")
+	db.Get(&revlog, "SELECT count() FROM revlog")
+	db.Get(&pending, "SELECT count() FROM notes WHERE usn = -1")
+	assert.Equal(t, 13, newCards)
+	assert.Equal(t, 0, revlog)
+	assert.Equal(t, 0, pending)
+	decks, err := repos.NewDeckRepository(db).DeckNameMap()
+	assert.NoError(t, err)
+	assert.Contains(t, decks, exportedDeck)
+	noteTypes, err := repos.NewColRepository(db).NoteTypes()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, noteTypes)
+}
+
+func TestExportPackageWithScheduling(t *testing.T) {
+	path := exportTestDeck(t, models.ExportOptions{WithScheduling: true})
+
+	db := openPackage(t, path)
+	var reviewCards, revlog int
+	db.Get(&reviewCards, "SELECT count() FROM cards WHERE type = 2")
+	db.Get(&revlog, "SELECT count() FROM revlog")
+	assert.Equal(t, 13, reviewCards)
+	assert.Equal(t, 55, revlog)
+}
+
+func TestExportPackageWithLatex(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestPackageService(db)
+	decks, err := repos.NewDeckRepository(db).DeckNameMap()
+	assert.NoError(t, err)
+	_, err = db.Exec("UPDATE notes SET flds = '[$]x^2[/$]' || flds WHERE id = (SELECT nid FROM cards WHERE did = ? LIMIT 1)",
+		decks[exportedDeck].ID)
+	assert.NoError(t, err)
+	manager, err := media.NewManager(filepath.Join(t.TempDir(), "collection.anki2"))
+	assert.NoError(t, err)
+	defer manager.Close()
+	commands := template.LATEX_COMMANDS
+	t.Cleanup(func() { template.LATEX_COMMANDS = commands })
+	template.LATEX_COMMANDS = [][]string{{"sh", "-c", "echo png > tmp.png"}}
+	path := filepath.Join(t.TempDir(), "deck.apkg")
+
+	res, err := svc.Export(exportedDeck, path, models.ExportOptions{WithLatex: true}, manager)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, res.Media)
+	image := "latex-026326cda34d40679435c991e5a4711df27dff8f.png"
+	assert.FileExists(t, filepath.Join(manager.Dir, image), "the image should be cached in the media folder")
+	pkg, err := apkg.Extract(path, t.TempDir())
+	assert.NoError(t, err)
+	assert.Contains(t, pkg.Media, image)
+}
+
+func TestExportPackageUnknownDeck(t *testing.T) {
+	svc := newTestPackageService(setupSyncDB(t))
+
+	_, err := svc.Export("Missing", filepath.Join(t.TempDir(), "deck.apkg"), models.ExportOptions{}, nil)
+
+	assert.EqualError(t, err, "deck Missing does not exist")
+}
+
+func TestImportPackageIntoEmptyCollection(t *testing.T) {
+	path := exportTestDeck(t, models.ExportOptions{WithScheduling: true})
+	db := emptyCollection(t)
+	svc := newTestPackageService(db)
+
+	res, err := svc.Import(path, nil, runTx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.ImportResult{Notes: 7, Cards: 13}, res)
+	var revlog, pending int
+	db.Get(&revlog, "SELECT count() FROM revlog")
+	db.Get(&pending, "SELECT count() FROM cards WHERE usn = -1")
+	assert.Equal(t, 55, revlog)
+	assert.Equal(t, 13, pending, "imported cards should be sent on the next sync")
+	decks, err := repos.NewDeckRepository(db).DeckNameMap()
+	assert.NoError(t, err)
+	assert.Contains(t, decks, exportedDeck)
+	var cardsInDeck int
+	db.Get(&cardsInDeck, "SELECT count() FROM cards WHERE did = ?", decks[exportedDeck].ID)
+	assert.Equal(t, 13, cardsInDeck)
+}
+
+func TestImportPackageSkipsDuplicates(t *testing.T) {
+	path := exportTestDeck(t, models.ExportOptions{})
+	db := setupSyncDB(t)
+	svc := newTestPackageService(db)
+
+	res, err := svc.Import(path, nil, runTx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.ImportResult{Duplicates: 7}, res)
+}
+
+func TestImportPackageUpdatesOlderNotes(t *testing.T) {
+	path := exportTestDeck(t, models.ExportOptions{})
+	db := setupSyncDB(t)
+	var nid int64
+	db.Get(&nid, "SELECT nid FROM cards WHERE did = 1514136055392 LIMIT 1")
+	db.MustExec("UPDATE notes SET mod = 0, flds = 'old' WHERE id = ?", nid)
+	svc := newTestPackageService(db)
+
+	res, err := svc.Import(path, nil, runTx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.ImportResult{Updated: 1, Duplicates: 6}, res)
+	var flds string
+	db.Get(&flds, "SELECT flds FROM notes WHERE id = ?", nid)
+	assert.NotEqual(t, "old", flds)
+}
+
+// mediaPackage writes a package with a single media file and returns it with an empty media folder
+func mediaPackage(t *testing.T) (string, *media.Manager) {
+	dir := t.TempDir()
+	colPath := filepath.Join(dir, "collection.anki2")
+	col := sqlx.MustConnect("sqlite3", colPath)
+	assert.NoError(t, repos.CreateCollection(col))
+	col.Close()
+	img := filepath.Join(dir, "cat.jpg")
+	os.WriteFile(img, []byte("cat"), 0644)
+	path := filepath.Join(dir, "media.apkg")
+	assert.NoError(t, apkg.Write(path, colPath, map[string]string{"cat.jpg": img}))
+	manager, err := media.NewManager(filepath.Join(t.TempDir(), "collection.anki2"))
+	assert.NoError(t, err)
+	t.Cleanup(func() { manager.Close() })
+	return path, manager
+}
+
+func TestImportPackageMedia(t *testing.T) {
+	path, manager := mediaPackage(t)
+	svc := newTestPackageService(emptyCollection(t))
+
+	res, err := svc.Import(path, manager, runTx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, res.Media)
+	assert.FileExists(t, filepath.Join(manager.Dir, "cat.jpg"))
+}
+
+func TestImportPackageMediaNotCopiedOnFailure(t *testing.T) {
+	path, manager := mediaPackage(t)
+	svc := newTestPackageService(emptyCollection(t))
+
+	_, err := svc.Import(path, manager, func(cb func() error) error {
+		if err := cb(); err != nil {
+			return err
+		}
+		return errors.New("rolled back")
+	})
+
+	assert.EqualError(t, err, "rolled back")
+	assert.NoFileExists(t, filepath.Join(manager.Dir, "cat.jpg"))
+	var dirty int
+	assert.NoError(t, manager.Conn.Get(&dirty, "SELECT count() FROM media WHERE dirty = 1"))
+	assert.Zero(t, dirty)
+}
+
+func TestRenameMedia(t *testing.T) {
+	renamed := map[string]string{"a.png": "a-1234.png", "a&b.mp3": "a&b-1234.mp3"}
+	tests := []struct {
+		fields   string
+		expected string
+	}{
+		{fields: `<img src="a.png">`, expected: `<img src="a-1234.png">`},
+		{fields: `<img src="ba.png"><img src='a.png'>`, expected: `<img src="ba.png"><img src='a-1234.png'>`},
+		{fields: "a.png\x1f[sound:a&amp;b.mp3]", expected: "a.png\x1f[sound:a&amp;b-1234.mp3]"},
+		{fields: "[sound:a.png.mp3]", expected: "[sound:a.png.mp3]"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, renameMedia(tt.fields, renamed), tt.fields)
+	}
+}
@@ -0,0 +1,207 @@
+package sched
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"time"
+
+	ankisql "github.com/aerex/go-anki/api/sql"
+	repos "github.com/aerex/go-anki/api/sql/sqlite/repositories"
+	"github.com/aerex/go-anki/api/sql/sqlite/services/sched/fsrs"
+	"github.com/aerex/go-anki/internal/utils"
+	"github.com/aerex/go-anki/pkg/models"
+)
+
+// 3, 3-7 or 3! to reset the interval
+var dueDateRe = regexp.MustCompile(`^\s*(\d+)\s*(?:-\s*(\d+))?\s*(!)?\s*$`)
+
+// CardActions changes the cards outside of the answers the same way in all the versions of the scheduler
+type CardActions struct {
+	ColRepo    repos.ColRepo
+	CardRepo   repos.CardRepo
+	DeckRepo   repos.DeckRepo
+	RevLogRepo repos.RevLogRepo
+	Server     bool
+}
+
+func NewCardActions(c repos.ColRepo, cd repos.CardRepo, d repos.DeckRepo, r repos.RevLogRepo, server bool) CardActions {
+	return CardActions{
+		ColRepo:    c,
+		CardRepo:   cd,
+		DeckRepo:   d,
+		RevLogRepo: r,
+		Server:     server,
+	}
+}
+
+// BuryCards hides the cards until the next day. The suspended cards stay suspended
+func (a CardActions) BuryCards(ids []models.ID) error {
+	return a.moveToQueue(ids, models.CardQueueBuried)
+}
+
+// BuryNotes hides the cards of the notes until the next day
+func (a CardActions) BuryNotes(noteIDs []models.ID) error {
+	ids, err := a.CardRepo.IDsOfNotes(noteIDs)
+	if err != nil {
+		return err
+	}
+	return a.BuryCards(ids)
+}
+
+// SuspendCards hides the cards until they are unsuspended
+func (a CardActions) SuspendCards(ids []models.ID) error {
+	return a.moveToQueue(ids, models.CardQueueSuspended)
+}
+
+// SuspendNotes hides the cards of the notes until they are unsuspended
+func (a CardActions) SuspendNotes(noteIDs []models.ID) error {
+	ids, err := a.CardRepo.IDsOfNotes(noteIDs)
+	if err != nil {
+		return err
+	}
+	return a.SuspendCards(ids)
+}
+
+// UnsuspendCards moves the suspended cards back to the queue of their type
+func (a CardActions) UnsuspendCards(ids []models.ID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	usn, err := a.ColRepo.USN(a.Server)
+	if err != nil {
+		return err
+	}
+	return a.CardRepo.RestoreQueue(ids, models.CardQueueSuspended, usn)
+}
+
+func (a CardActions) moveToQueue(ids []models.ID, queue models.CardQue) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	cards, err := a.CardRepo.List("c.id IN "+ankisql.InClauseFromIDs(ids), nil)
+	if err != nil {
+		return err
+	}
+	var moved []models.ID
+	for _, card := range cards {
+		// a buried card is unsuspended the next day
+		if card.Queue == queue || (card.Queue == models.CardQueueSuspended && queue == models.CardQueueBuried) {
+			continue
+		}
+		moved = append(moved, card.ID)
+	}
+	if len(moved) == 0 {
+		return nil
+	}
+	usn, err := a.ColRepo.USN(a.Server)
+	if err != nil {
+		return err
+	}
+	return a.CardRepo.BuryCards(moved, queue, usn)
+}
+
+// dueDate is the number of days from today to reschedule cards to, picked at random between min and max
+type dueDate struct {
+	min   int64
+	max   int64
+	reset bool
+}
+
+func parseDueDate(days string) (dueDate, error) {
+	match := dueDateRe.FindStringSubmatch(days)
+	if match == nil {
+		return dueDate{}, fmt.Errorf("invalid due date %q, expected a number of days (ie: 0, 3-7 or 1!)", days)
+	}
+	spec := dueDate{reset: match[3] != ""}
+	spec.min, _ = strconv.ParseInt(match[1], 10, 64)
+	spec.max = spec.min
+	if match[2] != "" {
+		spec.max, _ = strconv.ParseInt(match[2], 10, 64)
+	}
+	if spec.max < spec.min {
+		spec.min, spec.max = spec.max, spec.min
+	}
+	return spec, nil
+}
+
+// SetDueDate reschedules the cards as reviews due in a number of days from today (ie: 0), in a random number of
+// days within a range (ie: 3-7) and sets their interval to the number of days when it ends with ! (ie: 1!).
+// The new cards and the cards in learning become reviews and the cards of filtered decks return to their home deck
+func (a CardActions) SetDueDate(ids []models.ID, days string) error {
+	spec, err := parseDueDate(days)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	today, _, err := Today(a.ColRepo, a.Server)
+	if err != nil {
+		return err
+	}
+	usn, err := a.ColRepo.USN(a.Server)
+	if err != nil {
+		return err
+	}
+	cards, err := a.CardRepo.List("c.id IN "+ankisql.InClauseFromIDs(ids), nil)
+	if err != nil {
+		return err
+	}
+	decks, err := a.DeckRepo.Decks()
+	if err != nil {
+		return err
+	}
+	confs, err := a.DeckRepo.Confs()
+	if err != nil {
+		return err
+	}
+	for _, card := range cards {
+		lastInterval := card.Interval
+		home := card.DeckID
+		if card.OriginalDeckID != 0 {
+			home = card.OriginalDeckID
+		}
+		days := spec.min + rand.Int63n(spec.max-spec.min+1)
+		due := today + days
+		state, err := fsrs.ReadMemoryState(card.Data)
+		if err != nil {
+			return err
+		}
+		if spec.reset || (card.Type != models.CardTypeReview && card.Type != models.CardTypeRelearning) {
+			card.Interval = days
+		} else if state != nil {
+			// the interval is the time since the last review with FSRS
+			previous := int64(card.Due)
+			if card.OriginalDeckID != 0 {
+				previous = int64(card.OriginalDue)
+			}
+			card.Interval += due - previous
+		}
+		card.Interval = utils.MaxInt64(card.Interval, 1)
+		if card.OriginalDeckID != 0 {
+			card.DeckID = card.OriginalDeckID
+			card.OriginalDeckID = 0
+			card.OriginalDue = 0
+		}
+		card.Due = models.UnixTime(due)
+		card.Type = models.CardTypeReview
+		card.Queue = models.CardQueueReview
+		if card.Factor == 0 {
+			card.Factor = 2500
+			if deck, exists := decks[home]; exists && confs[models.ID(deck.Conf)] != nil && confs[models.ID(deck.Conf)].New.InitialFactor > 0 {
+				card.Factor = confs[models.ID(deck.Conf)].New.InitialFactor
+			}
+		}
+		card.Mod = models.UnixTime(time.Now().Unix())
+		card.USN = usn
+		if err := a.RevLogRepo.Create(card, usn, 0, card.Interval, lastInterval, 0, models.ReviewLogTypeManual); err != nil {
+			return err
+		}
+		if err := a.CardRepo.Update(card); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+// Package fsrs implements the Free Spaced Repetition Scheduler (FSRS-4.5) used by Anki to predict
+// when a card will be forgotten from its memory state
+// @see https://github.com/open-spaced-repetition/fsrs4anki/wiki/The-Algorithm
+package fsrs
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/aerex/go-anki/pkg/models"
+)
+
+const (
+	// DefaultRetention is the probability to recall a card when it is due used when the deck options do not set one
+	DefaultRetention = 0.9
+	// the retention assumed by the intervals of the SM-2 scheduler
+	sm2Retention = 0.9
+	decay        = -0.5
+	// chosen so the retrievability is 90% when the elapsed days equal the stability
+	factor        = 19.0 / 81
+	minStability  = 0.01
+	maxStability  = 36500
+	minDifficulty = 1
+	maxDifficulty = 10
+)
+
+// Parameters are the 17 weights of the FSRS model
+type Parameters []float64
+
+// DefaultParameters are used until the parameters are fitted to the reviews of the collection
+var DefaultParameters = Parameters{
+	0.4872, 1.4003, 3.7145, 13.8206, 5.1618, 1.2298, 0.8975, 0.031,
+	1.6474, 0.1367, 1.0461, 2.1072, 0.0793, 0.3246, 1.587, 0.2272, 2.8755,
+}
+
+// OrDefault returns the parameters or the default parameters when they are not valid
+func (p Parameters) OrDefault() Parameters {
+	if len(p) != len(DefaultParameters) {
+		return DefaultParameters
+	}
+	return p
+}
+
+// MemoryState is how well a card is known
+type MemoryState struct {
+	// the number of days before the probability to recall the card drops to 90%
+	Stability float64
+	// how hard the card is to remember, between 1 and 10
+	Difficulty float64
+}
+
+// Review is an answer given to a card
+type Review struct {
+	Rating models.Ease
+	// the number of days since the previous review, 0 for the first review
+	Elapsed int64
+}
+
+// Retrievability returns the probability to recall a card after the elapsed days
+func Retrievability(elapsed float64, stability float64) float64 {
+	return math.Pow(1+factor*elapsed/stability, decay)
+}
+
+// Interval returns the number of days before the probability to recall a card drops to the desired retention
+func Interval(stability float64, retention float64) float64 {
+	return stability / factor * (math.Pow(retention, 1/decay) - 1)
+}
+
+func (p Parameters) initialStability(rating models.Ease) float64 {
+	return math.Max(p[rating-1], minStability)
+}
+
+// initialDifficulty is the difficulty after the first answer of FSRS-4.5, p[4] when the card is answered good
+func (p Parameters) initialDifficulty(rating models.Ease) float64 {
+	return p[4] - float64(rating-3)*p[5]
+}
+
+// InitialState returns the memory state of a new card after its first answer
+func (p Parameters) InitialState(rating models.Ease) MemoryState {
+	return MemoryState{
+		Stability:  p.initialStability(rating),
+		Difficulty: clamp(p.initialDifficulty(rating), minDifficulty, maxDifficulty),
+	}
+}
+
+// NextState returns the memory state of a card after an answer given the days elapsed since the
+// previous answer. The state of a new card is nil
+func (p Parameters) NextState(state *MemoryState, elapsed float64, rating models.Ease) MemoryState {
+	if state == nil {
+		return p.InitialState(rating)
+	}
+	r := Retrievability(elapsed, state.Stability)
+	// the difficulty reverts to the initial difficulty of a card answered good
+	difficulty := state.Difficulty - p[6]*float64(rating-3)
+	difficulty = p[7]*p[4] + (1-p[7])*difficulty
+	var stability float64
+	if rating == models.ReviewEaseWrong {
+		stability = p[11] * math.Pow(state.Difficulty, -p[12]) * (math.Pow(state.Stability+1, p[13]) - 1) * math.Exp(p[14]*(1-r))
+		stability = math.Min(stability, state.Stability)
+	} else {
+		bonus := 1.0
+		if rating == models.ReviewEaseHard {
+			bonus = p[15]
+		} else if rating == models.ReviewEaseEasy {
+			bonus = p[16]
+		}
+		stability = state.Stability * (math.Exp(p[8])*(11-state.Difficulty)*math.Pow(state.Stability, -p[9])*
+			(math.Exp(p[10]*(1-r))-1)*bonus + 1)
+	}
+	return MemoryState{
+		Stability:  clamp(stability, minStability, maxStability),
+		Difficulty: clamp(difficulty, minDifficulty, maxDifficulty),
+	}
+}
+
+// MemoryStateFromHistory replays the reviews of a card and returns its memory state, nil without reviews
+func (p Parameters) MemoryStateFromHistory(reviews []Review) *MemoryState {
+	var state *MemoryState
+	for _, review := range reviews {
+		next := p.NextState(state, float64(review.Elapsed), review.Rating)
+		state = &next
+	}
+	return state
+}
+
+// MemoryStateFromSM2 estimates the memory state of a card scheduled by the SM-2 scheduler from its
+// ease factor (ie: 2.5) and its interval in days
+func (p Parameters) MemoryStateFromSM2(ease float64, interval float64) MemoryState {
+	stability := math.Max(interval, 1) * factor / (math.Pow(sm2Retention, 1/decay) - 1)
+	stability = clamp(stability, minStability, maxStability)
+	growth := math.Exp(p[8]) * math.Pow(stability, -p[9]) * (math.Exp(p[10]*(1-sm2Retention)) - 1)
+	return MemoryState{
+		Stability:  stability,
+		Difficulty: clamp(11-(ease-1)/growth, minDifficulty, maxDifficulty),
+	}
+}
+
+// Day returns the day of a review relative to today given the time the next day starts.
+// Today is 0 and yesterday is -1
+func Day(id models.ID, dayCutoff int64) int64 {
+	return -((dayCutoff*1000 - int64(id) - 1) / 86400000)
+}
+
+// Histories groups the review logs sorted by card and time into the reviews of each card. The manual
+// changes are left out and the history of a card starts the last time it was learned as a new card.
+// The cards never learned as new cards are left out since their initial memory state is unknown
+func Histories(logs []models.ReviewLog, dayCutoff int64) map[models.ID][]Review {
+	histories := make(map[models.ID][]Review)
+	var cardLogs []models.ReviewLog
+	flush := func() {
+		if reviews := history(cardLogs, dayCutoff); len(reviews) > 0 {
+			histories[cardLogs[0].CID] = reviews
+		}
+		cardLogs = cardLogs[:0]
+	}
+	for _, log := range logs {
+		if len(cardLogs) > 0 && cardLogs[0].CID != log.CID {
+			flush()
+		}
+		if log.Ease < int(models.ReviewEaseWrong) || log.Ease > int(models.ReviewEaseEasy) || log.Type > models.ReviewLogTypeCram {
+			continue
+		}
+		// the card was reset to a new card
+		if log.Type == models.ReviewLogTypeLearning && len(cardLogs) > 0 &&
+			cardLogs[len(cardLogs)-1].Type != models.ReviewLogTypeLearning {
+			cardLogs = cardLogs[:0]
+		}
+		cardLogs = append(cardLogs, log)
+	}
+	if len(cardLogs) > 0 {
+		flush()
+	}
+	return histories
+}
+
+func history(logs []models.ReviewLog, dayCutoff int64) []Review {
+	if len(logs) == 0 || logs[0].Type != models.ReviewLogTypeLearning {
+		return nil
+	}
+	reviews := make([]Review, len(logs))
+	for i, log := range logs {
+		reviews[i].Rating = models.Ease(log.Ease)
+		if i > 0 {
+			reviews[i].Elapsed = Day(log.ID, dayCutoff) - Day(logs[i-1].ID, dayCutoff)
+		}
+	}
+	return reviews
+}
+
+// cardData is the json stored in the data column of a card. The other keys are kept as they are
+type cardData map[string]json.RawMessage
+
+// ReadMemoryState returns the memory state stored in the data of a card, nil when there is none
+func ReadMemoryState(data string) (*MemoryState, error) {
+	if data == "" {
+		return nil, nil
+	}
+	var fields cardData
+	if err := json.Unmarshal([]byte(data), &fields); err != nil {
+		return nil, fmt.Errorf("invalid card data %s: %w", data, err)
+	}
+	var state MemoryState
+	if fields["s"] == nil || fields["d"] == nil {
+		return nil, nil
+	}
+	if err := json.Unmarshal(fields["s"], &state.Stability); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(fields["d"], &state.Difficulty); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// WriteMemoryState stores the memory state and the desired retention used to schedule the card in its data
+func WriteMemoryState(data string, state MemoryState, retention float64) (string, error) {
+	fields := make(cardData)
+	if data != "" {
+		if err := json.Unmarshal([]byte(data), &fields); err != nil {
+			return "", fmt.Errorf("invalid card data %s: %w", data, err)
+		}
+	}
+	values := map[string]float64{
+		"s":  round(state.Stability, 4),
+		"d":  round(state.Difficulty, 3),
+		"dr": round(retention, 2),
+	}
+	for key, value := range values {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		fields[key] = encoded
+	}
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+func round(value float64, digits int) float64 {
+	pow := math.Pow(10, float64(digits))
+	return math.Round(value*pow) / pow
+}
+
+func clamp(value float64, min float64, max float64) float64 {
+	return math.Min(math.Max(value, min), max)
+}
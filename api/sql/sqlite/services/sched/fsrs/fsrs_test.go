@@ -0,0 +1,103 @@
+package fsrs
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetrievability(t *testing.T) {
+	assert.InDelta(t, 0.9, Retrievability(10, 10), 1e-9)
+	assert.InDelta(t, 10, Interval(10, 0.9), 1e-9)
+	// a higher retention shows the cards sooner
+	assert.Less(t, Interval(10, 0.95), Interval(10, 0.9))
+}
+
+func TestNextState(t *testing.T) {
+	p := DefaultParameters
+	assert.Equal(t, p[2], p.NextState(nil, 0, models.ReviewEaseOK).Stability)
+
+	state := p.InitialState(models.ReviewEaseOK)
+	var stabilities []float64
+	for ease := models.ReviewEaseWrong; ease <= models.ReviewEaseEasy; ease++ {
+		next := p.NextState(&state, 3, ease)
+		stabilities = append(stabilities, next.Stability)
+		assert.GreaterOrEqual(t, next.Difficulty, 1.0)
+		assert.LessOrEqual(t, next.Difficulty, 10.0)
+	}
+	assert.IsIncreasing(t, stabilities)
+	// a forgotten card is not remembered longer than before
+	assert.Less(t, stabilities[0], state.Stability)
+
+	// the difficulty of the estimated state gives back the ease of the card
+	sm2 := p.MemoryStateFromSM2(2.5, 10)
+	assert.InDelta(t, 10, sm2.Stability, 1e-9)
+	after := p.NextState(&sm2, 10, models.ReviewEaseOK)
+	assert.InDelta(t, 2.5, after.Stability/sm2.Stability, 1e-6)
+}
+
+func TestInitialDifficulty(t *testing.T) {
+	// the reference values of FSRS-4.5 with the default parameters
+	tests := map[models.Ease]float64{
+		models.ReviewEaseWrong: 7.6214,
+		models.ReviewEaseHard:  6.3916,
+		models.ReviewEaseOK:    5.1618,
+		models.ReviewEaseEasy:  3.932,
+	}
+	for rating, difficulty := range tests {
+		assert.InDelta(t, difficulty, DefaultParameters.InitialState(rating).Difficulty, 1e-9, "rating %d", rating)
+	}
+	// the difficulty stays between 1 and 10
+	p := append(Parameters{}, DefaultParameters...)
+	p[5] = 5
+	assert.Equal(t, 10.0, p.InitialState(models.ReviewEaseWrong).Difficulty)
+	assert.Equal(t, 1.0, p.InitialState(models.ReviewEaseEasy).Difficulty)
+}
+
+func TestHistories(t *testing.T) {
+	dayCutoff := int64(1700000000)
+	at := func(day int64, hour int64) models.ID {
+		return models.ID((dayCutoff + day*86400 - 86400 + hour*3600) * 1000)
+	}
+	logs := []models.ReviewLog{
+		// never learned as a new card
+		{ID: at(-3, 1), CID: 1, Ease: 3, Type: models.ReviewLogTypeReview},
+		{ID: at(-5, 1), CID: 2, Ease: 3, Type: models.ReviewLogTypeLearning},
+		{ID: at(-5, 2), CID: 2, Ease: 3, Type: models.ReviewLogTypeLearning},
+		{ID: at(-2, 1), CID: 2, Ease: 1, Type: models.ReviewLogTypeReview},
+		// rescheduled by hand
+		{ID: at(-1, 1), CID: 2, Ease: 0, Type: models.ReviewLogTypeReview},
+		{ID: at(0, 1), CID: 2, Ease: 4, Type: models.ReviewLogTypeRelearn},
+		{ID: at(-9, 1), CID: 3, Ease: 3, Type: models.ReviewLogTypeLearning},
+		{ID: at(-4, 1), CID: 3, Ease: 3, Type: models.ReviewLogTypeReview},
+		// reset to a new card
+		{ID: at(-1, 1), CID: 3, Ease: 2, Type: models.ReviewLogTypeLearning},
+	}
+	histories := Histories(logs, dayCutoff)
+	assert.Equal(t, map[models.ID][]Review{
+		2: {{Rating: 3}, {Rating: 3}, {Rating: 1, Elapsed: 3}, {Rating: 4, Elapsed: 2}},
+		3: {{Rating: 2}},
+	}, histories)
+	assert.Equal(t, int64(0), Day(at(0, 23), dayCutoff))
+	assert.Equal(t, int64(-1), Day(at(-1, 23), dayCutoff))
+}
+
+func TestMemoryStateInCardData(t *testing.T) {
+	state, err := ReadMemoryState("")
+	assert.NoError(t, err)
+	assert.Nil(t, state)
+
+	data, err := WriteMemoryState(`{"pos":3}`, MemoryState{Stability: 12.345678, Difficulty: 5.4321}, 0.9)
+	assert.NoError(t, err)
+	var fields map[string]float64
+	assert.NoError(t, json.Unmarshal([]byte(data), &fields))
+	assert.Equal(t, map[string]float64{"pos": 3, "s": 12.3457, "d": 5.432, "dr": 0.9}, fields)
+	state, err = ReadMemoryState(data)
+	assert.NoError(t, err)
+	assert.Equal(t, &MemoryState{Stability: 12.3457, Difficulty: 5.432}, state)
+
+	_, err = ReadMemoryState("{")
+	assert.Error(t, err)
+}
@@ -0,0 +1,135 @@
+package fsrs
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/aerex/go-anki/pkg/models"
+)
+
+const (
+	// MinReviews is the number of reviews needed to fit the parameters
+	MinReviews = 400
+	// the settings of the gradient descent
+	learningRate = 0.04
+	iterations   = 200
+	// the iterations without a better loss before stopping
+	patience = 20
+)
+
+var ErrNotEnoughReviews = errors.New("not enough reviews to optimize the parameters")
+
+// the range of each parameter during the optimization
+var bounds = [][2]float64{
+	{0.1, 100}, {0.1, 100}, {0.1, 100}, {0.1, 100},
+	{1, 10}, {0.001, 4}, {0.001, 4}, {0.001, 0.75},
+	{0, 4.5}, {0, 0.8}, {0.001, 3.5}, {0.001, 5},
+	{0.001, 0.25}, {0.001, 0.9}, {0, 4}, {0, 1}, {1, 6},
+}
+
+// Result is the outcome of fitting the parameters to the reviews of a collection
+type Result struct {
+	Parameters Parameters
+	// the number of reviews of a card on a later day used to measure the predictions
+	Reviews int
+	// the log loss of the predictions with the default and the fitted parameters
+	DefaultLoss float64
+	Loss        float64
+}
+
+// Optimize fits the parameters to the histories of the cards by minimizing the log loss of the
+// predicted probabilities to recall the cards on the reviews made on a later day
+func Optimize(histories map[models.ID][]Review) (Result, error) {
+	ids := make([]models.ID, 0, len(histories))
+	for id := range histories {
+		ids = append(ids, id)
+	}
+	// the same order gives the same parameters
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	var cards [][]Review
+	var reviews int
+	for _, id := range ids {
+		cards = append(cards, histories[id])
+		reviews += predictions(histories[id])
+	}
+	if reviews < MinReviews {
+		return Result{}, fmt.Errorf("%w: %d reviews on a later day found, %d needed", ErrNotEnoughReviews, reviews, MinReviews)
+	}
+	best := append(Parameters{}, DefaultParameters...)
+	result := Result{
+		Reviews:     reviews,
+		DefaultLoss: logLoss(best, cards),
+	}
+	result.Loss = result.DefaultLoss
+
+	// adam with the gradient estimated by finite differences
+	params := append(Parameters{}, best...)
+	loss := result.DefaultLoss
+	m := make([]float64, len(params))
+	v := make([]float64, len(params))
+	gradient := make([]float64, len(params))
+	stale := 0
+	for i := 1; i <= iterations && stale < patience; i++ {
+		for j := range params {
+			step := 1e-6 * math.Max(1, math.Abs(params[j]))
+			value := params[j]
+			params[j] = value + step
+			gradient[j] = (logLoss(params, cards) - loss) / step
+			params[j] = value
+		}
+		for j := range params {
+			m[j] = 0.9*m[j] + 0.1*gradient[j]
+			v[j] = 0.999*v[j] + 0.001*gradient[j]*gradient[j]
+			mHat := m[j] / (1 - math.Pow(0.9, float64(i)))
+			vHat := v[j] / (1 - math.Pow(0.999, float64(i)))
+			params[j] = clamp(params[j]-learningRate*mHat/(math.Sqrt(vHat)+1e-8), bounds[j][0], bounds[j][1])
+		}
+		loss = logLoss(params, cards)
+		if loss < result.Loss-1e-7 {
+			result.Loss = loss
+			copy(best, params)
+			stale = 0
+		} else {
+			stale++
+		}
+	}
+	result.Parameters = best
+	return result, nil
+}
+
+// predictions returns the number of reviews of a card made on a later day than the previous review
+func predictions(reviews []Review) (count int) {
+	for _, review := range reviews[1:] {
+		if review.Elapsed > 0 {
+			count++
+		}
+	}
+	return
+}
+
+// logLoss returns the mean log loss of the predicted probabilities to recall the cards
+func logLoss(params Parameters, cards [][]Review) float64 {
+	var total float64
+	var count int
+	for _, reviews := range cards {
+		state := params.InitialState(reviews[0].Rating)
+		for _, review := range reviews[1:] {
+			if review.Elapsed > 0 {
+				r := clamp(Retrievability(float64(review.Elapsed), state.Stability), 1e-4, 1-1e-4)
+				if review.Rating == models.ReviewEaseWrong {
+					total -= math.Log(1 - r)
+				} else {
+					total -= math.Log(r)
+				}
+				count++
+			}
+			state = params.NextState(&state, float64(review.Elapsed), review.Rating)
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return total / float64(count)
+}
@@ -0,0 +1,165 @@
+package sched
+
+import (
+	"time"
+
+	"github.com/google/gapid/core/math/sint"
+
+	repos "github.com/aerex/go-anki/api/sql/sqlite/repositories"
+	"github.com/aerex/go-anki/internal/utils"
+	"github.com/aerex/go-anki/pkg/models"
+)
+
+// SchedService is implemented by the versions of the scheduler
+// @see https://faqs.ankiweb.net/the-anki-2.1-scheduler.html and https://faqs.ankiweb.net/the-2021-scheduler.html
+type SchedService interface {
+	DeckStudyStats() (map[models.ID]models.DeckStudyStats, error)
+	// Reset fills the queues with the cards of the active decks
+	Reset() error
+	// GetCard returns the next card to study or nil when there are no cards left today
+	GetCard() (*models.Card, error)
+	// Counts returns the number of learning, review and new cards left in the queues
+	Counts() models.DeckStudyStats
+	AnswerButtons(card models.Card) (int, error)
+	AnswerCard(card *models.Card, ease models.Ease) error
+	// CardConf returns the options of the deck of a card
+	CardConf(card models.Card) (models.DeckConfig, error)
+	NextIntervalString(card models.Card, ease models.Ease, conf models.DeckConfig) (string, error)
+	ExtendLimits(deckID models.ID, newCards int, revCards int) error
+	// RestoreCard fills the queues again once the answer of a card was undone and returns the card to show it again
+	RestoreCard(id models.ID) (*models.Card, error)
+	// BuryCards hides the cards until the next day
+	BuryCards(ids []models.ID) error
+	BuryNotes(noteIDs []models.ID) error
+	// SuspendCards hides the cards until they are unsuspended
+	SuspendCards(ids []models.ID) error
+	SuspendNotes(noteIDs []models.ID) error
+	UnsuspendCards(ids []models.ID) error
+	// SetDueDate reschedules the cards as reviews due in a number of days from today (ie: 0, 3-7 or 1!)
+	SetDueDate(ids []models.ID, days string) error
+}
+
+// Today returns the number of days since the collection was created and the time the next day starts
+func Today(colRepo repos.ColRepo, server bool) (today int64, dayCutoff int64, err error) {
+	colConf, err := colRepo.Conf()
+	if err != nil {
+		return
+	}
+	createdTime, err := colRepo.CreatedTime()
+	if err != nil {
+		return
+	}
+	offset, err := currentTimezoneOffset(colConf, server)
+	if err != nil {
+		return
+	}
+	if colConf.CreationOffset != 0 {
+		timing := timingToday(createdTime, colConf.CreationOffset, offset, int(colConf.Rollover))
+		return timing.DaysElapsed, timing.NextDayAt, nil
+	}
+	return daysSinceCreation(createdTime, int(colConf.Rollover)), nextDayCutoff(colConf), nil
+}
+
+func currentTimezoneOffset(conf models.CollectionConf, server bool) (int32, error) {
+	if server {
+		return conf.LocalOffset, nil
+	} else {
+		now := time.Now()
+		_, offset := now.Zone()
+		return int32((offset * -1) / 60), nil
+	}
+}
+
+func fixedOffsetFromMin(minWest int32) *time.Location {
+	boundedCrtMin := sint.Max(-23*60, int(minWest))
+	boundedCrtMin = sint.Min(23*60, boundedCrtMin)
+	// TODO: Confirm if UTC-12 is western hemisphere
+	return time.FixedZone("UTC-12", (boundedCrtMin * 60))
+}
+
+func normalizedRollowedHour(hour int) int {
+	cappedHour := sint.Max(hour, -23)
+	cappedHour = sint.Min(cappedHour, 23)
+	if cappedHour < 0 {
+		return 24 + cappedHour
+	}
+	return cappedHour
+}
+
+func daysElapsed(startDate time.Time, endDate time.Time, rolloverPassed bool) int64 {
+	days := (endDate.Sub(startDate).Abs().Hours()) / 24
+
+	if rolloverPassed {
+		return int64(days)
+	}
+	return int64(days - 1)
+}
+
+func timingToday(crt models.UnixTime, crtMinWest int32, nowMinWest int32, rolloverHr int) models.SchedTimingToday {
+	createdDate := time.Unix(int64(crt), 0).In(fixedOffsetFromMin(crtMinWest))
+	currentDate := time.Now().In(fixedOffsetFromMin(nowMinWest))
+
+	rolloverHr = normalizedRollowedHour(rolloverHr)
+	rolloverTodayDateTime := time.Date(currentDate.Year(), currentDate.Month(), currentDate.Day(), rolloverHr, currentDate.Minute(), currentDate.Second(), currentDate.Nanosecond(), fixedOffsetFromMin(nowMinWest))
+	nextDateAt := rolloverTodayDateTime.Unix()
+	rolloverPassed := rolloverTodayDateTime.Before(currentDate)
+	if rolloverPassed {
+		nextDateAt = rolloverTodayDateTime.Add(24 * time.Hour).Unix()
+	}
+
+	daysElapsed := daysElapsed(createdDate, currentDate, rolloverPassed)
+	return models.SchedTimingToday{
+		DaysElapsed: daysElapsed,
+		NextDayAt:   nextDateAt,
+	}
+}
+
+func nextDayCutoff(colConf models.CollectionConf) int64 {
+	rollover := colConf.Rollover
+	if rollover == 0 {
+		rollover = 4
+	}
+	if rollover < 0 {
+		rollover = 24 + rollover
+	}
+
+	date := time.Now()
+	date = time.Date(date.Year(), date.Month(), date.Day(), int(rollover), 0, 0, 0, time.UTC)
+	if date.Before(time.Now()) {
+		date = date.AddDate(0, 0, 1)
+	}
+	return date.Unix()
+}
+
+func daysSinceCreation(crt models.UnixTime, rollover int) int64 {
+	start := time.Unix(int64(crt), 0)
+	start = time.Date(start.Year(), start.Month(), start.Day(), rollover, 0, 0, 0, time.UTC)
+	return int64((time.Now().Unix() - start.Unix()) / 86400)
+}
+
+// UpdateDeck resets the counters of today of a deck when they were set on another day
+func UpdateDeck(deck *models.Deck, todayStmp int64) {
+	if deck.NewToday[0] != todayStmp {
+		deck.NewToday = [2]int64{todayStmp, 0}
+	}
+	if deck.ReviewsToday[0] != todayStmp {
+		deck.ReviewsToday = [2]int64{todayStmp, 0}
+	}
+
+	if deck.LearnToday[0] != todayStmp {
+		deck.LearnToday = [2]int64{todayStmp, 0}
+	}
+	if len(deck.TimeToday) != 2 || deck.TimeToday[0] != todayStmp {
+		deck.TimeToday = []int64{todayStmp, 0}
+	}
+}
+
+// TimeTaken returns the time taken to answer the card in milliseconds since it was given by the scheduler.
+// The time is capped at the max time of the deck config (in seconds)
+func TimeTaken(card models.Card, conf models.DeckConfig) int64 {
+	total := time.Now().UnixMilli() - int64(card.TimeStarted)
+	if conf.MaxTaken > 0 {
+		return utils.MinInt64(total, conf.MaxTaken*1000)
+	}
+	return total
+}
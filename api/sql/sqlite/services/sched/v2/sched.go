@@ -9,12 +9,14 @@ import (
 	"time"
 
 	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 
 	"github.com/google/gapid/core/math/sint"
 	"github.com/op/go-logging"
 
 	"github.com/aerex/go-anki/api/sql"
 	repos "github.com/aerex/go-anki/api/sql/sqlite/repositories"
+	"github.com/aerex/go-anki/api/sql/sqlite/services/sched"
 	"github.com/aerex/go-anki/internal/utils"
 	"github.com/aerex/go-anki/pkg/models"
 )
@@ -31,12 +33,12 @@ type learnQueue struct {
 }
 
 type schedV2Service struct {
+	sched.CardActions
 	colRepo           repos.ColRepo
 	deckRepo          repos.DeckRepo
 	cardsRepo         repos.CardRepo
 	revLogRepo        repos.RevLogRepo
 	noteRepo          repos.NoteRepo
-	colConf           *models.CollectionConf
 	server            bool
 	revCount          int
 	revQueue          []models.ID
@@ -45,7 +47,7 @@ type schedV2Service struct {
 	dayCutoff         int64
 	lrnCutoff         int64
 	lrnQueue          []*learnQueue
-	lrnDayQueue       []int
+	lrnDayQueue       []models.ID
 	lrnDeckIDs        []models.ID
 	newDeckIDs        []models.ID
 	newQueue          []models.ID
@@ -53,6 +55,8 @@ type schedV2Service struct {
 	burySiblingsOnAns bool
 	learningCount     int
 	today             int64
+	// the number of cards given since the queues were filled, used to spread the new cards
+	reps int
 }
 
 var (
@@ -63,18 +67,15 @@ var (
 const (
 	DynReportLimit = 99999
 	ReportLimit    = 1000
+	// the number of cards fetched at once in the review, new and day learning queues
+	queueLimit = 50
+	// the minutes before showing again a card failed in a filtered deck which does not reschedule
+	defaultPreviewDelay = 10
 )
 
-type SchedService interface {
-	DeckStudyStats() (map[models.ID]models.DeckStudyStats, error)
-	AnswerButtons(card models.Card) (int, error)
-	AnswerCard(card models.Card, ease models.Ease) error
-	NextIntervalString(card models.Card, ease models.Ease, conf models.DeckConfig) (string, error)
-	//BuryCards(cardIDs []models.Card)
-}
-
-func NewSchedV2Service(c repos.ColRepo, cd repos.CardRepo, d repos.DeckRepo, r repos.RevLogRepo, n repos.NoteRepo, server bool) SchedService {
-	return schedV2Service{
+func NewSchedV2Service(c repos.ColRepo, cd repos.CardRepo, d repos.DeckRepo, r repos.RevLogRepo, n repos.NoteRepo, server bool) sched.SchedService {
+	return &schedV2Service{
+		CardActions:       sched.NewCardActions(c, cd, d, r, server),
 		colRepo:           c,
 		revLogRepo:        r,
 		deckRepo:          d,
@@ -85,7 +86,7 @@ func NewSchedV2Service(c repos.ColRepo, cd repos.CardRepo, d repos.DeckRepo, r r
 	}
 }
 
-func (s schedV2Service) DeckStudyStats() (map[models.ID]models.DeckStudyStats, error) {
+func (s *schedV2Service) DeckStudyStats() (map[models.ID]models.DeckStudyStats, error) {
 	stats := make(map[models.ID]models.DeckStudyStats)
 	if err := s.checkDay(); err != nil {
 		return stats, err
@@ -123,8 +124,8 @@ func (s schedV2Service) DeckStudyStats() (map[models.ID]models.DeckStudyStats, e
 		if err != nil {
 			return stats, err
 		}
-		if p != "" {
-			nlmt = sint.Min(nlmt, limits[p][0])
+		if lim, exists := limits[p]; exists {
+			nlmt = sint.Min(nlmt, lim[0])
 		}
 		newCardCount, err := s.cardsRepo.CardsNewForDeck(deck.ID, nlmt)
 		if err != nil {
@@ -139,8 +140,8 @@ func (s schedV2Service) DeckStudyStats() (map[models.ID]models.DeckStudyStats, e
 		if err != nil {
 			return stats, err
 		}
-		if p != "" {
-			plmt = limits[p][1]
+		if lim, exists := limits[p]; exists {
+			plmt = lim[1]
 		} else {
 			plmt = -1
 		}
@@ -148,6 +149,7 @@ func (s schedV2Service) DeckStudyStats() (map[models.ID]models.DeckStudyStats, e
 		if err != nil {
 			return stats, err
 		}
+		limits[deck.Name] = []int{nlmt, reviewLmts}
 		childIDs, err := s.deckRepo.ChildrenDeckIDs(deck.ID)
 		if err != nil {
 			return stats, err
@@ -167,19 +169,22 @@ func (s schedV2Service) DeckStudyStats() (map[models.ID]models.DeckStudyStats, e
 	return stats, err
 }
 
-// CheckDay will check if the day has rolled over
-// passed the cutoff day. If so, reset
+// checkDay resets the queues when the day cached by the scheduler has passed
 func (s *schedV2Service) checkDay() error {
-	cutoff := s.colRepo.DayCutoff()
-	if time.Now().Unix() > cutoff {
-		if err := s.reset(false); err != nil {
+	if time.Now().Unix() > s.dayCutoff {
+		if err := s.reset(); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (s *schedV2Service) reset(server bool) error {
+// Reset fills the queues with the cards of the active decks
+func (s *schedV2Service) Reset() error {
+	return s.reset()
+}
+
+func (s *schedV2Service) reset() error {
 	if err := s.updateCutoff(); err != nil {
 		return err
 	}
@@ -196,106 +201,445 @@ func (s *schedV2Service) reset(server bool) error {
 	return nil
 }
 
-func (s *schedV2Service) currentTimezoneOffset() (int32, error) {
-	if s.server {
-		conf, err := s.colRepo.Conf()
-		if err != nil {
-			return 0, err
+// Counts returns the number of learning, review and new cards left in the queues
+func (s *schedV2Service) Counts() models.DeckStudyStats {
+	return models.DeckStudyStats{
+		New:      s.newCount,
+		Review:   s.revCount,
+		Learning: s.learningCount,
+	}
+}
+
+// GetCard returns the next card to study following the order of anki. The learning cards due now come
+// first, then the new cards spread among the reviews, the reviews, the cards learned over several days,
+// the remaining new cards and at last the learning cards due within the collapse time
+func (s *schedV2Service) GetCard() (*models.Card, error) {
+	if err := s.checkDay(); err != nil {
+		return nil, err
+	}
+	if !s.haveQueues {
+		if err := s.reset(); err != nil {
+			return nil, err
 		}
-		return conf.LocalOffset, nil
-	} else {
-		now := time.Now()
-		_, offset := now.Zone()
-		return int32((offset * -1) / 60), nil
 	}
+	id, err := s.nextCardID()
+	if err != nil || id == 0 {
+		return nil, err
+	}
+	card, err := s.card(id)
+	if err != nil {
+		return nil, err
+	}
+	s.reps++
+	card.TimeStarted = models.UnixTime(time.Now().UnixMilli())
+	return card, nil
+}
+
+// RestoreCard fills the queues again once the answer of a card was undone and returns the card
+// to show it again before the other cards. The card is counted as if it was given by GetCard
+func (s *schedV2Service) RestoreCard(id models.ID) (*models.Card, error) {
+	if err := s.reset(); err != nil {
+		return nil, err
+	}
+	card, err := s.card(id)
+	if err != nil {
+		return nil, err
+	}
+	// the card is not in the queues when it is beyond the cards fetched at once
+	switch card.Queue {
+	case models.CardQueueNew:
+		s.newQueue = withoutID(s.newQueue, id)
+		s.newCount = sint.Max(0, s.newCount-1)
+	case models.CardQueueReview:
+		s.revQueue = withoutID(s.revQueue, id)
+		s.revCount = sint.Max(0, s.revCount-1)
+	case models.CardQueueRelearning:
+		s.lrnDayQueue = withoutID(s.lrnDayQueue, id)
+		s.learningCount = sint.Max(0, s.learningCount-1)
+	case models.CardQueueLearning, models.CardQueuePreview:
+		lrnQueue := s.lrnQueue[:0]
+		for _, entry := range s.lrnQueue {
+			if entry.ID != id {
+				lrnQueue = append(lrnQueue, entry)
+			}
+		}
+		s.lrnQueue = lrnQueue
+		s.learningCount = sint.Max(0, s.learningCount-1)
+	}
+	card.TimeStarted = models.UnixTime(time.Now().UnixMilli())
+	return card, nil
 }
-func fixedOffsetFromMin(minWest int32) *time.Location {
-	boundedCrtMin := sint.Max(-23*60, int(minWest))
-	boundedCrtMin = sint.Min(23*60, boundedCrtMin)
-	// TODO: Confirm if UTC-12 is western hemisphere
-	return time.FixedZone("UTC-12", (boundedCrtMin * 60))
+
+func withoutID(ids []models.ID, id models.ID) []models.ID {
+	kept := ids[:0]
+	for _, queued := range ids {
+		if queued != id {
+			kept = append(kept, queued)
+		}
+	}
+	return kept
 }
 
-func normalizedRollowedHour(hour int) int {
-	cappedHour := sint.Max(hour, -23)
-	cappedHour = sint.Min(cappedHour, 23)
-	if cappedHour < 0 {
-		return 24 + cappedHour
+func (s *schedV2Service) nextCardID() (models.ID, error) {
+	colConf, err := s.colRepo.Conf()
+	if err != nil {
+		return 0, err
+	}
+	// learning card due?
+	if id, err := s.getLrnCard(false); err != nil || id != 0 {
+		return id, err
+	}
+	// new first, or time for one?
+	if s.timeForNewCard(colConf) {
+		if id, err := s.getNewCard(); err != nil || id != 0 {
+			return id, err
+		}
+	}
+	// day learning first and card due?
+	if colConf.DayLearnFirst {
+		if id, err := s.getLrnDayCard(); err != nil || id != 0 {
+			return id, err
+		}
 	}
-	return cappedHour
+	// card due for review?
+	if id, err := s.getRevCard(); err != nil || id != 0 {
+		return id, err
+	}
+	// day learning card due?
+	if !colConf.DayLearnFirst {
+		if id, err := s.getLrnDayCard(); err != nil || id != 0 {
+			return id, err
+		}
+	}
+	// new cards left?
+	if id, err := s.getNewCard(); err != nil || id != 0 {
+		return id, err
+	}
+	// collapse or finish
+	return s.getLrnCard(true)
 }
 
-func daysElapsed(startDate time.Time, endDate time.Time, rolloverPassed bool) int64 {
-	days := (endDate.Sub(startDate).Abs().Hours()) / 24
+// card returns a card with its note type and its deck to render it
+func (s *schedV2Service) card(id models.ID) (*models.Card, error) {
+	cards, err := s.cardsRepo.List("c.id = ?", []string{fmt.Sprint(id)})
+	if err != nil {
+		return nil, err
+	}
+	if len(cards) == 0 {
+		return nil, fmt.Errorf("could not find card %d", id)
+	}
+	card := cards[0]
+	noteTypes, err := s.colRepo.NoteTypes()
+	if err != nil {
+		return nil, err
+	}
+	decks, err := s.deckRepo.Decks()
+	if err != nil {
+		return nil, err
+	}
+	if noteType, exists := noteTypes[card.Note.ModelID]; exists {
+		card.Note.Model = *noteType
+	}
+	if deck, exists := decks[card.DeckID]; exists {
+		card.Deck = *deck
+	}
+	return &card, nil
+}
 
-	if rolloverPassed {
-		return int64(days)
+// timeForNewCard decides if a new card is shown before the reviews according to the new card spread
+func (s *schedV2Service) timeForNewCard(colConf models.CollectionConf) bool {
+	if s.newCount == 0 {
+		return false
+	}
+	switch int(colConf.NewSpread) {
+	case models.NewCardsLast:
+		return false
+	case models.NewCardsFirst:
+		return true
 	}
-	return int64(days - 1)
+	return s.newCardModulus != 0 && s.reps != 0 && s.reps%s.newCardModulus == 0
 }
 
-func (s *schedV2Service) timingToday(crt models.UnixTime, crtMinWest int32, nowMinWest int32, rolloverHr int) models.SchedTimingToday {
-	createdDate := time.Unix(int64(crt), 0).In(fixedOffsetFromMin(crtMinWest))
-	currentDate := time.Now().In(fixedOffsetFromMin(nowMinWest))
+// deckLimit returns the sql list of the active decks
+func (s *schedV2Service) deckLimit() (string, error) {
+	colConf, err := s.colRepo.Conf()
+	if err != nil {
+		return "", err
+	}
+	return sql.InClauseFromIDs(colConf.ActiveDecks), nil
+}
 
-	rolloverHr = normalizedRollowedHour(rolloverHr)
-	rolloverTodayDateTime := time.Date(currentDate.Year(), currentDate.Month(), currentDate.Day(), rolloverHr, currentDate.Minute(), currentDate.Second(), currentDate.Nanosecond(), fixedOffsetFromMin(nowMinWest))
-	nextDateAt := rolloverTodayDateTime.Unix()
-	rolloverPassed := rolloverTodayDateTime.Before(currentDate)
-	if rolloverPassed {
-		nextDateAt = rolloverTodayDateTime.Add(24 * time.Hour).Unix()
+func (s *schedV2Service) maybeResetLrn(force bool) error {
+	colConf, err := s.colRepo.Conf()
+	if err != nil {
+		return err
 	}
+	if s.updateLrnCutoff(force, colConf) {
+		return s.resetLrn()
+	}
+	return nil
+}
 
-	daysElapsed := daysElapsed(createdDate, currentDate, rolloverPassed)
-	return models.SchedTimingToday{
-		DaysElapsed: daysElapsed,
-		NextDayAt:   nextDateAt,
+func (s *schedV2Service) fillLrn() (bool, error) {
+	if s.learningCount == 0 {
+		return false, nil
+	}
+	if len(s.lrnQueue) > 0 {
+		return true, nil
+	}
+	colConf, err := s.colRepo.Conf()
+	if err != nil {
+		return false, err
 	}
+	cutoff := time.Now().Unix() + colConf.CollapseTime
+	cards, err := s.cardsRepo.LearningQueue(sql.InClauseFromIDs(colConf.ActiveDecks), cutoff, ReportLimit)
+	if err != nil {
+		return false, err
+	}
+	for _, card := range cards {
+		s.lrnQueue = append(s.lrnQueue, &learnQueue{Due: card.Due, ID: card.ID})
+	}
+	sort.Sort(ByLearnDue(s.lrnQueue))
+	return len(s.lrnQueue) > 0, nil
 }
-func (s *schedV2Service) _dayCutoff(colConf models.CollectionConf) int64 {
-	rollover := colConf.Rollover
-	if rollover == 0 {
-		rollover = 4
+
+// getLrnCard returns the learning card due now or, when collapsing, due within the collapse time
+func (s *schedV2Service) getLrnCard(collapse bool) (models.ID, error) {
+	if err := s.maybeResetLrn(collapse && s.learningCount == 0); err != nil {
+		return 0, err
+	}
+	filled, err := s.fillLrn()
+	if err != nil || !filled {
+		return 0, err
 	}
-	if rollover < 0 {
-		rollover = 24 + rollover
+	cutoff := time.Now().Unix()
+	if collapse {
+		colConf, err := s.colRepo.Conf()
+		if err != nil {
+			return 0, err
+		}
+		cutoff += colConf.CollapseTime
+	}
+	if int64(s.lrnQueue[0].Due) >= cutoff {
+		return 0, nil
 	}
+	id := s.lrnQueue[0].ID
+	s.lrnQueue = s.lrnQueue[1:]
+	s.learningCount--
+	return id, nil
+}
 
-	date := time.Now()
-	date = time.Date(date.Year(), date.Month(), date.Day(), int(rollover), 0, 0, 0, time.UTC)
-	if date.Before(time.Now()) {
-		date = date.AddDate(0, 0, 1)
+func (s *schedV2Service) fillLrnDay() (bool, error) {
+	if s.learningCount == 0 {
+		return false, nil
+	}
+	if len(s.lrnDayQueue) > 0 {
+		return true, nil
+	}
+	for len(s.lrnDeckIDs) > 0 {
+		ids, err := s.cardsRepo.DayLearningQueue(s.lrnDeckIDs[0], s.today, queueLimit)
+		if err != nil {
+			return false, err
+		}
+		if len(ids) > 0 {
+			// the cards are shuffled in the same order during the day
+			r := rand.New(rand.NewSource(s.today))
+			r.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+			s.lrnDayQueue = ids
+			if len(ids) < queueLimit {
+				s.lrnDeckIDs = s.lrnDeckIDs[1:]
+			}
+			return true, nil
+		}
+		s.lrnDeckIDs = s.lrnDeckIDs[1:]
 	}
-	return date.Unix()
+	return false, nil
 }
 
-func (s *schedV2Service) daysSinceCreation(crt models.UnixTime, rollover int) int64 {
-	start := time.Unix(int64(crt), 0)
-	start = time.Date(start.Year(), start.Month(), start.Day(), rollover, 0, 0, 0, time.UTC)
-	return int64((time.Now().Unix() - start.Unix()) / 86400)
+func (s *schedV2Service) getLrnDayCard() (models.ID, error) {
+	filled, err := s.fillLrnDay()
+	if err != nil || !filled {
+		return 0, err
+	}
+	id := s.lrnDayQueue[0]
+	s.lrnDayQueue = s.lrnDayQueue[1:]
+	s.learningCount--
+	return id, nil
 }
 
-func (s *schedV2Service) updateCutoff() error {
-	colConf, err := s.colRepo.Conf()
+func (s *schedV2Service) fillRev(recursing bool) (bool, error) {
+	if len(s.revQueue) > 0 {
+		return true, nil
+	}
+	if s.revCount == 0 {
+		return false, nil
+	}
+	limit, err := s.currentRevLimit()
 	if err != nil {
+		return false, err
+	}
+	limit = sint.Min(queueLimit, limit)
+	if limit > 0 {
+		deckLimit, err := s.deckLimit()
+		if err != nil {
+			return false, err
+		}
+		ids, err := s.cardsRepo.ReviewQueue(deckLimit, s.today, limit)
+		if err != nil {
+			return false, err
+		}
+		if len(ids) > 0 {
+			s.revQueue = ids
+			return true, nil
+		}
+	}
+	if recursing {
+		return false, nil
+	}
+	// the count was wrong, ie: the siblings of the answered cards were buried
+	if err := s.resetRev(); err != nil {
+		return false, err
+	}
+	return s.fillRev(true)
+}
+
+func (s *schedV2Service) getRevCard() (models.ID, error) {
+	filled, err := s.fillRev(false)
+	if err != nil || !filled {
+		return 0, err
+	}
+	id := s.revQueue[0]
+	s.revQueue = s.revQueue[1:]
+	s.revCount--
+	return id, nil
+}
+
+func (s *schedV2Service) fillNew(recursing bool) (bool, error) {
+	if len(s.newQueue) > 0 {
+		return true, nil
+	}
+	if s.newCount == 0 {
+		return false, nil
+	}
+	for len(s.newDeckIDs) > 0 {
+		did := s.newDeckIDs[0]
+		limit, err := s.deckNewLimit(did)
+		if err != nil {
+			return false, err
+		}
+		limit = sint.Min(queueLimit, limit)
+		if limit > 0 {
+			ids, err := s.cardsRepo.NewQueue(did, limit)
+			if err != nil {
+				return false, err
+			}
+			if len(ids) > 0 {
+				s.newQueue = ids
+				return true, nil
+			}
+		}
+		s.newDeckIDs = s.newDeckIDs[1:]
+	}
+	if recursing {
+		return false, nil
+	}
+	if err := s.resetNew(); err != nil {
+		return false, err
+	}
+	return s.fillNew(true)
+}
+
+func (s *schedV2Service) getNewCard() (models.ID, error) {
+	filled, err := s.fillNew(false)
+	if err != nil || !filled {
+		return 0, err
+	}
+	id := s.newQueue[0]
+	s.newQueue = s.newQueue[1:]
+	s.newCount--
+	return id, nil
+}
+
+// deckNewLimit returns the number of new cards left today for a deck and its parents
+func (s *schedV2Service) deckNewLimit(deckID models.ID) (int, error) {
+	decks, err := s.deckRepo.Decks()
+	if err != nil {
+		return 0, err
+	}
+	deck, exists := decks[deckID]
+	if !exists {
+		return 0, nil
+	}
+	limit, err := s.deckLimitForNewCards(*deck)
+	if err != nil {
+		return 0, err
+	}
+	parents, err := s.deckRepo.Parents(deckID)
+	if err != nil {
+		return 0, err
+	}
+	for _, parent := range parents {
+		parentLimit, err := s.deckLimitForNewCards(parent)
+		if err != nil {
+			return 0, err
+		}
+		limit = sint.Min(limit, parentLimit)
+	}
+	return limit, nil
+}
+
+// ExtendLimits raises the number of new cards and reviews of today for the deck, its parents and
+// its children. The extensions are kept in the deck to be suggested on the next custom study
+func (s *schedV2Service) ExtendLimits(deckID models.ID, newCards int, revCards int) error {
+	if err := s.updateCutoff(); err != nil {
 		return err
 	}
-	oldToday := s.today
-	createdTime, err := s.colRepo.CreatedTime()
+	decks, err := s.deckRepo.Decks()
 	if err != nil {
 		return err
 	}
-	offset, err := s.currentTimezoneOffset()
+	deck, exists := decks[deckID]
+	if !exists {
+		return fmt.Errorf("could not find deck %d", deckID)
+	}
+	usn, err := s.colRepo.USN(s.server)
 	if err != nil {
 		return err
 	}
-	timing := s.timingToday(createdTime, colConf.CreationOffset, offset, int(colConf.Rollover))
-	if colConf.CreationOffset != 0 {
-		s.today = timing.DaysElapsed
-		s.dayCutoff = timing.NextDayAt
-	} else {
-		s.today = s.daysSinceCreation(createdTime, int(colConf.Rollover))
-		s.dayCutoff = s._dayCutoff(colConf)
+	if newCards != 0 {
+		deck.ExtendNewCardLimit = newCards
+	}
+	if revCards != 0 {
+		deck.ExtendReviewCardLimit = revCards
+	}
+	mod := models.UnixTime(time.Now().Unix())
+	for _, dk := range decks {
+		isParent := strings.HasPrefix(deck.Name, dk.Name+"::")
+		isChild := strings.HasPrefix(dk.Name, deck.Name+"::")
+		if dk.ID != deck.ID && !isParent && !isChild {
+			continue
+		}
+		sched.UpdateDeck(dk, s.today)
+		dk.NewToday[1] -= int64(newCards)
+		dk.ReviewsToday[1] -= int64(revCards)
+		dk.Mod = &mod
+		dk.USN = usn
+	}
+	if err := s.deckRepo.SaveAll(decks); err != nil {
+		return err
+	}
+	return s.colRepo.UpdateMod()
+}
+
+func (s *schedV2Service) updateCutoff() error {
+	colConf, err := s.colRepo.Conf()
+	if err != nil {
+		return err
+	}
+	oldToday := s.today
+	s.today, s.dayCutoff, err = sched.Today(s.colRepo, s.server)
+	if err != nil {
+		return err
 	}
 	if oldToday != s.today {
 		// self.col.log(self.today, self.dayCutoff)
@@ -306,13 +650,16 @@ func (s *schedV2Service) updateCutoff() error {
 		return err
 	}
 	for _, deck := range decks {
-		updateDeck(deck, s.today)
+		sched.UpdateDeck(deck, s.today)
 	}
 	// unbury if the day has rolled over
 	if colConf.LastUnburied < s.today {
 		if err := s.cardsRepo.UnburyCards(); err != nil {
 			return err
 		}
+		if err := s.colRepo.SaveLastUnburied(s.today); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -326,17 +673,16 @@ func (s *schedV2Service) resetRev() error {
 }
 
 func (s *schedV2Service) resetRevCount() error {
-	colConf, err := s.colRepo.Conf()
+	limit, err := s.currentRevLimit()
 	if err != nil {
 		return err
 	}
-	limit, err := s.currentRevLimit()
+
+	deckLimit, err := s.deckLimit()
 	if err != nil {
 		return err
 	}
-
-	deckLimit := sql.InClauseFromIDs(colConf.ActiveDecks)
-	revisions, err := s.cardsRepo.Revisions(deckLimit, limit)
+	revisions, err := s.cardsRepo.Revisions(deckLimit, limit, s.today)
 	if err != nil {
 		return err
 	}
@@ -374,6 +720,7 @@ func (s *schedV2Service) deckRevLimit(deck models.Deck, parentLimit int) int {
 		// TODO: log error
 		return 0
 	}
+	sched.UpdateDeck(&deck, s.today)
 	limit := sint.Max(0, (deckConf.Rev.PerDay - int(deck.ReviewsToday[1])))
 
 	if parentLimit != -1 {
@@ -401,6 +748,7 @@ func (s *schedV2Service) deckLimitForNewCards(deck models.Deck) (int, error) {
 	if err != nil {
 		return 0, err
 	}
+	sched.UpdateDeck(&deck, s.today)
 	return sint.Max(0, conf.New.PerDay-int(deck.NewToday[1])), nil
 }
 
@@ -412,6 +760,7 @@ func (s *schedV2Service) deckLimitForReviewCards(deck models.Deck, parentLimit i
 	if err != nil {
 		return 0, err
 	}
+	sched.UpdateDeck(&deck, s.today)
 	limit := sint.Max(0, conf.Rev.PerDay-int(deck.ReviewsToday[1]))
 	if parentLimit != -1 {
 		return sint.Min(parentLimit, limit), nil
@@ -428,9 +777,6 @@ func (s *schedV2Service) deckLimitForReviewCards(deck models.Deck, parentLimit i
 			return 0, err
 		}
 		limit = sint.Min(limit, plim)
-		if err != nil {
-			return 0, err
-		}
 	}
 	return limit, nil
 }
@@ -470,7 +816,7 @@ func (s *schedV2Service) computeCount(lmtCb func(deck models.Deck) (int, error),
 		deckID := models.ID(id)
 		deck, exists := decks[deckID]
 		if !exists {
-			deck = decks[models.ID(1)]
+			continue
 		}
 		limit, err := lmtCb(*deck)
 		if err != nil {
@@ -498,8 +844,8 @@ func (s *schedV2Service) computeCount(lmtCb func(deck models.Deck) (int, error),
 		if err != nil {
 			return 0, err
 		}
-		for parentDeck := range parentDecks {
-			uniqueParentCounts[models.ID(parentDeck)] -= curCount
+		for _, parentDeck := range parentDecks {
+			uniqueParentCounts[parentDeck.ID] -= curCount
 		}
 		uniqueParentCounts[deckID] = limit - curCount
 		count += curCount
@@ -513,10 +859,13 @@ func (s *schedV2Service) resetLrn() error {
 		return err
 	}
 	s.updateLrnCutoff(true, colConf)
-	s.resetLrnCount(colConf)
+	if err := s.resetLrnCount(colConf); err != nil {
+		return err
+	}
 	s.lrnQueue = []*learnQueue{}
-	s.lrnDayQueue = []int{}
-	s.lrnDeckIDs = colConf.ActiveDecks
+	s.lrnDayQueue = []models.ID{}
+	s.lrnDeckIDs = make([]models.ID, len(colConf.ActiveDecks))
+	copy(s.lrnDeckIDs, colConf.ActiveDecks)
 	return nil
 }
 
@@ -532,7 +881,7 @@ func (s *schedV2Service) updateLrnCutoff(force bool, colConf models.CollectionCo
 func (s *schedV2Service) resetLrnCount(colConf models.CollectionConf) error {
 	deckLimit := sql.InClauseFromIDs(colConf.ActiveDecks)
 
-	learningCount, err := s.cardsRepo.LearningCount(deckLimit, s.lrnCutoff)
+	learningCount, err := s.cardsRepo.LearningCount(deckLimit, s.lrnCutoff, s.today)
 	if err != nil {
 		return err
 	}
@@ -547,16 +896,36 @@ func (s *schedV2Service) updateNewCardRatio(colConf models.CollectionConf) {
 			if s.revCount > 0 {
 				s.newCardModulus = sint.Max(2, s.newCardModulus)
 			}
-
+			return
 		}
-		return
 	}
 	s.newCardModulus = 0
 }
 
+// CardConf returns the options of the deck of a card. The cards of a filtered deck use
+// the resched option of the filtered deck and the other options of their home deck
+func (s *schedV2Service) CardConf(card models.Card) (models.DeckConfig, error) {
+	return s.deckConf(card.DeckID)
+}
+
+func (s *schedV2Service) deckConf(deckID models.ID) (models.DeckConfig, error) {
+	decks, err := s.deckRepo.Decks()
+	if err != nil {
+		return models.DeckConfig{}, err
+	}
+	deck, exists := decks[deckID]
+	if !exists {
+		return models.DeckConfig{}, fmt.Errorf("could not find deck %d", deckID)
+	}
+	if deck.Dyn {
+		return models.DeckConfig{Dyn: true, Resched: deck.Resched}, nil
+	}
+	return s.deckRepo.Conf(models.ID(deck.Conf))
+}
+
 // AnswerButtons returns the number of buttons to show when studying a deck
-func (s schedV2Service) AnswerButtons(card models.Card) (int, error) {
-	deckConf, err := s.deckRepo.Conf(card.DeckID)
+func (s *schedV2Service) AnswerButtons(card models.Card) (int, error) {
+	deckConf, err := s.CardConf(card)
 	if err != nil {
 		return 0, err
 	}
@@ -566,142 +935,140 @@ func (s schedV2Service) AnswerButtons(card models.Card) (int, error) {
 	return 4, nil
 }
 
-func (s schedV2Service) AnswerCard(card models.Card, ease models.Ease) error {
-	deckConf, err := s.deckRepo.Conf(card.DeckID)
+func (s *schedV2Service) AnswerCard(card *models.Card, ease models.Ease) error {
+	deckConf, err := s.CardConf(*card)
 	if err != nil {
 		return err
 	}
+	timeTaken := sched.TimeTaken(*card, deckConf)
 	// TODO: figure out how to do markReview
 	// @see anki pylib/anki/schedv2.py
 	if s.burySiblingsOnAns {
-		if err := s.burySiblings(card, deckConf); err != nil {
+		if err := s.burySiblings(*card); err != nil {
 			return err
 		}
 	}
-	previewCard, err := s.previewingCard(card)
-	if err != nil {
-		return err
-	}
-	if previewCard {
-		card, err = s.answerCardPreview(card, ease, deckConf)
-		if err != nil {
-			return err
-		}
-		if err := s.updateStats(card, models.CardTypeTime, TimeTaken(card, deckConf)); err != nil {
-			return err
-		}
+	if previewingCard(deckConf) {
+		s.answerCardPreview(card, ease, deckConf)
 	} else {
 		card.Reps = card.Reps + 1
 		// move new cards in queue to learning
 		if card.Queue == models.CardQueueNew {
 			card.Queue = models.CardQueueLearning
 			card.Type = models.CardTypeLearning
-			left, err := s.startingLeft(card, deckConf)
+			left, err := s.startingLeft(*card)
 			if err != nil {
 				return err
 			}
 			// initital reviews to complete
 			card.ReviewsLeft = left
-			if err := s.updateStats(card, models.CardTypeNew, 1); err != nil {
+			if err := s.updateStats(*card, models.CardTypeNew, 1); err != nil {
 				return err
 			}
 		}
-		if card.Queue == models.CardQueueLearning || card.Queue == models.CardQueueRelearning {
-			if err := s.answerLearnCard(card, deckConf, ease); err != nil {
+		switch card.Queue {
+		case models.CardQueueLearning, models.CardQueueRelearning:
+			if err := s.answerLearnCard(card, ease, timeTaken); err != nil {
 				return err
 			}
-		} else if card.Queue == models.CardQueueReview {
-			if err := s.answerReviewCard(card, ease, deckConf); err != nil {
+		case models.CardQueueReview:
+			if err := s.answerReviewCard(card, ease, timeTaken); err != nil {
 				return err
 			}
-			if err := s.updateStats(card, models.CardTypeReview, 1); err != nil {
+			if err := s.updateStats(*card, models.CardTypeReview, 1); err != nil {
 				return err
 			}
+		default:
+			return fmt.Errorf("card %d in queue %d cannot be answered", card.ID, card.Queue)
 		}
 
+		// once a card has been answered, the original due date no longer applies
 		if card.OriginalDue != 0 {
 			card.OriginalDue = 0
 		}
 	}
-  usn, err := s.colRepo.USN(false)
-  if err != nil {
-    return err
-  }
-  card.Mod = models.UnixTime(time.Now().Unix())
-  card.USN = usn
-  if err := s.cardsRepo.Update(card); err != nil {
-    return err
-  }
-	return nil
+	if err := s.updateStats(*card, models.CardTypeTime, timeTaken); err != nil {
+		return err
+	}
+	usn, err := s.colRepo.USN(s.server)
+	if err != nil {
+		return err
+	}
+	card.Mod = models.UnixTime(time.Now().Unix())
+	card.USN = usn
+	return s.cardsRepo.Update(*card)
 }
 
-func (s schedV2Service) emptyDyn(deckID models.ID, lim string) error {
+func (s *schedV2Service) emptyDyn(deckID models.ID, lim string) error {
 	if lim == "" {
 		lim = "did = " + fmt.Sprint(deckID)
 	}
-	usn, err := s.colRepo.USN(true)
+	usn, err := s.colRepo.USN(s.server)
 	if err != nil {
 		return err
 	}
 	return s.cardsRepo.EmptyDyn(lim, usn)
 }
 
-func (s schedV2Service) burySiblings(card models.Card, deckConfig models.DeckConfig) error {
+// burySiblings buries the other cards of the note which are new or due today and removes them from the queues
+func (s *schedV2Service) burySiblings(card models.Card) error {
 	var cardsToBury []models.ID
-	newCardConf, err := s.newCardConf(card, deckConfig)
+	newCardConf, err := s.newCardConf(card)
 	if err != nil {
 		return err
 	}
-	var buryNew bool
-	if newCardConf.Bury == nil {
-		buryNew = true
-	} else {
-		buryNew = *newCardConf.Bury
-	}
+	buryNew := newCardConf.Bury == nil || *newCardConf.Bury
 	revConf, err := s.revCardConf(card)
 	if err != nil {
 		return err
 	}
-	var buryRev bool
-	if revConf.Bury == nil {
-		buryRev = true
-	} else {
-		buryRev = *revConf.Bury
-	}
-	buriedCards, err := s.cardsRepo.BuriedCards(card.NoteID, card.ID)
+	buryRev := revConf.Bury == nil || *revConf.Bury
+	siblings, err := s.cardsRepo.BuriedCards(card.NoteID, card.ID, s.today)
 	if err != nil {
 		return err
 	}
-	for _, bcard := range buriedCards {
-		if bcard.Queue == models.CardQueueReview {
+	for _, sibling := range siblings {
+		// even if burying is disabled, the siblings are removed from the queues to space them
+		if sibling.Queue == models.CardQueueReview {
 			if buryRev {
-				cardsToBury = append(cardsToBury, bcard.ID)
+				cardsToBury = append(cardsToBury, sibling.ID)
 			}
-			_, s.revQueue = utils.DequeueModelID(s.revQueue, &bcard.ID)
+			s.revQueue = removeID(s.revQueue, sibling.ID)
 		} else {
 			if buryNew {
-				cardsToBury = append(cardsToBury, bcard.ID)
-			}
-			_, s.newQueue = utils.DequeueModelID(s.newQueue, &bcard.ID)
-		}
-		if len(cardsToBury) > 0 {
-			usn, err := s.colRepo.USN(true)
-			if err != nil {
-				return err
+				cardsToBury = append(cardsToBury, sibling.ID)
 			}
-			s.cardsRepo.BuryCards(cardsToBury, usn)
+			s.newQueue = removeID(s.newQueue, sibling.ID)
 		}
 	}
-	return nil
+	if len(cardsToBury) == 0 {
+		return nil
+	}
+	usn, err := s.colRepo.USN(s.server)
+	if err != nil {
+		return err
+	}
+	return s.cardsRepo.BuryCards(cardsToBury, models.CardQueueSBuried, usn)
+}
+
+func removeID(ids []models.ID, id models.ID) []models.ID {
+	if idx := slices.Index(ids, id); idx != -1 {
+		return slices.Delete(ids, idx, idx+1)
+	}
+	return ids
 }
 
-func (s schedV2Service) newCardConf(card models.Card, deckConf models.DeckConfig) (models.NewDeckConf, error) {
+func (s *schedV2Service) newCardConf(card models.Card) (models.NewDeckConf, error) {
+	deckConf, err := s.CardConf(card)
+	if err != nil {
+		return models.NewDeckConf{}, err
+	}
 	// normal deck
 	if card.OriginalDeckID == 0 {
 		return deckConf.New, nil
 	}
 	// dynamic deck
-	origConf, err := s.deckRepo.Conf(card.OriginalDeckID)
+	origConf, err := s.deckConf(card.OriginalDeckID)
 	if err != nil {
 		return models.NewDeckConf{}, err
 	}
@@ -722,30 +1089,33 @@ func (s schedV2Service) newCardConf(card models.Card, deckConf models.DeckConfig
 	}, nil
 }
 
-func (s schedV2Service) revCardConf(card models.Card) (models.RevDeckConf, error) {
-	conf, err := s.deckRepo.Conf(card.DeckID)
-	if err != nil {
-		return models.RevDeckConf{}, err
+func (s *schedV2Service) revCardConf(card models.Card) (models.RevDeckConf, error) {
+	// dynamic deck
+	if card.OriginalDeckID != 0 {
+		origConf, err := s.deckConf(card.OriginalDeckID)
+		if err != nil {
+			return models.RevDeckConf{}, err
+		}
+		return origConf.Rev, nil
 	}
-
 	// normal deck
-	if card.OriginalDeckID == 0 {
-		return conf.Rev, nil
-	}
-	// dynamic deck
-	origConf, err := s.deckRepo.Conf(card.OriginalDeckID)
+	conf, err := s.CardConf(card)
 	if err != nil {
 		return models.RevDeckConf{}, err
 	}
-	return origConf.Rev, nil
+	return conf.Rev, nil
 }
 
-func (s schedV2Service) lapseCardConf(card models.Card, deckConf models.DeckConfig) (models.LapseDeckConf, error) {
+func (s *schedV2Service) lapseCardConf(card models.Card) (models.LapseDeckConf, error) {
+	deckConf, err := s.CardConf(card)
+	if err != nil {
+		return models.LapseDeckConf{}, err
+	}
 	if card.OriginalDeckID == 0 {
 		return deckConf.Lapse, nil
 	}
 	// dynamic deck
-	origConf, err := s.deckRepo.Conf(card.OriginalDeckID)
+	origConf, err := s.deckConf(card.OriginalDeckID)
 	if err != nil {
 		return models.LapseDeckConf{}, err
 	}
@@ -754,16 +1124,19 @@ func (s schedV2Service) lapseCardConf(card models.Card, deckConf models.DeckConf
 		LeechAction: origConf.Lapse.LeechAction,
 		LeechFails:  origConf.Lapse.LeechFails,
 		MinInterval: origConf.Lapse.MinInterval,
-		Mult:        origConf.Lapse.MinInterval,
-		Resched:     origConf.Lapse.Resched,
+		Mult:        origConf.Lapse.Mult,
+		Resched:     deckConf.Resched,
 	}, nil
 }
 
-func (s schedV2Service) learnCardConf(card models.Card, deckConf models.DeckConfig) (interface{}, error) {
+// learnDelays returns the steps in minutes of the learning cards or of the lapsed reviews
+func (s *schedV2Service) learnDelays(card models.Card) ([]int64, error) {
 	if card.Type == models.CardTypeReview || card.Type == models.CardTypeRelearning {
-		return s.lapseCardConf(card, deckConf)
+		conf, err := s.lapseCardConf(card)
+		return conf.Delays, err
 	}
-	return s.newCardConf(card, deckConf)
+	conf, err := s.newCardConf(card)
+	return conf.Delays, err
 }
 
 func parent(name string) string {
@@ -772,64 +1145,39 @@ func parent(name string) string {
 		return ""
 	}
 	parts = parts[:len(parts)-1]
-	return strings.Join(parts, "")
+	return strings.Join(parts, "::")
 }
 
-func updateDeck(deck *models.Deck, todayStmp int64) {
-	if deck.NewToday[0] != todayStmp {
-		deck.NewToday = [2]int64{todayStmp, 0}
-	}
-	if deck.ReviewsToday[0] != todayStmp {
-		deck.ReviewsToday = [2]int64{todayStmp, 0}
-	}
-
-	if deck.LearnToday[0] != todayStmp {
-		deck.LearnToday = [2]int64{todayStmp, 0}
-	}
+func previewingCard(conf models.DeckConfig) bool {
+	return bool(conf.Dyn) && !conf.Resched
 }
 
-func (s schedV2Service) previewingCard(card models.Card) (bool, error) {
-	conf, err := s.deckRepo.Conf(card.DeckID)
-	if err != nil {
-		return false, err
+// previewDelay returns the seconds before showing again a card failed in a filtered deck which does not reschedule
+func previewDelay(conf models.DeckConfig) int64 {
+	if conf.PreviewDelay == nil {
+		return defaultPreviewDelay * 60
 	}
-	return bool(conf.Dyn) && !conf.Resched, nil
+	return int64(*conf.PreviewDelay) * 60
 }
 
-func (s schedV2Service) answerCardPreview(card models.Card, ease models.Ease, conf models.DeckConfig) (models.Card, error) {
-	if ease == 1 {
+func (s *schedV2Service) answerCardPreview(card *models.Card, ease models.Ease, conf models.DeckConfig) {
+	if ease == models.ReviewEaseWrong {
+		// repeat after delay
 		card.Queue = models.CardQueuePreview
-		var previewDelay models.UnixTime
-		if conf.PreviewDelay == nil {
-			previewDelay = 10
-		} else {
-			previewDelay = *conf.PreviewDelay
-		}
-		card.Due = models.UnixTime(time.Now().Unix() + int64(previewDelay)*60)
+		card.Due = models.UnixTime(time.Now().Unix() + previewDelay(conf))
 		s.learningCount = s.learningCount + 1
-		return card, nil
-	} else {
-		card = s.restorePreviewCard(card)
-		card = s.removeFromFiltered(card)
+		return
 	}
-	return card, nil
+	// restore original card state and remove from filtered deck
+	s.restorePreviewCard(card)
+	s.removeFromFiltered(card)
 }
 
-func (s schedV2Service) answerLearnCard(card models.Card, deckConfig models.DeckConfig, ease models.Ease) error {
-	conf, err := s.learnCardConf(card, deckConfig)
+func (s *schedV2Service) answerLearnCard(card *models.Card, ease models.Ease, timeTaken int64) error {
+	delays, err := s.learnDelays(*card)
 	if err != nil {
 		return err
 	}
-
-	var delays []int64
-	switch c := conf.(type) {
-	case models.NewDeckConf:
-		delays = c.Delays
-	case models.LapseDeckConf:
-		delays = c.Delays
-	default:
-		return fmt.Errorf("could not determine deck config type")
-	}
 	var revLogType models.ReviewLogType
 	if card.Type == models.CardTypeReview || card.Type == models.CardTypeRelearning {
 		revLogType = models.ReviewLogTypeRelearn
@@ -839,42 +1187,44 @@ func (s schedV2Service) answerLearnCard(card models.Card, deckConfig models.Deck
 	var leaving bool
 	// lrnCount was decremented once when card was fetched
 	lastLeft := card.ReviewsLeft
-	if ease == models.ReviewEaseEasy {
-		s.rescheduleAsReviewed(card, deckConfig, true)
+	switch ease {
+	case models.ReviewEaseEasy:
+		// immediate graduate
+		if err := s.rescheduleAsReviewed(card, true); err != nil {
+			return err
+		}
 		leaving = true
-	} else if ease == models.ReviewEaseOK {
+	case models.ReviewEaseOK:
+		// graduation time?
 		if (card.ReviewsLeft%1000)-1 <= 0 {
-			s.rescheduleAsReviewed(card, deckConfig, false)
+			if err := s.rescheduleAsReviewed(card, false); err != nil {
+				return err
+			}
 			leaving = true
-		} else {
-			s.moveToNextStep(card, delays)
+		} else if err := s.moveToNextStep(card, delays); err != nil {
+			return err
 		}
-
-	} else if ease == models.ReviewEaseHard {
-		colConf, err := s.colRepo.Conf()
-		if err != nil {
+	case models.ReviewEaseHard:
+		if err := s.repeatStep(card, delays); err != nil {
+			return err
+		}
+	default:
+		// back to first step
+		if _, err := s.moveToFirstStep(card, delays); err != nil {
 			return err
 		}
-		s.repeatStep(card, delays, colConf)
-	} else {
-    if _, err := s.moveToFirstStep(card, deckConfig, delays); err != nil {
-      return err
-    }
 	}
 
-	return s.logLearn(card, deckConfig, delays, lastLeft, leaving, ease, revLogType)
+	return s.logLearn(*card, delays, lastLeft, leaving, ease, revLogType, timeTaken)
 }
 
-func (s schedV2Service) answerReviewCard(card models.Card, ease models.Ease, deckConf models.DeckConfig) error {
+func (s *schedV2Service) answerReviewCard(card *models.Card, ease models.Ease, timeTaken int64) error {
 	var (
-		early      bool
 		delay      int64
 		revLogType models.ReviewLogType
 	)
 
-	if card.OriginalDeckID != 0 && int64(card.OriginalDue) > s.today {
-		early = true
-	}
+	early := card.OriginalDeckID != 0 && int64(card.OriginalDue) > s.today
 	if early {
 		revLogType = models.ReviewLogTypeCram
 	} else {
@@ -883,24 +1233,30 @@ func (s schedV2Service) answerReviewCard(card models.Card, ease models.Ease, dec
 
 	if ease == models.ReviewEaseWrong {
 		var err error
-		delay, err = s.rescheduleLapse(card, deckConf)
+		delay, err = s.rescheduleLapse(card)
 		if err != nil {
 			return err
 		}
-	} else {
-		s.rescheduleReview(card, ease, early, deckConf)
+	} else if err := s.rescheduleReview(card, ease, early); err != nil {
+		return err
 	}
 
-	usn, err := s.colRepo.USN(true)
+	usn, err := s.colRepo.USN(s.server)
 	if err != nil {
 		return err
 	}
-	return s.revLogRepo.Create(card, usn, ease, -delay, card.LastInterval, TimeTaken(card, deckConf), revLogType)
+	// the relearning delay is logged in negative seconds and the new interval in days
+	interval := -delay
+	if delay == 0 {
+		interval = card.Interval
+	}
+	return s.revLogRepo.Create(*card, usn, ease, interval, card.LastInterval, timeTaken, revLogType)
 }
 
-func (s schedV2Service) restorePreviewCard(card models.Card) models.Card {
-	previewCard := card
-	previewCard.Due = card.OriginalDue
+func (s *schedV2Service) restorePreviewCard(card *models.Card) {
+	card.Due = card.OriginalDue
+	// learning and relearning cards may be seconds-based or day-based;
+	// other types map directly to queues
 	if card.Type == models.CardTypeLearning || card.Type == models.CardTypeRelearning {
 		if card.OriginalDue > 1000000000 {
 			card.Queue = models.CardQueueLearning
@@ -910,53 +1266,34 @@ func (s schedV2Service) restorePreviewCard(card models.Card) models.Card {
 	} else {
 		card.Queue = models.CardQue(card.Type)
 	}
-	return previewCard
 }
 
-func (s schedV2Service) removeFromFiltered(card models.Card) models.Card {
+func (s *schedV2Service) removeFromFiltered(card *models.Card) {
 	if card.OriginalDeckID != 0 {
-		card.Deck.ID = card.OriginalDeckID
 		card.DeckID = card.OriginalDeckID
 		card.OriginalDeckID = 0
 		card.OriginalDue = 0
 	}
-	return card
 }
 
-func (s schedV2Service) startingLeft(card models.Card, deckConf models.DeckConfig) (int, error) {
-	var delays []int64
-	if card.Type == models.CardTypeRelearning {
-		laspeConf, err := s.lapseCardConf(card, deckConf)
-		delays = laspeConf.Delays
-		if err != nil {
-			return -1, err
-		}
-	} else {
-		conf, err := s.learnCardConf(card, deckConf)
-		if err != nil {
-			return -1, err
-		}
-		// TODO: figure out a better way to determine the type of conf
-		switch c := conf.(type) {
-		case models.NewDeckConf:
-			delays = c.Delays
-		case models.LapseDeckConf:
-			delays = c.Delays
-		default:
-			return -1, fmt.Errorf("could not determine deck config type")
-		}
+func (s *schedV2Service) startingLeft(card models.Card) (int, error) {
+	delays, err := s.learnDelays(card)
+	if err != nil {
+		return -1, err
 	}
 	totalDelays := len(delays)
 	return totalDelays + s.leftToday(delays, totalDelays)*1000, nil
 }
 
 // leftToday return the number of steps that can be completed by the day cutoff
-func (s schedV2Service) leftToday(delays []int64, left int) int {
+func (s *schedV2Service) leftToday(delays []int64, left int) int {
 	now := time.Now().Unix()
-	offset := sint.Min(left, len(delays))
+	if left > 0 && left < len(delays) {
+		delays = delays[len(delays)-left:]
+	}
 	var steps int
-	for i := 0; i < offset; i++ {
-		now += int64(delays[i] * 60)
+	for i, delay := range delays {
+		now += delay * 60
 		if now > s.dayCutoff {
 			break
 		}
@@ -965,41 +1302,52 @@ func (s schedV2Service) leftToday(delays []int64, left int) int {
 	return steps + 1
 }
 
-func (s schedV2Service) updateStats(card models.Card, cardType models.CardType, timeCount int64) error {
-	decks, err := s.deckRepo.DeckWithParents(card.DeckID)
+// updateStats adds the count to the counters of today of the deck of the card and of its parents
+func (s *schedV2Service) updateStats(card models.Card, cardType models.CardType, count int64) error {
+	decks, err := s.deckRepo.Decks()
 	if err != nil {
 		return err
 	}
-	for _, d := range decks {
+	deck, exists := decks[card.DeckID]
+	if !exists {
+		return fmt.Errorf("could not find deck %d", card.DeckID)
+	}
+	usn, err := s.colRepo.USN(s.server)
+	if err != nil {
+		return err
+	}
+	mod := models.UnixTime(time.Now().Unix())
+	for _, dk := range decks {
+		if dk.ID != deck.ID && !strings.HasPrefix(deck.Name, dk.Name+"::") {
+			continue
+		}
+		sched.UpdateDeck(dk, s.today)
 		switch cardType {
 		case models.CardTypeNew:
-			d.NewToday[1] += timeCount
+			dk.NewToday[1] += count
 		case models.CardTypeLearning, models.CardTypeRelearning:
-			d.LearnToday[1] += timeCount
+			dk.LearnToday[1] += count
 		case models.CardTypeReview:
-			d.ReviewsToday[1] += timeCount
-		default:
-			// add a log?
-			// do nothing
-		}
-		saveErr := s.deckRepo.Save(&d)
-		if saveErr != nil {
-			return saveErr
+			dk.ReviewsToday[1] += count
+		case models.CardTypeTime:
+			dk.TimeToday[1] += count
 		}
+		dk.Mod = &mod
+		dk.USN = usn
 	}
-	return nil
+	return s.deckRepo.SaveAll(decks)
 }
-func (s schedV2Service) rescheduleGraduatingLapse(card models.Card, early bool) models.Card {
+
+func (s *schedV2Service) rescheduleGraduatingLapse(card *models.Card, early bool) {
 	if early {
 		card.Interval += 1
 	}
 	card.Due = models.UnixTime(s.today) + models.UnixTime(card.Interval)
 	card.Queue = models.CardQueueReview
 	card.Type = models.CardTypeReview
-	return card
 }
 
-func (s schedV2Service) fuzzIntervalRange(interval int64) (int64, int64) {
+func (s *schedV2Service) fuzzIntervalRange(interval int64) (int64, int64) {
 	var fuzz int64
 	if interval < 2 {
 		return 1, 1
@@ -1017,200 +1365,171 @@ func (s schedV2Service) fuzzIntervalRange(interval int64) (int64, int64) {
 	return interval - fuzz, interval + fuzz
 }
 
-func (s schedV2Service) fuzzedInterval(interval int64) int64 {
+func (s *schedV2Service) fuzzedInterval(interval int64) int64 {
 	min, max := s.fuzzIntervalRange(interval)
-	return rand.Int63n(max+1) + min
+	return rand.Int63n(max-min+1) + min
 }
 
-func (s schedV2Service) graduatingInterval(card models.Card, deckConfig models.DeckConfig, early bool, fuzzy bool) int64 {
-	var bonus int64
+func (s *schedV2Service) graduatingInterval(card models.Card, conf models.NewDeckConf, early bool, fuzzy bool) int64 {
 	if card.Type == models.CardTypeReview || card.Type == models.CardTypeRelearning {
-		bonus = 1
+		var bonus int64
 		if early {
-			bonus = 0
+			bonus = 1
 		}
 		return card.Interval + bonus
 	}
-	var ideal int64
-	if !early {
-		// graduate / complete
-		ideal = deckConfig.New.Ints[0]
-	} else {
-		// early removal
-		ideal = deckConfig.New.Ints[1]
+	// graduate or early removal
+	ints := append(conf.Ints, 1, 4)
+	ideal := ints[0]
+	if early {
+		ideal = ints[1]
 	}
 	if fuzzy {
-		ideal = s.fuzzedInterval((ideal))
+		ideal = s.fuzzedInterval(ideal)
 	}
 	return ideal
 }
 
 // rescheduleNew will reschedule a new card that is graduated/completed for the first time
-func (s schedV2Service) rescheduleNew(card models.Card, deckConfig models.DeckConfig, early bool) {
-	card.Interval = s.graduatingInterval(card, deckConfig, early, true)
+func (s *schedV2Service) rescheduleNew(card *models.Card, early bool) error {
+	conf, err := s.newCardConf(*card)
+	if err != nil {
+		return err
+	}
+	card.Interval = s.graduatingInterval(*card, conf, early, true)
 	card.Due = models.UnixTime(s.today + int64(card.Interval))
-	card.Factor = deckConfig.New.InitialFactor
+	card.Factor = conf.InitialFactor
 	card.Type = models.CardTypeReview
 	card.Queue = models.CardQueueReview
+	return nil
 }
 
-func (s schedV2Service) rescheduleLapse(card models.Card, deckConf models.DeckConfig) (int64, error) {
-	laspeConf, err := s.lapseCardConf(card, deckConf)
+// rescheduleLapse moves a failed review to the relearning steps and returns the delay in seconds
+// or reschedules it as a review when there are no relearning steps
+func (s *schedV2Service) rescheduleLapse(card *models.Card) (int64, error) {
+	lapseConf, err := s.lapseCardConf(*card)
+	if err != nil {
+		return 0, err
+	}
 	card.Lapses += 1
 	card.Factor = utils.MaxInt64(1300, card.Factor-200)
-	var (
-		suspended bool
-		delay     int64
-	)
-	isLeechCard, err := s.isLeechCard(card, deckConf)
+	isLeechCard, err := s.checkLeech(card, lapseConf)
 	if err != nil {
-		return -1, err
-	}
-	if isLeechCard && card.Queue == models.CardQueueSuspended {
-		suspended = true
+		return 0, err
 	}
-	if len(laspeConf.Delays) > 0 && !suspended {
+	suspended := isLeechCard && card.Queue == models.CardQueueSuspended
+	if len(lapseConf.Delays) > 0 && !suspended {
 		card.Type = models.CardTypeRelearning
-		var stepErr error
-		delay, stepErr = s.moveToFirstStep(card, deckConf, laspeConf.Delays)
-		if stepErr != nil {
-			return -1, stepErr
-		}
-	} else {
-		// no relearning steps
-		card.LastInterval = card.Interval
-		card.Interval = utils.MaxOfInt64(1, int64(laspeConf.MinInterval), card.Interval*laspeConf.Mult)
-		if err := s.rescheduleAsReviewed(card, deckConf, false); err != nil {
-			return -1, err
-		}
-
-		if suspended {
-			card.Queue = models.CardQueueSuspended
-		}
+		return s.moveToFirstStep(card, lapseConf.Delays)
 	}
-	return delay, nil
-}
-func (s schedV2Service) reviewCardConfig(card models.Card, deckConfig models.DeckConfig) (models.RevDeckConf, error) {
-	// normal deck
-	if card.OriginalDeckID != 0 {
-		return deckConfig.Rev, nil
+	// no relearning steps
+	s.updateReviewIntervalOnFail(card, lapseConf)
+	if err := s.rescheduleAsReviewed(card, false); err != nil {
+		return 0, err
 	}
-	origConf, err := s.deckRepo.Conf(card.OriginalDeckID)
-	if err != nil {
-		return models.RevDeckConf{}, err
+	// need to reset the queue after rescheduling
+	if suspended {
+		card.Queue = models.CardQueueSuspended
 	}
+	return 0, nil
+}
 
-	return origConf.Rev, nil
+func (s *schedV2Service) lapseInterval(card models.Card, conf models.LapseDeckConf) int64 {
+	return utils.MaxOfInt64(1, conf.MinInterval, int64(float64(card.Interval)*conf.Mult))
 }
 
-func (s schedV2Service) constrainInterval(interval int64, revConf models.RevDeckConf, previous int64, fuzz bool) int64 {
-	var intervalFct int64
+func (s *schedV2Service) constrainInterval(interval float64, revConf models.RevDeckConf, previous int64, fuzz bool) int64 {
+	intervalFct := 1.0
 	if revConf.IvlFct != nil {
 		intervalFct = *revConf.IvlFct
-	} else {
-		intervalFct = 1.0
 	}
 	intervalNew := int64(interval * intervalFct)
 	if fuzz {
 		intervalNew = s.fuzzedInterval(intervalNew)
 	}
 	intervalNew = utils.MaxOfInt64(intervalNew, previous+1, 1)
-	intervalNew = utils.MinInt64(intervalNew, revConf.MaxIvl)
+	if revConf.MaxIvl > 0 {
+		intervalNew = utils.MinInt64(intervalNew, revConf.MaxIvl)
+	}
 	return intervalNew
 }
 
-func (s schedV2Service) earlyReviewInterval(card models.Card, ease models.Ease, deckConf models.DeckConfig) (int64, error) {
-	elapsed := int64(card.Interval) - int64(card.OriginalDue) - s.today
-	conf, err := s.reviewCardConfig(card, deckConf)
+// earlyReviewInterval returns the next interval in days of a review answered before it is due in a filtered deck
+func (s *schedV2Service) earlyReviewInterval(card models.Card, ease models.Ease) (int64, error) {
+	elapsed := card.Interval - (int64(card.OriginalDue) - s.today)
+	conf, err := s.revCardConf(card)
 	if err != nil {
 		return 0, err
 	}
-	var easyBonus float64 = 1
+	easyBonus := 1.0
 	// early 3/4 reviews shouldn't decrease previous interval
-	var minNewInterval float64 = 1
-	var (
-		factor     float64
-		hardFactor float64
-	)
-	if conf.HardFactor == nil {
-		hardFactor = 1.2
-	} else {
-		hardFactor = *conf.HardFactor
-	}
+	minNewInterval := 1.0
+	var factor float64
 
-	if ease == models.ReviewEaseHard {
-		factor = hardFactor
+	switch ease {
+	case models.ReviewEaseHard:
+		factor = hardFactor(conf)
 		// hard cards shouldn't have their interval decreased by more than 50%
 		// of the normal factor
 		minNewInterval = factor / 2
-	} else if ease == models.ReviewEaseOK {
+	case models.ReviewEaseOK:
 		factor = float64(card.Factor) / 1000
-	} else {
-		// ease == 4
+	default:
 		factor = float64(card.Factor) / 1000
-		ease4 := conf.Ease4
 		// 1.3 -> 1.15
-		easyBonus = ease4 - (ease4-1)/2
+		easyBonus = conf.Ease4 - (conf.Ease4-1)/2
 	}
-	interval := utils.MaxOfInt64(elapsed*int64(factor), 1.0)
+	interval := math.Max(float64(elapsed)*factor, 1)
 	// cap interval decreases
-	interval = utils.MaxOfInt64(card.Interval*int64(minNewInterval), interval) * int64(easyBonus)
-	interval = s.constrainInterval(interval, conf, 0, false)
+	interval = math.Max(float64(card.Interval)*minNewInterval, interval) * easyBonus
+	return s.constrainInterval(interval, conf, 0, false), nil
+}
 
-	return interval, nil
+func hardFactor(conf models.RevDeckConf) float64 {
+	if conf.HardFactor == nil {
+		return 1.2
+	}
+	return *conf.HardFactor
 }
 
 // TODO: check if method is shared with schedv1
-func (s schedV2Service) daysLate(card models.Card) int64 {
+func (s *schedV2Service) daysLate(card models.Card) int64 {
 	// "Number of days later than scheduled."
-	var due int64
+	due := int64(card.Due)
 	if card.OriginalDeckID != 0 {
-		due = int64(card.OriginalDeckID)
-	} else {
-		due = int64(card.Due)
+		due = int64(card.OriginalDue)
 	}
 	return utils.MaxInt64(0, s.today-due)
 }
 
-// TODO: check if method is shared with schedv1
-func (s schedV2Service) nextReviewInterval(card models.Card, ease models.Ease, fuzz bool, deckConfig models.DeckConfig) (int64, error) {
-	//"Next review interval for CARD, given EASE."
+// nextReviewInterval returns the next interval in days of a review given the ease
+func (s *schedV2Service) nextReviewInterval(card models.Card, ease models.Ease, fuzz bool) (int64, error) {
 	delay := s.daysLate(card)
-	conf, err := s.reviewCardConfig(card, deckConfig)
+	conf, err := s.revCardConf(card)
 	if err != nil {
 		return 0, err
 	}
-	factor := card.Factor / 1000
-	var hardFactor float64
-
-	if conf.HardFactor == nil {
-		hardFactor = 1.2
-	} else {
-		hardFactor = *conf.HardFactor
-	}
-
+	factor := float64(card.Factor) / 1000
+	hardFct := hardFactor(conf)
 	var hardMin int64
-	if hardFactor > 1 {
-		hardMin = int64(card.Interval)
+	if hardFct > 1 {
+		hardMin = card.Interval
 	}
 
-	ivl2 := card.Interval * int64(hardFactor)
-	ivl := s.constrainInterval(ivl2, conf, hardMin, fuzz)
-	if ease == models.LearnEaseOK {
-		return ivl, nil
+	ivl2 := s.constrainInterval(float64(card.Interval)*hardFct, conf, hardMin, fuzz)
+	if ease == models.ReviewEaseHard {
+		return ivl2, nil
 	}
 
-	ivl3 := (card.Interval + delay) / 2 * int64(factor)
-	ivl = s.constrainInterval(ivl3, conf, ivl, fuzz)
-	if ease == models.LearnEaseEasy {
-		return ivl, nil
+	ivl3 := s.constrainInterval(float64(card.Interval+delay/2)*factor, conf, ivl2, fuzz)
+	if ease == models.ReviewEaseOK {
+		return ivl3, nil
 	}
-	ivl4 := (card.Interval + delay) * int64(hardFactor) * int64(conf.Ease4)
-	ivl = s.constrainInterval(ivl4, conf, ivl, fuzz)
-	return ivl, nil
+	ivl4 := s.constrainInterval(float64(card.Interval+delay)*factor*conf.Ease4, conf, ivl3, fuzz)
+	return ivl4, nil
 }
 
-func (s schedV2Service) rescheduleReview(card models.Card, ease models.Ease, early bool, deckConfig models.DeckConfig) error {
+func (s *schedV2Service) rescheduleReview(card *models.Card, ease models.Ease, early bool) error {
 	// update interval
 	card.LastInterval = card.Interval
 	var (
@@ -1218,9 +1537,9 @@ func (s schedV2Service) rescheduleReview(card models.Card, ease models.Ease, ear
 		ivl int64
 	)
 	if early {
-		ivl, err = s.earlyReviewInterval(card, ease, deckConfig)
+		ivl, err = s.earlyReviewInterval(*card, ease)
 	} else {
-		ivl, err = s.nextReviewInterval(card, ease, true, deckConfig)
+		ivl, err = s.nextReviewInterval(*card, ease, true)
 	}
 
 	if err != nil {
@@ -1237,79 +1556,84 @@ func (s schedV2Service) rescheduleReview(card models.Card, ease models.Ease, ear
 	return nil
 }
 
-func (s schedV2Service) rescheduleAsReviewed(card models.Card, deckConfig models.DeckConfig, early bool) error {
+func (s *schedV2Service) rescheduleAsReviewed(card *models.Card, early bool) error {
 	if card.Type == models.CardTypeReview || card.Type == models.CardTypeRelearning {
-		card = s.rescheduleGraduatingLapse(card, early)
-	} else {
-		s.rescheduleNew(card, deckConfig, early)
+		s.rescheduleGraduatingLapse(card, early)
+	} else if err := s.rescheduleNew(card, early); err != nil {
+		return err
 	}
 
-	if card.OriginalDeckID != 0 {
-		s.removeFromFiltered(card)
-	}
+	// if we were dynamic, graduating means moving back to the old deck
+	s.removeFromFiltered(card)
 	return nil
 }
 
-func (s schedV2Service) moveToFirstStep(card models.Card, conf models.DeckConfig, delays []int64) (int64, error) {
+func (s *schedV2Service) moveToFirstStep(card *models.Card, delays []int64) (int64, error) {
 	var err error
-	colConf, err := s.colRepo.Conf()
-	if err != nil {
-		return -1, err
-	}
-	card.ReviewsLeft, err = s.startingLeft(card, conf)
+	card.ReviewsLeft, err = s.startingLeft(*card)
 	if err != nil {
-		return -1, err
+		return 0, err
 	}
 	// relearning card?
 	if card.Type == models.CardTypeRelearning {
-		s.updateReviewIntervalOnFail(card, conf)
+		lapseConf, err := s.lapseCardConf(*card)
+		if err != nil {
+			return 0, err
+		}
+		s.updateReviewIntervalOnFail(card, lapseConf)
 	}
-	return s.rescheduleLrnCard(card, delays, nil, colConf), nil
+	return s.rescheduleLrnCard(card, delays, nil)
 }
 
 // moveToNextStep determines how many card left to study by decrementing true remaining count from today
-func (s schedV2Service) moveToNextStep(card models.Card, delays []int64) error {
-	colConf, err := s.colRepo.Conf()
-	if err != nil {
-		return err
-	}
+func (s *schedV2Service) moveToNextStep(card *models.Card, delays []int64) error {
 	left := (card.ReviewsLeft % 1000) - 1
 	card.ReviewsLeft = s.leftToday(delays, left)*1000 + left
-	s.rescheduleLrnCard(card, delays, nil, colConf)
-	return nil
+	_, err := s.rescheduleLrnCard(card, delays, nil)
+	return err
 }
 
-func (s schedV2Service) delayForGrade(delays []int64, left int) (delay int64) {
+// delayForGrade returns the delay in seconds of the step with the given number of steps left
+func (s *schedV2Service) delayForGrade(delays []int64, left int) int64 {
 	left = left % 1000
-	if len(delays)-left > -1 {
+	var delay int64 = 1
+	if left > 0 && left <= len(delays) {
 		delay = delays[len(delays)-left]
 	} else if len(delays) > 0 {
 		delay = delays[0]
-	} else {
-		// use dummy value
-		delay = 1
 	}
-	delay = delay * 60
-  return
+	return delay * 60
 }
 
-func (s schedV2Service) rescheduleLrnCard(card models.Card, delays []int64, delay *int64, colConf models.CollectionConf) int64 {
+// rescheduleLrnCard sets the due time of a learning card after the delay of its step. The cards due today
+// go back to the learning queue and the others are due on a later day
+func (s *schedV2Service) rescheduleLrnCard(card *models.Card, delays []int64, delay *int64) (int64, error) {
+	colConf, err := s.colRepo.Conf()
+	if err != nil {
+		return 0, err
+	}
+	// normal delay for the current step?
 	if delay == nil {
-    delayGrade := s.delayForGrade(delays, card.ReviewsLeft)
+		delayGrade := s.delayForGrade(delays, card.ReviewsLeft)
 		delay = &delayGrade
 	}
-	card.Due = models.UnixTime(time.Now().Unix() + int64(*delay))
+	card.Due = models.UnixTime(time.Now().Unix() + *delay)
+	// due today?
 	if card.Due < models.UnixTime(s.dayCutoff) {
+		// add some randomness, up to 5 minutes or 25%
 		maxExtra := math.Min(300, float64(*delay)*0.25)
 		fuzz := rand.Int63n(int64(math.Max(1, maxExtra)))
 		card.Due = models.UnixTime(math.Min(float64(s.dayCutoff)-1, float64(int64(card.Due)+fuzz)))
 		card.Queue = models.CardQueueLearning
 		if card.Due < (models.UnixTime(time.Now().Unix() + colConf.CollapseTime)) {
 			s.learningCount = s.learningCount + 1
-			// prevent adding entry into queue twice by checking if queue is not empty
-			if s.lrnQueue != nil && s.revCount < 1 && s.newCount < 1 {
-				smallestDue := int(s.lrnQueue[0].Due)
-				card.Due = models.UnixTime(math.Max(float64(int64(card.Due)), float64((smallestDue)+1)))
+			// if the queue is not empty and there's nothing else to do, make sure
+			// we don't put it at the head of the queue and end up showing it twice in a row
+			if len(s.lrnQueue) > 0 && s.revCount < 1 && s.newCount < 1 {
+				smallestDue := s.lrnQueue[0].Due
+				if card.Due <= smallestDue {
+					card.Due = smallestDue + 1
+				}
 			}
 			s.lrnQueue = append(s.lrnQueue, &learnQueue{
 				Due: card.Due,
@@ -1318,14 +1642,15 @@ func (s schedV2Service) rescheduleLrnCard(card models.Card, delays []int64, dela
 			sort.Sort(ByLearnDue(s.lrnQueue))
 		}
 	} else {
-		ahead := math.Floor(float64(int64(card.Due)-s.dayCutoff)/float64(86400)) + 1
-		card.Due = models.UnixTime(int64(s.today) + int64(ahead))
+		// the card is due in one or more days, so we need to use the day learn queue
+		ahead := (int64(card.Due)-s.dayCutoff)/86400 + 1
+		card.Due = models.UnixTime(s.today + ahead)
 		card.Queue = models.CardQueueRelearning
 	}
-	return *delay
+	return *delay, nil
 }
 
-func (s schedV2Service) delayForRepeatingGrade(left int, delays []int64) int64 {
+func (s *schedV2Service) delayForRepeatingGrade(delays []int64, left int) int64 {
 	var delay2 int64
 	// halfway between last and next
 	delay1 := s.delayForGrade(delays, left)
@@ -1334,106 +1659,114 @@ func (s schedV2Service) delayForRepeatingGrade(left int, delays []int64) int64 {
 	} else {
 		delay2 = delay1 * 2
 	}
-	avg := (delay1 + utils.MaxInt64(delay1, delay2)) // 2
-	return avg
+	return (delay1 + utils.MaxInt64(delay1, delay2)) / 2
 }
 
-func (s schedV2Service) logLearn(card models.Card, conf models.DeckConfig, delays []int64, left int, leaving bool, ease models.Ease, revLogType models.ReviewLogType) error {
+func (s *schedV2Service) logLearn(card models.Card, delays []int64, left int, leaving bool, ease models.Ease, revLogType models.ReviewLogType, timeTaken int64) error {
 	lastInterval := -(s.delayForGrade(delays, left))
 	var interval int64
 	if leaving {
 		interval = card.Interval
-	} else if ease == models.LearnEaseOK {
-		interval = -(s.delayForRepeatingGrade(card.ReviewsLeft, delays))
+	} else if ease == models.ReviewEaseHard {
+		interval = -(s.delayForRepeatingGrade(delays, card.ReviewsLeft))
 	} else {
 		interval = -(s.delayForGrade(delays, card.ReviewsLeft))
 	}
 
-	usn, err := s.colRepo.USN(true)
+	usn, err := s.colRepo.USN(s.server)
 	if err != nil {
 		return err
 	}
-	return s.revLogRepo.Create(card, usn, ease, interval, lastInterval, TimeTaken(card, conf), revLogType)
+	return s.revLogRepo.Create(card, usn, ease, interval, lastInterval, timeTaken, revLogType)
 }
 
-func (s schedV2Service) repeatStep(card models.Card, delays []int64, colConf models.CollectionConf) {
-	delay := s.delayForRepeatingGrade(card.ReviewsLeft, delays)
-	s.rescheduleLrnCard(card, delays, &delay, colConf)
+func (s *schedV2Service) repeatStep(card *models.Card, delays []int64) error {
+	delay := s.delayForRepeatingGrade(delays, card.ReviewsLeft)
+	_, err := s.rescheduleLrnCard(card, delays, &delay)
+	return err
 }
 
-func (s schedV2Service) updateReviewIntervalOnFail(card models.Card, conf models.DeckConfig) {
+func (s *schedV2Service) updateReviewIntervalOnFail(card *models.Card, conf models.LapseDeckConf) {
 	card.LastInterval = card.Interval
-	card.Interval = utils.MaxInt64(conf.Lapse.MinInterval, card.Interval*conf.Lapse.Mult)
-}
-
-// TimeTaken returns the time taken to answer card, in integer MS."
-func TimeTaken(card models.Card, conf models.DeckConfig) int64 {
-	total := time.Now().Unix() - int64(card.TimeStarted)*1000
-	return utils.MaxInt64(total, conf.MaxTaken)
+	card.Interval = s.lapseInterval(*card, conf)
 }
 
-func (s schedV2Service) isLeechCard(card models.Card, conf models.DeckConfig) (bool, error) {
-	leechFails := conf.Lapse.LeechFails
+// checkLeech tags the note of a card failed too many times with leech and suspends the card
+// when the leech action of the deck is to suspend
+func (s *schedV2Service) checkLeech(card *models.Card, conf models.LapseDeckConf) (bool, error) {
+	leechFails := conf.LeechFails
 	if leechFails == 0 {
 		return false, nil
 	}
-
-	lf := leechFails / 2
-	if card.Lapses >= leechFails && (card.Lapses-leechFails)%(sint.Max(int(lf), 1)) == 0 {
-		note := card.Note
-		note.Model.Tags = append(note.Model.Tags, "leech")
-		if err := s.noteRepo.Create(note); err != nil {
+	// if over threshold or every half threshold reps after that
+	if card.Lapses < leechFails || (card.Lapses-leechFails)%(sint.Max(leechFails/2, 1)) != 0 {
+		return false, nil
+	}
+	note, exists, err := s.noteRepo.Find(card.NoteID)
+	if err != nil {
+		return false, err
+	}
+	if !exists {
+		return false, fmt.Errorf("could not find note %d", card.NoteID)
+	}
+	if !strings.Contains(strings.ToLower(note.StringTags), " leech ") {
+		usn, err := s.colRepo.USN(s.server)
+		if err != nil {
 			return false, err
 		}
-		if conf.Lapse.LeechAction == 0 {
-			card.Queue = models.CardQueueSuspended
+		note.StringTags = " " + strings.TrimSpace(strings.TrimSpace(note.StringTags)+" leech") + " "
+		note.Mod = models.UnixTime(time.Now().Unix())
+		note.USN = usn
+		if err := s.noteRepo.Create(note); err != nil {
+			return false, err
 		}
-		return true, nil
 	}
-	return false, nil
+	if int(conf.LeechAction) == models.LeechActionSuspend {
+		card.Queue = models.CardQueueSuspended
+	}
+	return true, nil
 }
 
-func (s schedV2Service) NextLearnInterval(card models.Card, ease models.Ease, deckConf models.DeckConfig) (int64, error) {
+// NextLearnInterval returns the next interval of a new or learning card in seconds
+func (s *schedV2Service) NextLearnInterval(card models.Card, ease models.Ease) (int64, error) {
 	if card.Queue == models.CardQueueNew {
-		left, err := s.startingLeft(card, deckConf)
+		left, err := s.startingLeft(card)
 		if err != nil {
 			return 0, err
 		}
 		card.ReviewsLeft = left
 	}
-	conf, err := s.learnCardConf(card, deckConf)
+	delays, err := s.learnDelays(card)
 	if err != nil {
 		return 0, err
 	}
 
-	var delays []int64
-	switch c := conf.(type) {
-	case models.NewDeckConf:
-		delays = c.Delays
-	case models.LapseDeckConf:
-		delays = c.Delays
+	switch ease {
+	case models.ReviewEaseWrong:
+		return s.delayForGrade(delays, len(delays)), nil
+	case models.ReviewEaseHard:
+		return s.delayForRepeatingGrade(delays, card.ReviewsLeft), nil
+	case models.ReviewEaseEasy:
+		conf, err := s.newCardConf(card)
+		if err != nil {
+			return 0, err
+		}
+		return s.graduatingInterval(card, conf, true, false) * 86400, nil
 	default:
-		return 0, fmt.Errorf("could not determine deck config type")
-	}
-
-	if ease == models.LearnEaseWrong {
-		return s.delayForGrade(delays, card.ReviewsLeft), nil
-	} else if ease == models.LearnEaseOK {
-		return s.delayForRepeatingGrade(card.ReviewsLeft, delays), nil
-	} else if ease == models.ReviewEaseEasy {
-		return s.graduatingInterval(card, deckConf, true, false) * 86400, nil
-	} else {
 		reviewsLeft := card.ReviewsLeft%1000 - 1
-		if reviewsLeft <= 0 {
-			return s.graduatingInterval(card, deckConf, false, false), nil
-		} else {
+		if reviewsLeft > 0 {
 			return s.delayForGrade(delays, reviewsLeft), nil
 		}
+		conf, err := s.newCardConf(card)
+		if err != nil {
+			return 0, err
+		}
+		return s.graduatingInterval(card, conf, false, false) * 86400, nil
 	}
 }
 
 // NextIntervalString returns the next interval for CARD as a string.
-func (s schedV2Service) NextIntervalString(card models.Card, ease models.Ease, conf models.DeckConfig) (string, error) {
+func (s *schedV2Service) NextIntervalString(card models.Card, ease models.Ease, conf models.DeckConfig) (string, error) {
 	colConf, err := s.colRepo.Conf()
 	if err != nil {
 		return "", err
@@ -1457,19 +1790,11 @@ func (s schedV2Service) NextIntervalString(card models.Card, ease models.Ease, c
 }
 
 // NextInterval returns the next interval for CARD, in seconds
-func (s schedV2Service) NextInterval(card models.Card, ease models.Ease, conf models.DeckConfig) (int64, error) {
+func (s *schedV2Service) NextInterval(card models.Card, ease models.Ease, conf models.DeckConfig) (int64, error) {
 	// preview mode
-	previewCard, err := s.previewingCard(card)
-	if err != nil {
-		return 0, err
-	}
-	if previewCard {
+	if previewingCard(conf) {
 		if ease == models.ReviewEaseWrong {
-			val, err := conf.Get("previewDelay", 10)
-			if err != nil {
-				return 0, err
-			}
-			return val.Int() * 60, nil
+			return previewDelay(conf), nil
 		}
 		return 0, nil
 	}
@@ -1477,24 +1802,27 @@ func (s schedV2Service) NextInterval(card models.Card, ease models.Ease, conf mo
 	if card.Queue == models.CardQueueNew ||
 		card.Queue == models.CardQueueLearning ||
 		card.Queue == models.CardQueueRelearning {
-		return s.NextLearnInterval(card, ease, conf)
+		return s.NextLearnInterval(card, ease)
 	} else if ease == models.ReviewEaseWrong {
 		// lapse
-		laspeConf, err := s.lapseCardConf(card, conf)
+		lapseConf, err := s.lapseCardConf(card)
 		if err != nil {
 			return 0, err
 		}
-		if len(laspeConf.Delays) > 0 {
-			return laspeConf.Delays[0] * 60, nil
+		if len(lapseConf.Delays) > 0 {
+			return lapseConf.Delays[0] * 60, nil
 		}
-		ivl := utils.MaxOfInt64(1, laspeConf.MinInterval, card.Interval*laspeConf.Mult)
-		return ivl, nil
+		return s.lapseInterval(card, lapseConf) * 86400, nil
+	}
+	// review
+	var (
+		ivl int64
+		err error
+	)
+	if card.OriginalDeckID != 0 && int64(card.OriginalDue) > s.today {
+		ivl, err = s.earlyReviewInterval(card, ease)
 	} else {
-		// review
-		if card.OriginalDeckID > 0 && card.OriginalDue > models.UnixTime(s.today) {
-			return s.earlyReviewInterval(card, ease, conf)
-		} else {
-			return s.nextReviewInterval(card, ease, false, conf)
-		}
+		ivl, err = s.nextReviewInterval(card, ease, false)
 	}
+	return ivl * 86400, err
 }
@@ -0,0 +1,133 @@
+package v2
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	repos "github.com/aerex/go-anki/api/sql/sqlite/repositories"
+	"github.com/aerex/go-anki/api/sql/sqlite/services/sched"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	sentencesDeckID = models.ID(1513458184142)
+	verbsDeckID     = models.ID(1513709967352)
+)
+
+// copy the fixture collection so the tests can modify it
+func setupDB(t *testing.T) *sqlx.DB {
+	_, fileName, _, _ := runtime.Caller(0)
+	src := filepath.Join(filepath.Dir(fileName), "../../fixtures/db/collection.anki2")
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatalf("could not read fixture: %v", err)
+	}
+	dst := filepath.Join(t.TempDir(), "collection.anki2")
+	if err := os.WriteFile(dst, data, 0600); err != nil {
+		t.Fatalf("could not copy fixture: %v", err)
+	}
+	db := sqlx.MustConnect("sqlite3", dst)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// newTestSched studies the deck with the scheduler
+func newTestSched(t *testing.T, db *sqlx.DB, deckID models.ID) sched.SchedService {
+	colRepo := repos.NewColRepository(db)
+	assert.NoError(t, colRepo.SaveCurrentDeck(deckID))
+	assert.NoError(t, colRepo.SaveActiveDecks([]models.ID{deckID}))
+	svc := NewSchedV2Service(colRepo, repos.NewCardRepository(db), repos.NewDeckRepository(db),
+		repos.NewRevLogRepository(db), repos.NewNoteRepository(db), false)
+	assert.NoError(t, svc.Reset())
+	return svc
+}
+
+func TestGetCardOrder(t *testing.T) {
+	db := setupDB(t)
+	svc := newTestSched(t, db, verbsDeckID)
+	assert.Equal(t, models.DeckStudyStats{Learning: 2, Review: 67, New: 1}, svc.Counts())
+
+	// the learning cards due are given first
+	for i := 0; i < 2; i++ {
+		card, err := svc.GetCard()
+		assert.NoError(t, err)
+		assert.Equal(t, models.CardQueueLearning, card.Queue)
+		assert.Equal(t, verbsDeckID, card.Deck.ID)
+		assert.NotEmpty(t, card.Note.Model.Templates)
+	}
+	// the new card is spread among the reviews
+	card, err := svc.GetCard()
+	assert.NoError(t, err)
+	assert.Equal(t, models.CardQueueReview, card.Queue)
+	assert.Equal(t, models.DeckStudyStats{Learning: 0, Review: 66, New: 1}, svc.Counts())
+}
+
+func TestGetCardDailyLimits(t *testing.T) {
+	db := setupDB(t)
+	deckRepo := repos.NewDeckRepository(db)
+	svc := newTestSched(t, db, sentencesDeckID).(*schedV2Service)
+	decks, err := deckRepo.Decks()
+	assert.NoError(t, err)
+	// 95 of the 100 reviews and 19 of the 20 new cards were studied today
+	decks[sentencesDeckID].ReviewsToday = [2]int64{svc.today, 95}
+	decks[sentencesDeckID].NewToday = [2]int64{svc.today, 19}
+	assert.NoError(t, deckRepo.SaveAll(decks))
+	assert.NoError(t, svc.Reset())
+	assert.Equal(t, models.DeckStudyStats{Review: 5, New: 1}, svc.Counts())
+
+	var queues []models.CardQue
+	for {
+		card, err := svc.GetCard()
+		assert.NoError(t, err)
+		if card == nil {
+			break
+		}
+		queues = append(queues, card.Queue)
+	}
+	assert.Len(t, queues, 6)
+}
+
+func TestAnswerCard(t *testing.T) {
+	db := setupDB(t)
+	svc := newTestSched(t, db, sentencesDeckID)
+	start := time.Now().UnixMilli()
+	answered := make(map[models.ID]bool)
+	for {
+		card, err := svc.GetCard()
+		assert.NoError(t, err)
+		if card == nil {
+			break
+		}
+		assert.False(t, answered[card.ID], "card %d was given twice", card.ID)
+		answered[card.ID] = true
+		assert.NoError(t, svc.AnswerCard(card, models.ReviewEaseEasy))
+	}
+	// a card is given by note, the siblings of the answered cards are buried
+	assert.Len(t, answered, 55)
+
+	var buried, left, reviews int
+	assert.NoError(t, db.Get(&buried, "SELECT COUNT() FROM cards WHERE did = ? AND queue = ?", sentencesDeckID, models.CardQueueSBuried))
+	assert.Equal(t, 3+91-55, buried)
+	assert.NoError(t, db.Get(&left, "SELECT COUNT() FROM cards WHERE did = ? AND queue IN (0, 1, 3)", sentencesDeckID))
+	assert.Equal(t, 0, left)
+	assert.NoError(t, db.Get(&reviews, "SELECT COUNT() FROM revlog WHERE id >= ?", start))
+	assert.Equal(t, 55, reviews)
+	decks, err := repos.NewDeckRepository(db).Decks()
+	assert.NoError(t, err)
+	var newCards int64
+	for id := range answered {
+		var logType models.ReviewLogType
+		assert.NoError(t, db.Get(&logType, "SELECT type FROM revlog WHERE cid = ? AND id >= ?", id, start))
+		if logType == models.ReviewLogTypeLearning {
+			newCards++
+		}
+	}
+	assert.Equal(t, newCards, decks[sentencesDeckID].NewToday[1])
+	assert.Equal(t, 55-newCards, decks[sentencesDeckID].ReviewsToday[1])
+}
@@ -0,0 +1,112 @@
+package v3
+
+import (
+	"fmt"
+
+	repos "github.com/aerex/go-anki/api/sql/sqlite/repositories"
+	"github.com/aerex/go-anki/api/sql/sqlite/services/sched"
+	"github.com/aerex/go-anki/api/sql/sqlite/services/sched/fsrs"
+	"github.com/aerex/go-anki/internal/utils"
+	"github.com/aerex/go-anki/pkg/models"
+)
+
+// memoryAnswer is the memory state of a card before and after an answer when the intervals are computed by FSRS
+type memoryAnswer struct {
+	params    fsrs.Parameters
+	retention float64
+	// the state before the answer, nil for a new card
+	previous *fsrs.MemoryState
+	// the days since the previous answer
+	elapsed float64
+	next    fsrs.MemoryState
+}
+
+// NewSchedFSRSService returns the v3 scheduler with the intervals computed by FSRS from the memory state
+// of the cards and the desired retention of their deck options. The learning steps are kept
+func NewSchedFSRSService(c repos.ColRepo, cd repos.CardRepo, d repos.DeckRepo, r repos.RevLogRepo, n repos.NoteRepo, server bool) sched.SchedService {
+	s := NewSchedV3Service(c, cd, d, r, n, server).(*schedV3Service)
+	s.fsrs = true
+	return s
+}
+
+func desiredRetention(conf models.DeckConfig) float64 {
+	if conf.DesiredRetention <= 0 || conf.DesiredRetention >= 1 {
+		return fsrs.DefaultRetention
+	}
+	return conf.DesiredRetention
+}
+
+// nextMemoryState returns the memory state of the card before and after the answer
+func (s *schedV3Service) nextMemoryState(card models.Card, conf models.DeckConfig, ease models.Ease) (*memoryAnswer, error) {
+	memory := &memoryAnswer{
+		params:    fsrs.Parameters(conf.FSRSWeights).OrDefault(),
+		retention: desiredRetention(conf),
+	}
+	if card.Queue != models.CardQueueNew {
+		var err error
+		if memory.previous, memory.elapsed, err = s.memoryState(card, memory.params); err != nil {
+			return nil, err
+		}
+	}
+	memory.next = memory.params.NextState(memory.previous, memory.elapsed, ease)
+	return memory, nil
+}
+
+// memoryState returns the memory state of a card and the days since its last review. The state is read from
+// the data of the card, replayed from its reviews or estimated from its interval and its ease
+func (s *schedV3Service) memoryState(card models.Card, params fsrs.Parameters) (*fsrs.MemoryState, float64, error) {
+	logs, err := s.revLogRepo.History(fmt.Sprintf("c.id = %d", card.ID))
+	if err != nil {
+		return nil, 0, err
+	}
+	var elapsed int64
+	reviewed := false
+	for i := len(logs) - 1; i >= 0 && !reviewed; i-- {
+		if logs[i].Ease > 0 {
+			elapsed = -fsrs.Day(logs[i].ID, s.dayCutoff)
+			reviewed = true
+		}
+	}
+	if !reviewed && card.Type == models.CardTypeReview {
+		due := int64(card.Due)
+		if card.OriginalDeckID != 0 {
+			due = int64(card.OriginalDue)
+		}
+		elapsed = utils.MaxInt64(0, s.today-(due-card.Interval))
+	}
+	state, err := fsrs.ReadMemoryState(card.Data)
+	if err != nil || state != nil {
+		return state, float64(elapsed), err
+	}
+	if history := fsrs.Histories(logs, s.dayCutoff)[card.ID]; len(history) > 0 {
+		return params.MemoryStateFromHistory(history), float64(elapsed), nil
+	}
+	ease := float64(card.Factor) / 1000
+	if card.Factor == 0 {
+		ease = 2.5
+	}
+	estimated := params.MemoryStateFromSM2(ease, float64(card.Interval))
+	return &estimated, float64(elapsed), nil
+}
+
+// interval returns the fuzzed days before the probability to recall the card drops to the desired retention
+func (m *memoryAnswer) interval(card models.Card, conf models.DeckConfig, state fsrs.MemoryState, minimum int64) int64 {
+	return constrainedInterval(card, fsrs.Interval(state.Stability, m.retention), minimum, conf.Rev.MaxIvl)
+}
+
+// reviewInterval returns the interval of a review answered with hard, good or easy. Good is at
+// least a day more than hard and easy at least a day more than good
+func (m *memoryAnswer) reviewInterval(card models.Card, conf models.DeckConfig, ease models.Ease) int64 {
+	after := func(ease models.Ease) fsrs.MemoryState {
+		return m.params.NextState(m.previous, m.elapsed, ease)
+	}
+	hard := m.interval(card, conf, after(models.ReviewEaseHard), 1)
+	if ease == models.ReviewEaseHard {
+		return hard
+	}
+	good := m.interval(card, conf, after(models.ReviewEaseOK), hard+1)
+	if ease == models.ReviewEaseOK {
+		return good
+	}
+	return m.interval(card, conf, after(models.ReviewEaseEasy), good+1)
+}
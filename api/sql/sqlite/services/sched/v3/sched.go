@@ -0,0 +1,1083 @@
+package v3
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slices"
+
+	"github.com/google/gapid/core/math/sint"
+
+	"github.com/aerex/go-anki/api/sql"
+	repos "github.com/aerex/go-anki/api/sql/sqlite/repositories"
+	"github.com/aerex/go-anki/api/sql/sqlite/services/sched"
+	"github.com/aerex/go-anki/api/sql/sqlite/services/sched/fsrs"
+	"github.com/aerex/go-anki/internal/utils"
+	"github.com/aerex/go-anki/pkg/models"
+)
+
+const (
+	DynReportLimit = 99999
+	// the minutes before showing again a card failed in a filtered deck which does not reschedule
+	defaultPreviewDelay = 10
+)
+
+// queueKind is the kind of a card in the main queue
+type queueKind int
+
+const (
+	kindReview queueKind = iota
+	kindDayLearn
+	kindNew
+)
+
+type queueEntry struct {
+	ID   models.ID
+	Kind queueKind
+}
+
+type learnEntry struct {
+	ID  models.ID
+	Due models.UnixTime
+}
+
+// queues are the cards to study today in the order of the v3 scheduler
+type queues struct {
+	// the cards in learning due today sorted by due time
+	learning []learnEntry
+	// the reviews, the cards in learning for more than a day and the new cards mixed
+	// according to the options of the selected deck
+	main []queueEntry
+}
+
+// limits are the number of new cards and reviews a deck can still show today
+type limits struct {
+	review int
+	new    int
+}
+
+type schedV3Service struct {
+	sched.CardActions
+	colRepo    repos.ColRepo
+	deckRepo   repos.DeckRepo
+	cardsRepo  repos.CardRepo
+	revLogRepo repos.RevLogRepo
+	noteRepo   repos.NoteRepo
+	server     bool
+	today      int64
+	dayCutoff  int64
+	queues     queues
+	haveQueues bool
+	// compute the intervals with FSRS
+	fsrs bool
+}
+
+func NewSchedV3Service(c repos.ColRepo, cd repos.CardRepo, d repos.DeckRepo, r repos.RevLogRepo, n repos.NoteRepo, server bool) sched.SchedService {
+	return &schedV3Service{
+		CardActions: sched.NewCardActions(c, cd, d, r, server),
+		colRepo:     c,
+		revLogRepo:  r,
+		deckRepo:    d,
+		cardsRepo:   cd,
+		noteRepo:    n,
+		server:      server,
+	}
+}
+
+// DeckStudyStats returns the counts of each deck as if it was selected, the limits of
+// its parents are not applied
+func (s *schedV3Service) DeckStudyStats() (map[models.ID]models.DeckStudyStats, error) {
+	stats := make(map[models.ID]models.DeckStudyStats)
+	if err := s.checkDay(); err != nil {
+		return stats, err
+	}
+	decks, err := s.deckRepo.Decks()
+	if err != nil {
+		return stats, err
+	}
+	colConf, err := s.colRepo.Conf()
+	if err != nil {
+		return stats, err
+	}
+	for _, deck := range decks {
+		q, err := s.buildQueues(decks, deckTree(decks, deck.ID))
+		if err != nil {
+			return stats, err
+		}
+		stats[deck.ID] = q.counts(time.Now().Unix() + colConf.CollapseTime)
+	}
+	return stats, nil
+}
+
+// checkDay resets the queues when the day cached by the scheduler has passed
+func (s *schedV3Service) checkDay() error {
+	if time.Now().Unix() > s.dayCutoff {
+		return s.Reset()
+	}
+	return nil
+}
+
+// Reset gathers the cards to study today in the active decks
+func (s *schedV3Service) Reset() error {
+	if err := s.updateCutoff(); err != nil {
+		return err
+	}
+	colConf, err := s.colRepo.Conf()
+	if err != nil {
+		return err
+	}
+	decks, err := s.deckRepo.Decks()
+	if err != nil {
+		return err
+	}
+	deckIDs := colConf.ActiveDecks
+	if len(deckIDs) == 0 {
+		deckIDs = deckTree(decks, colConf.CurrentDeck)
+	}
+	s.queues, err = s.buildQueues(decks, deckIDs)
+	if err != nil {
+		return err
+	}
+	s.haveQueues = true
+	return nil
+}
+
+func (s *schedV3Service) updateCutoff() error {
+	var err error
+	s.today, s.dayCutoff, err = sched.Today(s.colRepo, s.server)
+	if err != nil {
+		return err
+	}
+	colConf, err := s.colRepo.Conf()
+	if err != nil {
+		return err
+	}
+	// unbury if the day has rolled over
+	if colConf.LastUnburied < s.today {
+		if err := s.cardsRepo.UnburyCards(); err != nil {
+			return err
+		}
+		return s.colRepo.SaveLastUnburied(s.today)
+	}
+	return nil
+}
+
+// deckTree returns the deck followed by its children sorted by name
+func deckTree(decks models.Decks, deckID models.ID) []models.ID {
+	deck, exists := decks[deckID]
+	if !exists {
+		return nil
+	}
+	var children []*models.Deck
+	for _, dk := range decks {
+		if strings.HasPrefix(dk.Name, deck.Name+"::") {
+			children = append(children, dk)
+		}
+	}
+	sort.Sort(repos.ByDeckName(children))
+	ids := []models.ID{deck.ID}
+	for _, child := range children {
+		ids = append(ids, child.ID)
+	}
+	return ids
+}
+
+// buildQueues gathers the cards of the decks, the selected deck first. The limits are applied from the top
+// down: a deck gives at most the cards left in its limits and in the limits of its parents up to the
+// selected deck. The cards in learning for more than a day and the new cards count against the review limit
+func (s *schedV3Service) buildQueues(decks models.Decks, deckIDs []models.ID) (q queues, err error) {
+	if len(deckIDs) == 0 {
+		return
+	}
+	root := decks[deckIDs[0]]
+	rootConf, err := s.deckConf(root.ID)
+	if err != nil {
+		return
+	}
+	left := make(map[models.ID]*limits)
+	for _, did := range deckIDs {
+		lim, err := s.deckLimits(*decks[did])
+		if err != nil {
+			return q, err
+		}
+		left[did] = &lim
+	}
+	// the parents of each deck in the tree up to the selected deck
+	chains := make(map[models.ID][]models.ID)
+	for _, did := range deckIDs {
+		for _, parentID := range deckIDs {
+			if parentID == did || strings.HasPrefix(decks[did].Name, decks[parentID].Name+"::") {
+				chains[did] = append(chains[did], parentID)
+			}
+		}
+	}
+	remaining := func(did models.ID, new bool) int {
+		limit := math.MaxInt
+		for _, id := range chains[did] {
+			if new {
+				limit = sint.Min(limit, left[id].new)
+			} else {
+				limit = sint.Min(limit, left[id].review)
+			}
+		}
+		return sint.Max(limit, 0)
+	}
+	take := func(did models.ID, reviews int, new int) {
+		for _, id := range chains[did] {
+			left[id].review -= reviews
+			left[id].new -= new
+		}
+	}
+
+	var dayLearning, reviews, newCards []queueEntry
+	for _, did := range deckIDs {
+		ids, err := s.cardsRepo.DayLearningQueue(did, s.today, remaining(did, false))
+		if err != nil {
+			return q, err
+		}
+		take(did, len(ids), 0)
+		dayLearning = append(dayLearning, entries(ids, kindDayLearn)...)
+	}
+	for _, did := range deckIDs {
+		ids, err := s.cardsRepo.ReviewQueue(sql.InClauseFromIDs([]models.ID{did}), s.today, remaining(did, false))
+		if err != nil {
+			return q, err
+		}
+		take(did, len(ids), 0)
+		reviews = append(reviews, entries(ids, kindReview)...)
+	}
+	for _, did := range deckIDs {
+		limit := remaining(did, true)
+		if !rootConf.NewCardsIgnoreReviewLimit {
+			limit = sint.Min(limit, remaining(did, false))
+		}
+		ids, err := s.cardsRepo.NewQueue(did, limit)
+		if err != nil {
+			return q, err
+		}
+		take(did, len(ids), len(ids))
+		newCards = append(newCards, entries(ids, kindNew)...)
+	}
+	cards, err := s.cardsRepo.LearningQueue(sql.InClauseFromIDs(deckIDs), s.dayCutoff, DynReportLimit)
+	if err != nil {
+		return
+	}
+	for _, card := range cards {
+		q.learning = append(q.learning, learnEntry{ID: card.ID, Due: card.Due})
+	}
+	sort.SliceStable(q.learning, func(i, j int) bool { return q.learning[i].Due < q.learning[j].Due })
+	q.main = mix(reviews, dayLearning, rootConf.InterdayLearningMix)
+	q.main = mix(q.main, newCards, rootConf.NewMix)
+	return
+}
+
+func entries(ids []models.ID, kind queueKind) []queueEntry {
+	entries := make([]queueEntry, len(ids))
+	for i, id := range ids {
+		entries[i] = queueEntry{ID: id, Kind: kind}
+	}
+	return entries
+}
+
+// mix shows the cards before, after or spread evenly among the reviews
+func mix(reviews []queueEntry, cards []queueEntry, order models.ReviewMix) []queueEntry {
+	switch order {
+	case models.ReviewMixAfterReviews:
+		return append(reviews, cards...)
+	case models.ReviewMixBeforeReviews:
+		return append(cards, reviews...)
+	}
+	total := len(reviews) + len(cards)
+	mixed := make([]queueEntry, 0, total)
+	var ri, ci int
+	for i := 0; i < total; i++ {
+		// a card is taken when it is behind its share of the positions given so far
+		if ci < len(cards) && (ri == len(reviews) || (ci+1)*total <= (i+1)*len(cards)) {
+			mixed = append(mixed, cards[ci])
+			ci++
+		} else {
+			mixed = append(mixed, reviews[ri])
+			ri++
+		}
+	}
+	return mixed
+}
+
+// deckLimits returns the number of new cards and reviews the deck can still show today. The limits set
+// for today only on the deck replace the limits set on the deck which replace the limits of its options
+func (s *schedV3Service) deckLimits(deck models.Deck) (limits, error) {
+	if deck.Dyn {
+		return limits{review: DynReportLimit, new: DynReportLimit}, nil
+	}
+	conf, err := s.deckRepo.Conf(models.ID(deck.Conf))
+	if err != nil {
+		return limits{}, err
+	}
+	lim := limits{review: conf.Rev.PerDay, new: conf.New.PerDay}
+	if deck.ReviewLimit != nil {
+		lim.review = *deck.ReviewLimit
+	}
+	if deck.NewLimit != nil {
+		lim.new = *deck.NewLimit
+	}
+	if deck.ReviewLimitToday != nil && deck.ReviewLimitToday.Today == s.today {
+		lim.review = deck.ReviewLimitToday.Limit
+	}
+	if deck.NewLimitToday != nil && deck.NewLimitToday.Today == s.today {
+		lim.new = deck.NewLimitToday.Limit
+	}
+	sched.UpdateDeck(&deck, s.today)
+	lim.review -= int(deck.ReviewsToday[1])
+	lim.new -= int(deck.NewToday[1])
+	return lim, nil
+}
+
+// counts returns the number of cards left in the queues. The cards in learning are counted
+// when they are due before the learn ahead cutoff
+func (q queues) counts(learnAheadCutoff int64) models.DeckStudyStats {
+	var stats models.DeckStudyStats
+	for _, entry := range q.learning {
+		if int64(entry.Due) < learnAheadCutoff {
+			stats.Learning++
+		}
+	}
+	for _, entry := range q.main {
+		switch entry.Kind {
+		case kindNew:
+			stats.New++
+		case kindDayLearn:
+			stats.Learning++
+		default:
+			stats.Review++
+		}
+	}
+	return stats
+}
+
+// Counts returns the number of learning, review and new cards left in the queues
+func (s *schedV3Service) Counts() models.DeckStudyStats {
+	colConf, err := s.colRepo.Conf()
+	if err != nil {
+		return models.DeckStudyStats{}
+	}
+	return s.queues.counts(time.Now().Unix() + colConf.CollapseTime)
+}
+
+// GetCard returns the learning card due now, or the next card of the main queue, or when
+// nothing else is left the learning card due within the learn ahead limit
+func (s *schedV3Service) GetCard() (*models.Card, error) {
+	if err := s.checkDay(); err != nil {
+		return nil, err
+	}
+	if !s.haveQueues {
+		if err := s.Reset(); err != nil {
+			return nil, err
+		}
+	}
+	colConf, err := s.colRepo.Conf()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	var id models.ID
+	if len(s.queues.learning) > 0 && int64(s.queues.learning[0].Due) <= now {
+		id = s.popLearning()
+	} else if len(s.queues.main) > 0 {
+		id = s.queues.main[0].ID
+		s.queues.main = s.queues.main[1:]
+	} else if len(s.queues.learning) > 0 && int64(s.queues.learning[0].Due) < now+colConf.CollapseTime {
+		id = s.popLearning()
+	} else {
+		return nil, nil
+	}
+	card, err := s.card(id)
+	if err != nil {
+		return nil, err
+	}
+	card.TimeStarted = models.UnixTime(time.Now().UnixMilli())
+	return card, nil
+}
+
+// RestoreCard fills the queues again once the answer of a card was undone and returns the card
+// to show it again before the other cards
+func (s *schedV3Service) RestoreCard(id models.ID) (*models.Card, error) {
+	if err := s.Reset(); err != nil {
+		return nil, err
+	}
+	learning := s.queues.learning[:0]
+	for _, entry := range s.queues.learning {
+		if entry.ID != id {
+			learning = append(learning, entry)
+		}
+	}
+	s.queues.learning = learning
+	main := s.queues.main[:0]
+	for _, entry := range s.queues.main {
+		if entry.ID != id {
+			main = append(main, entry)
+		}
+	}
+	s.queues.main = main
+	card, err := s.card(id)
+	if err != nil {
+		return nil, err
+	}
+	card.TimeStarted = models.UnixTime(time.Now().UnixMilli())
+	return card, nil
+}
+
+func (s *schedV3Service) popLearning() models.ID {
+	id := s.queues.learning[0].ID
+	s.queues.learning = s.queues.learning[1:]
+	return id
+}
+
+// card returns a card with its note type and its deck to render it
+func (s *schedV3Service) card(id models.ID) (*models.Card, error) {
+	cards, err := s.cardsRepo.List("c.id = ?", []string{fmt.Sprint(id)})
+	if err != nil {
+		return nil, err
+	}
+	if len(cards) == 0 {
+		return nil, fmt.Errorf("could not find card %d", id)
+	}
+	card := cards[0]
+	noteTypes, err := s.colRepo.NoteTypes()
+	if err != nil {
+		return nil, err
+	}
+	decks, err := s.deckRepo.Decks()
+	if err != nil {
+		return nil, err
+	}
+	if noteType, exists := noteTypes[card.Note.ModelID]; exists {
+		card.Note.Model = *noteType
+	}
+	if deck, exists := decks[card.DeckID]; exists {
+		card.Deck = *deck
+	}
+	return &card, nil
+}
+
+// CardConf returns the options of the deck of a card. The cards of a filtered deck use
+// the resched option of the filtered deck and the other options of their home deck
+func (s *schedV3Service) CardConf(card models.Card) (models.DeckConfig, error) {
+	return s.deckConf(card.DeckID)
+}
+
+func (s *schedV3Service) deckConf(deckID models.ID) (models.DeckConfig, error) {
+	decks, err := s.deckRepo.Decks()
+	if err != nil {
+		return models.DeckConfig{}, err
+	}
+	deck, exists := decks[deckID]
+	if !exists {
+		return models.DeckConfig{}, fmt.Errorf("could not find deck %d", deckID)
+	}
+	if deck.Dyn {
+		return models.DeckConfig{Dyn: true, Resched: deck.Resched}, nil
+	}
+	return s.deckRepo.Conf(models.ID(deck.Conf))
+}
+
+// homeConf returns the options of the home deck of a card
+func (s *schedV3Service) homeConf(card models.Card) (models.DeckConfig, error) {
+	if card.OriginalDeckID != 0 {
+		return s.deckConf(card.OriginalDeckID)
+	}
+	return s.deckConf(card.DeckID)
+}
+
+// AnswerButtons returns the number of buttons to show when studying a deck
+func (s *schedV3Service) AnswerButtons(card models.Card) (int, error) {
+	conf, err := s.CardConf(card)
+	if err != nil {
+		return 0, err
+	}
+	if previewingCard(conf) {
+		return 2, nil
+	}
+	return 4, nil
+}
+
+func previewingCard(conf models.DeckConfig) bool {
+	return bool(conf.Dyn) && !conf.Resched
+}
+
+// previewDelay returns the seconds before showing again a card failed in a filtered deck which does not reschedule
+func previewDelay(conf models.DeckConfig) int64 {
+	if conf.PreviewDelay == nil {
+		return defaultPreviewDelay * 60
+	}
+	return int64(*conf.PreviewDelay) * 60
+}
+
+// answer is the state of a card after an answer
+type answer struct {
+	card models.Card
+	// the seconds before the card is shown again when it is in learning
+	delay int64
+	// the previous interval logged in the review log
+	lastInterval int64
+	logType      models.ReviewLogType
+	leech        bool
+	// the memory state of the card when the intervals are computed by FSRS
+	memory *memoryAnswer
+}
+
+// nextState returns the card as it would be after the answer without saving it. The fuzz of the intervals
+// depends on the card and its number of reviews so the intervals shown on the buttons are the given ones
+func (s *schedV3Service) nextState(card models.Card, ease models.Ease) (answer, error) {
+	ans := answer{card: card}
+	conf, err := s.homeConf(card)
+	if err != nil {
+		return ans, err
+	}
+	if s.fsrs {
+		if ans.memory, err = s.nextMemoryState(card, conf, ease); err != nil {
+			return ans, err
+		}
+	}
+	c := &ans.card
+	c.Reps++
+	switch card.Queue {
+	case models.CardQueueNew:
+		c.Type = models.CardTypeLearning
+		c.ReviewsLeft = len(conf.New.Delays)
+		ans.logType = models.ReviewLogTypeLearning
+		err = s.answerLearning(&ans, conf, conf.New.Delays, ease)
+	case models.CardQueueLearning, models.CardQueueRelearning, models.CardQueuePreview:
+		delays := conf.New.Delays
+		ans.logType = models.ReviewLogTypeLearning
+		if card.Type == models.CardTypeRelearning || card.Type == models.CardTypeReview {
+			delays = conf.Lapse.Delays
+			ans.logType = models.ReviewLogTypeRelearn
+		}
+		ans.lastInterval = -delayAt(delays, stepIndex(delays, card.ReviewsLeft))
+		err = s.answerLearning(&ans, conf, delays, ease)
+	case models.CardQueueReview:
+		ans.lastInterval = card.Interval
+		ans.logType = models.ReviewLogTypeReview
+		err = s.answerReview(&ans, conf, ease)
+	default:
+		return ans, fmt.Errorf("card %d in queue %d cannot be answered", card.ID, card.Queue)
+	}
+	if err != nil || ans.memory == nil {
+		return ans, err
+	}
+	c.Data, err = fsrs.WriteMemoryState(c.Data, ans.memory.next, ans.memory.retention)
+	return ans, err
+}
+
+// stepIndex returns the index of the current learning step of a card given its remaining steps
+func stepIndex(delays []int64, left int) int {
+	return sint.Max(0, len(delays)-left%1000)
+}
+
+// delayAt returns the delay in seconds of a learning step
+func delayAt(delays []int64, idx int) int64 {
+	if len(delays) == 0 {
+		return 60
+	}
+	if idx >= len(delays) {
+		idx = len(delays) - 1
+	}
+	return delays[idx] * 60
+}
+
+// hardDelay returns the delay in seconds of the hard button. On the first step it is halfway between
+// the first two steps, or 50% more than the only step but at most one more day. Otherwise the step is repeated
+func hardDelay(delays []int64, idx int) int64 {
+	if idx > 0 {
+		return delayAt(delays, idx)
+	}
+	first := delayAt(delays, 0)
+	if len(delays) > 1 {
+		return (first + delayAt(delays, 1)) / 2
+	}
+	return utils.MinInt64(first*3/2, first+86400)
+}
+
+func (s *schedV3Service) answerLearning(ans *answer, conf models.DeckConfig, delays []int64, ease models.Ease) error {
+	c := &ans.card
+	idx := stepIndex(delays, c.ReviewsLeft)
+	if len(delays) == 0 {
+		return s.graduate(ans, conf, ease == models.ReviewEaseEasy)
+	}
+	switch ease {
+	case models.ReviewEaseWrong:
+		c.ReviewsLeft = len(delays)
+		s.scheduleStep(ans, delayAt(delays, 0))
+	case models.ReviewEaseHard:
+		s.scheduleStep(ans, hardDelay(delays, idx))
+	case models.ReviewEaseOK:
+		if idx+1 >= len(delays) {
+			return s.graduate(ans, conf, false)
+		}
+		c.ReviewsLeft = len(delays) - idx - 1
+		s.scheduleStep(ans, delayAt(delays, idx+1))
+	default:
+		return s.graduate(ans, conf, true)
+	}
+	return nil
+}
+
+// scheduleStep shows the card again after the delay in seconds, on a later day when the delay
+// goes past the end of today
+func (s *schedV3Service) scheduleStep(ans *answer, delay int64) {
+	c := &ans.card
+	// add some randomness, up to 5 minutes or 25%
+	maxExtra := int64(math.Min(300, float64(delay)*0.25))
+	delay += int64(fuzzFactor(*c) * float64(maxExtra))
+	ans.delay = delay
+	due := time.Now().Unix() + delay
+	if due < s.dayCutoff {
+		c.Due = models.UnixTime(due)
+		c.Queue = models.CardQueueLearning
+		return
+	}
+	ahead := (due-s.dayCutoff)/86400 + 1
+	c.Due = models.UnixTime(s.today + ahead)
+	c.Queue = models.CardQueueRelearning
+}
+
+// graduate moves a card in learning to the reviews
+func (s *schedV3Service) graduate(ans *answer, conf models.DeckConfig, easy bool) error {
+	c := &ans.card
+	ans.delay = 0
+	lapsed := c.Type == models.CardTypeRelearning || c.Type == models.CardTypeReview
+	switch {
+	case ans.memory != nil:
+		c.Interval = ans.memory.interval(*c, conf, ans.memory.next, 1)
+	case lapsed:
+		// a lapsed review keeps the interval set when it was failed
+		if easy {
+			c.Interval++
+		}
+	default:
+		ints := append(conf.New.Ints, 1, 4)
+		ideal := ints[0]
+		if easy {
+			ideal = ints[1]
+		}
+		c.Interval = constrainedInterval(*c, float64(ideal), 1, conf.Rev.MaxIvl)
+	}
+	if !lapsed {
+		c.Factor = conf.New.InitialFactor
+	}
+	c.ReviewsLeft = 0
+	c.Type = models.CardTypeReview
+	c.Queue = models.CardQueueReview
+	c.Due = models.UnixTime(s.today + c.Interval)
+	removeFromFiltered(c)
+	return nil
+}
+
+func (s *schedV3Service) answerReview(ans *answer, conf models.DeckConfig, ease models.Ease) error {
+	c := &ans.card
+	early := c.OriginalDeckID != 0 && int64(c.OriginalDue) > s.today
+	if early {
+		ans.logType = models.ReviewLogTypeCram
+	}
+	if ease == models.ReviewEaseWrong {
+		c.Lapses++
+		c.Factor = utils.MaxInt64(1300, c.Factor-200)
+		c.LastInterval = c.Interval
+		if ans.memory != nil {
+			c.Interval = ans.memory.interval(*c, conf, ans.memory.next, conf.Lapse.MinInterval)
+		} else {
+			c.Interval = utils.MaxOfInt64(1, conf.Lapse.MinInterval, int64(float64(c.Interval)*conf.Lapse.Mult))
+		}
+		if conf.Rev.MaxIvl > 0 {
+			c.Interval = utils.MinInt64(c.Interval, conf.Rev.MaxIvl)
+		}
+		ans.leech = isLeech(*c, conf.Lapse)
+		if len(conf.Lapse.Delays) > 0 {
+			c.Type = models.CardTypeRelearning
+			c.ReviewsLeft = len(conf.Lapse.Delays)
+			s.scheduleStep(ans, delayAt(conf.Lapse.Delays, 0))
+			return nil
+		}
+		c.Due = models.UnixTime(s.today + c.Interval)
+		removeFromFiltered(c)
+		return nil
+	}
+	c.LastInterval = c.Interval
+	if ans.memory != nil {
+		// the days elapsed since the last review are part of the memory state
+		c.Interval = ans.memory.reviewInterval(*c, conf, ease)
+	} else if early {
+		c.Interval = s.earlyReviewInterval(*c, conf.Rev, ease)
+	} else {
+		c.Interval = s.reviewInterval(*c, conf.Rev, ease)
+	}
+	c.Factor = utils.MaxInt64(1300, c.Factor+[]int64{-150, 0, 150}[ease-2])
+	c.Due = models.UnixTime(s.today + c.Interval)
+	removeFromFiltered(c)
+	return nil
+}
+
+func hardFactor(conf models.RevDeckConf) float64 {
+	if conf.HardFactor == nil {
+		return 1.2
+	}
+	return *conf.HardFactor
+}
+
+// reviewInterval returns the next interval in days of a review. Hard is at least a day more than the
+// current interval unless the hard factor is below 1, good is at least a day more than hard and easy
+// at least a day more than good
+func (s *schedV3Service) reviewInterval(card models.Card, conf models.RevDeckConf, ease models.Ease) int64 {
+	due := int64(card.Due)
+	if card.OriginalDeckID != 0 {
+		due = int64(card.OriginalDue)
+	}
+	daysLate := float64(utils.MaxInt64(0, s.today-due))
+	current := float64(card.Interval)
+	factor := float64(card.Factor) / 1000
+	hardFct := hardFactor(conf)
+	var hardMin int64
+	if hardFct > 1 {
+		hardMin = card.Interval + 1
+	}
+	hard := constrainedInterval(card, current*hardFct*ivlFct(conf), hardMin, conf.MaxIvl)
+	if ease == models.ReviewEaseHard {
+		return hard
+	}
+	good := constrainedInterval(card, (current+daysLate/2)*factor*ivlFct(conf), hard+1, conf.MaxIvl)
+	if ease == models.ReviewEaseOK {
+		return good
+	}
+	return constrainedInterval(card, (current+daysLate)*factor*conf.Ease4*ivlFct(conf), good+1, conf.MaxIvl)
+}
+
+// earlyReviewInterval returns the next interval in days of a review answered before it is due in a filtered deck
+func (s *schedV3Service) earlyReviewInterval(card models.Card, conf models.RevDeckConf, ease models.Ease) int64 {
+	elapsed := float64(card.Interval - (int64(card.OriginalDue) - s.today))
+	factor := float64(card.Factor) / 1000
+	var interval float64
+	switch ease {
+	case models.ReviewEaseHard:
+		// hard cards shouldn't have their interval decreased by more than 50% of the normal factor
+		interval = math.Max(elapsed*hardFactor(conf), float64(card.Interval)*hardFactor(conf)/2)
+	case models.ReviewEaseOK:
+		interval = math.Max(elapsed*factor, float64(card.Interval))
+	default:
+		// 1.3 -> 1.15
+		interval = math.Max(elapsed*factor, float64(card.Interval)) * (conf.Ease4 - (conf.Ease4-1)/2)
+	}
+	return constrainedInterval(card, interval*ivlFct(conf), 1, conf.MaxIvl)
+}
+
+func ivlFct(conf models.RevDeckConf) float64 {
+	if conf.IvlFct == nil {
+		return 1
+	}
+	return *conf.IvlFct
+}
+
+// fuzzFactor returns a number between 0 and 1 which is the same for a card until it is reviewed again
+func fuzzFactor(card models.Card) float64 {
+	return rand.New(rand.NewSource(int64(card.ID) + int64(card.Reps))).Float64()
+}
+
+// the part of the interval in days added to the range of the fuzz
+var fuzzRanges = []struct{ start, end, factor float64 }{
+	{2.5, 7, 0.15},
+	{7, 20, 0.1},
+	{20, math.Inf(1), 0.05},
+}
+
+// constrainedInterval fuzzes the interval in days and keeps it between the minimum and the maximum
+func constrainedInterval(card models.Card, interval float64, minimum int64, maximum int64) int64 {
+	if maximum <= 0 {
+		maximum = math.MaxInt32
+	}
+	minimum = utils.MinInt64(utils.MaxInt64(minimum, 1), maximum)
+	ivl := int64(math.Round(interval))
+	if interval >= 2.5 {
+		delta := 1.0
+		for _, r := range fuzzRanges {
+			delta += r.factor * math.Max(math.Min(interval, r.end)-r.start, 0)
+		}
+		lower := utils.MaxInt64(int64(math.Round(interval-delta)), minimum)
+		upper := utils.MinInt64(int64(math.Round(interval+delta)), maximum)
+		if upper >= lower {
+			ivl = lower + int64(fuzzFactor(card)*float64(upper-lower+1))
+		}
+	}
+	return utils.MinInt64(utils.MaxInt64(ivl, minimum), maximum)
+}
+
+func isLeech(card models.Card, conf models.LapseDeckConf) bool {
+	if conf.LeechFails == 0 || card.Lapses < conf.LeechFails {
+		return false
+	}
+	// if over threshold or every half threshold reps after that
+	return (card.Lapses-conf.LeechFails)%sint.Max(conf.LeechFails/2, 1) == 0
+}
+
+func removeFromFiltered(card *models.Card) {
+	if card.OriginalDeckID != 0 {
+		card.DeckID = card.OriginalDeckID
+		card.OriginalDeckID = 0
+		card.OriginalDue = 0
+	}
+}
+
+func (s *schedV3Service) AnswerCard(card *models.Card, ease models.Ease) error {
+	conf, err := s.CardConf(*card)
+	if err != nil {
+		return err
+	}
+	timeTaken := sched.TimeTaken(*card, conf)
+	if err := s.burySiblings(*card); err != nil {
+		return err
+	}
+	usn, err := s.colRepo.USN(s.server)
+	if err != nil {
+		return err
+	}
+	previousQueue := card.Queue
+	if previewingCard(conf) {
+		s.answerPreview(card, ease, conf)
+	} else {
+		ans, err := s.nextState(*card, ease)
+		if err != nil {
+			return err
+		}
+		*card = ans.card
+		if ans.leech {
+			homeConf, err := s.homeConf(*card)
+			if err != nil {
+				return err
+			}
+			if err := s.tagLeech(*card, usn); err != nil {
+				return err
+			}
+			if int(homeConf.Lapse.LeechAction) == models.LeechActionSuspend {
+				card.Queue = models.CardQueueSuspended
+			}
+		}
+		interval := card.Interval
+		if ans.delay != 0 {
+			interval = -ans.delay
+		}
+		if err := s.revLogRepo.Create(*card, usn, ease, interval, ans.lastInterval, timeTaken, ans.logType); err != nil {
+			return err
+		}
+		switch previousQueue {
+		case models.CardQueueNew:
+			err = s.updateStats(*card, models.CardTypeNew, 1)
+		case models.CardQueueReview, models.CardQueueRelearning:
+			// the cards in learning for more than a day count against the review limit
+			err = s.updateStats(*card, models.CardTypeReview, 1)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := s.updateStats(*card, models.CardTypeTime, timeTaken); err != nil {
+		return err
+	}
+	card.Mod = models.UnixTime(time.Now().Unix())
+	card.USN = usn
+	if err := s.cardsRepo.Update(*card); err != nil {
+		return err
+	}
+	if card.Queue == models.CardQueueLearning || card.Queue == models.CardQueuePreview {
+		s.queues.learning = append(s.queues.learning, learnEntry{ID: card.ID, Due: card.Due})
+		sort.SliceStable(s.queues.learning, func(i, j int) bool { return s.queues.learning[i].Due < s.queues.learning[j].Due })
+	}
+	return nil
+}
+
+func (s *schedV3Service) answerPreview(card *models.Card, ease models.Ease, conf models.DeckConfig) {
+	if ease == models.ReviewEaseWrong {
+		// repeat after delay
+		card.Queue = models.CardQueuePreview
+		card.Due = models.UnixTime(time.Now().Unix() + previewDelay(conf))
+		return
+	}
+	// restore original card state and remove from filtered deck
+	card.Due = card.OriginalDue
+	if card.Type == models.CardTypeLearning || card.Type == models.CardTypeRelearning {
+		if card.OriginalDue > 1000000000 {
+			card.Queue = models.CardQueueLearning
+		} else {
+			card.Queue = models.CardQueueRelearning
+		}
+	} else {
+		card.Queue = models.CardQue(card.Type)
+	}
+	removeFromFiltered(card)
+}
+
+// tagLeech tags the note of the card with leech
+func (s *schedV3Service) tagLeech(card models.Card, usn int) error {
+	note, exists, err := s.noteRepo.Find(card.NoteID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("could not find note %d", card.NoteID)
+	}
+	if strings.Contains(strings.ToLower(note.StringTags), " leech ") {
+		return nil
+	}
+	note.StringTags = " " + strings.TrimSpace(strings.TrimSpace(note.StringTags)+" leech") + " "
+	note.Mod = models.UnixTime(time.Now().Unix())
+	note.USN = usn
+	return s.noteRepo.Create(note)
+}
+
+// burySiblings buries the other cards of the note which are new or due today and removes them from the queues
+func (s *schedV3Service) burySiblings(card models.Card) error {
+	conf, err := s.homeConf(card)
+	if err != nil {
+		return err
+	}
+	buryNew := conf.New.Bury == nil || *conf.New.Bury
+	buryRev := conf.Rev.Bury == nil || *conf.Rev.Bury
+	siblings, err := s.cardsRepo.BuriedCards(card.NoteID, card.ID, s.today)
+	if err != nil {
+		return err
+	}
+	var cardsToBury []models.ID
+	for _, sibling := range siblings {
+		if (sibling.Queue == models.CardQueueReview && buryRev) || (sibling.Queue == models.CardQueueNew && buryNew) {
+			cardsToBury = append(cardsToBury, sibling.ID)
+			s.queues.main = slices.DeleteFunc(s.queues.main, func(entry queueEntry) bool { return entry.ID == sibling.ID })
+		}
+	}
+	if len(cardsToBury) == 0 {
+		return nil
+	}
+	usn, err := s.colRepo.USN(s.server)
+	if err != nil {
+		return err
+	}
+	return s.cardsRepo.BuryCards(cardsToBury, models.CardQueueSBuried, usn)
+}
+
+// updateStats adds the count to the counters of today of the deck of the card and of its parents
+func (s *schedV3Service) updateStats(card models.Card, cardType models.CardType, count int64) error {
+	decks, err := s.deckRepo.Decks()
+	if err != nil {
+		return err
+	}
+	deck, exists := decks[card.DeckID]
+	if !exists {
+		return fmt.Errorf("could not find deck %d", card.DeckID)
+	}
+	usn, err := s.colRepo.USN(s.server)
+	if err != nil {
+		return err
+	}
+	mod := models.UnixTime(time.Now().Unix())
+	for _, dk := range decks {
+		if dk.ID != deck.ID && !strings.HasPrefix(deck.Name, dk.Name+"::") {
+			continue
+		}
+		sched.UpdateDeck(dk, s.today)
+		switch cardType {
+		case models.CardTypeNew:
+			dk.NewToday[1] += count
+		case models.CardTypeReview:
+			dk.ReviewsToday[1] += count
+		case models.CardTypeTime:
+			dk.TimeToday[1] += count
+		}
+		dk.Mod = &mod
+		dk.USN = usn
+	}
+	return s.deckRepo.SaveAll(decks)
+}
+
+// ExtendLimits raises the number of new cards and reviews of today for the deck, its parents and
+// its children. The extensions are kept in the deck to be suggested on the next custom study
+func (s *schedV3Service) ExtendLimits(deckID models.ID, newCards int, revCards int) error {
+	if err := s.updateCutoff(); err != nil {
+		return err
+	}
+	decks, err := s.deckRepo.Decks()
+	if err != nil {
+		return err
+	}
+	deck, exists := decks[deckID]
+	if !exists {
+		return fmt.Errorf("could not find deck %d", deckID)
+	}
+	usn, err := s.colRepo.USN(s.server)
+	if err != nil {
+		return err
+	}
+	if newCards != 0 {
+		deck.ExtendNewCardLimit = newCards
+	}
+	if revCards != 0 {
+		deck.ExtendReviewCardLimit = revCards
+	}
+	mod := models.UnixTime(time.Now().Unix())
+	for _, dk := range decks {
+		isParent := strings.HasPrefix(deck.Name, dk.Name+"::")
+		isChild := strings.HasPrefix(dk.Name, deck.Name+"::")
+		if dk.ID != deck.ID && !isParent && !isChild {
+			continue
+		}
+		sched.UpdateDeck(dk, s.today)
+		dk.NewToday[1] -= int64(newCards)
+		dk.ReviewsToday[1] -= int64(revCards)
+		dk.Mod = &mod
+		dk.USN = usn
+	}
+	if err := s.deckRepo.SaveAll(decks); err != nil {
+		return err
+	}
+	return s.colRepo.UpdateMod()
+}
+
+// NextInterval returns the next interval for CARD, in seconds
+func (s *schedV3Service) NextInterval(card models.Card, ease models.Ease, conf models.DeckConfig) (int64, error) {
+	if previewingCard(conf) {
+		if ease == models.ReviewEaseWrong {
+			return previewDelay(conf), nil
+		}
+		return 0, nil
+	}
+	ans, err := s.nextState(card, ease)
+	if err != nil {
+		return 0, err
+	}
+	if ans.delay != 0 {
+		return ans.delay, nil
+	}
+	return ans.card.Interval * 86400, nil
+}
+
+// NextIntervalString returns the next interval for CARD as a string.
+func (s *schedV3Service) NextIntervalString(card models.Card, ease models.Ease, conf models.DeckConfig) (string, error) {
+	colConf, err := s.colRepo.Conf()
+	if err != nil {
+		return "", err
+	}
+	ivl, err := s.NextInterval(card, ease, conf)
+	if err != nil {
+		return "", err
+	}
+	if ivl == 0 {
+		return "(end)", nil
+	}
+	ivlStr, err := utils.FormatTimeSpan(ivl, 0, 0, false, false, nil)
+	if err != nil {
+		return "", err
+	}
+	if ivl < colConf.CollapseTime {
+		ivlStr = "<" + ivlStr
+	}
+	return ivlStr, nil
+}
@@ -0,0 +1,340 @@
+package v3
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	repos "github.com/aerex/go-anki/api/sql/sqlite/repositories"
+	"github.com/aerex/go-anki/api/sql/sqlite/services/sched"
+	"github.com/aerex/go-anki/api/sql/sqlite/services/sched/fsrs"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	vocabularyDeckID = models.ID(1512971773018)
+	sentencesDeckID  = models.ID(1513458184142)
+)
+
+// copy the fixture collection so the tests can modify it
+func setupDB(t *testing.T) *sqlx.DB {
+	_, fileName, _, _ := runtime.Caller(0)
+	src := filepath.Join(filepath.Dir(fileName), "../../fixtures/db/collection.anki2")
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatalf("could not read fixture: %v", err)
+	}
+	dst := filepath.Join(t.TempDir(), "collection.anki2")
+	if err := os.WriteFile(dst, data, 0600); err != nil {
+		t.Fatalf("could not copy fixture: %v", err)
+	}
+	db := sqlx.MustConnect("sqlite3", dst)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// newTestSched studies the decks with the scheduler
+func newTestSched(t *testing.T, db *sqlx.DB, deckIDs ...models.ID) *schedV3Service {
+	colRepo := repos.NewColRepository(db)
+	assert.NoError(t, colRepo.SaveCurrentDeck(deckIDs[0]))
+	assert.NoError(t, colRepo.SaveActiveDecks(deckIDs))
+	svc := NewSchedV3Service(colRepo, repos.NewCardRepository(db), repos.NewDeckRepository(db),
+		repos.NewRevLogRepository(db), repos.NewNoteRepository(db), false).(*schedV3Service)
+	assert.NoError(t, svc.Reset())
+	return svc
+}
+
+// updateDecks changes the decks and gathers the cards again
+func updateDecks(t *testing.T, db *sqlx.DB, svc *schedV3Service, update func(decks models.Decks)) {
+	deckRepo := repos.NewDeckRepository(db)
+	decks, err := deckRepo.Decks()
+	assert.NoError(t, err)
+	update(decks)
+	assert.NoError(t, deckRepo.SaveAll(decks))
+	assert.NoError(t, svc.Reset())
+}
+
+func TestLimitsFromTheTopDown(t *testing.T) {
+	db := setupDB(t)
+	svc := newTestSched(t, db, sentencesDeckID)
+	// the new cards are limited by the reviews left
+	assert.Equal(t, models.DeckStudyStats{Review: 91, New: 3}, svc.Counts())
+	updateDecks(t, db, svc, func(decks models.Decks) {
+		limit := 92
+		decks[sentencesDeckID].ReviewLimit = &limit
+	})
+	assert.Equal(t, models.DeckStudyStats{Review: 91, New: 1}, svc.Counts())
+	// the limits of today replace the limits of the deck
+	updateDecks(t, db, svc, func(decks models.Decks) {
+		decks[sentencesDeckID].ReviewLimitToday = &models.DayLimit{Limit: 10, Today: svc.today}
+		decks[sentencesDeckID].NewLimitToday = &models.DayLimit{Limit: 5, Today: svc.today - 1}
+	})
+	assert.Equal(t, models.DeckStudyStats{Review: 10}, svc.Counts())
+
+	// the children are limited by their parents
+	svc = newTestSched(t, db, vocabularyDeckID, sentencesDeckID)
+	updateDecks(t, db, svc, func(decks models.Decks) {
+		limit := 150
+		decks[vocabularyDeckID].ReviewLimit = &limit
+		decks[sentencesDeckID].ReviewLimit = nil
+		decks[sentencesDeckID].ReviewLimitToday = nil
+		decks[sentencesDeckID].Name = "Vocabulary::Sentences"
+	})
+	assert.Equal(t, models.DeckStudyStats{Review: 150}, svc.Counts())
+	var fromSentences int
+	for _, entry := range svc.queues.main {
+		var did models.ID
+		assert.NoError(t, db.Get(&did, "SELECT did FROM cards WHERE id = ?", entry.ID))
+		if did == sentencesDeckID {
+			fromSentences++
+		}
+	}
+	assert.Equal(t, 150-107, fromSentences)
+
+	// the limits of the parents of the selected deck are ignored
+	stats, err := svc.DeckStudyStats()
+	assert.NoError(t, err)
+	assert.Equal(t, models.DeckStudyStats{Review: 91, New: 3}, stats[sentencesDeckID])
+}
+
+func TestMix(t *testing.T) {
+	reviews := entries([]models.ID{1, 2, 3, 4}, kindReview)
+	cards := entries([]models.ID{5, 6}, kindNew)
+	ids := func(entries []queueEntry) (ids []models.ID) {
+		for _, entry := range entries {
+			ids = append(ids, entry.ID)
+		}
+		return
+	}
+	assert.Equal(t, []models.ID{1, 2, 5, 3, 4, 6}, ids(mix(reviews, cards, models.ReviewMixWithReviews)))
+	assert.Equal(t, []models.ID{1, 2, 3, 4, 5, 6}, ids(mix(reviews, cards, models.ReviewMixAfterReviews)))
+	assert.Equal(t, []models.ID{5, 6, 1, 2, 3, 4}, ids(mix(reviews, cards, models.ReviewMixBeforeReviews)))
+}
+
+func TestHardDelay(t *testing.T) {
+	// halfway between the first two steps
+	assert.Equal(t, int64(330), hardDelay([]int64{1, 10}, 0))
+	// 50% more than the only step but at most a day more
+	assert.Equal(t, int64(900), hardDelay([]int64{10}, 0))
+	assert.Equal(t, int64(3*86400), hardDelay([]int64{2 * 1440}, 0))
+	// the later steps are repeated
+	assert.Equal(t, int64(600), hardDelay([]int64{1, 10}, 1))
+}
+
+func TestReviewIntervals(t *testing.T) {
+	db := setupDB(t)
+	svc := newTestSched(t, db, sentencesDeckID)
+	card := models.Card{ID: 1, Interval: 10, Factor: 2500, Due: models.UnixTime(svc.today), Queue: models.CardQueueReview}
+	conf := models.RevDeckConf{Ease4: 1.3, MaxIvl: 36500}
+	hard := svc.reviewInterval(card, conf, models.ReviewEaseHard)
+	good := svc.reviewInterval(card, conf, models.ReviewEaseOK)
+	easy := svc.reviewInterval(card, conf, models.ReviewEaseEasy)
+	assert.GreaterOrEqual(t, hard, int64(11))
+	assert.Greater(t, good, hard)
+	assert.Greater(t, easy, good)
+	// the fuzz is the same until the card is reviewed again
+	assert.Equal(t, good, svc.reviewInterval(card, conf, models.ReviewEaseOK))
+	conf.MaxIvl = 12
+	assert.Equal(t, int64(12), svc.reviewInterval(card, conf, models.ReviewEaseEasy))
+}
+
+func TestAnswerCard(t *testing.T) {
+	db := setupDB(t)
+	svc := newTestSched(t, db, sentencesDeckID)
+	start := time.Now().UnixMilli()
+	var given int
+	learning := make(map[models.ID]bool)
+	for {
+		card, err := svc.GetCard()
+		assert.NoError(t, err)
+		if card == nil {
+			break
+		}
+		given++
+		if card.Queue == models.CardQueueNew {
+			next, err := svc.NextInterval(*card, models.ReviewEaseOK, models.DeckConfig{})
+			assert.NoError(t, err)
+			assert.InDelta(t, 600, next, 150)
+			learning[card.ID] = true
+		}
+		assert.NoError(t, svc.AnswerCard(card, models.ReviewEaseOK))
+	}
+	// the new cards are shown again at their second step within the learn ahead limit
+	assert.Equal(t, 55+len(learning), given)
+
+	var left, reviews int
+	assert.NoError(t, db.Get(&left, "SELECT COUNT() FROM cards WHERE did = ? AND queue IN (0, 1, 3)", sentencesDeckID))
+	assert.Equal(t, 0, left)
+	assert.NoError(t, db.Get(&reviews, "SELECT COUNT() FROM revlog WHERE id >= ?", start))
+	assert.Equal(t, given, reviews)
+	decks, err := repos.NewDeckRepository(db).Decks()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(learning)), decks[sentencesDeckID].NewToday[1])
+	assert.Equal(t, int64(55-len(learning)), decks[sentencesDeckID].ReviewsToday[1])
+}
+
+func TestFSRS(t *testing.T) {
+	db := setupDB(t)
+	svc := newTestSched(t, db, sentencesDeckID)
+	svc.fsrs = true
+	var card *models.Card
+	for card == nil || card.Queue != models.CardQueueReview {
+		var err error
+		card, err = svc.GetCard()
+		assert.NoError(t, err)
+	}
+	goodInterval := func() int64 {
+		next, err := svc.NextInterval(*card, models.ReviewEaseOK, models.DeckConfig{})
+		assert.NoError(t, err)
+		return next
+	}
+	var intervals []int64
+	for ease := models.ReviewEaseHard; ease <= models.ReviewEaseEasy; ease++ {
+		next, err := svc.NextInterval(*card, ease, models.DeckConfig{})
+		assert.NoError(t, err)
+		intervals = append(intervals, next)
+	}
+	assert.IsIncreasing(t, intervals)
+
+	// a higher desired retention shows the card sooner
+	deckRepo := repos.NewDeckRepository(db)
+	confs, err := deckRepo.Confs()
+	assert.NoError(t, err)
+	confs[1].DesiredRetention = 0.97
+	assert.NoError(t, deckRepo.SaveConfs(confs))
+	assert.Less(t, goodInterval(), intervals[1])
+
+	// the memory state is kept in the card
+	good := goodInterval()
+	assert.NoError(t, svc.AnswerCard(card, models.ReviewEaseOK))
+	var saved models.Card
+	assert.NoError(t, db.Get(&saved, "SELECT ivl, data FROM cards WHERE id = ?", card.ID))
+	assert.Equal(t, good/86400, saved.Interval)
+	state, err := fsrs.ReadMemoryState(saved.Data)
+	assert.NoError(t, err)
+	assert.NotNil(t, state)
+	assert.Contains(t, saved.Data, `"dr":0.97`)
+}
+
+func TestRestoreCard(t *testing.T) {
+	db := setupDB(t)
+	svc := newTestSched(t, db, sentencesDeckID)
+	card, err := svc.GetCard()
+	assert.NoError(t, err)
+	counts := svc.Counts()
+	row := func() (row []interface{}) {
+		res := db.QueryRowx("SELECT * FROM cards WHERE id = ?", card.ID)
+		row, err := res.SliceScan()
+		assert.NoError(t, err)
+		return row
+	}
+	before := row()
+	reviews := func() (count int) {
+		assert.NoError(t, db.Get(&count, "SELECT COUNT() FROM revlog WHERE cid = ?", card.ID))
+		return
+	}
+	reviewed := reviews()
+	deckRepo := repos.NewDeckRepository(db)
+	decks, err := deckRepo.Decks()
+	assert.NoError(t, err)
+	deck := *decks[sentencesDeckID]
+
+	undoRepo := repos.NewUndoRepository(db)
+	statements, err := undoRepo.Record(func() error {
+		return svc.AnswerCard(card, models.ReviewEaseOK)
+	})
+	assert.NoError(t, err)
+	assert.NotEqual(t, before, row())
+	assert.Equal(t, reviewed+1, reviews())
+	assert.NoError(t, undoRepo.Exec(statements))
+
+	// the card, its review and the counters of today are restored
+	assert.Equal(t, before, row())
+	assert.Equal(t, reviewed, reviews())
+	decks, err = deckRepo.Decks()
+	assert.NoError(t, err)
+	assert.Equal(t, deck.ReviewsToday, decks[sentencesDeckID].ReviewsToday)
+	assert.Equal(t, deck.TimeToday, decks[sentencesDeckID].TimeToday)
+
+	// the card is shown again before the other cards
+	restored, err := svc.RestoreCard(card.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, card.ID, restored.ID)
+	assert.Equal(t, counts, svc.Counts())
+	next, err := svc.GetCard()
+	assert.NoError(t, err)
+	assert.NotEqual(t, card.ID, next.ID)
+}
+
+func TestBuryAndSuspend(t *testing.T) {
+	db := setupDB(t)
+	svc := newTestSched(t, db, sentencesDeckID)
+	card, err := svc.GetCard()
+	assert.NoError(t, err)
+	queue := func(id models.ID) (queue models.CardQue) {
+		assert.NoError(t, db.Get(&queue, "SELECT queue FROM cards WHERE id = ?", id))
+		return
+	}
+	original := queue(card.ID)
+	total := svc.Counts()
+
+	assert.NoError(t, svc.SuspendCards([]models.ID{card.ID}))
+	assert.Equal(t, models.CardQueueSuspended, queue(card.ID))
+	// a suspended card stays suspended when buried
+	assert.NoError(t, svc.BuryCards([]models.ID{card.ID}))
+	assert.Equal(t, models.CardQueueSuspended, queue(card.ID))
+	assert.NoError(t, svc.UnsuspendCards([]models.ID{card.ID}))
+	assert.Equal(t, original, queue(card.ID))
+
+	assert.NoError(t, svc.BuryNotes([]models.ID{card.NoteID}))
+	assert.Equal(t, models.CardQueueBuried, queue(card.ID))
+	assert.NoError(t, svc.Reset())
+	counts := svc.Counts()
+	assert.Less(t, counts.New+counts.Learning+counts.Review, total.New+total.Learning+total.Review)
+}
+
+func TestSetDueDate(t *testing.T) {
+	db := setupDB(t)
+	svc := newTestSched(t, db, sentencesDeckID)
+	today, _, err := sched.Today(svc.colRepo, false)
+	assert.NoError(t, err)
+	var id models.ID
+	assert.NoError(t, db.Get(&id, "SELECT id FROM cards WHERE did = ? AND type = 0 LIMIT 1", sentencesDeckID))
+
+	assert.Error(t, svc.SetDueDate([]models.ID{id}, "tomorrow"))
+	assert.NoError(t, svc.SetDueDate([]models.ID{id}, "3-7"))
+	var card models.Card
+	assert.NoError(t, db.Get(&card, "SELECT type, queue, due, ivl, factor FROM cards WHERE id = ?", id))
+	assert.Equal(t, models.CardTypeReview, card.Type)
+	assert.Equal(t, models.CardQueueReview, card.Queue)
+	assert.GreaterOrEqual(t, int64(card.Due), today+3)
+	assert.LessOrEqual(t, int64(card.Due), today+7)
+	// the interval of a new card is the number of days until it is due
+	assert.Equal(t, int64(card.Due)-today, card.Interval)
+	assert.Equal(t, int64(2500), card.Factor)
+	var logged int
+	assert.NoError(t, db.Get(&logged, "SELECT COUNT() FROM revlog WHERE cid = ? AND type = ?", id, models.ReviewLogTypeManual))
+	assert.Equal(t, 1, logged)
+
+	// the interval of a review is kept unless it is reset
+	assert.NoError(t, svc.SetDueDate([]models.ID{id}, "0"))
+	assert.NoError(t, db.Get(&card, "SELECT due, ivl FROM cards WHERE id = ?", id))
+	assert.Equal(t, today, int64(card.Due))
+	assert.GreaterOrEqual(t, card.Interval, int64(3))
+	assert.NoError(t, svc.SetDueDate([]models.ID{id}, "1!"))
+	assert.NoError(t, db.Get(&card, "SELECT due, ivl FROM cards WHERE id = ?", id))
+	assert.Equal(t, today+1, int64(card.Due))
+	assert.Equal(t, int64(1), card.Interval)
+}
+
+func TestTimeTaken(t *testing.T) {
+	card := models.Card{TimeStarted: models.UnixTime(time.Now().Add(-90 * time.Second).UnixMilli())}
+	assert.InDelta(t, 90000, sched.TimeTaken(card, models.DeckConfig{}), 1000)
+	// the time is capped at the max time of the deck config
+	assert.Equal(t, int64(60000), sched.TimeTaken(card, models.DeckConfig{MaxTaken: 60}))
+}
@@ -0,0 +1,29 @@
+package services
+
+import (
+	"testing"
+
+	repos "github.com/aerex/go-anki/api/sql/sqlite/repositories"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTodayStats(t *testing.T) {
+	db := setupSyncDB(t)
+	revLogRepo := repos.NewRevLogRepository(db)
+	svc := NewStatsService(revLogRepo, repos.NewColRepository(db))
+	stats, err := svc.TodayStats()
+	assert.NoError(t, err)
+	assert.Equal(t, models.StudiedToday{}, stats)
+
+	card := models.Card{ID: 1, Factor: 2500}
+	assert.NoError(t, revLogRepo.Create(card, -1, models.ReviewEaseWrong, -600, 0, 12000, models.ReviewLogTypeLearning))
+	assert.NoError(t, revLogRepo.Create(card, -1, models.ReviewEaseOK, 1, -600, 8000, models.ReviewLogTypeLearning))
+	assert.NoError(t, revLogRepo.Create(card, -1, models.ReviewEaseOK, 3, 1, 4000, models.ReviewLogTypeReview))
+	// a card rescheduled by hand is not studied
+	assert.NoError(t, revLogRepo.Create(card, -1, 0, 5, 3, 0, models.ReviewLogTypeManual))
+
+	stats, err = svc.TodayStats()
+	assert.NoError(t, err)
+	assert.Equal(t, models.StudiedToday{Cards: 3, Time: 24, Failed: 1, Learning: 2, Review: 1}, stats)
+}
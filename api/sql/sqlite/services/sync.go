@@ -0,0 +1,482 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	repos "github.com/aerex/go-anki/api/sql/sqlite/repositories"
+	ankisync "github.com/aerex/go-anki/api/sync"
+	"github.com/aerex/go-anki/pkg/models"
+)
+
+// The maximum number of rows sent to the server in one chunk
+const SyncChunkSize = 250
+
+type SyncService struct {
+	colRepo   repos.ColRepo
+	deckRepo  repos.DeckRepo
+	graveRepo repos.GraveRepo
+	syncRepo  repos.SyncRepo
+}
+
+func NewSyncService(c repos.ColRepo, d repos.DeckRepo, g repos.GraveRepo, s repos.SyncRepo) SyncService {
+	return SyncService{
+		colRepo:   c,
+		deckRepo:  d,
+		graveRepo: g,
+		syncRepo:  s,
+	}
+}
+
+// Sync exchanges the changes made since the last sync with the server.
+// A SyncFullSync status is returned when the schema was modified on either side
+// and the collection must be uploaded or downloaded in full.
+// The changes sent are marked with the usn of the server so Sync must run in a batch
+// that is rolled back when it fails
+func (s *SyncService) Sync(server ankisync.Server) (status models.SyncStatus, err error) {
+	if err = server.Login(); err != nil {
+		return
+	}
+	meta, err := server.Meta()
+	if err != nil {
+		return
+	}
+	if !meta.Cont {
+		return models.SyncAborted, fmt.Errorf("sync server refused to sync: %s", meta.Msg)
+	}
+	col, err := s.colRepo.Meta()
+	if err != nil {
+		return
+	}
+	if col.Mod == meta.Mod {
+		return models.SyncNoChanges, nil
+	}
+	// the schema was modified on the server or locally since the last sync
+	if col.Scm != meta.Scm || col.Scm > col.LastSync {
+		return models.SyncFullSync, nil
+	}
+	lnewer := col.Mod > meta.Mod
+	minUsn := col.USN
+	maxUsn := meta.USN
+
+	status, err = s.sync(server, minUsn, maxUsn, lnewer)
+	if err != nil {
+		// let the server discard the changes it received so far
+		server.Abort()
+	}
+	return
+}
+
+func (s *SyncService) sync(server ankisync.Server, minUsn int, maxUsn int, lnewer bool) (models.SyncStatus, error) {
+	// deletions
+	graves, err := s.graveRepo.Pending()
+	if err != nil {
+		return "", err
+	}
+	remoteGraves, err := server.Start(minUsn, lnewer, graves)
+	if err != nil {
+		return "", err
+	}
+	if err := s.applyGraves(remoteGraves); err != nil {
+		return "", err
+	}
+	if err := s.graveRepo.Mark(maxUsn); err != nil {
+		return "", err
+	}
+
+	// models, decks, tags and collection config
+	changes, err := s.changes(maxUsn, lnewer)
+	if err != nil {
+		return "", err
+	}
+	remoteChanges, err := server.ApplyChanges(changes)
+	if err != nil {
+		return "", err
+	}
+	if err := s.mergeChanges(remoteChanges, maxUsn, lnewer); err != nil {
+		return "", err
+	}
+
+	// revlog, cards and notes
+	for {
+		chunk, err := server.Chunk()
+		if err != nil {
+			return "", err
+		}
+		if err := s.applyChunk(chunk); err != nil {
+			return "", err
+		}
+		if chunk.Done {
+			break
+		}
+	}
+	for {
+		chunk, err := s.chunk(maxUsn)
+		if err != nil {
+			return "", err
+		}
+		if err := server.ApplyChunk(chunk); err != nil {
+			return "", err
+		}
+		if chunk.Done {
+			break
+		}
+	}
+
+	counts, err := s.sanityCounts()
+	if err != nil {
+		return "", err
+	}
+	res, err := server.SanityCheck(counts)
+	if err != nil {
+		return "", err
+	}
+	if res.Status != "ok" {
+		return models.SyncSanityCheckFailed, fmt.Errorf("sanity check failed: client %v server %v", res.Client, res.Server)
+	}
+
+	mod, err := server.Finish()
+	if err != nil {
+		return "", err
+	}
+	if err := s.colRepo.FinishSync(mod, maxUsn+1); err != nil {
+		return "", err
+	}
+	return models.SyncSuccess, nil
+}
+
+// FullUpload replaces the collection on the server with the local collection file
+func (s *SyncService) FullUpload(server ankisync.Server, path string) error {
+	if err := server.Login(); err != nil {
+		return err
+	}
+	if err := s.beforeUpload(); err != nil {
+		return err
+	}
+	col, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer col.Close()
+	return server.Upload(col)
+}
+
+// FullDownload writes the collection stored on the server
+func (s *SyncService) FullDownload(server ankisync.Server, col io.Writer) error {
+	if err := server.Login(); err != nil {
+		return err
+	}
+	return server.Download(col)
+}
+
+// beforeUpload marks every change as synced since the server will receive the whole collection
+func (s *SyncService) beforeUpload() error {
+	if err := s.syncRepo.ResetUSN(); err != nil {
+		return err
+	}
+	noteTypes, err := s.colRepo.NoteTypes()
+	if err != nil {
+		return err
+	}
+	for _, nt := range noteTypes {
+		nt.USN = 0
+	}
+	if err := s.colRepo.SaveNoteTypes(noteTypes); err != nil {
+		return err
+	}
+	decks, err := s.deckRepo.Decks()
+	if err != nil {
+		return err
+	}
+	for _, deck := range decks {
+		deck.USN = 0
+	}
+	if err := s.deckRepo.SaveAll(decks); err != nil {
+		return err
+	}
+	confs, err := s.deckRepo.Confs()
+	if err != nil {
+		return err
+	}
+	for _, conf := range confs {
+		conf.USN = 0
+	}
+	if err := s.deckRepo.SaveConfs(confs); err != nil {
+		return err
+	}
+	tags, err := s.colRepo.TagCache()
+	if err != nil {
+		return err
+	}
+	for tag := range tags {
+		tags[tag] = 0
+	}
+	if err := s.colRepo.SaveTags(tags); err != nil {
+		return err
+	}
+	// the uploaded collection becomes the new schema on the server
+	if err := s.colRepo.ModSchema(); err != nil {
+		return err
+	}
+	col, err := s.colRepo.Meta()
+	if err != nil {
+		return err
+	}
+	if err := s.colRepo.SetLastSync(col.Scm); err != nil {
+		return err
+	}
+	return s.syncRepo.Vacuum()
+}
+
+func (s *SyncService) applyGraves(graves models.Graves) error {
+	if err := s.syncRepo.Remove("cards", graves.Cards); err != nil {
+		return err
+	}
+	if err := s.syncRepo.Remove("notes", graves.Notes); err != nil {
+		return err
+	}
+	if len(graves.Decks) == 0 {
+		return nil
+	}
+	decks, err := s.deckRepo.Decks()
+	if err != nil {
+		return err
+	}
+	for _, id := range graves.Decks {
+		delete(decks, id)
+	}
+	return s.deckRepo.SaveAll(decks)
+}
+
+// changes collects the note types, decks, deck configs and tags modified locally
+// and marks them with the server usn
+func (s *SyncService) changes(usn int, lnewer bool) (changes models.SyncChanges, err error) {
+	changes.Models = []*models.NoteType{}
+	changes.Tags = []string{}
+
+	noteTypes, err := s.colRepo.NoteTypes()
+	if err != nil {
+		return
+	}
+	for _, nt := range noteTypes {
+		if nt.USN == -1 {
+			nt.USN = usn
+			changes.Models = append(changes.Models, nt)
+		}
+	}
+	if len(changes.Models) > 0 {
+		if err = s.colRepo.SaveNoteTypes(noteTypes); err != nil {
+			return
+		}
+	}
+
+	decks, err := s.deckRepo.Decks()
+	if err != nil {
+		return
+	}
+	for _, deck := range decks {
+		if deck.USN == -1 {
+			deck.USN = usn
+			changes.Decks.Decks = append(changes.Decks.Decks, deck)
+		}
+	}
+	if len(changes.Decks.Decks) > 0 {
+		if err = s.deckRepo.SaveAll(decks); err != nil {
+			return
+		}
+	}
+
+	confs, err := s.deckRepo.Confs()
+	if err != nil {
+		return
+	}
+	for _, conf := range confs {
+		if conf.USN == -1 {
+			conf.USN = usn
+			changes.Decks.Confs = append(changes.Decks.Confs, conf)
+		}
+	}
+	if len(changes.Decks.Confs) > 0 {
+		if err = s.deckRepo.SaveConfs(confs); err != nil {
+			return
+		}
+	}
+
+	tags, err := s.colRepo.TagCache()
+	if err != nil {
+		return
+	}
+	for tag, tagUsn := range tags {
+		if tagUsn == -1 {
+			tags[tag] = usn
+			changes.Tags = append(changes.Tags, tag)
+		}
+	}
+	if len(changes.Tags) > 0 {
+		if err = s.colRepo.SaveTags(tags); err != nil {
+			return
+		}
+	}
+
+	// the collection config is only sent by the side modified last
+	if lnewer {
+		if changes.Conf, err = s.colRepo.RawConf(); err != nil {
+			return
+		}
+		if changes.Crt, err = s.colRepo.CreatedTime(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// mergeChanges applies the changes received from the server keeping
+// the most recently modified version of each note type, deck and deck config
+func (s *SyncService) mergeChanges(changes models.SyncChanges, usn int, lnewer bool) error {
+	if len(changes.Models) > 0 {
+		noteTypes, err := s.colRepo.NoteTypes()
+		if err != nil {
+			return err
+		}
+		for _, nt := range changes.Models {
+			if local, exists := noteTypes[nt.ID]; !exists || local.Mod < nt.Mod {
+				noteTypes[nt.ID] = nt
+			}
+		}
+		if err := s.colRepo.SaveNoteTypes(noteTypes); err != nil {
+			return err
+		}
+	}
+
+	if len(changes.Decks.Decks) > 0 {
+		decks, err := s.deckRepo.Decks()
+		if err != nil {
+			return err
+		}
+		for _, deck := range changes.Decks.Decks {
+			if local, exists := decks[deck.ID]; !exists || deckMod(local) < deckMod(deck) {
+				decks[deck.ID] = deck
+			}
+		}
+		if err := s.deckRepo.SaveAll(decks); err != nil {
+			return err
+		}
+	}
+
+	if len(changes.Decks.Confs) > 0 {
+		confs, err := s.deckRepo.Confs()
+		if err != nil {
+			return err
+		}
+		for _, conf := range changes.Decks.Confs {
+			if local, exists := confs[conf.ID]; !exists || local.Mod < conf.Mod {
+				confs[conf.ID] = conf
+			}
+		}
+		if err := s.deckRepo.SaveConfs(confs); err != nil {
+			return err
+		}
+	}
+
+	if len(changes.Tags) > 0 {
+		tags, err := s.colRepo.TagCache()
+		if err != nil {
+			return err
+		}
+		for _, tag := range changes.Tags {
+			tags[tag] = usn
+		}
+		if err := s.colRepo.SaveTags(tags); err != nil {
+			return err
+		}
+	}
+
+	if !lnewer {
+		if len(changes.Conf) > 0 {
+			if err := s.colRepo.SaveConf(changes.Conf); err != nil {
+				return err
+			}
+		}
+		if changes.Crt != 0 {
+			if err := s.colRepo.SaveCreatedTime(changes.Crt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *SyncService) applyChunk(chunk models.SyncChunk) error {
+	if err := s.syncRepo.MergeRows("revlog", chunk.Revlog); err != nil {
+		return err
+	}
+	if err := s.syncRepo.MergeRows("cards", chunk.Cards); err != nil {
+		return err
+	}
+	return s.syncRepo.MergeRows("notes", chunk.Notes)
+}
+
+// chunk collects up to SyncChunkSize rows modified locally
+func (s *SyncService) chunk(usn int) (chunk models.SyncChunk, err error) {
+	limit := SyncChunkSize
+	for _, table := range []string{"revlog", "cards", "notes"} {
+		var rows []models.SyncRow
+		rows, err = s.syncRepo.PendingRows(table, limit, usn)
+		if err != nil {
+			return
+		}
+		switch table {
+		case "revlog":
+			chunk.Revlog = rows
+		case "cards":
+			chunk.Cards = rows
+		case "notes":
+			chunk.Notes = rows
+		}
+		limit -= len(rows)
+		if limit == 0 {
+			return
+		}
+	}
+	chunk.Done = true
+	return
+}
+
+func (s *SyncService) sanityCounts() (counts models.SanityCounts, err error) {
+	if counts.Cards, err = s.syncRepo.Count("cards"); err != nil {
+		return
+	}
+	if counts.Notes, err = s.syncRepo.Count("notes"); err != nil {
+		return
+	}
+	if counts.Revlog, err = s.syncRepo.Count("revlog"); err != nil {
+		return
+	}
+	if counts.Graves, err = s.graveRepo.Count(); err != nil {
+		return
+	}
+	noteTypes, err := s.colRepo.NoteTypes()
+	if err != nil {
+		return
+	}
+	counts.Models = len(noteTypes)
+	decks, err := s.deckRepo.Decks()
+	if err != nil {
+		return
+	}
+	counts.Decks = len(decks)
+	confs, err := s.deckRepo.Confs()
+	if err != nil {
+		return
+	}
+	counts.Confs = len(confs)
+	return
+}
+
+func deckMod(deck *models.Deck) models.UnixTime {
+	if deck.Mod == nil {
+		return 0
+	}
+	return *deck.Mod
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	repos "github.com/aerex/go-anki/api/sql/sqlite/repositories"
+	ankisync "github.com/aerex/go-anki/api/sync"
+	"github.com/aerex/go-anki/api/sync/synctest"
+	"github.com/aerex/go-anki/internal/config"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+const fixtureScm = 1543553566030
+
+// copy the fixture collection so the tests can modify it
+func setupSyncDB(t *testing.T) *sqlx.DB {
+	_, fileName, _, _ := runtime.Caller(0)
+	src := filepath.Join(filepath.Dir(fileName), "fixtures/db/collection.anki2")
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatalf("could not read fixture: %v", err)
+	}
+	dst := filepath.Join(t.TempDir(), "collection.anki2")
+	if err := os.WriteFile(dst, data, 0600); err != nil {
+		t.Fatalf("could not copy fixture: %v", err)
+	}
+	db := sqlx.MustConnect("sqlite3", dst)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func newTestSyncService(db *sqlx.DB) SyncService {
+	return NewSyncService(repos.NewColRepository(db), repos.NewDeckRepository(db),
+		repos.NewGraveRepository(db), repos.NewSyncRepository(db))
+}
+
+func newTestServer(t *testing.T) (*synctest.Server, *ankisync.RemoteServer) {
+	server := synctest.NewServer()
+	t.Cleanup(server.Close)
+	remote := ankisync.NewRemoteServer(config.Sync{Endpoint: server.URL, User: "user", Pass: "pass"})
+	return server, remote
+}
+
+func TestSyncNoChanges(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestSyncService(db)
+	server, remote := newTestServer(t)
+	server.Meta = models.SyncMeta{Mod: 1543557609254, Scm: fixtureScm, USN: 200, Cont: true}
+
+	status, err := svc.Sync(remote)
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.SyncNoChanges, status)
+	assert.Equal(t, []string{"hostKey", "meta"}, server.Calls)
+}
+
+func TestSyncRequiresFullSyncWhenSchemaChanged(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestSyncService(db)
+	server, remote := newTestServer(t)
+	server.Meta = models.SyncMeta{Mod: 1, Scm: fixtureScm + 1, USN: 200, Cont: true}
+
+	status, err := svc.Sync(remote)
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.SyncFullSync, status)
+}
+
+func TestSyncRequiresFullSyncWhenSchemaChangedSinceLastSync(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestSyncService(db)
+	server, remote := newTestServer(t)
+	server.Meta = models.SyncMeta{Mod: 1, Scm: fixtureScm, USN: 200, Cont: true}
+	_, err := db.Exec("UPDATE col SET ls = ?", fixtureScm-1)
+	assert.NoError(t, err)
+
+	status, err := svc.Sync(remote)
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.SyncFullSync, status)
+}
+
+func TestSyncAbortedByServer(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestSyncService(db)
+	server, remote := newTestServer(t)
+	server.Meta = models.SyncMeta{Cont: false, Msg: "client too old"}
+
+	status, err := svc.Sync(remote)
+
+	assert.Error(t, err)
+	assert.Equal(t, models.SyncAborted, status)
+}
+
+func TestSyncExchangesChanges(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestSyncService(db)
+	server, remote := newTestServer(t)
+	server.Meta = models.SyncMeta{Mod: 1543557600000, Scm: fixtureScm, USN: 200, Cont: true}
+	server.FinishMod = 1600000000000
+	// remote deleted a card and reviewed another one
+	server.Graves = models.Graves{Cards: []models.ID{1512792283826}}
+	server.Chunks = []models.SyncChunk{{
+		Done:   true,
+		Revlog: []models.SyncRow{{1600000000001, 1512792261945, 200, 3, 10, 5, 2500, 6000, 1}},
+		Cards: []models.SyncRow{{1512792261945, 1512792229832, 1512791947391, 0, 1600000000, 200,
+			2, 2, 100, 10, 2500, 5, 0, 0, 0, 0, 0, ""}},
+	}}
+
+	// local changes: a modified card and a deleted note
+	_, err := db.Exec("UPDATE cards SET usn = -1 WHERE id = 1512792261946")
+	assert.NoError(t, err)
+	err = repos.NewGraveRepository(db).Add([]models.ID{42}, models.GraveTypeNote, -1)
+	assert.NoError(t, err)
+
+	status, err := svc.Sync(remote)
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.SyncSuccess, status)
+	assert.Equal(t, []string{"hostKey", "meta", "start", "applyChanges", "chunk", "applyChunk", "sanityCheck2", "finish"}, server.Calls)
+	assert.Equal(t, []models.ID{42}, server.ReceivedGraves.Notes)
+
+	// local changes were sent with the server usn
+	assert.Len(t, server.ReceivedChunks, 1)
+	chunk := server.ReceivedChunks[0]
+	assert.True(t, chunk.Done)
+	assert.Len(t, chunk.Cards, 1)
+	assert.EqualValues(t, 1512792261946, chunk.Cards[0][0])
+	assert.EqualValues(t, 200, chunk.Cards[0][5])
+	assert.Equal(t, 678-1, server.ReceivedCounts.Cards)
+	assert.Equal(t, 4680+1, server.ReceivedCounts.Revlog)
+
+	// remote changes were applied
+	var count int
+	assert.NoError(t, db.Get(&count, "SELECT COUNT() FROM cards WHERE id = 1512792283826"))
+	assert.Equal(t, 0, count)
+	var due int
+	assert.NoError(t, db.Get(&due, "SELECT due FROM cards WHERE id = 1512792261945"))
+	assert.Equal(t, 100, due)
+	assert.NoError(t, db.Get(&count, "SELECT COUNT() FROM revlog WHERE id = 1600000000001"))
+	assert.Equal(t, 1, count)
+	assert.NoError(t, db.Get(&count, "SELECT COUNT() FROM graves WHERE usn = -1"))
+	assert.Equal(t, 0, count)
+
+	col, err := repos.NewColRepository(db).Meta()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1600000000000), col.Mod)
+	assert.Equal(t, int64(1600000000000), col.LastSync)
+	assert.Equal(t, 201, col.USN)
+}
+
+func TestFullUpload(t *testing.T) {
+	db := setupSyncDB(t)
+	svc := newTestSyncService(db)
+	server, remote := newTestServer(t)
+	_, err := db.Exec("UPDATE cards SET usn = -1 WHERE id = 1512792261946")
+	assert.NoError(t, err)
+	err = repos.NewGraveRepository(db).Add([]models.ID{42}, models.GraveTypeNote, -1)
+	assert.NoError(t, err)
+
+	var path string
+	assert.NoError(t, db.Get(&path, "SELECT file FROM pragma_database_list WHERE name = 'main'"))
+	err = svc.FullUpload(remote, path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"hostKey", "upload"}, server.Calls)
+	uploaded, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, uploaded, server.Collection)
+
+	var count int
+	assert.NoError(t, db.Get(&count, "SELECT COUNT() FROM cards WHERE usn = -1"))
+	assert.Equal(t, 0, count)
+	assert.NoError(t, db.Get(&count, "SELECT COUNT() FROM graves"))
+	assert.Equal(t, 0, count)
+	col, err := repos.NewColRepository(db).Meta()
+	assert.NoError(t, err)
+	assert.Greater(t, col.Scm, int64(fixtureScm))
+	assert.Equal(t, col.Scm, col.LastSync)
+}
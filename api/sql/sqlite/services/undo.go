@@ -0,0 +1,156 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	repos "github.com/aerex/go-anki/api/sql/sqlite/repositories"
+	"github.com/aerex/go-anki/pkg/models"
+)
+
+// MaxUndoSteps is the number of operations kept in the undo history
+const MaxUndoSteps = 30
+
+var (
+	ErrNothingToUndo = errors.New("nothing to undo")
+	ErrNothingToRedo = errors.New("nothing to redo")
+	// the collection was modified by an operation that was not recorded (ie: a sync or a study session)
+	ErrCollectionModified = errors.New("collection was modified")
+)
+
+type UndoService struct {
+	undoRepo repos.UndoRepo
+	// the file keeping the history between commands, the history is only kept in memory without it
+	path    string
+	history *models.UndoHistory
+}
+
+func NewUndoService(u repos.UndoRepo, path string) *UndoService {
+	return &UndoService{
+		undoRepo: u,
+		path:     path,
+	}
+}
+
+// Do runs the operation in a single transaction and records it so it can be undone.
+// The operations undone are no longer available to redo.
+// It returns false when the operation changed nothing and no step was recorded
+func (u *UndoService) Do(name string, cb func() error) (recorded bool, err error) {
+	history, err := u.load()
+	if err != nil {
+		return false, err
+	}
+	statements, err := u.undoRepo.Record(cb)
+	if err != nil || len(statements) == 0 {
+		return false, err
+	}
+	step, err := u.step(name, statements)
+	if err != nil {
+		return false, err
+	}
+	history.Undo = pushStep(history.Undo, step)
+	history.Redo = nil
+	return true, u.save()
+}
+
+// Undo reverts the last operation and returns its name
+func (u *UndoService) Undo() (string, error) {
+	history, err := u.load()
+	if err != nil {
+		return "", err
+	}
+	if len(history.Undo) == 0 {
+		return "", ErrNothingToUndo
+	}
+	return u.revert(&history.Undo, &history.Redo)
+}
+
+// Redo applies again the last operation undone and returns its name
+func (u *UndoService) Redo() (string, error) {
+	history, err := u.load()
+	if err != nil {
+		return "", err
+	}
+	if len(history.Redo) == 0 {
+		return "", ErrNothingToRedo
+	}
+	return u.revert(&history.Redo, &history.Undo)
+}
+
+// revert runs the statements of the last step of from and pushes the statements reverting them to to
+func (u *UndoService) revert(from *[]models.UndoStep, to *[]models.UndoStep) (string, error) {
+	last := (*from)[0]
+	stamp, err := u.undoRepo.Stamp()
+	if err != nil {
+		return "", err
+	}
+	if stamp != last.Stamp {
+		// the history no longer matches the collection
+		u.history = &models.UndoHistory{}
+		if err := u.save(); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("%w since %s", ErrCollectionModified, last.Name)
+	}
+	statements, err := u.undoRepo.Record(func() error {
+		return u.undoRepo.Exec(last.Statements)
+	})
+	if err != nil {
+		return "", err
+	}
+	step, err := u.step(last.Name, statements)
+	if err != nil {
+		return "", err
+	}
+	*from = (*from)[1:]
+	*to = pushStep(*to, step)
+	return last.Name, u.save()
+}
+
+func (u *UndoService) step(name string, statements []string) (models.UndoStep, error) {
+	stamp, err := u.undoRepo.Stamp()
+	if err != nil {
+		return models.UndoStep{}, err
+	}
+	return models.UndoStep{Name: name, Statements: statements, Stamp: stamp}, nil
+}
+
+func pushStep(steps []models.UndoStep, step models.UndoStep) []models.UndoStep {
+	steps = append([]models.UndoStep{step}, steps...)
+	if len(steps) > MaxUndoSteps {
+		steps = steps[:MaxUndoSteps]
+	}
+	return steps
+}
+
+func (u *UndoService) load() (*models.UndoHistory, error) {
+	if u.history != nil {
+		return u.history, nil
+	}
+	history := &models.UndoHistory{}
+	if u.path != "" {
+		data, err := os.ReadFile(u.path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		// an unreadable history is replaced by the next operation
+		if err == nil && json.Unmarshal(data, history) != nil {
+			history = &models.UndoHistory{}
+		}
+	}
+	u.history = history
+	return history, nil
+}
+
+func (u *UndoService) save() error {
+	if u.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(u.history)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(u.path, data, 0644)
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	repos "github.com/aerex/go-anki/api/sql/sqlite/repositories"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+// snapshot returns the rows of the tables of the collection
+func snapshot(t *testing.T, db *sqlx.DB) string {
+	var rows []string
+	for _, table := range []string{"col", "notes", "cards", "revlog", "graves"} {
+		res, err := db.Queryx(fmt.Sprintf("SELECT * FROM %s ORDER BY rowid", table))
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		for res.Next() {
+			row, err := res.SliceScan()
+			assert.NoError(t, err)
+			rows = append(rows, fmt.Sprint(table, row))
+		}
+		res.Close()
+	}
+	return fmt.Sprint(rows)
+}
+
+func TestUndoDeleteDeck(t *testing.T) {
+	db := setupSyncDB(t)
+	decks := newTestDeckService(db)
+	notes := newTestNoteService(db)
+	path := filepath.Join(t.TempDir(), "undo.json")
+	undo := NewUndoService(repos.NewUndoRepository(db), path)
+	before := snapshot(t, db)
+
+	recorded, err := undo.Do("Delete Deck", func() error {
+		_, cardIDs, err := decks.Delete("Investment Terms", "")
+		if err != nil {
+			return err
+		}
+		_, err = notes.DeleteCards(cardIDs)
+		return err
+	})
+	assert.NoError(t, err)
+	assert.True(t, recorded)
+	assert.NotContains(t, deckNames(t, db), "Investment Terms")
+	after := snapshot(t, db)
+
+	// the history is kept between commands
+	undo = NewUndoService(repos.NewUndoRepository(db), path)
+	name, err := undo.Undo()
+	assert.NoError(t, err)
+	assert.Equal(t, "Delete Deck", name)
+	assert.Equal(t, before, snapshot(t, db))
+	_, err = undo.Undo()
+	assert.ErrorIs(t, err, ErrNothingToUndo)
+
+	name, err = undo.Redo()
+	assert.NoError(t, err)
+	assert.Equal(t, "Delete Deck", name)
+	assert.Equal(t, after, snapshot(t, db))
+	_, err = undo.Redo()
+	assert.ErrorIs(t, err, ErrNothingToRedo)
+}
+
+func TestUndoCollectionModified(t *testing.T) {
+	db := setupSyncDB(t)
+	decks := newTestDeckService(db)
+	undo := NewUndoService(repos.NewUndoRepository(db), "")
+
+	_, err := undo.Do("Move Deck", func() error {
+		_, err := decks.Move("Investment Terms", "Vocabulary")
+		return err
+	})
+	assert.NoError(t, err)
+	// a change made without recording it
+	assert.NoError(t, decks.Create(&models.Deck{Name: "Finance"}))
+
+	_, err = undo.Undo()
+	assert.ErrorIs(t, err, ErrCollectionModified)
+	assert.Contains(t, deckNames(t, db), "Vocabulary::Investment Terms")
+	// the history is cleared
+	_, err = undo.Undo()
+	assert.ErrorIs(t, err, ErrNothingToUndo)
+}
+
+func TestUndoNothingChanged(t *testing.T) {
+	db := setupSyncDB(t)
+	undo := NewUndoService(repos.NewUndoRepository(db), "")
+
+	recorded, err := undo.Do("Rename Deck", func() error {
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.False(t, recorded)
+	_, err = undo.Undo()
+	assert.ErrorIs(t, err, ErrNothingToUndo)
+}
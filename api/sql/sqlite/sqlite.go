@@ -1,21 +1,27 @@
 package sqlite
 
 import (
+	"fmt"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 
+	ankisql "github.com/aerex/go-anki/api/sql"
 	repos "github.com/aerex/go-anki/api/sql/sqlite/repositories"
 	"github.com/aerex/go-anki/pkg/models"
 	"github.com/aerex/go-anki/pkg/ui/screen"
 	"github.com/rs/zerolog"
-	sqldblogger "github.com/simukti/sqldb-logger"
 
 	"github.com/aerex/go-anki/api"
 	"github.com/aerex/go-anki/api/sql/sqlite/services"
+	"github.com/aerex/go-anki/api/sql/sqlite/services/sched"
 	schedv2 "github.com/aerex/go-anki/api/sql/sqlite/services/sched/v2"
+	schedv3 "github.com/aerex/go-anki/api/sql/sqlite/services/sched/v3"
+	ankisync "github.com/aerex/go-anki/api/sync"
 	"github.com/aerex/go-anki/internal/config"
+	"github.com/aerex/go-anki/pkg/media"
 	"github.com/jmoiron/sqlx"
-	"github.com/simukti/sqldb-logger/logadapter/zerologadapter"
 )
 
 func init() {
@@ -26,34 +32,64 @@ func init() {
 }
 
 type SqliteApi struct {
-	Config       *config.Config
-	CardService  services.CardService
-	ColService   services.ColService
-	DeckService  services.DeckService
-	SchedService schedv2.SchedService
+	Config         *config.Config
+	CardService    services.CardService
+	ColService     services.ColService
+	DeckService    services.DeckService
+	SchedService   sched.SchedService
+	SyncService    services.SyncService
+	MediaService   services.MediaService
+	PackageService services.PackageService
+	NoteService    services.NoteService
+	FSRSService    services.FSRSService
+	StatService    services.StatService
+	// records the operations made on the collection so the last one can be undone by the next command
+	UndoService *services.UndoService
+	// the connection shared by the repositories
+	db  *sqlx.DB
+	log *zerolog.Logger
+	// opened on first use since most commands do not need the media folder
+	media *media.Manager
 }
 
 func NewApi(config *config.Config, log *zerolog.Logger) api.Api {
 	api := &SqliteApi{
 		Config: config,
+		log:    log,
 	}
-	db := sqlx.MustConnect(strings.ToLower(config.DB.Driver), config.DB.File)
-
-	// enable sql logging
-	if config.Logger.Sql {
-		db.DB = sqldblogger.OpenDriver(config.DB.File, db.Driver(), zerologadapter.New(*log))
+	db, err := openDB(config, log)
+	if err != nil {
+		panic(err)
 	}
+	api.db = db
 	cardRepo := repos.NewCardRepository(db)
 	colRepo := repos.NewColRepository(db)
 	revRepo := repos.NewRevLogRepository(db)
 	deckRepo := repos.NewDeckRepository(db)
 	noteRepo := repos.NewNoteRepository(db)
+	graveRepo := repos.NewGraveRepository(db)
+	syncRepo := repos.NewSyncRepository(db)
 	api.CardService = services.NewCardService(cardRepo, colRepo, deckRepo, noteRepo)
 	api.ColService = services.NewColService(colRepo)
-	api.DeckService = services.NewDeckService(deckRepo, colRepo)
-	// TODO: Figure out how to handle the server property
-	// @see third parameter in NewSchedService method
-	api.SchedService = schedv2.NewSchedV2Service(colRepo, cardRepo, deckRepo, revRepo, noteRepo, true)
+	api.DeckService = services.NewDeckService(deckRepo, colRepo, cardRepo, graveRepo, noteRepo)
+	api.SyncService = services.NewSyncService(colRepo, deckRepo, graveRepo, syncRepo)
+	api.MediaService = services.NewMediaService(noteRepo)
+	api.PackageService = services.NewPackageService(colRepo, deckRepo, repos.NewPackageRepository(db))
+	api.NoteService = services.NewNoteService(cardRepo, colRepo, deckRepo, graveRepo, noteRepo)
+	api.FSRSService = services.NewFSRSService(deckRepo, colRepo, revRepo)
+	api.StatService = services.NewStatsService(revRepo, colRepo)
+	api.UndoService = services.NewUndoService(repos.NewUndoRepository(db), undoFile(config.DB.File))
+	// changes made by the client are marked with a usn of -1 so they are sent on the next sync
+	switch config.General.SchedulerVersion {
+	case 3:
+		if config.General.FSRS {
+			api.SchedService = schedv3.NewSchedFSRSService(colRepo, cardRepo, deckRepo, revRepo, noteRepo, false)
+		} else {
+			api.SchedService = schedv3.NewSchedV3Service(colRepo, cardRepo, deckRepo, revRepo, noteRepo, false)
+		}
+	default:
+		api.SchedService = schedv2.NewSchedV2Service(colRepo, cardRepo, deckRepo, revRepo, noteRepo, false)
+	}
 	return api
 }
 
@@ -74,7 +110,7 @@ func (a *SqliteApi) Decks(qs string) ([]*models.Deck, error) {
 
 func (a *SqliteApi) DeckStudyStats() (stats map[models.ID]models.DeckStudyStats, err error) {
 	switch a.Config.General.SchedulerVersion {
-	case 2:
+	case 2, 3:
 		return a.SchedService.DeckStudyStats()
 	default:
 	}
@@ -88,7 +124,10 @@ func (a *SqliteApi) GetStudiedStats(filter string) (models.CollectionStats, erro
 
 // RenameDeck rename the deck provided
 func (a SqliteApi) RenameDeck(name string, newName string) error {
-	return a.DeckService.Rename(name, newName)
+	_, err := a.UndoService.Do("Rename Deck", func() error {
+		return a.DeckService.Rename(name, newName)
+	})
+	return err
 }
 
 // UpdateDeckConfig implements api.Api
@@ -113,11 +152,14 @@ func (a SqliteApi) NoteType(name string) (noteType models.NoteType, err error) {
 }
 
 func (a SqliteApi) CreateCard(note models.Note, noteType models.NoteType, deckName string) (createdCard models.Card, err error) {
-	for _, tmpl := range noteType.Templates {
-		if err = a.CardService.Create(createdCard, note, noteType, *tmpl, deckName); err != nil {
-			return
+	_, err = a.UndoService.Do("Add Card", func() error {
+		cards, err := a.CardService.Create(note, noteType, deckName)
+		if err != nil {
+			return err
 		}
-	}
+		createdCard = cards[0]
+		return nil
+	})
 	return
 }
 
@@ -129,14 +171,79 @@ func (a SqliteApi) Cards(qs string, limit int) (cards []models.Card, err error)
 	return
 }
 
-func (a SqliteApi) StudyReview(log *zerolog.Logger, deckName string, cardQAs []*models.CardQA, stats models.DeckStudyStats) error {
-	return screen.StudyReview(log, deckName, cardQAs, stats, a.SchedService, a.DeckService, a.ColService)
+// StudyReview selects the deck and studies the cards of the scheduler queues
+func (a *SqliteApi) StudyReview(log *zerolog.Logger, deckName string, render func(models.Card) (models.CardQA, error),
+	edit models.EditNoteFunc, media models.StudyMedia) error {
+	var deck models.Deck
+	err := ankisql.Batch(a.db, func() (err error) {
+		if deck, err = a.DeckService.Select(deckName); err != nil {
+			return err
+		}
+		return a.SchedService.Reset()
+	})
+	if err != nil {
+		return err
+	}
+	// the answers can only be undone during the session
+	undo := services.NewUndoService(repos.NewUndoRepository(a.db), "")
+	return screen.StudyReview(log, deck.Name, render, edit, media, a.SchedService, a.ColService, a.CardService, a.NoteService, a.StatService,
+		undo)
 }
 
-func (a SqliteApi) CreateDeck(name string) (err error) {
-	if err = a.DeckService.Create(&models.Deck{Name: name}); err != nil {
-		return
+// CustomStudy extends the limits of a deck with the scheduler or creates a custom study session
+func (a *SqliteApi) CustomStudy(deckName string, study models.CustomStudy) (count int, err error) {
+	_, err = a.UndoService.Do("Custom Study", func() error {
+		switch study.Type {
+		case models.CustomStudyExtendNew:
+			return a.extendLimits(deckName, study.Value, 0)
+		case models.CustomStudyExtendReview:
+			return a.extendLimits(deckName, 0, study.Value)
+		}
+		count, err = a.DeckService.CustomStudy(deckName, study)
+		return err
+	})
+	return
+}
+
+// OptimizeFSRS fits the parameters of FSRS to the reviews of a deck or of the collection
+func (a *SqliteApi) OptimizeFSRS(deckName string) (optimization models.FSRSOptimization, err error) {
+	_, err = a.UndoService.Do("Optimize FSRS", func() error {
+		optimization, err = a.FSRSService.Optimize(deckName)
+		return err
+	})
+	return
+}
+
+// Undo reverts the last operation made on the collection outside of a study session and returns its name
+func (a *SqliteApi) Undo() (string, error) {
+	return a.UndoService.Undo()
+}
+
+// Redo applies again the last operation undone and returns its name
+func (a *SqliteApi) Redo() (string, error) {
+	return a.UndoService.Redo()
+}
+
+// undoFile returns the file keeping the operations that can be undone next to the collection
+func undoFile(collection string) string {
+	return strings.TrimSuffix(collection, filepath.Ext(collection)) + ".undo.json"
+}
+
+func (a *SqliteApi) extendLimits(deckName string, newCards int, revCards int) error {
+	deck, err := a.DeckService.Find(deckName)
+	if err != nil {
+		return err
+	}
+	if bool(deck.Dyn) {
+		return fmt.Errorf("custom study is not available for filtered deck %s", deck.Name)
 	}
+	return a.SchedService.ExtendLimits(deck.ID, newCards, revCards)
+}
+
+func (a SqliteApi) CreateDeck(name string) (err error) {
+	_, err = a.UndoService.Do("Create Deck", func() error {
+		return a.DeckService.Create(&models.Deck{Name: name})
+	})
 	return
 }
 
@@ -147,3 +254,236 @@ func (a *SqliteApi) NoteTypes() (types models.NoteTypes, err error) {
 func (a *SqliteApi) Tags() ([]string, error) {
 	return a.ColService.Tags()
 }
+
+// Sync exchanges the changes made to the collection with the configured sync server.
+// The local changes are made in a single transaction committed once the server finished the sync
+// so the changes marked as sent are sent again when the sync fails
+func (a *SqliteApi) Sync() (status models.SyncStatus, err error) {
+	server, err := a.syncServer()
+	if err != nil {
+		return "", err
+	}
+	err = ankisql.Batch(a.db, func() error {
+		status, err = a.SyncService.Sync(server)
+		return err
+	})
+	return
+}
+
+func (a *SqliteApi) FullUpload() error {
+	server, err := a.syncServer()
+	if err != nil {
+		return err
+	}
+	return a.SyncService.FullUpload(server, a.Config.DB.File)
+}
+
+// FullDownload downloads the collection next to the local collection
+// and swaps the files once the download is verified
+func (a *SqliteApi) FullDownload() error {
+	server, err := a.syncServer()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(a.Config.DB.File), ".collection-*.anki2")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := a.SyncService.FullDownload(server, tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return a.replaceCollection(tmp.Name())
+}
+
+func (a *SqliteApi) syncServer() (*ankisync.RemoteServer, error) {
+	if a.Config.Sync.Endpoint == "" {
+		return nil, fmt.Errorf("sync endpoint is not set in config")
+	}
+	return ankisync.NewRemoteServer(a.Config.Sync), nil
+}
+
+func (a *SqliteApi) mediaManager() (*media.Manager, error) {
+	if a.media != nil {
+		return a.media, nil
+	}
+	manager, err := media.NewManager(a.Config.DB.File)
+	if err != nil {
+		return nil, err
+	}
+	a.media = manager
+	return manager, nil
+}
+
+func (a *SqliteApi) MediaFiles() ([]models.MediaFile, error) {
+	manager, err := a.mediaManager()
+	if err != nil {
+		return nil, err
+	}
+	return manager.Files()
+}
+
+func (a *SqliteApi) CheckMedia() (models.MediaCheck, error) {
+	manager, err := a.mediaManager()
+	if err != nil {
+		return models.MediaCheck{}, err
+	}
+	return a.MediaService.Check(manager)
+}
+
+func (a *SqliteApi) AddMedia(path string) (string, error) {
+	manager, err := a.mediaManager()
+	if err != nil {
+		return "", err
+	}
+	return manager.Add(path)
+}
+
+func (a *SqliteApi) RemoveMedia(name string) error {
+	manager, err := a.mediaManager()
+	if err != nil {
+		return err
+	}
+	return manager.Remove(name)
+}
+
+// SyncMedia logs in the sync server to retrieve the host key used by the media server
+func (a *SqliteApi) SyncMedia() (models.SyncStatus, error) {
+	server, err := a.syncServer()
+	if err != nil {
+		return "", err
+	}
+	if err := server.Login(); err != nil {
+		return "", err
+	}
+	manager, err := a.mediaManager()
+	if err != nil {
+		return "", err
+	}
+	return manager.Sync(ankisync.NewRemoteMediaServer(a.Config.Sync, server.HostKey))
+}
+
+// ImportPackage adds the content of the deck package in a single transaction that can be undone
+func (a *SqliteApi) ImportPackage(path string) (res models.ImportResult, err error) {
+	manager, err := a.mediaManager()
+	if err != nil {
+		return
+	}
+	return a.PackageService.Import(path, manager, func(cb func() error) error {
+		_, err := a.UndoService.Do("Import", cb)
+		return err
+	})
+}
+
+func (a *SqliteApi) ExportPackage(deckName string, path string, opts models.ExportOptions) (models.ExportResult, error) {
+	manager, err := a.mediaManager()
+	if err != nil {
+		return models.ExportResult{}, err
+	}
+	return a.PackageService.Export(deckName, path, opts, manager)
+}
+
+// CreateNotes adds the notes in a single transaction so no note is added when one of them is invalid
+func (a *SqliteApi) CreateNotes(notes []models.CreateNote) (ids []models.ID, err error) {
+	_, err = a.UndoService.Do("Add Notes", func() error {
+		ids, err = a.NoteService.Create(notes)
+		return err
+	})
+	return
+}
+
+// UpdateNote saves the note and its new cards in a single transaction
+func (a *SqliteApi) UpdateNote(id models.ID, fields map[string]string, tags []string) (res models.NoteRowResult, err error) {
+	_, err = a.UndoService.Do("Update Note", func() error {
+		res, err = a.NoteService.Update(id, fields, tags)
+		return err
+	})
+	return
+}
+
+// DeleteDeck removes a deck and its children in a single transaction.
+// The cards of the decks are deleted with the notes left without cards unless moveCardsTo is set
+func (a *SqliteApi) DeleteDeck(name string, moveCardsTo string) (res models.DeleteResult, err error) {
+	_, err = a.UndoService.Do("Delete Deck", func() error {
+		deckIDs, cardIDs, err := a.DeckService.Delete(name, moveCardsTo)
+		if err != nil {
+			return err
+		}
+		if res, err = a.NoteService.DeleteCards(cardIDs); err != nil {
+			return err
+		}
+		res.Decks = len(deckIDs)
+		return nil
+	})
+	return
+}
+
+func (a *SqliteApi) MoveDeck(name string, parent string) (newName string, err error) {
+	_, err = a.UndoService.Do("Move Deck", func() error {
+		newName, err = a.DeckService.Move(name, parent)
+		return err
+	})
+	return
+}
+
+// CreateFilteredDeck creates a filtered deck and gathers its cards in a single transaction
+func (a *SqliteApi) CreateFilteredDeck(name string, terms []models.FilterTerm, reschedule bool) (count int, err error) {
+	_, err = a.UndoService.Do("Create Filtered Deck", func() error {
+		count, err = a.DeckService.CreateFiltered(name, terms, reschedule)
+		return err
+	})
+	return
+}
+
+func (a *SqliteApi) RebuildFilteredDeck(name string) (count int, err error) {
+	_, err = a.UndoService.Do("Rebuild Filtered Deck", func() error {
+		count, err = a.DeckService.Rebuild(name)
+		return err
+	})
+	return
+}
+
+func (a *SqliteApi) EmptyFilteredDeck(name string) error {
+	_, err := a.UndoService.Do("Empty Filtered Deck", func() error {
+		return a.DeckService.Empty(name)
+	})
+	return err
+}
+
+// DeleteCards removes the cards and the notes left without cards in a single transaction
+func (a *SqliteApi) DeleteCards(ids []models.ID) (res models.DeleteResult, err error) {
+	_, err = a.UndoService.Do("Delete Cards", func() error {
+		res, err = a.NoteService.DeleteCards(ids)
+		return err
+	})
+	return
+}
+
+// DeleteNotes removes the notes and all their cards in a single transaction
+func (a *SqliteApi) DeleteNotes(ids []models.ID) (res models.DeleteResult, err error) {
+	_, err = a.UndoService.Do("Delete Notes", func() error {
+		res, err = a.NoteService.Delete(ids)
+		return err
+	})
+	return
+}
+
+func (a *SqliteApi) ImportNotes(rows []models.NoteRow, duplicates models.DuplicateMode) (results []models.NoteRowResult, err error) {
+	_, err = a.UndoService.Do("Import Notes", func() error {
+		results, err = a.NoteService.Import(rows, duplicates)
+		return err
+	})
+	return
+}
+
+func (a *SqliteApi) SyncNotes(rows []models.NoteRow, removed []string) (results []models.NoteRowResult, err error) {
+	_, err = a.UndoService.Do("Sync Notes", func() error {
+		results, err = a.NoteService.Sync(rows, removed)
+		return err
+	})
+	return
+}
@@ -3,6 +3,7 @@ package sql
 import (
 	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/jmoiron/sqlx"
 
@@ -14,6 +15,12 @@ type TxOpts struct {
 	DryRun bool
 }
 
+var (
+	batchMu sync.Mutex
+	// the transactions opened by Batch for each database
+	batches = make(map[*sqlx.DB]*sqlx.Tx)
+)
+
 func InClauseFromIDs(IDs []models.ID) string {
 	var ids []string
 	for _, id := range IDs {
@@ -25,8 +32,13 @@ func InClauseFromIDs(IDs []models.ID) string {
 }
 
 func Tx(opts TxOpts, cb func(tx *sqlx.Tx) error) error {
+	// the changes are committed or rolled back with the rest of the batch
+	if tx := batch(opts.DB); tx != nil {
+		return cb(tx)
+	}
 	tx := opts.DB.MustBegin()
 	if err := cb(tx); err != nil {
+		tx.Rollback()
 		return err
 	}
 
@@ -37,3 +49,48 @@ func Tx(opts TxOpts, cb func(tx *sqlx.Tx) error) error {
 	}
 	return nil
 }
+
+// Batch runs cb in a single transaction. The changes made with Tx on the same database
+// are only committed when cb succeeds.
+// The reads must be made with Reader: the other connections of db do not see the changes
+// and can not read the database once the batch holds its lock
+func Batch(db *sqlx.DB, cb func() error) error {
+	batchMu.Lock()
+	if _, exists := batches[db]; exists {
+		batchMu.Unlock()
+		return cb()
+	}
+	tx, err := db.Beginx()
+	if err != nil {
+		batchMu.Unlock()
+		return err
+	}
+	batches[db] = tx
+	batchMu.Unlock()
+
+	defer func() {
+		batchMu.Lock()
+		delete(batches, db)
+		batchMu.Unlock()
+	}()
+	if err := cb(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Reader returns the transaction of the batch opened on db so the queries see the changes of the batch.
+// Without a batch the queries are made with db
+func Reader(db *sqlx.DB) sqlx.Queryer {
+	if tx := batch(db); tx != nil {
+		return tx
+	}
+	return db
+}
+
+func batch(db *sqlx.DB) *sqlx.Tx {
+	batchMu.Lock()
+	defer batchMu.Unlock()
+	return batches[db]
+}
@@ -0,0 +1,142 @@
+package sync
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aerex/go-anki/internal/config"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/go-resty/resty/v2"
+)
+
+// MediaServer is the remote side of the media sync protocol
+// See https://github.com/ankitects/anki/blob/2.1.15/anki/sync.py for the reference implementation
+type MediaServer interface {
+	// Begin starts a media sync and returns the media update sequence number of the server
+	Begin() (usn int, err error)
+	// MediaChanges returns the files changed on the server after lastUsn
+	MediaChanges(lastUsn int) ([]models.MediaChange, error)
+	// DownloadFiles returns a zip with some or all of the files requested
+	DownloadFiles(fnames []string) ([]byte, error)
+	// UploadChanges sends a zip of the files added or removed locally and returns the number
+	// of changes processed and the new media update sequence number of the server
+	UploadChanges(zip []byte) (processed int, lastUsn int, err error)
+	// MediaSanity compares the number of media files on both sides
+	MediaSanity(count int) (string, error)
+}
+
+// RemoteMediaServer talks to the media sync endpoints (msync) of an anki sync server over http
+type RemoteMediaServer struct {
+	Client     *resty.Client
+	HostKey    string
+	SessionKey string
+}
+
+// NewRemoteMediaServer creates a media server client authenticated with the host key
+// retrieved when logging in the sync server
+func NewRemoteMediaServer(config config.Sync, hostKey string) *RemoteMediaServer {
+	endpoint := config.MediaEndpoint
+	if endpoint == "" {
+		endpoint = config.Endpoint
+	}
+	client := resty.New()
+	client.SetBaseURL(strings.TrimSuffix(endpoint, "/"))
+	client.SetTimeout(5 * time.Minute)
+	return &RemoteMediaServer{
+		Client:  client,
+		HostKey: hostKey,
+	}
+}
+
+func (s *RemoteMediaServer) Begin() (usn int, err error) {
+	var res struct {
+		SessionKey string `json:"sk"`
+		USN        int    `json:"usn"`
+	}
+	data, err := Compress(map[string]interface{}{})
+	if err != nil {
+		return
+	}
+	fields := map[string]string{"c": "1", "k": s.HostKey, "v": "go-anki"}
+	if err = s.request("begin", fields, data, &res); err != nil {
+		return
+	}
+	s.SessionKey = res.SessionKey
+	return res.USN, nil
+}
+
+func (s *RemoteMediaServer) MediaChanges(lastUsn int) (changes []models.MediaChange, err error) {
+	err = s.requestJSON("mediaChanges", map[string]interface{}{"lastUsn": lastUsn}, &changes)
+	return
+}
+
+func (s *RemoteMediaServer) DownloadFiles(fnames []string) ([]byte, error) {
+	data, err := Compress(map[string]interface{}{"files": fnames})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := post(s.Client, "/msync/downloadFiles", s.sessionFields(true), data)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body(), nil
+}
+
+func (s *RemoteMediaServer) UploadChanges(zip []byte) (processed int, lastUsn int, err error) {
+	var res []int
+	// the zip is already compressed
+	if err = s.request("uploadChanges", s.sessionFields(false), zip, &res); err != nil {
+		return
+	}
+	if len(res) != 2 {
+		return 0, 0, fmt.Errorf("unexpected upload media response %v", res)
+	}
+	return res[0], res[1], nil
+}
+
+func (s *RemoteMediaServer) MediaSanity(count int) (res string, err error) {
+	err = s.requestJSON("mediaSanity", map[string]interface{}{"local": count}, &res)
+	return
+}
+
+func (s *RemoteMediaServer) sessionFields(compressed bool) map[string]string {
+	c := "0"
+	if compressed {
+		c = "1"
+	}
+	return map[string]string{"c": c, "sk": s.SessionKey}
+}
+
+func (s *RemoteMediaServer) requestJSON(method string, payload interface{}, result interface{}) error {
+	data, err := Compress(payload)
+	if err != nil {
+		return err
+	}
+	return s.request(method, s.sessionFields(true), data, result)
+}
+
+// request decodes the `data` entry of the json response into result.
+// Media sync responses are wrapped as `{"data": ..., "err": ""}`
+func (s *RemoteMediaServer) request(method string, fields map[string]string, data []byte, result interface{}) error {
+	resp, err := post(s.Client, "/msync/"+method, fields, data)
+	if err != nil {
+		return err
+	}
+	var res struct {
+		Data json.RawMessage `json:"data"`
+		Err  string          `json:"err"`
+	}
+	if err := json.NewDecoder(bytes.NewReader(resp.Body())).Decode(&res); err != nil {
+		return fmt.Errorf("could not decode %s response: %w", method, err)
+	}
+	if res.Err != "" {
+		return fmt.Errorf("media sync %s failed: %s", method, res.Err)
+	}
+	if err := json.Unmarshal(res.Data, result); err != nil {
+		return fmt.Errorf("could not decode %s response: %w", method, err)
+	}
+	return nil
+}
@@ -0,0 +1,315 @@
+package sync
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"mime/multipart"
+	"strings"
+	"time"
+
+	"github.com/aerex/go-anki/internal/config"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/go-resty/resty/v2"
+)
+
+// Server is the remote side of the sync protocol
+// See https://github.com/ankitects/anki/blob/2.1.28/pylib/anki/sync.py for the reference implementation
+type Server interface {
+	Login() error
+	Meta() (models.SyncMeta, error)
+	Start(minUsn int, lnewer bool, graves models.Graves) (models.Graves, error)
+	ApplyGraves(graves models.Graves) error
+	ApplyChanges(changes models.SyncChanges) (models.SyncChanges, error)
+	Chunk() (models.SyncChunk, error)
+	ApplyChunk(chunk models.SyncChunk) error
+	SanityCheck(counts models.SanityCounts) (models.SanityCheckResult, error)
+	Finish() (mod int64, err error)
+	Abort() error
+	// Upload replaces the collection on the server with the local collection file
+	Upload(col io.Reader) error
+	// Download writes the collection file stored on the server
+	Download(col io.Writer) error
+}
+
+// The body of the download response when the collection can not be downloaded by this version
+const upgradeRequired = "upgradeRequired"
+
+// RemoteServer talks to an anki sync server over http
+type RemoteServer struct {
+	Client     *resty.Client
+	Config     config.Sync
+	HostKey    string
+	SessionKey string
+}
+
+func NewRemoteServer(config config.Sync) *RemoteServer {
+	client := resty.New()
+	client.SetBaseURL(strings.TrimSuffix(config.Endpoint, "/"))
+	client.SetTimeout(5 * time.Minute)
+	return &RemoteServer{
+		Client:     client,
+		Config:     config,
+		HostKey:    config.HostKey,
+		SessionKey: newSessionKey(),
+	}
+}
+
+// The session key identifies the sync across multiple requests
+func newSessionKey() string {
+	sum := sha1.Sum([]byte(fmt.Sprint(rand.Float64())))
+	return hex.EncodeToString(sum[:])[:8]
+}
+
+// Login retrieves the host key used to authenticate the other requests.
+// The request is skipped if a host key was already set in the config
+func (s *RemoteServer) Login() error {
+	if s.HostKey != "" {
+		return nil
+	}
+	if s.Config.User == "" {
+		return fmt.Errorf("sync user is not set in config")
+	}
+	var res struct {
+		Key string `json:"key"`
+	}
+	payload := map[string]string{"u": s.Config.User, "p": s.Config.Pass}
+	if err := s.request("hostKey", payload, &res); err != nil {
+		return err
+	}
+	if res.Key == "" {
+		return fmt.Errorf("invalid sync user or password")
+	}
+	s.HostKey = res.Key
+	return nil
+}
+
+func (s *RemoteServer) Meta() (meta models.SyncMeta, err error) {
+	payload := map[string]interface{}{"v": models.SyncVersion, "cv": "go-anki"}
+	err = s.request("meta", payload, &meta)
+	return
+}
+
+func (s *RemoteServer) Start(minUsn int, lnewer bool, graves models.Graves) (remoteGraves models.Graves, err error) {
+	payload := map[string]interface{}{"minUsn": minUsn, "lnewer": lnewer, "graves": graves}
+	err = s.request("start", payload, &remoteGraves)
+	return
+}
+
+func (s *RemoteServer) ApplyGraves(graves models.Graves) error {
+	return s.request("applyGraves", map[string]interface{}{"chunk": graves}, nil)
+}
+
+func (s *RemoteServer) ApplyChanges(changes models.SyncChanges) (remoteChanges models.SyncChanges, err error) {
+	err = s.request("applyChanges", map[string]interface{}{"changes": changes}, &remoteChanges)
+	return
+}
+
+func (s *RemoteServer) Chunk() (chunk models.SyncChunk, err error) {
+	if err = s.request("chunk", map[string]interface{}{}, &chunk); err != nil {
+		return
+	}
+	NormalizeChunk(&chunk)
+	return
+}
+
+func (s *RemoteServer) ApplyChunk(chunk models.SyncChunk) error {
+	return s.request("applyChunk", map[string]interface{}{"chunk": chunk}, nil)
+}
+
+func (s *RemoteServer) SanityCheck(counts models.SanityCounts) (res models.SanityCheckResult, err error) {
+	err = s.request("sanityCheck2", map[string]interface{}{"client": counts}, &res)
+	return
+}
+
+func (s *RemoteServer) Finish() (mod int64, err error) {
+	err = s.request("finish", map[string]interface{}{}, &mod)
+	return
+}
+
+func (s *RemoteServer) Abort() error {
+	return s.request("abort", map[string]interface{}{}, nil)
+}
+
+// Upload streams the collection gzipped while it is sent so the collection is not held in memory
+func (s *RemoteServer) Upload(col io.Reader) error {
+	compressed, pw := io.Pipe()
+	// stops the compression when the request fails before reading the whole collection
+	defer compressed.Close()
+	go func() {
+		gz := gzip.NewWriter(pw)
+		if _, err := io.Copy(gz, col); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(gz.Close())
+	}()
+	resp, err := send(s.Client.R(), "/sync/upload", s.fields(), compressed)
+	if err != nil {
+		return err
+	}
+	if resp.String() != "OK" {
+		return fmt.Errorf("sync server did not accept the collection: %s", resp.String())
+	}
+	return nil
+}
+
+// Download copies the collection to col while it is received
+func (s *RemoteServer) Download(col io.Writer) error {
+	data, err := Compress(map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	resp, err := send(s.Client.R().SetDoNotParseResponse(true), "/sync/download", s.fields(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	body := resp.RawBody()
+	defer body.Close()
+	reader := bufio.NewReader(body)
+	if head, _ := reader.Peek(len(upgradeRequired)); string(head) == upgradeRequired {
+		return fmt.Errorf("sync server requires a newer client to download the collection")
+	}
+	_, err = io.Copy(col, reader)
+	return err
+}
+
+// request sends the payload as a gzipped json file in a multipart form
+// and decodes the json response into result
+func (s *RemoteServer) request(method string, payload interface{}, result interface{}) error {
+	data, err := Compress(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := s.post(method, data)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(resp.Body()))
+	decoder.UseNumber()
+	if err := decoder.Decode(result); err != nil {
+		return fmt.Errorf("could not decode %s response: %w", method, err)
+	}
+	return nil
+}
+
+// post sends the gzipped data to the sync method
+func (s *RemoteServer) post(method string, data []byte) (*resty.Response, error) {
+	return post(s.Client, "/sync/"+method, s.fields(), data)
+}
+
+// fields are the form fields identifying the session and the user
+func (s *RemoteServer) fields() map[string]string {
+	fields := map[string]string{"c": "1", "s": s.SessionKey}
+	if s.HostKey != "" {
+		fields["k"] = s.HostKey
+	}
+	return fields
+}
+
+// post sends the data as a file in a multipart form along with the fields
+func post(client *resty.Client, url string, fields map[string]string, data []byte) (*resty.Response, error) {
+	return send(client.R(), url, fields, bytes.NewReader(data))
+}
+
+// send streams the data as a file in a multipart form along with the fields
+// so large files (ie: the collection) are not held in memory
+func send(req *resty.Request, url string, fields map[string]string, data io.Reader) (*resty.Response, error) {
+	method := url[strings.LastIndex(url, "/")+1:]
+	body, pw := io.Pipe()
+	// stops writing the form when the request fails before reading the whole body
+	defer body.Close()
+	form := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(writeForm(form, fields, data))
+	}()
+	resp, err := req.
+		SetHeader("Content-Type", form.FormDataContentType()).
+		SetBody(body).
+		Post(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == 403 {
+		closeRawBody(resp)
+		return nil, fmt.Errorf("sync server rejected the credentials")
+	}
+	if resp.IsError() {
+		return nil, fmt.Errorf("sync server returned %s for %s: %s", resp.Status(), method, responseText(resp))
+	}
+	return resp, nil
+}
+
+func writeForm(form *multipart.Writer, fields map[string]string, data io.Reader) error {
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			return err
+		}
+	}
+	file, err := form.CreateFormFile("data", "data")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, data); err != nil {
+		return err
+	}
+	return form.Close()
+}
+
+// responseText returns the body of the response even when it was not read (ie: a download)
+func responseText(resp *resty.Response) string {
+	if len(resp.Body()) > 0 || resp.RawBody() == nil {
+		return resp.String()
+	}
+	defer resp.RawBody().Close()
+	text, _ := io.ReadAll(io.LimitReader(resp.RawBody(), 1024))
+	return strings.TrimSpace(string(text))
+}
+
+func closeRawBody(resp *resty.Response) {
+	if resp.RawBody() != nil {
+		resp.RawBody().Close()
+	}
+}
+
+// Compress encodes the payload as json and gzip it
+func Compress(payload interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(gz).Encode(payload); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// NormalizeChunk converts the json numbers in the chunk rows into int64 or float64
+// so they can be inserted back into the database
+func NormalizeChunk(chunk *models.SyncChunk) {
+	for _, rows := range [][]models.SyncRow{chunk.Revlog, chunk.Cards, chunk.Notes} {
+		for _, row := range rows {
+			for idx, col := range row {
+				num, ok := col.(json.Number)
+				if !ok {
+					continue
+				}
+				if i, err := num.Int64(); err == nil {
+					row[idx] = i
+				} else if f, err := num.Float64(); err == nil {
+					row[idx] = f
+				}
+			}
+		}
+	}
+}
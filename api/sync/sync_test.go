@@ -0,0 +1,92 @@
+package sync
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/aerex/go-anki/api/sync/synctest"
+	"github.com/aerex/go-anki/internal/config"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogin(t *testing.T) {
+	server := synctest.NewServer()
+	defer server.Close()
+
+	remote := NewRemoteServer(config.Sync{Endpoint: server.URL + "/", User: "user", Pass: "pass"})
+	assert.NoError(t, remote.Login())
+	assert.Equal(t, "hkey", remote.HostKey)
+
+	remote = NewRemoteServer(config.Sync{Endpoint: server.URL, User: "user", Pass: "wrong"})
+	assert.Error(t, remote.Login())
+}
+
+func TestLoginSkippedWithHostKey(t *testing.T) {
+	server := synctest.NewServer()
+	defer server.Close()
+
+	remote := NewRemoteServer(config.Sync{Endpoint: server.URL, HostKey: "hkey"})
+	assert.NoError(t, remote.Login())
+	_, err := remote.Meta()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"meta"}, server.Calls)
+}
+
+func TestRequestsWithInvalidHostKey(t *testing.T) {
+	server := synctest.NewServer()
+	defer server.Close()
+
+	remote := NewRemoteServer(config.Sync{Endpoint: server.URL, HostKey: "invalid"})
+	_, err := remote.Meta()
+	assert.Error(t, err)
+}
+
+func TestUploadAndDownloadCollection(t *testing.T) {
+	server := synctest.NewServer()
+	defer server.Close()
+	col := bytes.Repeat([]byte("collection"), 1<<20)
+
+	remote := NewRemoteServer(config.Sync{Endpoint: server.URL, HostKey: "hkey"})
+	assert.NoError(t, remote.Upload(bytes.NewReader(col)))
+	assert.Equal(t, col, server.Collection)
+	var downloaded bytes.Buffer
+	assert.NoError(t, remote.Download(&downloaded))
+	assert.Equal(t, col, downloaded.Bytes())
+
+	server.Collection = []byte("upgradeRequired")
+	assert.EqualError(t, remote.Download(&downloaded), "sync server requires a newer client to download the collection")
+	remote = NewRemoteServer(config.Sync{Endpoint: server.URL, HostKey: "invalid"})
+	assert.EqualError(t, remote.Download(&downloaded), "sync server rejected the credentials")
+}
+
+func TestChunkNormalizesNumbers(t *testing.T) {
+	server := synctest.NewServer()
+	defer server.Close()
+	server.Chunks = []models.SyncChunk{{
+		Done:  true,
+		Notes: []models.SyncRow{{1512792229832, "guid", 1512791750932, 1512870511, 0, "", "front\x1fback", "front", 2469774680, 0, ""}},
+		Cards: []models.SyncRow{{1, 2, 3, 0, 4, 5, 0, 0, 1.5, 0, 0, 0, 0, 0, 0, 0, 0, ""}},
+	}}
+
+	remote := NewRemoteServer(config.Sync{Endpoint: server.URL, HostKey: "hkey"})
+	chunk, err := remote.Chunk()
+
+	assert.NoError(t, err)
+	assert.True(t, chunk.Done)
+	assert.Equal(t, int64(1512792229832), chunk.Notes[0][0])
+	assert.Equal(t, "front\x1fback", chunk.Notes[0][6])
+	assert.Equal(t, 1.5, chunk.Cards[0][8])
+}
+
+func TestSanityCountsEncoding(t *testing.T) {
+	counts := models.SanityCounts{Cards: 1, Notes: 2, Revlog: 3, Graves: 4, Models: 5, Decks: 6, Confs: 7}
+	data, err := json.Marshal(counts)
+	assert.NoError(t, err)
+	assert.Equal(t, "[[0,0,0],1,2,3,4,5,6,7]", string(data))
+
+	var decoded models.SanityCounts
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, counts, decoded)
+}
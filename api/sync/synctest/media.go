@@ -0,0 +1,238 @@
+package synctest
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aerex/go-anki/pkg/models"
+)
+
+// MediaServer stores the media files in memory and keeps a change log
+// like the media sync endpoints of an anki sync server
+type MediaServer struct {
+	*httptest.Server
+	mu sync.Mutex
+
+	HostKey string
+	// The content of the files stored on the server
+	Files map[string][]byte
+	// The changes made to the files with the latest change last
+	Log []models.MediaChange
+	// Populated by the client requests
+	Calls    []string
+	Uploaded []string
+	Removed  []string
+}
+
+func NewMediaServer() *MediaServer {
+	s := &MediaServer{
+		HostKey: "hkey",
+		Files:   make(map[string][]byte),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// AddFile stores a file as if it was uploaded by another client
+func (s *MediaServer) AddFile(name string, content []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Files[name] = content
+	s.record(name, checksum(content))
+}
+
+// RemoveFile deletes a file as if it was removed by another client
+func (s *MediaServer) RemoveFile(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.Files, name)
+	s.record(name, "")
+}
+
+func (s *MediaServer) usn() int {
+	return len(s.Log)
+}
+
+func (s *MediaServer) record(name, csum string) {
+	s.Log = append(s.Log, models.MediaChange{Name: name, USN: s.usn() + 1, Checksum: csum})
+}
+
+func (s *MediaServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	method := strings.TrimPrefix(r.URL.Path, "/msync/")
+	s.Calls = append(s.Calls, method)
+
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if method == "begin" && r.FormValue("k") != s.HostKey {
+		http.Error(w, "invalid host key", http.StatusForbidden)
+		return
+	}
+	var data []byte
+	var err error
+	if r.FormValue("c") == "1" {
+		data, err = readData(r)
+	} else {
+		data, err = readRawData(r)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var res interface{}
+	switch method {
+	case "begin":
+		res = map[string]interface{}{"sk": "skey", "usn": s.usn()}
+	case "mediaChanges":
+		var req struct {
+			LastUsn int `json:"lastUsn"`
+		}
+		err = json.Unmarshal(data, &req)
+		changes := []models.MediaChange{}
+		// only the latest change of each file is sent
+		latest := make(map[string]int)
+		for idx, change := range s.Log {
+			latest[change.Name] = idx
+		}
+		for idx, change := range s.Log {
+			if change.USN > req.LastUsn && latest[change.Name] == idx {
+				changes = append(changes, change)
+			}
+		}
+		res = changes
+	case "downloadFiles":
+		var req struct {
+			Files []string `json:"files"`
+		}
+		if err = json.Unmarshal(data, &req); err == nil {
+			var zipData []byte
+			zipData, err = s.zipFiles(req.Files)
+			if err == nil {
+				w.Write(zipData)
+				return
+			}
+		}
+	case "uploadChanges":
+		var processed int
+		processed, err = s.applyZip(data)
+		res = []int{processed, s.usn()}
+	case "mediaSanity":
+		var req struct {
+			Local int `json:"local"`
+		}
+		err = json.Unmarshal(data, &req)
+		if req.Local == len(s.Files) {
+			res = "OK"
+		} else {
+			res = "FAILED"
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": res, "err": ""})
+}
+
+func (s *MediaServer) zipFiles(fnames []string) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	meta := make(map[string]string)
+	for idx, name := range fnames {
+		content, exists := s.Files[name]
+		if !exists {
+			continue
+		}
+		zipName := strconv.Itoa(idx)
+		f, err := writer.Create(zipName)
+		if err != nil {
+			return nil, err
+		}
+		f.Write(content)
+		meta[zipName] = name
+	}
+	f, err := writer.Create("_meta")
+	if err != nil {
+		return nil, err
+	}
+	if err := json.NewEncoder(f).Encode(meta); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *MediaServer) applyZip(data []byte) (int, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return 0, err
+	}
+	files := make(map[string][]byte)
+	var meta [][]string
+	for _, f := range reader.File {
+		r, err := f.Open()
+		if err != nil {
+			return 0, err
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return 0, err
+		}
+		if f.Name == "_meta" {
+			if err := json.Unmarshal(content, &meta); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		files[f.Name] = content
+	}
+	for _, entry := range meta {
+		name, zipName := entry[0], entry[1]
+		if zipName == "" {
+			delete(s.Files, name)
+			s.Removed = append(s.Removed, name)
+			s.record(name, "")
+			continue
+		}
+		s.Files[name] = files[zipName]
+		s.Uploaded = append(s.Uploaded, name)
+		s.record(name, checksum(files[zipName]))
+	}
+	return len(meta), nil
+}
+
+// readRawData reads the data field of the multipart form that was not compressed
+func readRawData(r *http.Request) ([]byte, error) {
+	file, _, err := r.FormFile("data")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+func checksum(content []byte) string {
+	sum := sha1.Sum(content)
+	return hex.EncodeToString(sum[:])
+}
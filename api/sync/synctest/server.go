@@ -0,0 +1,176 @@
+// Package synctest provides a fake anki sync server to test the sync protocol
+package synctest
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/aerex/go-anki/pkg/models"
+)
+
+// Server records the requests made by the client and replies with the
+// graves, changes and chunks configured on it
+type Server struct {
+	*httptest.Server
+	mu sync.Mutex
+
+	User    string
+	Pass    string
+	HostKey string
+
+	Meta         models.SyncMeta
+	Graves       models.Graves
+	Changes      models.SyncChanges
+	Chunks       []models.SyncChunk
+	SanityStatus string
+	FinishMod    int64
+	// The collection file stored on the server
+	Collection []byte
+
+	// Populated by the client requests
+	Calls           []string
+	ReceivedGraves  models.Graves
+	ReceivedChanges models.SyncChanges
+	ReceivedChunks  []models.SyncChunk
+	ReceivedCounts  models.SanityCounts
+	Aborted         bool
+}
+
+func NewServer() *Server {
+	s := &Server{
+		User:         "user",
+		Pass:         "pass",
+		HostKey:      "hkey",
+		SanityStatus: "ok",
+		Meta:         models.SyncMeta{Cont: true},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	method := strings.TrimPrefix(r.URL.Path, "/sync/")
+	s.Calls = append(s.Calls, method)
+
+	data, err := readData(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if method != "hostKey" && r.FormValue("k") != s.HostKey {
+		http.Error(w, "invalid host key", http.StatusForbidden)
+		return
+	}
+	// full syncs exchange the collection file instead of json
+	switch method {
+	case "upload":
+		s.Collection = data
+		w.Write([]byte("OK"))
+		return
+	case "download":
+		w.Write(s.Collection)
+		return
+	}
+	payload := json.RawMessage(data)
+
+	var res interface{}
+	switch method {
+	case "hostKey":
+		var creds struct {
+			User string `json:"u"`
+			Pass string `json:"p"`
+		}
+		err = json.Unmarshal(payload, &creds)
+		if creds.User != s.User || creds.Pass != s.Pass {
+			http.Error(w, "invalid credentials", http.StatusForbidden)
+			return
+		}
+		res = map[string]string{"key": s.HostKey}
+	case "meta":
+		res = s.Meta
+	case "start":
+		var req struct {
+			Graves models.Graves `json:"graves"`
+		}
+		err = json.Unmarshal(payload, &req)
+		s.addGraves(req.Graves)
+		res = s.Graves
+	case "applyGraves":
+		var req struct {
+			Chunk models.Graves `json:"chunk"`
+		}
+		err = json.Unmarshal(payload, &req)
+		s.addGraves(req.Chunk)
+	case "applyChanges":
+		var req struct {
+			Changes models.SyncChanges `json:"changes"`
+		}
+		err = json.Unmarshal(payload, &req)
+		s.ReceivedChanges = req.Changes
+		res = s.Changes
+	case "chunk":
+		if len(s.Chunks) == 0 {
+			res = models.SyncChunk{Done: true}
+		} else {
+			res = s.Chunks[0]
+			s.Chunks = s.Chunks[1:]
+		}
+	case "applyChunk":
+		var req struct {
+			Chunk models.SyncChunk `json:"chunk"`
+		}
+		err = json.Unmarshal(payload, &req)
+		s.ReceivedChunks = append(s.ReceivedChunks, req.Chunk)
+	case "sanityCheck2":
+		var req struct {
+			Client models.SanityCounts `json:"client"`
+		}
+		err = json.Unmarshal(payload, &req)
+		s.ReceivedCounts = req.Client
+		res = models.SanityCheckResult{Status: s.SanityStatus}
+	case "finish":
+		res = s.FinishMod
+	case "abort":
+		s.Aborted = true
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func (s *Server) addGraves(graves models.Graves) {
+	s.ReceivedGraves.Cards = append(s.ReceivedGraves.Cards, graves.Cards...)
+	s.ReceivedGraves.Notes = append(s.ReceivedGraves.Notes, graves.Notes...)
+	s.ReceivedGraves.Decks = append(s.ReceivedGraves.Decks, graves.Decks...)
+}
+
+// readData decompress the gzipped data field of the multipart form
+func readData(r *http.Request) ([]byte, error) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		return nil, err
+	}
+	file, _, err := r.FormFile("data")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(gz)
+}
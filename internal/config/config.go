@@ -26,12 +26,25 @@ const (
 	EXEC        = "exec"
 )
 
+const (
+	DEFAULT_BACKUP_KEEP     = 20
+	DEFAULT_BACKUP_INTERVAL = 30
+)
+
 type Logger struct {
   Level  string `toml:"level" comment:"The log level verbosity. Default is DEBUG. Available levels: TRACE, DEBUG, INFO, WARN, ERROR, FATAL, OFF"`
   File   string `toml:"file" comment:"The file path where the logs will be stored"`
 	Sql    bool   `toml:"sql" comment:"Enable to log SQL statements"`
 }
 
+type Study struct {
+	// The command playing the sounds of the cards. The path of the sound file is appended to the command.
+	// Defaults to the first player found among mpv, ffplay and afplay
+	Player string `toml:"player,omitempty" comment:"Command playing the sounds of the cards (ie: mpv --no-terminal). The file is appended to the command"`
+	// How the images of the cards are drawn in the terminal. Options are auto, kitty, sixel, halfblock, ascii and none
+	Images string `toml:"images,omitempty" comment:"How the images of the cards are shown. Options are auto, kitty, sixel, halfblock, ascii and none. Default is auto"`
+}
+
 type Prompt struct {
 	Vim bool `toml:"vim" comment:"Enable vim mode to use j/k to cycle through selections"`
 }
@@ -48,13 +61,40 @@ type API struct {
 	Endpoint string `toml:"endpoint" comment:"URL to retrieve data from backend"`
 }
 
+type Sync struct {
+	// The URL of the sync server (ie: a self-hosted anki sync server)
+	Endpoint string `toml:"endpoint" comment:"URL of the sync server"`
+	// The URL of the media sync server. Defaults to the sync server
+	MediaEndpoint string `toml:"media-endpoint,omitempty" mapstructure:"media-endpoint" comment:"URL of the media sync server. Defaults to endpoint"`
+	User          string `toml:"user"`
+	PassEval      string `toml:"pass-cmd,inline" mapstructure:"pass-cmd" comment:"Run a command to retrieve the password"`
+	Pass          string `toml:"pass,omitempty"`
+	// The host key returned by the server after logging in.
+	// When set the user and password are not used
+	HostKey string `toml:"hkey,omitempty" mapstructure:"hkey" comment:"The host key used to authenticate with the sync server"`
+}
+
+type Backup struct {
+	// The directory where the backups (.colpkg) are stored. Defaults to a backups directory next to the collection
+	Dir string `toml:"dir,omitempty" comment:"Directory where the backups are stored. Defaults to a backups directory next to the collection"`
+	// The number of backups to keep. The oldest backups are removed first
+	Keep int `toml:"keep" comment:"Number of backups to keep. Default is 20"`
+	// The minimum number of minutes between automatic backups
+	Interval int `toml:"interval" comment:"Minutes between automatic backups. Default is 30"`
+	// Disable the backups made before modifying the collection
+	Disabled bool `toml:"disabled" comment:"Disable automatic backups before modifying the collection"`
+}
+
 type General struct {
 	// Options are `REST` and `DB`
   Type string `toml:"type" mapstructure:"type" comment:"Options are REST and DB"`
-	// SchedulerVersion sets the the scheduler version to use when syncing. Options are 2 or 3
+	// SchedulerVersion sets the the scheduler version used to study and sync. Options are 2 or 3
 	// @see https://faqs.ankiweb.net/the-anki-2.1-scheduler.html and https://faqs.ankiweb.net/the-2021-scheduler.html
 	// for information on compatibility
-	SchedulerVersion int `toml:"sched" mapstructure:"sched" comment:"Sets the scheduler version to use when syncing. Options are 2 or 3"`
+	SchedulerVersion int `toml:"sched" mapstructure:"sched" comment:"Sets the scheduler version used to study and sync. Options are 2 or 3"`
+	// FSRS computes the intervals of the v3 scheduler from the memory state of the cards instead of their ease
+	// @see https://github.com/open-spaced-repetition/fsrs4anki/wiki/The-Algorithm
+	FSRS bool `toml:"fsrs" mapstructure:"fsrs" comment:"Computes the intervals with FSRS. Requires the scheduler version 3"`
 	// The path of for the editor that will be launched when editing content (ie: vim or notepad)
 	// Default will use the editor set by the EDITOR or ANKICLI_EDITOR environment variable
 	Editor string `toml:"editor" comment:"The path of for the editor that will be launched when editing content (ie: vim or notepad)"`
@@ -72,10 +112,13 @@ type Config struct {
 	// The username credential to access backend
 	Logger  Logger  `toml:"logger"`
 	API     API     `toml:"api"`
+	Sync    Sync    `toml:"sync,omitempty"`
+	Backup  Backup  `toml:"backup"`
 	General General `toml:"general"`
 	Color   Color   `toml:"color,omitempty"`
 	Dir     string  `toml:"dir,omitempty"`
 	Prompt  Prompt  `toml:"prompt"`
+	Study   Study   `toml:"study,omitempty"`
 }
 
 func init() {
@@ -144,6 +187,15 @@ func Load(configPath string, config *Config, io *io.IO) error {
 		config.API.Pass = strings.Replace(buf.String(), "\n", "", 1)
 	}
 
+	if config.Sync.PassEval != "" {
+		buf := bytes.NewBufferString("")
+		err := io.Eval(config.Sync.PassEval, buf)
+		if err != nil {
+			return err
+		}
+		config.Sync.Pass = strings.Replace(buf.String(), "\n", "", 1)
+	}
+
 	// Remove trailing / from endpoint if there is one
 	if config.API.Endpoint != "" {
 		lastCharIdx := strings.LastIndex(config.API.Endpoint, "/")
@@ -160,6 +212,14 @@ func Load(configPath string, config *Config, io *io.IO) error {
 		config.DB.File = expandedPath
 	}
 
+	if config.Backup.Dir != "" {
+		expandedPath, err := homedir.Expand(config.Backup.Dir)
+		if err != nil {
+			return err
+		}
+		config.Backup.Dir = expandedPath
+	}
+
 	// Retrieve config file path from absolute file path
 	configFilePathUsed := viper.ConfigFileUsed()
 	lastSlashIdx := strings.LastIndex(configFilePathUsed, "/")
@@ -197,6 +257,8 @@ func GenerateSampleConfig(config *Config, io *io.IO) (string, error) {
 	}
 
 	config.General.SchedulerVersion = 2
+	config.Backup.Keep = DEFAULT_BACKUP_KEEP
+	config.Backup.Interval = DEFAULT_BACKUP_INTERVAL
   config.Logger.Level = strings.ToUpper(zerolog.DebugLevel.String())
 
 	out, err := toml.Marshal(config)
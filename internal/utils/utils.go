@@ -28,6 +28,11 @@ const (
 	BASE91_EXTRA_CHARS = "!#$%&()*+,-./:;<=>?@[]^_`{|}~"
 )
 
+// Media references found in fields (ie: <img src="cat.jpg"> or [sound:meow.mp3])
+var MEDIA_IMG_REGEX = regexp.MustCompile("(?i)<img[^>]+src=[\"']?([^\"'>]+)[\"']?[^>]*>")
+var MEDIA_SOUND_REGEX = regexp.MustCompile("(?i)\\[sound:([^]]+)\\]")
+var REMOTE_MEDIA_REGEX = regexp.MustCompile("(?i)^(https?|ftp|data):")
+
 func BoolToInt(val bool) int {
 	if val {
 		return 1
@@ -55,16 +60,37 @@ func UTF8EncodeString(data string) string {
 }
 
 func StripHTMLMedia(data string) string {
-	// TODO: Move to another method
 	// strip html but keep media files
-	reMedia, err := regexp.Compile("(?i)<img[^>]+src=[\"']?([^\"'>]+)[\"']?[^>]*>")
-	if err != nil {
-		return ""
-	}
-	d := reMedia.ReplaceAllString(data, " \\1 ")
+	d := MEDIA_IMG_REGEX.ReplaceAllString(data, " ${1} ")
 	return stripHTML(d)
 }
 
+// StripHTMLAndMedia returns the text of a field without its html and its media references.
+// The line breaks become spaces
+func StripHTMLAndMedia(data string) string {
+	d := MEDIA_IMG_REGEX.ReplaceAllString(data, "")
+	d = MEDIA_SOUND_REGEX.ReplaceAllString(d, "")
+	d = regexp.MustCompile(`(?i)(\n|<br ?/?>|</?div>)+`).ReplaceAllString(d, " ")
+	d = strings.ReplaceAll(stripHTML(d), "\u00a0", " ")
+	return strings.TrimSpace(d)
+}
+
+// MediaReferences returns the local media files referenced in a field
+// Remote files (ie: <img src="https://...">) are ignored
+func MediaReferences(data string) []string {
+	var refs []string
+	for _, re := range []*regexp.Regexp{MEDIA_IMG_REGEX, MEDIA_SOUND_REGEX} {
+		for _, match := range re.FindAllStringSubmatch(data, -1) {
+			fname := html.UnescapeString(strings.TrimSpace(match[1]))
+			if fname == "" || REMOTE_MEDIA_REGEX.MatchString(fname) {
+				continue
+			}
+			refs = append(refs, fname)
+		}
+	}
+	return refs
+}
+
 // EntsToTxt replaces all html entities to friendly text
 // TODO: Need to test how this is going to work
 func entsToTxt(ht string) string {
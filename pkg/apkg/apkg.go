@@ -0,0 +1,159 @@
+// Package apkg reads and writes the zip archives used by anki to share decks (.apkg)
+// and to back up collections (.colpkg)
+// See https://github.com/ankitects/anki/blob/2.1.15/anki/exporting.py
+package apkg
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// The collection in the format used by anki 2.0 clients
+	CollectionFile = "collection.anki2"
+	// The collection in the format used by anki 2.1 clients (same schema)
+	Collection21File = "collection.anki21"
+	// The entry mapping the numbered media entries to the media file names
+	MediaFile = "media"
+)
+
+// Package is an archive extracted in a directory
+type Package struct {
+	// Path of the extracted collection
+	Collection string
+	// Maps the media file names to the path of the extracted files
+	Media map[string]string
+}
+
+// Write creates an archive with the collection file and the media files.
+// media maps the media file names to their path on disk
+func Write(path string, colPath string, media map[string]string) (err error) {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	writer := zip.NewWriter(out)
+	if err := addFile(writer, CollectionFile, colPath); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(media))
+	for name := range media {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	mediaMap := make(map[string]string)
+	for idx, name := range names {
+		entry := strconv.Itoa(idx)
+		if err := addFile(writer, entry, media[name]); err != nil {
+			return err
+		}
+		mediaMap[entry] = name
+	}
+	f, err := writer.Create(MediaFile)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(mediaMap); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+func addFile(writer *zip.Writer, name, path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	f, err := writer.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, in)
+	return err
+}
+
+// Extract unzips the archive into dir
+func Extract(path string, dir string) (*Package, error) {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open package %s: %w", path, err)
+	}
+	defer reader.Close()
+
+	pkg := &Package{Media: make(map[string]string)}
+	mediaMap := make(map[string]string)
+	entries := make(map[string]string)
+	for _, f := range reader.File {
+		// entries are never nested so anything else is not a valid package
+		if f.Name != filepath.Base(f.Name) || strings.HasPrefix(f.Name, ".") {
+			return nil, fmt.Errorf("unexpected entry %s in package %s", f.Name, path)
+		}
+		if f.Name == MediaFile {
+			if err := readJSON(f, &mediaMap); err != nil {
+				return nil, fmt.Errorf("invalid media in package %s: %w", path, err)
+			}
+			continue
+		}
+		dst := filepath.Join(dir, f.Name)
+		if err := extractFile(f, dst); err != nil {
+			return nil, err
+		}
+		entries[f.Name] = dst
+	}
+	// prefer the collection of the newer clients when both are included
+	for _, name := range []string{Collection21File, CollectionFile} {
+		if col, exists := entries[name]; exists {
+			pkg.Collection = col
+			break
+		}
+	}
+	if pkg.Collection == "" {
+		return nil, fmt.Errorf("package %s does not contain a collection", path)
+	}
+	for entry, name := range mediaMap {
+		if extracted, exists := entries[entry]; exists {
+			pkg.Media[name] = extracted
+		}
+	}
+	return pkg, nil
+}
+
+func readJSON(f *zip.File, dst interface{}) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return json.NewDecoder(r).Decode(dst)
+}
+
+func extractFile(f *zip.File, dst string) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,58 @@
+package apkg
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteAndExtract(t *testing.T) {
+	dir := t.TempDir()
+	col := filepath.Join(dir, "col")
+	img := filepath.Join(dir, "img")
+	os.WriteFile(col, []byte("collection"), 0644)
+	os.WriteFile(img, []byte("image"), 0644)
+	path := filepath.Join(dir, "deck.apkg")
+
+	err := Write(path, col, map[string]string{"cat.jpg": img})
+	assert.NoError(t, err)
+
+	pkg, err := Extract(path, t.TempDir())
+	assert.NoError(t, err)
+	content, _ := os.ReadFile(pkg.Collection)
+	assert.Equal(t, "collection", string(content))
+	assert.Len(t, pkg.Media, 1)
+	content, _ = os.ReadFile(pkg.Media["cat.jpg"])
+	assert.Equal(t, "image", string(content))
+}
+
+func TestExtractRejectsNestedEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.apkg")
+	out, _ := os.Create(path)
+	writer := zip.NewWriter(out)
+	f, _ := writer.Create("../collection.anki2")
+	f.Write([]byte("collection"))
+	writer.Close()
+	out.Close()
+
+	_, err := Extract(path, t.TempDir())
+
+	assert.ErrorContains(t, err, "unexpected entry ../collection.anki2")
+}
+
+func TestExtractWithoutCollection(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.apkg")
+	out, _ := os.Create(path)
+	writer := zip.NewWriter(out)
+	f, _ := writer.Create(MediaFile)
+	f.Write([]byte("{}"))
+	writer.Close()
+	out.Close()
+
+	_, err := Extract(path, t.TempDir())
+
+	assert.ErrorContains(t, err, "does not contain a collection")
+}
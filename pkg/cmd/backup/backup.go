@@ -0,0 +1,22 @@
+package backup
+
+import (
+	"github.com/aerex/go-anki/pkg/anki"
+	cmdCreate "github.com/aerex/go-anki/pkg/cmd/backup/create"
+	cmdList "github.com/aerex/go-anki/pkg/cmd/backup/list"
+	cmdRestore "github.com/aerex/go-anki/pkg/cmd/backup/restore"
+	"github.com/spf13/cobra"
+)
+
+func NewBackupCmd(anki *anki.Anki) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "backup <command>",
+		Short: "Manage backups of the collection",
+	}
+
+	cmd.AddCommand(cmdCreate.NewCreateCmd(anki, nil))
+	cmd.AddCommand(cmdList.NewListCmd(anki, nil))
+	cmd.AddCommand(cmdRestore.NewRestoreCmd(anki, nil))
+
+	return cmd
+}
@@ -0,0 +1,50 @@
+package create
+
+import (
+	"bytes"
+
+	"github.com/aerex/go-anki/pkg/anki"
+	"github.com/spf13/cobra"
+)
+
+type CreateOptions struct {
+	WithMedia bool
+	Quiet     bool
+}
+
+func NewCreateCmd(anki *anki.Anki, cb func(*anki.Anki) error) *cobra.Command {
+	opts := &CreateOptions{}
+
+	cmd := &cobra.Command{
+		Use:          "create <options>",
+		Short:        "Back up the collection",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cb != nil {
+				return cb(anki)
+			}
+			return createCmd(anki, opts)
+		},
+	}
+
+	cmd.Flags().BoolVar(&opts.WithMedia, "with-media", false, "Include the media files in the backup")
+	cmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, "Supress output from terminal and logs")
+
+	return cmd
+}
+
+func createCmd(anki *anki.Anki, opts *CreateOptions) error {
+	backup, err := anki.API.Backup(opts.WithMedia)
+	if err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to back up collection")
+		return err
+	}
+
+	if !opts.Quiet {
+		var buffer bytes.Buffer
+		buffer.WriteString("Backed up collection to " + backup.Path + "\n")
+		buffer.WriteTo(anki.IO.Output)
+	}
+	return nil
+}
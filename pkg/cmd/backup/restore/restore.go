@@ -0,0 +1,48 @@
+package restore
+
+import (
+	"bytes"
+
+	"github.com/aerex/go-anki/pkg/anki"
+	"github.com/spf13/cobra"
+)
+
+type RestoreOptions struct {
+	Quiet bool
+}
+
+func NewRestoreCmd(anki *anki.Anki, cb func(*anki.Anki) error) *cobra.Command {
+	opts := &RestoreOptions{}
+
+	cmd := &cobra.Command{
+		Use:          "restore <name|file.colpkg> <options>",
+		Short:        "Replace the collection with a backup",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cb != nil {
+				return cb(anki)
+			}
+			return restoreCmd(anki, opts, args[0])
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, "Supress output from terminal and logs")
+
+	return cmd
+}
+
+func restoreCmd(anki *anki.Anki, opts *RestoreOptions, name string) error {
+	if err := anki.API.RestoreBackup(name); err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to restore backup %s", name)
+		return err
+	}
+
+	if !opts.Quiet {
+		var buffer bytes.Buffer
+		buffer.WriteString("Restored collection from " + name + "\n")
+		buffer.WriteString("The next sync will require a full upload or download\n")
+		buffer.WriteTo(anki.IO.Output)
+	}
+	return nil
+}
@@ -3,6 +3,8 @@ package card
 import (
 	"github.com/aerex/go-anki/pkg/anki"
 	cmdCreate "github.com/aerex/go-anki/pkg/cmd/card/create"
+	cmdDelete "github.com/aerex/go-anki/pkg/cmd/card/delete"
+	cmdEdit "github.com/aerex/go-anki/pkg/cmd/card/edit"
 	cmdList "github.com/aerex/go-anki/pkg/cmd/card/list"
 	"github.com/spf13/cobra"
 )
@@ -15,6 +17,8 @@ func NewCardCmd(anki *anki.Anki) *cobra.Command {
 
 	cmd.AddCommand(cmdList.NewListCmd(anki))
 	cmd.AddCommand(cmdCreate.NewCreateCmd(anki))
+	cmd.AddCommand(cmdEdit.NewEditCmd(anki))
+	cmd.AddCommand(cmdDelete.NewDeleteCmd(anki))
 
 	return cmd
 }
@@ -1,7 +1,11 @@
 package create
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 	"strings"
 
 	survey "github.com/AlecAivazis/survey/v2"
@@ -10,6 +14,7 @@ import (
 	"github.com/aerex/go-anki/pkg/ui/prompt"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
 )
 
 type CreateCmd struct {
@@ -28,9 +33,23 @@ func NewCreateCmd(anki *anki.Anki) *cobra.Command {
 		Anki: anki,
 	}
 	cmd := &cobra.Command{
-		Use:                   "create [--type|-T TYPE] [--field|-f FIELD...] [--deck|-d DECK_NAME] [--file|-F FILE] [--tag|-t TAG...]",
+		Use:                   "create [--type|-T TYPE] [--field|-f FIELD...] [--deck|-d DECK_NAME] [--file|-F FILE] [--tag|-t TAG...] [--quiet|-q]",
 		DisableFlagsInUseLine: true, // disables [flags] in usage text
 		Short:                 "Create a card",
+		Long: `Create a card interactively or from a file.
+
+The file holds a YAML document per note or a list of notes in YAML or JSON:
+
+  type: Basic
+  deck: Grammar
+  fields:
+    - Question
+    - Answer
+  tags:
+    - example
+
+The fields are given in the order of the fields of the note type.
+All the notes of the file are created in a single transaction.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return run.execute()
 		},
@@ -41,11 +60,15 @@ func NewCreateCmd(anki *anki.Anki) *cobra.Command {
 	cmd.Flags().StringVarP(&run.Deck, "deck", "d", "", "The name of the deck the new card will be added to")
 	cmd.Flags().StringSliceVarP(&run.Tags, "tag", "t", []string{}, "List of tags on note")
 	cmd.Flags().StringToStringVarP(&run.Fields, "field", "f", map[string]string{}, "Set the card fields")
+	cmd.Flags().BoolVarP(&run.Quiet, "quiet", "q", false, "Supress output from terminal and logs")
 
 	return cmd
 }
 
 func (cmd *CreateCmd) execute() (err error) {
+	if cmd.File != "" {
+		return cmd.createFromFile()
+	}
 	var (
 		cardType string
 		deckName string
@@ -147,6 +170,10 @@ func (cmd *CreateCmd) execute() (err error) {
 			note.StringTags = strings.Join(selectedTags, ",")
 		}
 	}
+	if err = cmd.Anki.API.AutoBackup(); err != nil {
+		log.Logger.Error().Err(err).Msg("failed to back up collection before creating card")
+		return err
+	}
 	_, err = cmd.Anki.API.CreateCard(note, noteType, deckName)
 	if err != nil {
 		log.Logger.Error().Err(err)
@@ -154,3 +181,109 @@ func (cmd *CreateCmd) execute() (err error) {
 	}
 	return nil
 }
+
+// createFromFile creates the notes described in a YAML or JSON file.
+// The type and the deck of the notes default to the --type and --deck flags
+// and the --tag flags are added to the tags of each note
+func (cmd *CreateCmd) createFromFile() error {
+	var in io.Reader = cmd.Anki.IO.Input
+	if cmd.File != "-" {
+		f, err := os.Open(cmd.File)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	notes, err := readNotes(in)
+	if err != nil {
+		cmd.Anki.IO.Log.Err(err).Msgf("failed to read notes from %s", cmd.File)
+		return err
+	}
+	if len(notes) == 0 {
+		return fmt.Errorf("no notes found in %s", cmd.File)
+	}
+	for idx := range notes {
+		note := &notes[idx]
+		if note.Type == "" {
+			note.Type = cmd.Type
+		}
+		if note.Type == "" {
+			return fmt.Errorf("note %d: the note type is required: set type or use --type", idx+1)
+		}
+		if note.Deck == "" {
+			note.Deck = cmd.Deck
+		}
+		if note.Deck == "" {
+			note.Deck = "Default"
+		}
+		note.Tags = append(note.Tags, cmd.Tags...)
+	}
+
+	if err = cmd.Anki.API.AutoBackup(); err != nil {
+		cmd.Anki.IO.Log.Err(err).Msg("failed to back up collection before creating cards")
+		return err
+	}
+	ids, err := cmd.Anki.API.CreateNotes(notes)
+	if err != nil {
+		cmd.Anki.IO.Log.Err(err).Msgf("failed to create notes from %s", cmd.File)
+		return err
+	}
+	if !cmd.Quiet {
+		var buffer bytes.Buffer
+		for _, id := range ids {
+			buffer.WriteString(fmt.Sprintf("Created note %d\n", id))
+		}
+		buffer.WriteTo(cmd.Anki.IO.Output)
+	}
+	return nil
+}
+
+// noteDocument is a YAML document holding a note or a list of notes
+type noteDocument []models.CreateNote
+
+func (d *noteDocument) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var notes []models.CreateNote
+	if err := unmarshal(&notes); err == nil {
+		*d = notes
+		return nil
+	}
+	var note models.CreateNote
+	if err := unmarshal(&note); err != nil {
+		return err
+	}
+	*d = noteDocument{note}
+	return nil
+}
+
+// readNotes reads a JSON array or object of notes or a stream of YAML documents
+// where each document is a note or a list of notes
+func readNotes(r io.Reader) (notes []models.CreateNote, err error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return
+	}
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		err = json.Unmarshal(trimmed, &notes)
+		return
+	}
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		var note models.CreateNote
+		if err = json.Unmarshal(trimmed, &note); err != nil {
+			return
+		}
+		return []models.CreateNote{note}, nil
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc noteDocument
+		if err = dec.Decode(&doc); err == io.EOF {
+			return notes, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, doc...)
+	}
+}
@@ -0,0 +1,80 @@
+package delete
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/aerex/go-anki/pkg/anki"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/aerex/go-anki/pkg/ui/prompt"
+	"github.com/spf13/cobra"
+)
+
+type DeleteOptions struct {
+	Yes   bool
+	Quiet bool
+}
+
+func NewDeleteCmd(anki *anki.Anki) *cobra.Command {
+	opts := &DeleteOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "delete <query> [--yes|-y] [--quiet|-q]",
+		Short: "Delete the cards matching a search query",
+		Long: `Delete the cards matching a search query, see https://docs.ankiweb.net/searching.html
+
+The notes left without cards are deleted too.
+The deletions are sent to the sync server on the next sync.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return deleteCmd(anki, opts, args[0])
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.Yes, "yes", "y", false, "Delete without asking for confirmation")
+	cmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, "Supress output from terminal and logs")
+
+	return cmd
+}
+
+func deleteCmd(anki *anki.Anki, opts *DeleteOptions, query string) error {
+	cards, err := anki.API.Cards(query, -1)
+	if err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to find the cards of %s", query)
+		return err
+	}
+	if len(cards) == 0 {
+		return fmt.Errorf("no card found for %s", query)
+	}
+	if !opts.Yes {
+		confirm, err := prompt.NewSurveyPrompt(*anki.Config).Confirm(fmt.Sprintf("Delete %d cards?", len(cards)))
+		if err != nil {
+			return err
+		}
+		if !confirm {
+			return nil
+		}
+	}
+
+	ids := make([]models.ID, len(cards))
+	for idx, card := range cards {
+		ids[idx] = card.ID
+	}
+	if err = anki.API.AutoBackup(); err != nil {
+		anki.IO.Log.Err(err).Msg("failed to back up collection before deleting cards")
+		return err
+	}
+	res, err := anki.API.DeleteCards(ids)
+	if err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to delete the cards of %s", query)
+		return err
+	}
+
+	if !opts.Quiet {
+		var buffer bytes.Buffer
+		buffer.WriteString(fmt.Sprintf("Deleted %d cards and %d notes\n", res.Cards, res.Notes))
+		buffer.WriteTo(anki.IO.Output)
+	}
+	return nil
+}
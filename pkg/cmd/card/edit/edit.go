@@ -0,0 +1,245 @@
+package edit
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aerex/go-anki/pkg/anki"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/aerex/go-anki/pkg/template"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+type EditOptions struct {
+	Quiet bool
+}
+
+// editDocument is the YAML document opened in the editor.
+// The fields are kept in the order of the fields of the note type
+type editDocument struct {
+	Fields yaml.MapSlice `yaml:"fields,omitempty"`
+	Tags   []string      `yaml:"tags"`
+}
+
+// editedDocument is the YAML document saved by the user.
+type editedDocument struct {
+	Fields map[string]fieldText `yaml:"fields"`
+	Tags   []string             `yaml:"tags"`
+}
+
+// fieldText is the value of a field kept exactly as written, so that YAML
+// does not turn yes, 010 or 1.0 into true, 8 or 1
+type fieldText struct {
+	text    string
+	invalid bool
+}
+
+func (f *fieldText) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&f.text); err != nil {
+		f.invalid = true
+	}
+	return nil
+}
+
+// editTemplateData is passed to the edit-note template
+type editTemplateData struct {
+	NoteID     models.ID
+	NoteType   string
+	FieldNames string
+	Note       editDocument
+}
+
+func NewEditCmd(anki *anki.Anki) *cobra.Command {
+	opts := &EditOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "edit <cid|query> [--quiet|-q]",
+		Short: "Edit the fields and the tags of the note of a card",
+		Long: `Edit the fields and the tags of the note of a card in your editor ($EDITOR).
+
+The argument is either the id of a card or a search query in which case the notes
+of the matched cards are edited one after the other.
+The note is saved when the file is changed and the cards of the templates that are
+no longer empty are created.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return editCmd(anki, opts, args[0])
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, "Supress output from terminal and logs")
+
+	return cmd
+}
+
+func editCmd(anki *anki.Anki, opts *EditOptions, arg string) error {
+	qs := arg
+	if _, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		qs = "cid:" + arg
+	}
+	cards, err := anki.API.Cards(qs, -1)
+	if err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to find the cards of %s", arg)
+		return err
+	}
+	if len(cards) == 0 {
+		return fmt.Errorf("no card found for %s", arg)
+	}
+	if err := anki.Templates.Load(template.EDIT_NOTE); err != nil {
+		return err
+	}
+
+	var buffer bytes.Buffer
+	edited := make(map[models.ID]bool)
+	backedUp := false
+	for _, card := range cards {
+		if edited[card.NoteID] {
+			continue
+		}
+		edited[card.NoteID] = true
+		fields, tags, changed, err := EditNote(anki, card)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			buffer.WriteString(fmt.Sprintf("Note %d was not changed\n", card.NoteID))
+			continue
+		}
+		if !backedUp {
+			if err = anki.API.AutoBackup(); err != nil {
+				anki.IO.Log.Err(err).Msg("failed to back up collection before editing notes")
+				return err
+			}
+			backedUp = true
+		}
+		res, err := anki.API.UpdateNote(card.NoteID, fields, tags)
+		if err != nil {
+			anki.IO.Log.Err(err).Msgf("failed to update note %d", card.NoteID)
+			return err
+		}
+		switch {
+		case res.Status == models.NoteRowSkipped:
+			buffer.WriteString(fmt.Sprintf("Note %d was not changed\n", card.NoteID))
+		case res.Cards > 0:
+			buffer.WriteString(fmt.Sprintf("Updated note %d and created %d cards\n", card.NoteID, res.Cards))
+		default:
+			buffer.WriteString(fmt.Sprintf("Updated note %d\n", card.NoteID))
+		}
+	}
+	if !opts.Quiet {
+		buffer.WriteTo(anki.IO.Output)
+	}
+	return nil
+}
+
+// EditNote opens the note of the card in the editor with the edit-note template until the user saves
+// a valid note or gives up
+func EditNote(anki *anki.Anki, card models.Card) (fields map[string]string, tags []string, changed bool, err error) {
+	noteType := card.Note.Model
+	names := make([]string, len(noteType.Fields))
+	doc := editDocument{Tags: strings.Fields(card.Note.StringTags)}
+	for idx, field := range noteType.Fields {
+		names[idx] = field.Name
+		value := ""
+		if idx < len(card.Note.Fields) {
+			value = card.Note.Fields[idx]
+		}
+		doc.Fields = append(doc.Fields, yaml.MapItem{Key: field.Name, Value: value})
+	}
+	data := editTemplateData{
+		NoteID:     card.NoteID,
+		NoteType:   noteType.Name,
+		FieldNames: strings.Join(names, ", "),
+		Note:       doc,
+	}
+	changed, err = openEditor(anki, card.NoteID, data, func(content []byte) (err error) {
+		fields, tags, err = parseEdit(content, noteType)
+		return
+	})
+	return
+}
+
+// EditTags opens the tags of the note of the card in the editor with the edit-tags template
+// and returns the fields of the note unchanged with the edited tags
+func EditTags(anki *anki.Anki, card models.Card) (fields map[string]string, tags []string, changed bool, err error) {
+	fields = make(map[string]string)
+	for idx, field := range card.Note.Model.Fields {
+		if idx < len(card.Note.Fields) {
+			fields[field.Name] = card.Note.Fields[idx]
+		}
+	}
+	data := editTemplateData{
+		NoteID:   card.NoteID,
+		NoteType: card.Note.Model.Name,
+		Note:     editDocument{Tags: strings.Fields(card.Note.StringTags)},
+	}
+	changed, err = openEditor(anki, card.NoteID, data, func(content []byte) error {
+		var doc editDocument
+		if err := yaml.Unmarshal(content, &doc); err != nil {
+			return fmt.Errorf("invalid YAML: %w", err)
+		}
+		tags = nil
+		for _, tag := range doc.Tags {
+			tags = append(tags, strings.Fields(tag)...)
+		}
+		return nil
+	})
+	return
+}
+
+// openEditor opens the data in the editor until parse accepts the content saved by the user or the user gives up
+func openEditor(anki *anki.Anki, noteID models.ID, data editTemplateData, parse func([]byte) error) (changed bool, err error) {
+	if err = anki.Editor.Create(); err != nil {
+		return
+	}
+	// the editor files may already be removed
+	defer anki.Editor.Remove()
+	for {
+		var content []byte
+		err, content, changed = anki.Editor.Edit(data)
+		if err != nil || !changed {
+			return
+		}
+		if err = parse(content); err == nil {
+			return
+		}
+		fmt.Fprintf(anki.IO.Output, "Note %d: %s\n", noteID, err)
+		if !anki.Editor.ConfirmUserError() {
+			return
+		}
+	}
+}
+
+// parseEdit reads the fields and the tags of an edited note and checks the fields against the note type.
+// The fields missing from the document are empty
+func parseEdit(content []byte, noteType models.NoteType) (fields map[string]string, tags []string, err error) {
+	var doc editedDocument
+	if err = yaml.Unmarshal(content, &doc); err != nil {
+		return nil, nil, fmt.Errorf("invalid YAML: %w", err)
+	}
+	known := make(map[string]bool)
+	for _, field := range noteType.Fields {
+		known[field.Name] = true
+	}
+	fields = make(map[string]string)
+	for name, value := range doc.Fields {
+		if !known[name] {
+			return nil, nil, fmt.Errorf("field %q is not defined in %s", name, noteType.Name)
+		}
+		if value.invalid {
+			return nil, nil, fmt.Errorf("field %s must be text", name)
+		}
+		fields[name] = value.text
+	}
+	if len(noteType.Fields) > 0 && strings.TrimSpace(fields[noteType.Fields[0].Name]) == "" {
+		return nil, nil, fmt.Errorf("first field %s is empty", noteType.Fields[0].Name)
+	}
+	for _, tag := range doc.Tags {
+		tags = append(tags, strings.Fields(tag)...)
+	}
+	return
+}
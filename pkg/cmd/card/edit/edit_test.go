@@ -0,0 +1,100 @@
+package edit
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aerex/go-anki/pkg/anki"
+	"github.com/aerex/go-anki/pkg/editor/editorfakes"
+	"github.com/aerex/go-anki/pkg/io"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func testCard() models.Card {
+	return models.Card{
+		NoteID: 1,
+		Note: models.Note{
+			Fields:     models.NoteFields{"eat", "ate"},
+			StringTags: " verbs ",
+			Model: models.NoteType{
+				Name:   "Basic",
+				Fields: []*models.CardField{{Name: "Front"}, {Name: "Back"}},
+			},
+		},
+	}
+}
+
+func TestEditTags(t *testing.T) {
+	fakeEditor := &editorfakes.FakeEditor{}
+	fakeEditor.EditReturns(nil, []byte("# comment\ntags: [verbs, past tense]\n"), true)
+	anki := &anki.Anki{Editor: fakeEditor, IO: &io.IO{Output: &bytes.Buffer{}}}
+
+	fields, tags, changed, err := EditTags(anki, testCard())
+
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	// the fields are kept
+	assert.Equal(t, map[string]string{"Front": "eat", "Back": "ate"}, fields)
+	assert.Equal(t, []string{"verbs", "past", "tense"}, tags)
+	data := fakeEditor.EditArgsForCall(0).(editTemplateData)
+	assert.Equal(t, []string{"verbs"}, data.Note.Tags)
+	assert.Empty(t, data.Note.Fields)
+	assert.Equal(t, 1, fakeEditor.RemoveCallCount())
+}
+
+func TestEditNoteInvalid(t *testing.T) {
+	fakeEditor := &editorfakes.FakeEditor{}
+	fakeEditor.EditReturns(nil, []byte("fields:\n  Side: eat\n"), true)
+	fakeEditor.ConfirmUserErrorReturns(false)
+	output := &bytes.Buffer{}
+	anki := &anki.Anki{Editor: fakeEditor, IO: &io.IO{Output: output}}
+
+	_, _, _, err := EditNote(anki, testCard())
+
+	assert.Error(t, err)
+	assert.Contains(t, output.String(), `field "Side" is not defined in Basic`)
+	assert.Equal(t, 1, fakeEditor.ConfirmUserErrorCallCount())
+}
+
+func TestParseEditKeepsFieldText(t *testing.T) {
+	noteType := testCard().Note.Model
+	tests := []struct {
+		name    string
+		content string
+		fields  map[string]string
+		err     string
+	}{
+		{
+			name:    "boolean",
+			content: "fields:\n  Front: yes\n  Back: no\n",
+			fields:  map[string]string{"Front": "yes", "Back": "no"},
+		},
+		{
+			name:    "octal",
+			content: "fields:\n  Front: 010\n",
+			fields:  map[string]string{"Front": "010"},
+		},
+		{
+			name:    "float",
+			content: "fields:\n  Front: 1.0\n  Back:\n",
+			fields:  map[string]string{"Front": "1.0", "Back": ""},
+		},
+		{
+			name:    "list",
+			content: "fields:\n  Front: eat\n  Back: [ate]\n",
+			err:     "field Back must be text",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, _, err := parseEdit([]byte(tt.content), noteType)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.fields, fields)
+		})
+	}
+}
@@ -71,7 +71,7 @@ func listCmd(anki *anki.Anki, opts *ListOptions) error {
 		}
 
 		defer template.RecoverRender(cardTmpl, idx+1)
-		QA, err := template.RenderCard(anki.Config, card, cardTmpl)
+		QA, err := template.RenderCard(anki.Config, card, cardTmpl, template.RENDER_LIST)
 		if err != nil {
 			return err
 		}
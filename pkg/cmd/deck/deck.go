@@ -3,7 +3,10 @@ package deck
 import (
 	"github.com/aerex/go-anki/pkg/anki"
 	cmdCreate "github.com/aerex/go-anki/pkg/cmd/deck/create"
+	cmdDelete "github.com/aerex/go-anki/pkg/cmd/deck/delete"
+	cmdFilter "github.com/aerex/go-anki/pkg/cmd/deck/filter"
 	cmdList "github.com/aerex/go-anki/pkg/cmd/deck/list"
+	cmdMove "github.com/aerex/go-anki/pkg/cmd/deck/move"
 	cmdRename "github.com/aerex/go-anki/pkg/cmd/deck/rename"
 	"github.com/spf13/cobra"
 )
@@ -17,6 +20,9 @@ func NewCmdDeck(anki *anki.Anki) *cobra.Command {
 	cmd.AddCommand(cmdList.NewListCmd(anki, nil))
 	cmd.AddCommand(cmdRename.NewRenameCmd(anki, nil))
 	cmd.AddCommand(cmdCreate.NewCreateCmd(anki, nil))
+	cmd.AddCommand(cmdDelete.NewDeleteCmd(anki, nil))
+	cmd.AddCommand(cmdMove.NewMoveCmd(anki, nil))
+	cmd.AddCommand(cmdFilter.NewFilterCmd(anki))
 
 	return cmd
 }
@@ -0,0 +1,81 @@
+package delete
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/aerex/go-anki/pkg/anki"
+	"github.com/aerex/go-anki/pkg/ui/prompt"
+	"github.com/spf13/cobra"
+)
+
+type DeleteOptions struct {
+	KeepCardsTo string
+	Yes         bool
+	Quiet       bool
+}
+
+func NewDeleteCmd(anki *anki.Anki, cb func(*anki.Anki) error) *cobra.Command {
+	opts := &DeleteOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "delete <name> <options>",
+		Short: "Delete a deck and its subdecks",
+		Long: `Delete a deck and its subdecks.
+
+The cards of the decks are deleted with the notes left without cards unless
+--keep-cards-to moves them to another deck. The cards of filtered decks return
+to their home deck. The Default deck cannot be deleted.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cb != nil {
+				return cb(anki)
+			}
+			return deleteCmd(anki, opts, args[0])
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.KeepCardsTo, "keep-cards-to", "", "Move the cards of the deleted decks to this deck")
+	cmd.Flags().BoolVarP(&opts.Yes, "yes", "y", false, "Delete without asking for confirmation")
+	cmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, "Supress output from terminal and logs")
+
+	return cmd
+}
+
+func deleteCmd(anki *anki.Anki, opts *DeleteOptions, name string) error {
+	if !opts.Yes {
+		title := fmt.Sprintf("Delete deck %s, its subdecks and their cards?", name)
+		if opts.KeepCardsTo != "" {
+			title = fmt.Sprintf("Delete deck %s and its subdecks and move their cards to %s?", name, opts.KeepCardsTo)
+		}
+		confirm, err := prompt.NewSurveyPrompt(*anki.Config).Confirm(title)
+		if err != nil {
+			return err
+		}
+		if !confirm {
+			return nil
+		}
+	}
+
+	if err := anki.API.AutoBackup(); err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to back up collection before deleting deck")
+		return err
+	}
+	res, err := anki.API.DeleteDeck(name, opts.KeepCardsTo)
+	if err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to delete deck %s", name)
+		return err
+	}
+
+	if !opts.Quiet {
+		var buffer bytes.Buffer
+		if opts.KeepCardsTo != "" {
+			buffer.WriteString(fmt.Sprintf("Deleted %d decks and moved their cards to %s\n", res.Decks, opts.KeepCardsTo))
+		} else {
+			buffer.WriteString(fmt.Sprintf("Deleted %d decks, %d cards and %d notes\n", res.Decks, res.Cards, res.Notes))
+		}
+		buffer.WriteTo(anki.IO.Output)
+	}
+	return nil
+}
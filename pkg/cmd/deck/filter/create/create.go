@@ -0,0 +1,84 @@
+package create
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aerex/go-anki/pkg/anki"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/maps"
+)
+
+type CreateOptions struct {
+	Query      string
+	Limit      int
+	Order      string
+	Reschedule bool
+	Quiet      bool
+}
+
+func NewCreateCmd(anki *anki.Anki, cb func(*anki.Anki) error) *cobra.Command {
+	opts := &CreateOptions{}
+	orders := maps.Keys(models.FilterOrders)
+	sort.Strings(orders)
+
+	cmd := &cobra.Command{
+		Use:   "create <name> --query <query> <options>",
+		Short: "Create a filtered deck",
+		Long: `Create a filtered deck with the cards matching a search.
+
+The suspended and buried cards and the cards already in another filtered deck are
+skipped. Unless --reschedule is set, the answers given in the deck do not change
+when the cards are due.`,
+		Example:      `$ anki deck filter create Review --query "is:due tag:verbs" --limit 100 --order random --reschedule`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cb != nil {
+				return cb(anki)
+			}
+			return createCmd(anki, opts, args[0])
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Query, "query", "", "The search gathering the cards")
+	cmd.Flags().IntVar(&opts.Limit, "limit", 100, "The maximum number of cards")
+	cmd.Flags().StringVar(&opts.Order, "order", "random",
+		fmt.Sprintf("The order of the gathered cards (%s)", strings.Join(orders, ", ")))
+	cmd.Flags().BoolVar(&opts.Reschedule, "reschedule", false, "Reschedule the cards based on the answers given in this deck")
+	cmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, "Supress output from terminal and logs")
+	cmd.MarkFlagRequired("query")
+
+	return cmd
+}
+
+func createCmd(anki *anki.Anki, opts *CreateOptions, name string) error {
+	order, exists := models.FilterOrders[opts.Order]
+	if !exists {
+		return fmt.Errorf("unknown order %s", opts.Order)
+	}
+	if opts.Limit <= 0 {
+		return fmt.Errorf("the limit must be greater than 0")
+	}
+
+	if err := anki.API.AutoBackup(); err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to back up collection before creating filtered deck")
+		return err
+	}
+	terms := []models.FilterTerm{{Search: opts.Query, Limit: opts.Limit, Order: order}}
+	count, err := anki.API.CreateFilteredDeck(name, terms, opts.Reschedule)
+	if err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to create filtered deck %s", name)
+		return err
+	}
+
+	if !opts.Quiet {
+		var buffer bytes.Buffer
+		buffer.WriteString(fmt.Sprintf("Created filtered deck %s with %d cards\n", name, count))
+		buffer.WriteTo(anki.IO.Output)
+	}
+	return nil
+}
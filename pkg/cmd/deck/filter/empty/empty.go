@@ -0,0 +1,51 @@
+package empty
+
+import (
+	"bytes"
+
+	"github.com/aerex/go-anki/pkg/anki"
+	"github.com/spf13/cobra"
+)
+
+type EmptyOptions struct {
+	Quiet bool
+}
+
+func NewEmptyCmd(anki *anki.Anki, cb func(*anki.Anki) error) *cobra.Command {
+	opts := &EmptyOptions{}
+
+	cmd := &cobra.Command{
+		Use:          "empty <name> <options>",
+		Short:        "Return the cards of a filtered deck to their home deck",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cb != nil {
+				return cb(anki)
+			}
+			return emptyCmd(anki, opts, args[0])
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, "Supress output from terminal and logs")
+
+	return cmd
+}
+
+func emptyCmd(anki *anki.Anki, opts *EmptyOptions, name string) error {
+	if err := anki.API.AutoBackup(); err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to back up collection before emptying filtered deck")
+		return err
+	}
+	if err := anki.API.EmptyFilteredDeck(name); err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to empty filtered deck %s", name)
+		return err
+	}
+
+	if !opts.Quiet {
+		var buffer bytes.Buffer
+		buffer.WriteString("Emptied filtered deck " + name + "\n")
+		buffer.WriteTo(anki.IO.Output)
+	}
+	return nil
+}
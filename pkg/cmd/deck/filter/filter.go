@@ -0,0 +1,26 @@
+package filter
+
+import (
+	"github.com/aerex/go-anki/pkg/anki"
+	cmdCreate "github.com/aerex/go-anki/pkg/cmd/deck/filter/create"
+	cmdEmpty "github.com/aerex/go-anki/pkg/cmd/deck/filter/empty"
+	cmdRebuild "github.com/aerex/go-anki/pkg/cmd/deck/filter/rebuild"
+	"github.com/spf13/cobra"
+)
+
+func NewFilterCmd(anki *anki.Anki) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "filter <command>",
+		Short: "Manage filtered decks",
+		Long: `Manage filtered decks.
+
+A filtered deck temporarily gathers the cards matching a search. The cards keep
+their home deck and return to it when the filtered deck is emptied or deleted.`,
+	}
+
+	cmd.AddCommand(cmdCreate.NewCreateCmd(anki, nil))
+	cmd.AddCommand(cmdRebuild.NewRebuildCmd(anki, nil))
+	cmd.AddCommand(cmdEmpty.NewEmptyCmd(anki, nil))
+
+	return cmd
+}
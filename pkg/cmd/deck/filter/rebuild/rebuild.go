@@ -0,0 +1,55 @@
+package rebuild
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/aerex/go-anki/pkg/anki"
+	"github.com/spf13/cobra"
+)
+
+type RebuildOptions struct {
+	Quiet bool
+}
+
+func NewRebuildCmd(anki *anki.Anki, cb func(*anki.Anki) error) *cobra.Command {
+	opts := &RebuildOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "rebuild <name> <options>",
+		Short: "Gather the cards of a filtered deck again",
+		Long: `Return the cards of a filtered deck to their home deck and gather
+the cards matching its search again.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cb != nil {
+				return cb(anki)
+			}
+			return rebuildCmd(anki, opts, args[0])
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, "Supress output from terminal and logs")
+
+	return cmd
+}
+
+func rebuildCmd(anki *anki.Anki, opts *RebuildOptions, name string) error {
+	if err := anki.API.AutoBackup(); err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to back up collection before rebuilding filtered deck")
+		return err
+	}
+	count, err := anki.API.RebuildFilteredDeck(name)
+	if err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to rebuild filtered deck %s", name)
+		return err
+	}
+
+	if !opts.Quiet {
+		var buffer bytes.Buffer
+		buffer.WriteString(fmt.Sprintf("Rebuilt filtered deck %s with %d cards\n", name, count))
+		buffer.WriteTo(anki.IO.Output)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package move
+
+import (
+	"bytes"
+
+	"github.com/aerex/go-anki/pkg/anki"
+	"github.com/spf13/cobra"
+)
+
+type MoveOptions struct {
+	Under string
+	Quiet bool
+}
+
+func NewMoveCmd(anki *anki.Anki, cb func(*anki.Anki) error) *cobra.Command {
+	opts := &MoveOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "move <name> --under <parent> <options>",
+		Short: "Move a deck and its subdecks under another deck",
+		Long: `Move a deck and its subdecks under another deck.
+
+The missing parent decks are created. Use --under "" to move the deck to the top level.
+The Default deck cannot be moved.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cb != nil {
+				return cb(anki)
+			}
+			return moveCmd(anki, opts, args[0])
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Under, "under", "", "The name of the parent deck")
+	cmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, "Supress output from terminal and logs")
+	cmd.MarkFlagRequired("under")
+
+	return cmd
+}
+
+func moveCmd(anki *anki.Anki, opts *MoveOptions, name string) error {
+	if err := anki.API.AutoBackup(); err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to back up collection before moving deck")
+		return err
+	}
+
+	newName, err := anki.API.MoveDeck(name, opts.Under)
+	if err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to move deck %s", name)
+		return err
+	}
+
+	if !opts.Quiet {
+		var buffer bytes.Buffer
+		buffer.WriteString("Moved deck to " + newName + "\n")
+		buffer.WriteTo(anki.IO.Output)
+	}
+	return nil
+}
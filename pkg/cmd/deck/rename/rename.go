@@ -33,6 +33,10 @@ func NewRenameCmd(anki *anki.Anki, cb func(*anki.Anki) error) *cobra.Command {
 }
 
 func renameCmd(anki *anki.Anki, opts *RenameOptions, args []string) error {
+	if err := anki.API.AutoBackup(); err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to back up collection before renaming deck")
+		return err
+	}
 
 	err := anki.API.RenameDeck(args[0], args[1])
 	if err != nil {
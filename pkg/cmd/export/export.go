@@ -0,0 +1,70 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/aerex/go-anki/pkg/anki"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/spf13/cobra"
+)
+
+type ExportOptions struct {
+	Deck           string
+	Out            string
+	WithMedia      bool
+	WithScheduling bool
+	WithLatex      bool
+	Quiet          bool
+}
+
+func NewExportCmd(anki *anki.Anki, cb func(*anki.Anki) error) *cobra.Command {
+	opts := &ExportOptions{}
+
+	cmd := &cobra.Command{
+		Use:          "export <options>",
+		Short:        "Export a deck and its subdecks to a deck package",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cb != nil {
+				return cb(anki)
+			}
+			return exportCmd(anki, opts)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Deck, "deck", "d", "", "Name of the deck to export")
+	cmd.Flags().StringVarP(&opts.Out, "out", "o", "", "Path of the deck package (.apkg)")
+	cmd.Flags().BoolVar(&opts.WithMedia, "with-media", false, "Include the media files referenced by the notes")
+	cmd.Flags().BoolVar(&opts.WithScheduling, "with-scheduling", false, "Include the review history and due dates of the cards")
+	cmd.Flags().BoolVar(&opts.WithLatex, "with-latex", false, "Include the images of the LaTeX of the notes, rendered with latex and dvipng when missing")
+	cmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, "Supress output from terminal and logs")
+	cmd.MarkFlagRequired("deck")
+	cmd.MarkFlagRequired("out")
+
+	return cmd
+}
+
+func exportCmd(anki *anki.Anki, opts *ExportOptions) error {
+	res, err := anki.API.ExportPackage(opts.Deck, opts.Out, models.ExportOptions{
+		WithMedia:      opts.WithMedia,
+		WithScheduling: opts.WithScheduling,
+		WithLatex:      opts.WithLatex,
+	})
+	if err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to export deck %s", opts.Deck)
+		return err
+	}
+
+	if !opts.Quiet {
+		var buffer bytes.Buffer
+		buffer.WriteString(fmt.Sprintf("Exported %d notes and %d cards", res.Notes, res.Cards))
+		if opts.WithMedia || opts.WithLatex {
+			buffer.WriteString(fmt.Sprintf(" with %d media files", res.Media))
+		}
+		buffer.WriteString(" to " + opts.Out + "\n")
+		buffer.WriteTo(anki.IO.Output)
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package fsrs
+
+import (
+	"github.com/aerex/go-anki/pkg/anki"
+	cmdOptimize "github.com/aerex/go-anki/pkg/cmd/fsrs/optimize"
+	"github.com/spf13/cobra"
+)
+
+func NewFSRSCmd(anki *anki.Anki) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "fsrs <command>",
+		Short: "Manage the Free Spaced Repetition Scheduler",
+	}
+
+	cmd.AddCommand(cmdOptimize.NewOptimizeCmd(anki, nil))
+
+	return cmd
+}
@@ -0,0 +1,71 @@
+package optimize
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/aerex/go-anki/pkg/anki"
+	"github.com/spf13/cobra"
+)
+
+type OptimizeOptions struct {
+	Deck  string
+	Quiet bool
+}
+
+func NewOptimizeCmd(anki *anki.Anki, cb func(*anki.Anki) error) *cobra.Command {
+	opts := &OptimizeOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "optimize <options>",
+		Short: "Fit the parameters of FSRS to the review history",
+		Long: `Fit the parameters of FSRS to the review history and save them in the deck options.
+
+With --deck the reviews of the deck and its subdecks are used and the parameters are
+saved in the options of the deck. Otherwise the reviews of the collection are used and
+the parameters are saved in all the deck options. The parameters are used when studying
+with sched = 3 and fsrs = true in the config.`,
+		Example: `$ anki fsrs optimize
+$ anki fsrs optimize --deck Japanese`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cb != nil {
+				return cb(anki)
+			}
+			return optimizeCmd(anki, opts)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Deck, "deck", "d", "", "Fit the parameters to the reviews of the deck and its subdecks")
+	cmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, "Supress output from terminal and logs")
+
+	return cmd
+}
+
+func optimizeCmd(anki *anki.Anki, opts *OptimizeOptions) error {
+	if err := anki.API.AutoBackup(); err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to back up collection before optimizing FSRS")
+		return err
+	}
+	optimization, err := anki.API.OptimizeFSRS(opts.Deck)
+	if err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to optimize the parameters of FSRS")
+		return err
+	}
+
+	if !opts.Quiet {
+		var buffer bytes.Buffer
+		params := make([]string, len(optimization.Parameters))
+		for i, param := range optimization.Parameters {
+			params[i] = fmt.Sprintf("%.4f", param)
+		}
+		buffer.WriteString(fmt.Sprintf("Fitted the parameters to %d reviews\n", optimization.Reviews))
+		buffer.WriteString(fmt.Sprintf("Log loss: %.4f (default %.4f)\n", optimization.Loss, optimization.DefaultLoss))
+		buffer.WriteString("Parameters: " + strings.Join(params, ", ") + "\n")
+		buffer.WriteString("Saved in the options: " + strings.Join(optimization.Configs, ", ") + "\n")
+		buffer.WriteTo(anki.IO.Output)
+	}
+	return nil
+}
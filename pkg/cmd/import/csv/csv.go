@@ -0,0 +1,209 @@
+package csv
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aerex/go-anki/pkg/anki"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/aerex/go-anki/pkg/textimport"
+	"github.com/spf13/cobra"
+)
+
+type CSVOptions struct {
+	Type       string
+	Deck       string
+	Map        string
+	TagsColumn int
+	Duplicates string
+	Quiet      bool
+}
+
+func NewCSVCmd(anki *anki.Anki, cb func(*anki.Anki) error) *cobra.Command {
+	opts := &CSVOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "csv <file> <options>",
+		Short: "Import notes from a csv or tsv file",
+		Long: `Import notes from a delimited text file. Use "-" to read from stdin.
+
+The delimiter is detected from the first row unless the file sets it with a #separator: header.
+The #html:, #tags:, #columns:, #notetype:, #deck:, #notetype column:, #deck column: and
+#tags column: headers are supported like in the anki desktop importer.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cb != nil {
+				return cb(anki)
+			}
+			return csvCmd(anki, opts, args[0])
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Type, "type", "T", "", "The note type of the notes")
+	cmd.Flags().StringVarP(&opts.Deck, "deck", "d", "", "The name of the deck the cards are added to")
+	cmd.Flags().StringVarP(&opts.Map, "map", "m", "", "Map the note fields to columns starting at 1 (ie: \"Front=1,Back=2\")")
+	cmd.Flags().IntVar(&opts.TagsColumn, "tags-column", 0, "The column holding the space separated tags of the notes")
+	cmd.Flags().StringVar(&opts.Duplicates, "duplicates", string(models.DuplicateSkip),
+		"What to do when a note with the same first field exists: skip, update or duplicate")
+	cmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, "Supress output from terminal and logs")
+
+	return cmd
+}
+
+func csvCmd(anki *anki.Anki, opts *CSVOptions, path string) error {
+	mode := models.DuplicateMode(opts.Duplicates)
+	switch mode {
+	case models.DuplicateSkip, models.DuplicateUpdate, models.DuplicateAllow:
+	default:
+		return fmt.Errorf("invalid --duplicates %s: expected skip, update or duplicate", opts.Duplicates)
+	}
+
+	file, err := parseFile(anki, path)
+	if err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to read %s", path)
+		return err
+	}
+	if opts.TagsColumn != 0 {
+		file.TagsColumn = opts.TagsColumn
+	}
+	if opts.Type == "" && file.NoteType == "" && file.NoteTypeColumn == 0 {
+		return fmt.Errorf("the note type is required: use --type or a #notetype: header")
+	}
+
+	rows, err := noteRows(anki, opts, file)
+	if err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to map the columns of %s", path)
+		return err
+	}
+
+	if err = anki.API.AutoBackup(); err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to back up collection before importing %s", path)
+		return err
+	}
+	results, err := anki.API.ImportNotes(rows, mode)
+	if err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to import %s", path)
+		return err
+	}
+
+	if !opts.Quiet {
+		var buffer bytes.Buffer
+		counts := make(map[models.NoteRowStatus]int)
+		for _, res := range results {
+			counts[res.Status]++
+			buffer.WriteString(rowReport(res) + "\n")
+		}
+		buffer.WriteString(fmt.Sprintf("Added %d notes, updated %d, skipped %d, failed %d\n",
+			counts[models.NoteRowAdded]+counts[models.NoteRowDuplicate], counts[models.NoteRowUpdated],
+			counts[models.NoteRowSkipped], counts[models.NoteRowFailed]))
+		buffer.WriteTo(anki.IO.Output)
+	}
+	return nil
+}
+
+func parseFile(anki *anki.Anki, path string) (*textimport.File, error) {
+	var in io.Reader = anki.IO.Input
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		in = f
+	}
+	return textimport.Parse(in)
+}
+
+// noteRows maps the columns of the rows to the fields of their note type
+func noteRows(anki *anki.Anki, opts *CSVOptions, file *textimport.File) ([]models.NoteRow, error) {
+	var mapping map[string]int
+	var err error
+	if opts.Map != "" {
+		if mapping, err = textimport.ParseMapping(opts.Map); err != nil {
+			return nil, err
+		}
+	}
+	noteTypes, err := anki.API.NoteTypes()
+	if err != nil {
+		return nil, err
+	}
+	fieldNames := make(map[string][]string)
+	for _, noteType := range noteTypes {
+		for _, field := range noteType.Fields {
+			fieldNames[noteType.Name] = append(fieldNames[noteType.Name], field.Name)
+		}
+	}
+
+	rows := make([]models.NoteRow, len(file.Rows))
+	for idx, row := range file.Rows {
+		noteRow := models.NoteRow{
+			Line:     row.Line,
+			NoteType: firstOf(row.Column(file.NoteTypeColumn), opts.Type, file.NoteType),
+			Deck:     firstOf(row.Column(file.DeckColumn), opts.Deck, file.Deck, "Default"),
+			Fields:   make(map[string]string),
+			Tags:     append(append([]string{}, file.Tags...), strings.Fields(row.Column(file.TagsColumn))...),
+		}
+		// the rows may hold different note types when the file has a note type column
+		rowMapping := mapping
+		if rowMapping == nil {
+			rowMapping = defaultMapping(file, fieldNames[noteRow.NoteType], len(row.Columns))
+		}
+		for name, col := range rowMapping {
+			noteRow.Fields[name] = file.Field(row.Column(col))
+		}
+		rows[idx] = noteRow
+	}
+	return rows, nil
+}
+
+// defaultMapping maps the fields to the columns with the same name set by the #columns header
+// or otherwise maps the fields in order to the columns that are not holding the note type, deck or tags
+func defaultMapping(file *textimport.File, fields []string, columns int) map[string]int {
+	mapping := make(map[string]int)
+	if len(file.Columns) > 0 {
+		for idx, name := range file.Columns {
+			for _, field := range fields {
+				if strings.EqualFold(name, field) && !file.IsSpecial(idx+1) {
+					mapping[field] = idx + 1
+				}
+			}
+		}
+		return mapping
+	}
+	next := 0
+	for col := 1; col <= columns && next < len(fields); col++ {
+		if file.IsSpecial(col) {
+			continue
+		}
+		mapping[fields[next]] = col
+		next++
+	}
+	return mapping
+}
+
+func rowReport(res models.NoteRowResult) string {
+	switch res.Status {
+	case models.NoteRowAdded:
+		return fmt.Sprintf("line %d: added note %d with %d cards", res.Line, res.NoteID, res.Cards)
+	case models.NoteRowDuplicate:
+		return fmt.Sprintf("line %d: added duplicate note %d with %d cards", res.Line, res.NoteID, res.Cards)
+	case models.NoteRowUpdated:
+		return fmt.Sprintf("line %d: updated note %d", res.Line, res.NoteID)
+	case models.NoteRowSkipped:
+		return fmt.Sprintf("line %d: skipped, %s (note %d)", res.Line, res.Reason, res.NoteID)
+	}
+	return fmt.Sprintf("line %d: failed, %s", res.Line, res.Reason)
+}
+
+func firstOf(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
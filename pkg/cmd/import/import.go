@@ -0,0 +1,65 @@
+package imports
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/aerex/go-anki/pkg/anki"
+	cmdCSV "github.com/aerex/go-anki/pkg/cmd/import/csv"
+	"github.com/spf13/cobra"
+)
+
+type ImportOptions struct {
+	Quiet bool
+}
+
+func NewImportCmd(anki *anki.Anki, cb func(*anki.Anki) error) *cobra.Command {
+	opts := &ImportOptions{}
+
+	cmd := &cobra.Command{
+		Use:          "import <file.apkg> <options>",
+		Short:        "Import the notes, cards and media of a deck package",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cb != nil {
+				return cb(anki)
+			}
+			return importCmd(anki, opts, args[0])
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, "Supress output from terminal and logs")
+
+	cmd.AddCommand(cmdCSV.NewCSVCmd(anki, nil))
+
+	return cmd
+}
+
+func importCmd(anki *anki.Anki, opts *ImportOptions, path string) error {
+	if err := anki.API.AutoBackup(); err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to back up collection before importing %s", path)
+		return err
+	}
+	res, err := anki.API.ImportPackage(path)
+	if err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to import %s", path)
+		return err
+	}
+
+	if !opts.Quiet {
+		var buffer bytes.Buffer
+		buffer.WriteString(fmt.Sprintf("Imported %d notes and %d cards from %s\n", res.Notes, res.Cards, path))
+		if res.Updated > 0 {
+			buffer.WriteString(fmt.Sprintf("Updated %d existing notes\n", res.Updated))
+		}
+		if res.Duplicates > 0 {
+			buffer.WriteString(fmt.Sprintf("Skipped %d notes already in the collection\n", res.Duplicates))
+		}
+		if res.Media > 0 {
+			buffer.WriteString(fmt.Sprintf("Added %d media files\n", res.Media))
+		}
+		buffer.WriteTo(anki.IO.Output)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package add
+
+import (
+	"bytes"
+
+	"github.com/aerex/go-anki/pkg/anki"
+	"github.com/spf13/cobra"
+)
+
+type AddOptions struct {
+	Quiet bool
+}
+
+func NewAddCmd(anki *anki.Anki, cb func(*anki.Anki) error) *cobra.Command {
+	opts := &AddOptions{}
+
+	cmd := &cobra.Command{
+		Use:          "add <file>... <options>",
+		Short:        "Copy files into the media folder",
+		Args:         cobra.MinimumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cb != nil {
+				return cb(anki)
+			}
+			return addCmd(anki, opts, args)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, "Supress output from terminal and logs")
+
+	return cmd
+}
+
+func addCmd(anki *anki.Anki, opts *AddOptions, args []string) error {
+	var buffer bytes.Buffer
+	for _, path := range args {
+		name, err := anki.API.AddMedia(path)
+		if err != nil {
+			anki.IO.Log.Err(err).Msgf("failed to add %s to media folder", path)
+			return err
+		}
+		// the name may differ from the file when another file with the same name exists
+		buffer.WriteString("Added " + name + "\n")
+	}
+	if !opts.Quiet {
+		buffer.WriteTo(anki.IO.Output)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package check
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/aerex/go-anki/pkg/anki"
+	"github.com/spf13/cobra"
+)
+
+type CheckOptions struct {
+	Quiet bool
+}
+
+func NewCheckCmd(anki *anki.Anki, cb func(*anki.Anki) error) *cobra.Command {
+	opts := &CheckOptions{}
+
+	cmd := &cobra.Command{
+		Use:          "check <options>",
+		Short:        "Find media missing from the media folder and media not used by any note",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cb != nil {
+				return cb(anki)
+			}
+			return checkCmd(anki, opts)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, "Supress output from terminal and logs")
+
+	return cmd
+}
+
+func checkCmd(anki *anki.Anki, opts *CheckOptions) error {
+	check, err := anki.API.CheckMedia()
+	if err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to check media")
+		return err
+	}
+	if opts.Quiet {
+		return nil
+	}
+
+	var buffer bytes.Buffer
+	if len(check.Missing) == 0 && len(check.Unused) == 0 {
+		buffer.WriteString("No missing or unused media\n")
+	}
+	if len(check.Missing) > 0 {
+		buffer.WriteString(fmt.Sprintf("Missing media referenced by notes (%d):\n", len(check.Missing)))
+		for _, name := range check.Missing {
+			buffer.WriteString("  " + name + "\n")
+		}
+	}
+	if len(check.Unused) > 0 {
+		buffer.WriteString(fmt.Sprintf("Media not used by any note (%d):\n", len(check.Unused)))
+		for _, name := range check.Unused {
+			buffer.WriteString("  " + name + "\n")
+		}
+	}
+	buffer.WriteTo(anki.IO.Output)
+	return nil
+}
@@ -0,0 +1,59 @@
+package list
+
+import (
+	"github.com/aerex/go-anki/pkg/anki"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/aerex/go-anki/pkg/template"
+	"github.com/spf13/cobra"
+)
+
+type ListOptions struct {
+	Template string
+}
+
+func NewListCmd(anki *anki.Anki, cb func(*ListOptions) error) *cobra.Command {
+	opts := &ListOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "list <options>",
+		Short: "List the files in the media folder",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cb != nil {
+				return cb(opts)
+			}
+			return listCmd(anki, opts)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Template, "template", "t", "", "Override template for output")
+
+	return cmd
+}
+
+func listCmd(anki *anki.Anki, opts *ListOptions) error {
+	tmpl := template.LIST_MEDIA
+	if opts.Template != "" {
+		tmpl = opts.Template
+	}
+	if err := anki.Templates.Load(tmpl); err != nil {
+		return err
+	}
+
+	files, err := anki.API.MediaFiles()
+	if err != nil {
+		return err
+	}
+
+	data := struct {
+		Data []models.MediaFile
+	}{
+		Data: files,
+	}
+
+	if err := anki.Templates.Execute(data, anki.IO); err != nil {
+		return err
+	}
+
+	return nil
+}
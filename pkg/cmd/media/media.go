@@ -0,0 +1,24 @@
+package media
+
+import (
+	"github.com/aerex/go-anki/pkg/anki"
+	cmdAdd "github.com/aerex/go-anki/pkg/cmd/media/add"
+	cmdCheck "github.com/aerex/go-anki/pkg/cmd/media/check"
+	cmdList "github.com/aerex/go-anki/pkg/cmd/media/list"
+	cmdRemove "github.com/aerex/go-anki/pkg/cmd/media/remove"
+	"github.com/spf13/cobra"
+)
+
+func NewMediaCmd(anki *anki.Anki) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "media <command>",
+		Short: "Manage the media files referenced by notes",
+	}
+
+	cmd.AddCommand(cmdList.NewListCmd(anki, nil))
+	cmd.AddCommand(cmdCheck.NewCheckCmd(anki, nil))
+	cmd.AddCommand(cmdAdd.NewAddCmd(anki, nil))
+	cmd.AddCommand(cmdRemove.NewRemoveCmd(anki, nil))
+
+	return cmd
+}
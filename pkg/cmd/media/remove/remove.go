@@ -0,0 +1,48 @@
+package remove
+
+import (
+	"bytes"
+
+	"github.com/aerex/go-anki/pkg/anki"
+	"github.com/spf13/cobra"
+)
+
+type RemoveOptions struct {
+	Quiet bool
+}
+
+func NewRemoveCmd(anki *anki.Anki, cb func(*anki.Anki) error) *cobra.Command {
+	opts := &RemoveOptions{}
+
+	cmd := &cobra.Command{
+		Use:          "remove <name>... <options>",
+		Short:        "Delete files from the media folder",
+		Args:         cobra.MinimumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cb != nil {
+				return cb(anki)
+			}
+			return removeCmd(anki, opts, args)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, "Supress output from terminal and logs")
+
+	return cmd
+}
+
+func removeCmd(anki *anki.Anki, opts *RemoveOptions, args []string) error {
+	var buffer bytes.Buffer
+	for _, name := range args {
+		if err := anki.API.RemoveMedia(name); err != nil {
+			anki.IO.Log.Err(err).Msgf("failed to remove %s from media folder", name)
+			return err
+		}
+		buffer.WriteString("Removed " + name + "\n")
+	}
+	if !opts.Quiet {
+		buffer.WriteTo(anki.IO.Output)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package delete
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/aerex/go-anki/pkg/anki"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/aerex/go-anki/pkg/ui/prompt"
+	"github.com/spf13/cobra"
+)
+
+type DeleteOptions struct {
+	Yes   bool
+	Quiet bool
+}
+
+func NewDeleteCmd(anki *anki.Anki, cb func(*anki.Anki) error) *cobra.Command {
+	opts := &DeleteOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "delete <query> <options>",
+		Short: "Delete the notes of the cards matching a search query",
+		Long: `Delete the notes of the cards matching a search query with all their cards,
+see https://docs.ankiweb.net/searching.html
+
+The deletions are sent to the sync server on the next sync.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cb != nil {
+				return cb(anki)
+			}
+			return deleteCmd(anki, opts, args[0])
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.Yes, "yes", "y", false, "Delete without asking for confirmation")
+	cmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, "Supress output from terminal and logs")
+
+	return cmd
+}
+
+func deleteCmd(anki *anki.Anki, opts *DeleteOptions, query string) error {
+	cards, err := anki.API.Cards(query, -1)
+	if err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to find the cards of %s", query)
+		return err
+	}
+	var ids []models.ID
+	seen := make(map[models.ID]bool)
+	for _, card := range cards {
+		if !seen[card.NoteID] {
+			seen[card.NoteID] = true
+			ids = append(ids, card.NoteID)
+		}
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("no note found for %s", query)
+	}
+	if !opts.Yes {
+		confirm, err := prompt.NewSurveyPrompt(*anki.Config).Confirm(fmt.Sprintf("Delete %d notes and their cards?", len(ids)))
+		if err != nil {
+			return err
+		}
+		if !confirm {
+			return nil
+		}
+	}
+
+	if err = anki.API.AutoBackup(); err != nil {
+		anki.IO.Log.Err(err).Msg("failed to back up collection before deleting notes")
+		return err
+	}
+	res, err := anki.API.DeleteNotes(ids)
+	if err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to delete the notes of %s", query)
+		return err
+	}
+
+	if !opts.Quiet {
+		var buffer bytes.Buffer
+		buffer.WriteString(fmt.Sprintf("Deleted %d notes and %d cards\n", res.Notes, res.Cards))
+		buffer.WriteTo(anki.IO.Output)
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package notes
+
+import (
+	"github.com/aerex/go-anki/pkg/anki"
+	cmdDelete "github.com/aerex/go-anki/pkg/cmd/notes/delete"
+	cmdSyncDir "github.com/aerex/go-anki/pkg/cmd/notes/syncdir"
+	"github.com/spf13/cobra"
+)
+
+func NewNotesCmd(anki *anki.Anki) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "notes <command>",
+		Short:   "Manage notes",
+		Aliases: []string{"note"},
+	}
+
+	cmd.AddCommand(cmdSyncDir.NewSyncDirCmd(anki, nil))
+	cmd.AddCommand(cmdDelete.NewDeleteCmd(anki, nil))
+
+	return cmd
+}
@@ -0,0 +1,159 @@
+package syncdir
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/aerex/go-anki/pkg/anki"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/aerex/go-anki/pkg/notesdir"
+	"github.com/spf13/cobra"
+)
+
+type SyncDirOptions struct {
+	Type  string
+	Deck  string
+	Prune bool
+	Quiet bool
+}
+
+func NewSyncDirCmd(anki *anki.Anki, cb func(*anki.Anki) error) *cobra.Command {
+	opts := &SyncDirOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "sync-dir <dir> <options>",
+		Short: "Create or update the notes written in the Markdown and Org files of a directory",
+		Long: `Create or update the notes written in the Markdown (.md) and Org (.org) files of a directory.
+
+Each file holds a note. The type, deck and tags of the note are set in the front matter
+of a Markdown file (or the #+TYPE:, #+DECK: and #+TAGS: keywords of an Org file) and each
+first level heading starts a field named after the heading.
+
+The id of the created notes is written back to the files so the next syncs update the notes.
+The deck of a note is only used when the note is created.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cb != nil {
+				return cb(anki)
+			}
+			return syncDirCmd(anki, opts, args[0])
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Type, "type", "T", "", "The note type of the files that do not set one")
+	cmd.Flags().StringVarP(&opts.Deck, "deck", "d", "", "The deck of the files that do not set one")
+	cmd.Flags().BoolVar(&opts.Prune, "prune", false, "Delete the notes whose files were deleted")
+	cmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, "Supress output from terminal and logs")
+
+	return cmd
+}
+
+func syncDirCmd(anki *anki.Anki, opts *SyncDirOptions, dir string) error {
+	notes, err := notesdir.Scan(dir)
+	if err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to read the notes of %s", dir)
+		return err
+	}
+	manifest, err := notesdir.LoadManifest(dir)
+	if err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to read the notes synced from %s", dir)
+		return err
+	}
+
+	paths := make(map[string]string)
+	rows := make([]models.NoteRow, len(notes))
+	for idx, note := range notes {
+		if note.GUID != "" {
+			if path, exists := paths[note.GUID]; exists {
+				return fmt.Errorf("%s and %s have the same guid %s", path, note.Path, note.GUID)
+			}
+			paths[note.GUID] = note.Path
+		}
+		row := models.NoteRow{
+			Line:     idx + 1,
+			NoteType: firstOf(note.Type, opts.Type),
+			Deck:     firstOf(note.Deck, opts.Deck, "Default"),
+			Fields:   make(map[string]string),
+			Tags:     note.Tags,
+			GUID:     note.GUID,
+		}
+		if row.NoteType == "" {
+			return fmt.Errorf("%s: the note type is required: set type in the file or use --type", note.Path)
+		}
+		for _, field := range note.Fields {
+			row.Fields[field.Name] = field.Value
+		}
+		rows[idx] = row
+	}
+	var removed []string
+	if opts.Prune {
+		removed = manifest.Removed(notes)
+	}
+
+	if err = anki.API.AutoBackup(); err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to back up collection before syncing %s", dir)
+		return err
+	}
+	results, err := anki.API.SyncNotes(rows, removed)
+	if err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to sync the notes of %s", dir)
+		return err
+	}
+
+	var buffer bytes.Buffer
+	for _, res := range results {
+		if res.Status == models.NoteRowRemoved {
+			buffer.WriteString(fmt.Sprintf("%s: removed note %d\n", manifest.Notes[res.GUID], res.NoteID))
+			delete(manifest.Notes, res.GUID)
+			continue
+		}
+		note := notes[res.Line-1]
+		buffer.WriteString(note.Path + ": " + report(res) + "\n")
+		if res.GUID == "" {
+			continue
+		}
+		if note.GUID != res.GUID {
+			if err := notesdir.SetGUID(dir, note.Path, res.GUID); err != nil {
+				anki.IO.Log.Err(err).Msgf("failed to write the guid of note %d to %s", res.NoteID, note.Path)
+				return err
+			}
+		}
+		manifest.Notes[res.GUID] = note.Path
+	}
+	if opts.Prune {
+		// the notes that were already deleted from the collection
+		for _, guid := range removed {
+			delete(manifest.Notes, guid)
+		}
+	}
+	if err := manifest.Save(dir); err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to save the notes synced from %s", dir)
+		return err
+	}
+	if !opts.Quiet {
+		buffer.WriteTo(anki.IO.Output)
+	}
+	return nil
+}
+
+func report(res models.NoteRowResult) string {
+	switch res.Status {
+	case models.NoteRowAdded, models.NoteRowDuplicate:
+		return fmt.Sprintf("added note %d with %d cards", res.NoteID, res.Cards)
+	case models.NoteRowUpdated:
+		return fmt.Sprintf("updated note %d", res.NoteID)
+	case models.NoteRowSkipped:
+		return fmt.Sprintf("note %d is up to date", res.NoteID)
+	}
+	return "failed, " + res.Reason
+}
+
+func firstOf(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,127 @@
+package custom
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/aerex/go-anki/pkg/anki"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type CustomOptions struct {
+	ExtendNew      int
+	ExtendReview   int
+	ForgottenDays  int
+	ReviewAhead    int
+	PreviewNewDays int
+	TagFilter      string
+	CardState      string
+	Limit          int
+	Quiet          bool
+}
+
+var studyFlags = []string{"extend-new", "extend-review", "forgotten-days", "review-ahead", "preview-new-days", "tag-filter"}
+
+func NewCustomCmd(anki *anki.Anki, cb func(*anki.Anki) error) *cobra.Command {
+	opts := &CustomOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "custom <deck_name> <option>",
+		Short: "Study a deck beyond its daily limits",
+		Long: `Study a deck beyond its daily limits like the Custom Study of Anki.
+
+--extend-new and --extend-review increase the limits of today of the deck, its parents
+and its subdecks. The other options gather the cards in the "Custom Study Session"
+filtered deck which replaces the previous session and becomes the current deck.
+Only the answers given while reviewing ahead or studying by tags reschedule the cards,
+except when all the cards are studied by tags.`,
+		Example: `$ anki study custom Japanese --extend-new 20
+$ anki study custom Japanese --forgotten-days 3
+$ anki study custom Japanese --tag-filter "verbs -hard" --card-state due --limit 50`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cb != nil {
+				return cb(anki)
+			}
+			return customCmd(anki, opts, cmd.Flags(), args[0])
+		},
+	}
+
+	cmd.Flags().IntVar(&opts.ExtendNew, "extend-new", 0, "Increase today's limit of new cards")
+	cmd.Flags().IntVar(&opts.ExtendReview, "extend-review", 0, "Increase today's limit of reviews")
+	cmd.Flags().IntVar(&opts.ForgottenDays, "forgotten-days", 0, "Review the cards forgotten in the last days")
+	cmd.Flags().IntVar(&opts.ReviewAhead, "review-ahead", 0, "Review the cards due in the next days")
+	cmd.Flags().IntVar(&opts.PreviewNewDays, "preview-new-days", 0, "Preview the new cards added in the last days")
+	cmd.Flags().StringVar(&opts.TagFilter, "tag-filter", "", "Study the cards with these tags. The tags starting with - are excluded")
+	cmd.Flags().StringVar(&opts.CardState, "card-state", "all", "The state of the cards studied by tags (new, due, review, all)")
+	cmd.Flags().IntVar(&opts.Limit, "limit", 100, "The maximum number of cards studied by tags")
+	cmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, "Supress output from terminal and logs")
+	cmd.MarkFlagsMutuallyExclusive(studyFlags...)
+	cmd.MarkFlagsOneRequired(studyFlags...)
+
+	return cmd
+}
+
+func customCmd(anki *anki.Anki, opts *CustomOptions, flags *pflag.FlagSet, deckName string) error {
+	study, err := customStudy(opts, flags)
+	if err != nil {
+		return err
+	}
+
+	if err := anki.API.AutoBackup(); err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to back up collection before custom study of deck %s", deckName)
+		return err
+	}
+	count, err := anki.API.CustomStudy(deckName, study)
+	if err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to start custom study of deck %s", deckName)
+		return err
+	}
+
+	if !opts.Quiet {
+		var buffer bytes.Buffer
+		switch study.Type {
+		case models.CustomStudyExtendNew:
+			buffer.WriteString(fmt.Sprintf("Added %d new cards to today's limit of %s\n", study.Value, deckName))
+		case models.CustomStudyExtendReview:
+			buffer.WriteString(fmt.Sprintf("Added %d reviews to today's limit of %s\n", study.Value, deckName))
+		default:
+			buffer.WriteString(fmt.Sprintf("Gathered %d cards in Custom Study Session\n", count))
+		}
+		buffer.WriteTo(anki.IO.Output)
+	}
+	return nil
+}
+
+// customStudy returns the custom study of the option set by the user.
+// The option is found from the flag set on the command line and not from its value
+// so that a value of 0 is rejected instead of studying by tags
+func customStudy(opts *CustomOptions, flags *pflag.FlagSet) (study models.CustomStudy, err error) {
+	switch {
+	case flags.Changed("extend-new"):
+		study = models.CustomStudy{Type: models.CustomStudyExtendNew, Value: opts.ExtendNew}
+	case flags.Changed("extend-review"):
+		study = models.CustomStudy{Type: models.CustomStudyExtendReview, Value: opts.ExtendReview}
+	case flags.Changed("forgotten-days"):
+		study = models.CustomStudy{Type: models.CustomStudyForgotten, Value: opts.ForgottenDays}
+	case flags.Changed("review-ahead"):
+		study = models.CustomStudy{Type: models.CustomStudyReviewAhead, Value: opts.ReviewAhead}
+	case flags.Changed("preview-new-days"):
+		study = models.CustomStudy{Type: models.CustomStudyPreviewNew, Value: opts.PreviewNewDays}
+	default:
+		study = models.CustomStudy{
+			Type:      models.CustomStudyTags,
+			Tags:      strings.Fields(opts.TagFilter),
+			CardState: opts.CardState,
+			Limit:     opts.Limit,
+		}
+	}
+	if study.Type != models.CustomStudyTags && study.Value <= 0 {
+		return study, fmt.Errorf("the value must be greater than 0")
+	}
+	return
+}
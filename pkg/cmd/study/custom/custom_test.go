@@ -0,0 +1,73 @@
+package custom
+
+import (
+	"testing"
+
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCustomStudy(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		study models.CustomStudy
+		err   string
+	}{
+		{
+			name:  "extend new",
+			args:  []string{"--extend-new", "20"},
+			study: models.CustomStudy{Type: models.CustomStudyExtendNew, Value: 20},
+		},
+		{
+			name: "forgotten days of 0",
+			args: []string{"--forgotten-days", "0"},
+			err:  "the value must be greater than 0",
+		},
+		{
+			name: "review ahead of 0",
+			args: []string{"--review-ahead", "0"},
+			err:  "the value must be greater than 0",
+		},
+		{
+			name: "extend new of 0",
+			args: []string{"--extend-new", "0"},
+			err:  "the value must be greater than 0",
+		},
+		{
+			name: "tag filter",
+			args: []string{"--tag-filter", "verbs -hard", "--card-state", "due"},
+			study: models.CustomStudy{
+				Type:      models.CustomStudyTags,
+				Tags:      []string{"verbs", "-hard"},
+				CardState: "due",
+				Limit:     100,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &CustomOptions{}
+			flags := pflag.NewFlagSet("custom", pflag.ContinueOnError)
+			flags.IntVar(&opts.ExtendNew, "extend-new", 0, "")
+			flags.IntVar(&opts.ExtendReview, "extend-review", 0, "")
+			flags.IntVar(&opts.ForgottenDays, "forgotten-days", 0, "")
+			flags.IntVar(&opts.ReviewAhead, "review-ahead", 0, "")
+			flags.IntVar(&opts.PreviewNewDays, "preview-new-days", 0, "")
+			flags.StringVar(&opts.TagFilter, "tag-filter", "", "")
+			flags.StringVar(&opts.CardState, "card-state", "all", "")
+			flags.IntVar(&opts.Limit, "limit", 100, "")
+			assert.NoError(t, flags.Parse(tt.args))
+
+			study, err := customStudy(opts, flags)
+
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.study, study)
+		})
+	}
+}
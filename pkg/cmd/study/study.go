@@ -1,7 +1,12 @@
 package study
 
 import (
+	"context"
+
 	"github.com/aerex/go-anki/pkg/anki"
+	"github.com/aerex/go-anki/pkg/cmd/card/edit"
+	cmdCustom "github.com/aerex/go-anki/pkg/cmd/study/custom"
+	"github.com/aerex/go-anki/pkg/media"
 	"github.com/aerex/go-anki/pkg/models"
 	"github.com/aerex/go-anki/pkg/template"
 	"github.com/spf13/cobra"
@@ -12,40 +17,43 @@ func NewStudyCmd(anki *anki.Anki) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "study <deck_name>",
 		Short: "Study a deck",
-		Args:  cobra.ExactArgs(1),
+		Long: `Study the cards of a deck and its subdecks due today.
+
+The cards are given one at a time in the order of the Anki scheduler within the daily
+limits of the deck: the learning cards first, the new cards spread among the reviews
+and the learning cards due soon at the end.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
 
 			return run(anki, args)
 		},
 	}
+
+	cmd.AddCommand(cmdCustom.NewCustomCmd(anki, nil))
 	return cmd
 }
 
 func run(anki *anki.Anki, args []string) error {
 	deckName := args[0]
-	var studyDeck models.Deck
-	cards, err := anki.API.Cards("deck:"+args[0], -1)
-	if err != nil {
-		anki.IO.Log.Err(err).Msgf("failed to find cards for deck %s", deckName)
+
+	if err := anki.API.AutoBackup(); err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to back up collection before studying deck %s", deckName)
 		return err
 	}
-	if len(cards) == 0 {
-		anki.IO.Log.Info().Msgf("no cards to study for deck %s", deckName)
-		return nil
-	} else {
-		// TODO: add the ability to select from decks that share the same name
-		studyDeck = cards[0].Deck
-	}
 
-	if err != nil {
-		anki.IO.Log.Err(err).Msgf("failed to list cards for deck %s", deckName)
+	if err := anki.API.StudyReview(anki.Log, deckName, renderCard(anki), editNote(anki), studyMedia(anki)); err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to study deck %s", deckName)
 		return err
 	}
 
-	cardQAs := make([]*models.CardQA, len(cards))
-	var cardTmpl models.CardTemplate
+	return nil
+}
 
-	for idx, card := range cards {
+// renderCard returns the func rendering the question and answer of the cards given by the scheduler
+func renderCard(anki *anki.Anki) func(models.Card) (models.CardQA, error) {
+	return func(card models.Card) (models.CardQA, error) {
+		var cardTmpl models.CardTemplate
 		if card.Note.Model.Type == models.ClozeCardType {
 			cardTmpl = *card.Note.Model.Templates[0]
 		} else {
@@ -56,29 +64,37 @@ func run(anki *anki.Anki, args []string) error {
 				}
 			}
 		}
+		return template.RenderCard(anki.Config, card, cardTmpl, template.RENDER_STUDY)
+	}
+}
 
-		defer template.RecoverRender(cardTmpl, idx+1)
-		cardQA, err := template.RenderCard(anki.Config, card, cardTmpl)
-		if err != nil {
-			return err
+// editNote returns the func opening the note or the tags of the card being studied in the editor
+func editNote(anki *anki.Anki) models.EditNoteFunc {
+	return func(card models.Card, tagsOnly bool) (map[string]string, []string, bool, error) {
+		if tagsOnly {
+			if err := anki.Templates.Load(template.EDIT_TAGS); err != nil {
+				return nil, nil, false, err
+			}
+			return edit.EditTags(anki, card)
 		}
-		cardQAs[idx] = &cardQA
+		if err := anki.Templates.Load(template.EDIT_NOTE); err != nil {
+			return nil, nil, false, err
+		}
+		return edit.EditNote(anki, card)
 	}
+}
 
-	stats, err := anki.API.DeckStudyStats()
-	if err != nil {
-		return err
+// studyMedia returns where the media of the cards being studied are found and how their sounds are played
+func studyMedia(anki *anki.Anki) models.StudyMedia {
+	player := anki.Config.Study.Player
+	if player == "" {
+		player = media.DefaultPlayer()
 	}
-
-	if err := anki.API.StudyReview(anki.Log, studyDeck.Name, cardQAs, stats[studyDeck.ID]); err != nil {
-		return err
+	return models.StudyMedia{
+		Dir:    media.Dir(anki.Config.DB.File),
+		Images: anki.Config.Study.Images,
+		Play: func(ctx context.Context, path string) error {
+			return media.Play(ctx, anki.IO, player, path)
+		},
 	}
-
-	// Create terminal app
-	// For each card in deck
-	// Fill terminal app with
-	// -- card template
-	// -- show answer button
-
-	return nil
 }
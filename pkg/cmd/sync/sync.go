@@ -0,0 +1,120 @@
+package sync
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/aerex/go-anki/pkg/anki"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/spf13/cobra"
+)
+
+type SyncOptions struct {
+	Quiet        bool
+	FullUpload   bool
+	FullDownload bool
+	NoMedia      bool
+}
+
+func NewSyncCmd(anki *anki.Anki, cb func(*anki.Anki) error) *cobra.Command {
+	opts := &SyncOptions{}
+
+	cmd := &cobra.Command{
+		Use:          "sync <options>",
+		Short:        "Synchronize the collection with the sync server",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cb != nil {
+				return cb(anki)
+			}
+			return syncCmd(anki, opts)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, "Supress output from terminal and logs")
+	cmd.Flags().BoolVar(&opts.FullUpload, "full-upload", false, "Replace the collection on the server with the local collection")
+	cmd.Flags().BoolVar(&opts.FullDownload, "full-download", false, "Replace the local collection with the collection on the server")
+	cmd.Flags().BoolVar(&opts.NoMedia, "no-media", false, "Skip syncing the media folder")
+	cmd.MarkFlagsMutuallyExclusive("full-upload", "full-download")
+
+	return cmd
+}
+
+func syncCmd(anki *anki.Anki, opts *SyncOptions) error {
+	if opts.FullUpload || opts.FullDownload {
+		return fullSyncCmd(anki, opts)
+	}
+	status, err := anki.API.Sync()
+	if err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to sync collection")
+		return err
+	}
+
+	var buffer bytes.Buffer
+	switch status {
+	case models.SyncNoChanges:
+		buffer.WriteString("Collection is already up to date\n")
+	case models.SyncSuccess:
+		buffer.WriteString("Collection synced\n")
+	case models.SyncFullSync:
+		return fmt.Errorf("the collection schema was modified and a full sync is required. " +
+			"Run `anki sync --full-upload` to keep the local collection or `anki sync --full-download` to keep the collection on the server")
+	default:
+		return fmt.Errorf("sync finished with status %s", status)
+	}
+	if !opts.NoMedia {
+		if err := syncMedia(anki, &buffer); err != nil {
+			return err
+		}
+	}
+	if !opts.Quiet {
+		buffer.WriteTo(anki.IO.Output)
+	}
+	return nil
+}
+
+func syncMedia(anki *anki.Anki, buffer *bytes.Buffer) error {
+	status, err := anki.API.SyncMedia()
+	if err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to sync media")
+		return err
+	}
+	switch status {
+	case models.SyncNoChanges:
+		buffer.WriteString("Media is already up to date\n")
+	case models.SyncSuccess:
+		buffer.WriteString("Media synced\n")
+	case models.SyncSanityCheckFailed:
+		return fmt.Errorf("the media folder does not match the server after syncing. Run `anki sync` again to compare all media files")
+	default:
+		return fmt.Errorf("media sync finished with status %s", status)
+	}
+	return nil
+}
+
+func fullSyncCmd(anki *anki.Anki, opts *SyncOptions) error {
+	var buffer bytes.Buffer
+	if opts.FullUpload {
+		if err := anki.API.FullUpload(); err != nil {
+			anki.IO.Log.Err(err).Msgf("failed to upload collection")
+			return err
+		}
+		buffer.WriteString("Uploaded collection to server\n")
+	} else {
+		if err := anki.API.FullDownload(); err != nil {
+			anki.IO.Log.Err(err).Msgf("failed to download collection")
+			return err
+		}
+		buffer.WriteString("Downloaded collection from server\n")
+	}
+	if !opts.NoMedia {
+		if err := syncMedia(anki, &buffer); err != nil {
+			return err
+		}
+	}
+	if !opts.Quiet {
+		buffer.WriteTo(anki.IO.Output)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package undo
+
+import (
+	"bytes"
+
+	"github.com/aerex/go-anki/pkg/anki"
+	"github.com/spf13/cobra"
+)
+
+type UndoOptions struct {
+	Quiet bool
+}
+
+func NewUndoCmd(anki *anki.Anki, cb func(*anki.Anki) error) *cobra.Command {
+	opts := &UndoOptions{}
+
+	cmd := &cobra.Command{
+		Use:          "undo <options>",
+		Short:        "Revert the last change made to the collection",
+		Long:         "Revert the last change made to the collection by a command. The answers given while studying can only be undone during the session",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cb != nil {
+				return cb(anki)
+			}
+			return undoCmd(anki, opts)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, "Supress output from terminal and logs")
+
+	return cmd
+}
+
+func NewRedoCmd(anki *anki.Anki, cb func(*anki.Anki) error) *cobra.Command {
+	opts := &UndoOptions{}
+
+	cmd := &cobra.Command{
+		Use:          "redo <options>",
+		Short:        "Apply again the last change undone",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cb != nil {
+				return cb(anki)
+			}
+			return redoCmd(anki, opts)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, "Supress output from terminal and logs")
+
+	return cmd
+}
+
+func undoCmd(anki *anki.Anki, opts *UndoOptions) error {
+	if err := anki.API.AutoBackup(); err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to back up collection before undoing the last change")
+		return err
+	}
+	name, err := anki.API.Undo()
+	if err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to undo the last change")
+		return err
+	}
+
+	if !opts.Quiet {
+		var buffer bytes.Buffer
+		buffer.WriteString("Undid " + name + "\n")
+		buffer.WriteTo(anki.IO.Output)
+	}
+	return nil
+}
+
+func redoCmd(anki *anki.Anki, opts *UndoOptions) error {
+	if err := anki.API.AutoBackup(); err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to back up collection before redoing the last change undone")
+		return err
+	}
+	name, err := anki.API.Redo()
+	if err != nil {
+		anki.IO.Log.Err(err).Msgf("failed to redo the last change undone")
+		return err
+	}
+
+	if !opts.Quiet {
+		var buffer bytes.Buffer
+		buffer.WriteString("Redid " + name + "\n")
+		buffer.WriteTo(anki.IO.Output)
+	}
+	return nil
+}
@@ -86,6 +86,9 @@ func (e *modelEditor) Edit(in interface{}) (error, []byte, bool) {
 
 func getEditor() string {
 	editor := viper.GetString("EDITOR")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
 	if editor == "" {
 		if runtime.GOOS == "windows" {
 			return "notepad.exe"
@@ -123,6 +126,7 @@ func (e *modelEditor) Create() error {
 	}
 	e.FilePath = f.Name()
 	e.IO = &io.IO{Output: f}
+	e.retry = false
 
 	return nil
 }
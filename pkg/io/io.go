@@ -2,11 +2,14 @@ package io
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"runtime"
+	"time"
 
 	shellQuote "github.com/kballard/go-shellquote"
 	"github.com/rs/zerolog"
@@ -44,12 +47,10 @@ func NewTestIO(in *bytes.Buffer, out *bytes.Buffer, err *bytes.Buffer, execCtx E
 
 // Eval will evalute cmd and pipe the stdout to a provided buffer
 func (i *IO) Eval(cmdString string, buf *bytes.Buffer) error {
-	cmdSplit, err := shellQuote.Split(cmdString)
+	cmd, err := command(context.Background(), cmdString)
 	if err != nil {
 		return err
 	}
-	//cmd := i.ExecContext(cmdSplit[0], cmdSplit[1:]...)
-	cmd := exec.Command(cmdSplit[0], cmdSplit[1:]...)
 	// Set stdout to write buffer
 	cmd.Stdout, cmd.Stderr, cmd.Stdin = os.Stdout, os.Stderr, os.Stdin
 	if buf != nil {
@@ -62,6 +63,35 @@ func (i *IO) Eval(cmdString string, buf *bytes.Buffer) error {
 	return nil
 }
 
+// EvalContext evaluates cmd in the background and kills it once ctx is done.
+// The cmd does not read the terminal and both its stdout and stderr are written to the buffer
+// so that it does not draw over the screen
+func (i *IO) EvalContext(ctx context.Context, cmdString string, buf *bytes.Buffer) error {
+	cmd, err := command(ctx, cmdString)
+	if err != nil {
+		return err
+	}
+	// the children of a killed command may keep writing to the buffer
+	cmd.WaitDelay = time.Second
+	cmd.Stdin = nil
+	if buf != nil {
+		cmd.Stdout, cmd.Stderr = buf, buf
+	}
+	return cmd.Run()
+}
+
+func command(ctx context.Context, cmdString string) (*exec.Cmd, error) {
+	cmdSplit, err := shellQuote.Split(cmdString)
+	if err != nil {
+		return nil, err
+	}
+	if len(cmdSplit) == 0 {
+		return nil, fmt.Errorf("no command to evaluate")
+	}
+	//cmd := i.ExecContext(cmdSplit[0], cmdSplit[1:]...)
+	return exec.CommandContext(ctx, cmdSplit[0], cmdSplit[1:]...), nil
+}
+
 // Get available editor program to use edit files
 // If on Windows, default editor will be notepad.exe
 // otherwise vim is used
@@ -0,0 +1,21 @@
+package io
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvalContext(t *testing.T) {
+	io := NewTestIO(&bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{}, nil)
+	var buf bytes.Buffer
+
+	// the errors are written to the buffer and nothing is read from the terminal
+	err := io.EvalContext(context.Background(), `sh -c 'echo out; echo err >&2; cat'`, &buf)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "out\nerr\n", buf.String())
+	assert.Error(t, io.EvalContext(context.Background(), "", &buf))
+}
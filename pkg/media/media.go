@@ -0,0 +1,306 @@
+package media
+
+import (
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"golang.org/x/text/unicode/norm"
+)
+
+// The change log schema used by Anki to track the media folder
+// See https://github.com/ankitects/anki/blob/2.1.15/anki/media.py
+const schema = `
+CREATE TABLE IF NOT EXISTS media (
+    fname TEXT NOT NULL PRIMARY KEY,
+    csum TEXT,           -- null indicates deleted file
+    mtime INT NOT NULL,  -- zero if deleted
+    dirty INT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_media_dirty ON media (dirty);
+CREATE TABLE IF NOT EXISTS meta (dirMod INT, lastUsn INT);
+INSERT INTO meta SELECT 0, 0 WHERE NOT EXISTS (SELECT 1 FROM meta);
+`
+
+// Manager keeps the media folder of a collection (collection.media)
+// in sync with its change log (collection.media.db2)
+type Manager struct {
+	Dir  string
+	Conn *sqlx.DB
+}
+
+type mediaEntry struct {
+	Name     string         `db:"fname"`
+	Checksum sql.NullString `db:"csum"`
+	Mod      int64          `db:"mtime"`
+	Dirty    bool           `db:"dirty"`
+}
+
+// Dir returns the media folder next to the collection file
+func Dir(colPath string) string {
+	return strings.TrimSuffix(colPath, filepath.Ext(colPath)) + ".media"
+}
+
+// NewManager opens the media folder and the media change log next to the collection file
+func NewManager(colPath string) (*Manager, error) {
+	base := strings.TrimSuffix(colPath, filepath.Ext(colPath))
+	dir := Dir(colPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	conn, err := sqlx.Connect("sqlite3", base+".media.db2")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Exec(schema); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Manager{Dir: dir, Conn: conn}, nil
+}
+
+func (m *Manager) Close() error {
+	return m.Conn.Close()
+}
+
+// Checksum returns the sha1 of the file content used to detect changes
+func Checksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha1.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// validName normalizes the name of a media file and rejects the names of files outside the media folder
+// (ie: ../collection.anki2) and of the files ignored in the media folder
+func validName(name string) (string, error) {
+	name = norm.NFC.String(name)
+	if name == "" || name != filepath.Base(name) || strings.ContainsAny(name, `/\`) || ignored(name) {
+		return "", fmt.Errorf("invalid media file name %s", name)
+	}
+	return name, nil
+}
+
+// ignored returns true for files that are never synced
+func ignored(name string) bool {
+	lower := strings.ToLower(name)
+	return strings.HasPrefix(name, ".") || lower == "thumbs.db" || lower == "desktop.ini"
+}
+
+// Scan records the files added, modified or removed from the media folder since the last scan
+func (m *Manager) Scan() error {
+	entries, err := os.ReadDir(m.Dir)
+	if err != nil {
+		return err
+	}
+	var known []mediaEntry
+	if err := m.Conn.Select(&known, "SELECT fname, csum, mtime, dirty FROM media"); err != nil {
+		return err
+	}
+	knownByName := make(map[string]mediaEntry)
+	for _, entry := range known {
+		knownByName[entry.Name] = entry
+	}
+
+	tx, err := m.Conn.Beginx()
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.IsDir() || ignored(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		name := norm.NFC.String(entry.Name())
+		seen[name] = true
+		prev, exists := knownByName[name]
+		if exists && prev.Checksum.Valid && prev.Mod == info.ModTime().Unix() {
+			continue
+		}
+		csum, err := Checksum(filepath.Join(m.Dir, entry.Name()))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		dirty := !exists || prev.Checksum.String != csum
+		if _, err := tx.Exec("INSERT OR REPLACE INTO media VALUES (?,?,?,?)",
+			name, csum, info.ModTime().Unix(), dirty || prev.Dirty); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for _, entry := range known {
+		if entry.Checksum.Valid && !seen[entry.Name] {
+			if _, err := tx.Exec("UPDATE media SET csum = NULL, mtime = 0, dirty = 1 WHERE fname = ?", entry.Name); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// Files lists the files in the media folder
+func (m *Manager) Files() (files []models.MediaFile, err error) {
+	if err = m.Scan(); err != nil {
+		return
+	}
+	var entries []mediaEntry
+	query := "SELECT fname, csum, mtime, dirty FROM media WHERE csum IS NOT NULL ORDER BY fname"
+	if err = m.Conn.Select(&entries, query); err != nil {
+		return
+	}
+	for _, entry := range entries {
+		info, err := os.Stat(filepath.Join(m.Dir, entry.Name))
+		if err != nil {
+			return files, err
+		}
+		files = append(files, models.MediaFile{
+			Name:  entry.Name,
+			Size:  info.Size(),
+			Mod:   models.UnixTime(entry.Mod),
+			Dirty: entry.Dirty,
+		})
+	}
+	return
+}
+
+// Add copies a file into the media folder and returns the name used in the folder.
+// If a different file with the same name already exists the checksum is appended to the name
+func (m *Manager) Add(src string) (string, error) {
+	return m.AddAs(src, filepath.Base(src))
+}
+
+// AddAs copies a file into the media folder using the provided name
+func (m *Manager) AddAs(src string, name string) (string, error) {
+	name, exists, err := m.NameOf(src, name)
+	if err != nil || exists {
+		return name, err
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return "", err
+	}
+	if err := m.write(name, data, true); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// NameOf returns the name AddAs gives to the file in the media folder without copying it
+// and whether the same file is already in the folder
+func (m *Manager) NameOf(src string, name string) (string, bool, error) {
+	csum, err := Checksum(src)
+	if err != nil {
+		return "", false, err
+	}
+	if name, err = validName(name); err != nil {
+		return "", false, err
+	}
+	if existing, err := Checksum(filepath.Join(m.Dir, name)); err == nil {
+		if existing == csum {
+			return name, true, nil
+		}
+		ext := filepath.Ext(name)
+		name = fmt.Sprintf("%s-%s%s", strings.TrimSuffix(name, ext), csum[:8], ext)
+	}
+	return name, false, nil
+}
+
+// Replace copies a file into the media folder and overwrites the file with the same name
+func (m *Manager) Replace(src string, name string) error {
+	name, err := validName(name)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return m.write(name, data, true)
+}
+
+// Remove deletes a file from the media folder
+func (m *Manager) Remove(name string) error {
+	name, err := validName(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(m.Dir, name)); err != nil {
+		return err
+	}
+	_, err = m.Conn.Exec("UPDATE media SET csum = NULL, mtime = 0, dirty = 1 WHERE fname = ?", name)
+	return err
+}
+
+// Check compares the media referenced by notes with the files in the media folder
+func (m *Manager) Check(refs []string) (check models.MediaCheck, err error) {
+	files, err := m.Files()
+	if err != nil {
+		return
+	}
+	inFolder := make(map[string]bool)
+	for _, f := range files {
+		inFolder[f.Name] = true
+	}
+	referenced := make(map[string]bool)
+	check.Missing = []string{}
+	check.Unused = []string{}
+	for _, ref := range refs {
+		ref = norm.NFC.String(ref)
+		if referenced[ref] {
+			continue
+		}
+		referenced[ref] = true
+		if !inFolder[ref] {
+			check.Missing = append(check.Missing, ref)
+		}
+	}
+	for _, f := range files {
+		if !referenced[f.Name] {
+			check.Unused = append(check.Unused, f.Name)
+		}
+	}
+	sort.Strings(check.Missing)
+	return
+}
+
+// write saves the file in the media folder and records the change
+func (m *Manager) write(name string, data []byte, dirty bool) error {
+	name, err := validName(name)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(m.Dir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	sum := sha1.Sum(data)
+	_, err = m.Conn.Exec("INSERT OR REPLACE INTO media VALUES (?,?,?,?)",
+		name, hex.EncodeToString(sum[:]), info.ModTime().Unix(), dirty)
+	return err
+}
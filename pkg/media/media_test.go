@@ -0,0 +1,111 @@
+package media
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	manager, err := NewManager(filepath.Join(t.TempDir(), "collection.anki2"))
+	if err != nil {
+		t.Fatalf("could not open media manager: %v", err)
+	}
+	t.Cleanup(func() { manager.Close() })
+	return manager
+}
+
+func writeFile(t *testing.T, path, content string) string {
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("could not write %s: %v", path, err)
+	}
+	return path
+}
+
+func TestNewManagerUsesCollectionName(t *testing.T) {
+	dir := t.TempDir()
+	manager, err := NewManager(filepath.Join(dir, "collection.anki2"))
+
+	assert.NoError(t, err)
+	defer manager.Close()
+	assert.Equal(t, filepath.Join(dir, "collection.media"), manager.Dir)
+	assert.FileExists(t, filepath.Join(dir, "collection.media.db2"))
+}
+
+func TestAddMedia(t *testing.T) {
+	manager := newTestManager(t)
+	src := writeFile(t, filepath.Join(t.TempDir(), "cat.jpg"), "cat")
+
+	name, err := manager.Add(src)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "cat.jpg", name)
+	files, err := manager.Files()
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	assert.Equal(t, int64(3), files[0].Size)
+	assert.True(t, files[0].Dirty)
+}
+
+func TestAddMediaRenamesOnConflict(t *testing.T) {
+	manager := newTestManager(t)
+	writeFile(t, filepath.Join(manager.Dir, "cat.jpg"), "another cat")
+	src := writeFile(t, filepath.Join(t.TempDir(), "cat.jpg"), "cat")
+
+	name, err := manager.Add(src)
+
+	assert.NoError(t, err)
+	// first 8 characters of the sha1 of the content
+	assert.Equal(t, "cat-9d989e8d.jpg", name)
+
+	name, err = manager.Add(src)
+	assert.NoError(t, err)
+	assert.Equal(t, "cat-9d989e8d.jpg", name, "adding the same file again reuses it")
+}
+
+func TestMediaRejectsNamesOutsideFolder(t *testing.T) {
+	manager := newTestManager(t)
+	src := writeFile(t, filepath.Join(t.TempDir(), "cat.jpg"), "cat")
+	victim := writeFile(t, filepath.Join(filepath.Dir(manager.Dir), "victim.txt"), "victim")
+
+	for _, name := range []string{"../victim.txt", "sub/cat.jpg", `..\victim.txt`, "..", ".hidden", ""} {
+		_, err := manager.AddAs(src, name)
+		assert.Error(t, err, name)
+		assert.Error(t, manager.Replace(src, name), name)
+		assert.Error(t, manager.Remove(name), name)
+		assert.Error(t, manager.write(name, []byte("cat"), false), name)
+		assert.Error(t, manager.syncDelete(name), name)
+	}
+	content, err := os.ReadFile(victim)
+	assert.NoError(t, err)
+	assert.Equal(t, "victim", string(content))
+}
+
+func TestScanDetectsRemovedFiles(t *testing.T) {
+	manager := newTestManager(t)
+	writeFile(t, filepath.Join(manager.Dir, "a.mp3"), "a")
+	assert.NoError(t, manager.Scan())
+	assert.NoError(t, manager.markClean([]string{"a.mp3"}))
+
+	os.Remove(filepath.Join(manager.Dir, "a.mp3"))
+	assert.NoError(t, manager.Scan())
+
+	entry, err := manager.entry("a.mp3")
+	assert.NoError(t, err)
+	assert.False(t, entry.Checksum.Valid)
+	assert.True(t, entry.Dirty)
+}
+
+func TestCheckMedia(t *testing.T) {
+	manager := newTestManager(t)
+	writeFile(t, filepath.Join(manager.Dir, "used.jpg"), "used")
+	writeFile(t, filepath.Join(manager.Dir, "unused.jpg"), "unused")
+
+	check, err := manager.Check([]string{"used.jpg", "missing.mp3", "used.jpg"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"missing.mp3"}, check.Missing)
+	assert.Equal(t, []string{"unused.jpg"}, check.Unused)
+}
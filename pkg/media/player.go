@@ -0,0 +1,40 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	ankiio "github.com/aerex/go-anki/pkg/io"
+	shellquote "github.com/kballard/go-shellquote"
+)
+
+// players are the commands tried in order when no player is set in the config.
+// They must not read the terminal since the sounds are played while studying
+var players = []string{
+	"mpv --no-terminal --no-video",
+	"ffplay -nodisp -autoexit -loglevel quiet",
+	"afplay",
+}
+
+// DefaultPlayer returns the first player installed or an empty string when none is found
+func DefaultPlayer() string {
+	for _, player := range players {
+		if _, err := exec.LookPath(strings.Fields(player)[0]); err == nil {
+			return player
+		}
+	}
+	return ""
+}
+
+// Play plays the sound file with the player command until it ends or ctx is done
+func Play(ctx context.Context, io *ankiio.IO, player string, path string) error {
+	if player == "" {
+		return fmt.Errorf("no player found to play %s, set the player in the study section of the config", filepath.Base(path))
+	}
+	var out bytes.Buffer
+	return io.EvalContext(ctx, player+" "+shellquote.Join(path), &out)
+}
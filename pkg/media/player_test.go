@@ -0,0 +1,28 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ankiio "github.com/aerex/go-anki/pkg/io"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlay(t *testing.T) {
+	io := ankiio.NewTestIO(&bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{}, nil)
+	path := writeFile(t, filepath.Join(t.TempDir(), "hello world.mp3"), "sound")
+
+	// the file is appended to the player as a single argument
+	assert.NoError(t, Play(context.Background(), io, `sh -c 'test -f "$1"' sh`, path))
+	assert.Error(t, Play(context.Background(), io, "", path))
+
+	// the player is stopped once the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.Error(t, Play(ctx, io, `sh -c 'exec sleep 5' sh`, path))
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
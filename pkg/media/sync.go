@@ -0,0 +1,314 @@
+package media
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	ankisync "github.com/aerex/go-anki/api/sync"
+	"github.com/aerex/go-anki/pkg/models"
+)
+
+const (
+	// Maximum number of files sent in a single upload
+	SYNC_ZIP_COUNT = 25
+	// Maximum size of the files sent in a single upload
+	SYNC_ZIP_SIZE = int64(2.5 * 1024 * 1024)
+)
+
+// Sync exchanges the files added or removed from the media folder with the media server
+// See MediaSyncer.sync in https://github.com/ankitects/anki/blob/2.1.15/anki/sync.py
+func (m *Manager) Sync(server ankisync.MediaServer) (models.SyncStatus, error) {
+	if err := m.Scan(); err != nil {
+		return "", err
+	}
+	lastUsn, err := m.lastUsn()
+	if err != nil {
+		return "", err
+	}
+	serverUsn, err := server.Begin()
+	if err != nil {
+		return "", err
+	}
+	dirty, err := m.dirtyCount()
+	if err != nil {
+		return "", err
+	}
+	if lastUsn == serverUsn && dirty == 0 {
+		return models.SyncNoChanges, nil
+	}
+
+	// apply the changes made on the server
+	for {
+		changes, err := server.MediaChanges(lastUsn)
+		if err != nil {
+			return "", err
+		}
+		if len(changes) == 0 {
+			break
+		}
+		need := []string{}
+		lastUsn = changes[len(changes)-1].USN
+		for _, change := range changes {
+			entry, err := m.entry(change.Name)
+			if err != nil {
+				return "", err
+			}
+			switch {
+			case change.Checksum != "" && entry.Checksum.String != change.Checksum:
+				need = append(need, change.Name)
+			case change.Checksum != "":
+				err = m.markClean([]string{change.Name})
+			case entry.Checksum.Valid && !entry.Dirty:
+				err = m.syncDelete(change.Name)
+			case !entry.Checksum.Valid:
+				// removed on both sides
+				err = m.markClean([]string{change.Name})
+			}
+			// a file added locally and removed on the server is uploaded again
+			if err != nil {
+				return "", err
+			}
+		}
+		if err := m.downloadFiles(server, need); err != nil {
+			return "", err
+		}
+		if err := m.setLastUsn(lastUsn); err != nil {
+			return "", err
+		}
+	}
+
+	// send the local changes
+	conflict := false
+	for {
+		zipData, fnames, err := m.changesZip()
+		if err != nil {
+			return "", err
+		}
+		if len(fnames) == 0 {
+			break
+		}
+		processed, serverUsn, err := server.UploadChanges(zipData)
+		if err != nil {
+			return "", err
+		}
+		if processed > len(fnames) {
+			processed = len(fnames)
+		}
+		if err := m.markClean(fnames[:processed]); err != nil {
+			return "", err
+		}
+		if serverUsn != lastUsn+processed {
+			conflict = true
+		}
+		lastUsn = serverUsn
+		if err := m.setLastUsn(lastUsn); err != nil {
+			return "", err
+		}
+	}
+	if conflict {
+		// the server was modified during the sync so the changes are fetched again
+		if err := m.setLastUsn(0); err != nil {
+			return "", err
+		}
+		return m.Sync(server)
+	}
+
+	count, err := m.count()
+	if err != nil {
+		return "", err
+	}
+	res, err := server.MediaSanity(count)
+	if err != nil {
+		return "", err
+	}
+	if res != "OK" {
+		// the next sync will compare all the files
+		if err := m.setLastUsn(0); err != nil {
+			return "", err
+		}
+		return models.SyncSanityCheckFailed, nil
+	}
+	return models.SyncSuccess, nil
+}
+
+// downloadFiles retrieves the files from the server. The server may return fewer
+// files than requested so the request is repeated until all files are received
+func (m *Manager) downloadFiles(server ankisync.MediaServer, fnames []string) error {
+	for len(fnames) > 0 {
+		data, err := server.DownloadFiles(fnames)
+		if err != nil {
+			return err
+		}
+		count, err := m.addFilesFromZip(data)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return fmt.Errorf("media server did not send the requested files")
+		}
+		fnames = fnames[count:]
+	}
+	return nil
+}
+
+// addFilesFromZip saves the files of a zip sent by the server.
+// The `_meta` entry maps the names of the zip entries to the media file names
+func (m *Manager) addFilesFromZip(data []byte) (int, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return 0, err
+	}
+	meta := make(map[string]string)
+	for _, f := range reader.File {
+		if f.Name != "_meta" {
+			continue
+		}
+		content, err := readZipFile(f)
+		if err != nil {
+			return 0, err
+		}
+		if err := json.Unmarshal(content, &meta); err != nil {
+			return 0, fmt.Errorf("invalid media zip meta: %w", err)
+		}
+	}
+	count := 0
+	for _, f := range reader.File {
+		if f.Name == "_meta" {
+			continue
+		}
+		name, exists := meta[f.Name]
+		if !exists {
+			return count, fmt.Errorf("media zip entry %s is missing from meta", f.Name)
+		}
+		content, err := readZipFile(f)
+		if err != nil {
+			return count, err
+		}
+		if err := m.write(name, content, false); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// changesZip bundles the next batch of files added or removed locally.
+// The `_meta` entry lists the media file names along with the name of the zip entry
+// or an empty string for removed files
+func (m *Manager) changesZip() ([]byte, []string, error) {
+	var entries []mediaEntry
+	if err := m.Conn.Select(&entries, "SELECT fname, csum, mtime, dirty FROM media WHERE dirty = 1 LIMIT ?", SYNC_ZIP_COUNT); err != nil {
+		return nil, nil, err
+	}
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	meta := [][]string{}
+	fnames := []string{}
+	size := int64(0)
+	for idx, entry := range entries {
+		fnames = append(fnames, entry.Name)
+		if !entry.Checksum.Valid {
+			meta = append(meta, []string{entry.Name, ""})
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(m.Dir, entry.Name))
+		if err != nil {
+			return nil, nil, err
+		}
+		zipName := strconv.Itoa(idx)
+		f, err := writer.Create(zipName)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := f.Write(content); err != nil {
+			return nil, nil, err
+		}
+		meta = append(meta, []string{entry.Name, zipName})
+		size += int64(len(content))
+		if size > SYNC_ZIP_SIZE {
+			break
+		}
+	}
+	metaData, err := json.Marshal(meta)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := writer.Create("_meta")
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := f.Write(metaData); err != nil {
+		return nil, nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), fnames, nil
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func (m *Manager) entry(name string) (entry mediaEntry, err error) {
+	err = m.Conn.Get(&entry, "SELECT fname, csum, mtime, dirty FROM media WHERE fname = ?", name)
+	if err == sql.ErrNoRows {
+		return mediaEntry{Name: name}, nil
+	}
+	return
+}
+
+// syncDelete removes a file deleted on the server
+func (m *Manager) syncDelete(name string) error {
+	name, err := validName(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(m.Dir, name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	_, err = m.Conn.Exec("DELETE FROM media WHERE fname = ?", name)
+	return err
+}
+
+func (m *Manager) markClean(fnames []string) error {
+	for _, name := range fnames {
+		if _, err := m.Conn.Exec("UPDATE media SET dirty = 0 WHERE fname = ?", name); err != nil {
+			return err
+		}
+	}
+	_, err := m.Conn.Exec("DELETE FROM media WHERE csum IS NULL AND dirty = 0")
+	return err
+}
+
+func (m *Manager) lastUsn() (usn int, err error) {
+	err = m.Conn.Get(&usn, "SELECT lastUsn FROM meta")
+	return
+}
+
+func (m *Manager) setLastUsn(usn int) error {
+	_, err := m.Conn.Exec("UPDATE meta SET lastUsn = ?", usn)
+	return err
+}
+
+func (m *Manager) dirtyCount() (count int, err error) {
+	err = m.Conn.Get(&count, "SELECT count() FROM media WHERE dirty = 1")
+	return
+}
+
+func (m *Manager) count() (count int, err error) {
+	err = m.Conn.Get(&count, "SELECT count() FROM media WHERE csum IS NOT NULL")
+	return
+}
@@ -0,0 +1,117 @@
+package media
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	ankisync "github.com/aerex/go-anki/api/sync"
+	"github.com/aerex/go-anki/api/sync/synctest"
+	"github.com/aerex/go-anki/internal/config"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMediaServer(t *testing.T) (*synctest.MediaServer, *ankisync.RemoteMediaServer) {
+	server := synctest.NewMediaServer()
+	t.Cleanup(server.Close)
+	return server, ankisync.NewRemoteMediaServer(config.Sync{Endpoint: server.URL}, server.HostKey)
+}
+
+func TestSyncMediaNoChanges(t *testing.T) {
+	manager := newTestManager(t)
+	server, remote := newTestMediaServer(t)
+
+	status, err := manager.Sync(remote)
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.SyncNoChanges, status)
+	assert.Equal(t, []string{"begin"}, server.Calls)
+}
+
+func TestSyncMediaDownloadsFiles(t *testing.T) {
+	manager := newTestManager(t)
+	server, remote := newTestMediaServer(t)
+	server.AddFile("dog.jpg", []byte("dog"))
+	server.AddFile("bird.mp3", []byte("bird"))
+
+	status, err := manager.Sync(remote)
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.SyncSuccess, status)
+	content, err := os.ReadFile(filepath.Join(manager.Dir, "dog.jpg"))
+	assert.NoError(t, err)
+	assert.Equal(t, "dog", string(content))
+	usn, _ := manager.lastUsn()
+	assert.Equal(t, 2, usn)
+	dirty, _ := manager.dirtyCount()
+	assert.Equal(t, 0, dirty, "downloaded files should not be uploaded again")
+}
+
+func TestSyncMediaUploadsChanges(t *testing.T) {
+	manager := newTestManager(t)
+	server, remote := newTestMediaServer(t)
+	server.AddFile("old.jpg", []byte("old"))
+	_, err := manager.Sync(remote)
+	assert.NoError(t, err)
+
+	writeFile(t, filepath.Join(manager.Dir, "new.jpg"), "new")
+	assert.NoError(t, manager.Remove("old.jpg"))
+	status, err := manager.Sync(remote)
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.SyncSuccess, status)
+	assert.Equal(t, []string{"new.jpg"}, server.Uploaded)
+	assert.Equal(t, []string{"old.jpg"}, server.Removed)
+	assert.Equal(t, map[string][]byte{"new.jpg": []byte("new")}, server.Files)
+}
+
+func TestSyncMediaAppliesRemoteDeletions(t *testing.T) {
+	manager := newTestManager(t)
+	server, remote := newTestMediaServer(t)
+	server.AddFile("gone.jpg", []byte("gone"))
+	_, err := manager.Sync(remote)
+	assert.NoError(t, err)
+
+	server.RemoveFile("gone.jpg")
+	status, err := manager.Sync(remote)
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.SyncSuccess, status)
+	assert.NoFileExists(t, filepath.Join(manager.Dir, "gone.jpg"))
+}
+
+func TestSyncMediaRejectsNamesOutsideFolder(t *testing.T) {
+	manager := newTestManager(t)
+	server, remote := newTestMediaServer(t)
+	server.AddFile("../escaped.jpg", []byte("escaped"))
+
+	_, err := manager.Sync(remote)
+
+	assert.EqualError(t, err, "invalid media file name ../escaped.jpg")
+	assert.NoFileExists(t, filepath.Join(filepath.Dir(manager.Dir), "escaped.jpg"))
+}
+
+func TestSyncMediaBatchesUploads(t *testing.T) {
+	manager := newTestManager(t)
+	server, remote := newTestMediaServer(t)
+	for i := 0; i < SYNC_ZIP_COUNT+5; i++ {
+		writeFile(t, filepath.Join(manager.Dir, filepath.Base(t.Name())+string(rune('a'+i))), "x")
+	}
+
+	status, err := manager.Sync(remote)
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.SyncSuccess, status)
+	assert.Len(t, server.Files, SYNC_ZIP_COUNT+5)
+	assert.Equal(t, 2, countCalls(server.Calls, "uploadChanges"))
+}
+
+func countCalls(calls []string, method string) (count int) {
+	for _, call := range calls {
+		if call == method {
+			count++
+		}
+	}
+	return
+}
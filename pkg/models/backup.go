@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Backup is a copy of the collection stored as a collection package (.colpkg)
+type Backup struct {
+	Name string `json:"name" yaml:"name"`
+	Path string `json:"path" yaml:"path"`
+	// Size of the backup in bytes
+	Size    int64     `json:"size" yaml:"size"`
+	Created time.Time `json:"created" yaml:"created"`
+}
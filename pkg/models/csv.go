@@ -0,0 +1,50 @@
+package models
+
+// DuplicateMode describes what to do with an imported note
+// when a note of the same type has the same first field
+type DuplicateMode string
+
+const (
+	// Keep the existing note and ignore the imported one
+	DuplicateSkip DuplicateMode = "skip"
+	// Replace the fields of the existing note and add the imported tags
+	DuplicateUpdate DuplicateMode = "update"
+	// Add the imported note alongside the existing one
+	DuplicateAllow DuplicateMode = "duplicate"
+)
+
+// NoteRow is a note read from a row of a text file
+type NoteRow struct {
+	// The line of the row in the file
+	Line     int
+	NoteType string
+	Deck     string
+	// The values of the fields keyed by field name
+	Fields map[string]string
+	Tags   []string
+	// The globally unique id of the note when the row describes a known note
+	GUID string
+}
+
+type NoteRowStatus string
+
+const (
+	NoteRowAdded     NoteRowStatus = "added"
+	NoteRowUpdated   NoteRowStatus = "updated"
+	NoteRowDuplicate NoteRowStatus = "duplicate"
+	NoteRowSkipped   NoteRowStatus = "skipped"
+	NoteRowFailed    NoteRowStatus = "failed"
+	NoteRowRemoved   NoteRowStatus = "removed"
+)
+
+// NoteRowResult reports what happened to a row of a text file
+type NoteRowResult struct {
+	Line   int           `json:"line" yaml:"line"`
+	Status NoteRowStatus `json:"status" yaml:"status"`
+	// The note that was added, updated or that the row duplicates
+	NoteID ID     `json:"nid,omitempty" yaml:"nid,omitempty"`
+	GUID   string `json:"guid,omitempty" yaml:"guid,omitempty"`
+	Cards  int    `json:"cards,omitempty" yaml:"cards,omitempty"`
+	// Why the row was skipped or failed
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// MediaFile is a file stored in the media folder of the collection
+type MediaFile struct {
+	Name string `json:"name" yaml:"name"`
+	// Size of the file in bytes
+	Size int64 `json:"size" yaml:"size"`
+	// Last modification time in seconds
+	Mod UnixTime `json:"mod" yaml:"mod"`
+	// True if the file was added or modified since the last media sync
+	Dirty bool `json:"dirty" yaml:"dirty"`
+}
+
+// MediaCheck lists the media files referenced by notes that are missing from the media folder
+// and the files in the media folder that no note references
+type MediaCheck struct {
+	Missing []string `json:"missing" yaml:"missing"`
+	Unused  []string `json:"unused" yaml:"unused"`
+}
+
+// MediaChange is a file added, modified or removed on the server since the last media sync.
+// The server serializes the change as `[fname, usn, checksum]` where the checksum is empty for removed files
+type MediaChange struct {
+	Name     string
+	USN      int
+	Checksum string
+}
+
+func (m *MediaChange) UnmarshalJSON(src []byte) error {
+	var tmp []json.RawMessage
+	if err := json.Unmarshal(src, &tmp); err != nil {
+		return err
+	}
+	if len(tmp) != 3 {
+		return fmt.Errorf("expected media change with 3 entries but got %d", len(tmp))
+	}
+	if err := json.Unmarshal(tmp[0], &m.Name); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(tmp[1], &m.USN); err != nil {
+		return err
+	}
+	var csum *string
+	if err := json.Unmarshal(tmp[2], &csum); err != nil {
+		return err
+	}
+	if csum != nil {
+		m.Checksum = *csum
+	}
+	return nil
+}
+
+func (m MediaChange) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{m.Name, m.USN, m.Checksum})
+}
@@ -1,5 +1,7 @@
 package models
 
+import "context"
+
 type CardQA struct {
 	Question        string
 	QuestionBrowser string
@@ -8,6 +10,20 @@ type CardQA struct {
 	Card            Card
 }
 
+// EditNoteFunc opens the note of a card or only its tags in the editor and returns the fields and the tags
+// of the note once changed
+type EditNoteFunc func(card Card, tagsOnly bool) (fields map[string]string, tags []string, changed bool, err error)
+
+// StudyMedia finds the media of the cards while studying and plays their sounds
+type StudyMedia struct {
+	// The folder of the media files of the collection
+	Dir string
+	// How the images are drawn in the terminal (ie: auto, kitty, sixel, halfblock, ascii or none)
+	Images string
+	// Play plays the sound file until it ends or ctx is done
+	Play func(ctx context.Context, path string) error
+}
+
 // structure for the card fields
 type CardField struct {
 	// Name of the field
@@ -183,7 +199,7 @@ type Card struct {
 	// At this time, cards in learning becomes due again, with their previous due date)
 	// In any other case it's 0.
 	OriginalDue    UnixTime `json:"odue" db:"odue"`
-	Flags          string   `json:"-"`
+	Flags          int      `json:"flags" db:"flags"`
 	Data           string   `json:"-"`
 	Question       string   `json:"question" db:"question"`
 	Answer         string   `json:"answer" db:"answer"`
@@ -197,11 +213,20 @@ type Card struct {
 	TimeStarted    UnixTime
 }
 
+// CreateNote describes a note to create from a file.
+// The fields are given in the order of the fields of the note type
 type CreateNote struct {
-	Type   string   `yaml:"type"`
-	Deck   string   `yaml:"deck"`
-	Fields []string `yaml:"fields"`
-	Tags   []string `yaml:"tags"`
+	Type   string   `json:"type" yaml:"type"`
+	Deck   string   `json:"deck" yaml:"deck"`
+	Fields []string `json:"fields" yaml:"fields"`
+	Tags   []string `json:"tags" yaml:"tags"`
+}
+
+// DeleteResult counts the cards, the notes and the decks removed from the collection
+type DeleteResult struct {
+	Cards int `json:"cards" yaml:"cards"`
+	Notes int `json:"notes" yaml:"notes"`
+	Decks int `json:"decks" yaml:"decks"`
 }
 
 type CardType int
@@ -276,11 +301,14 @@ type StudiedToday struct {
 	// The number of relearned cards
 	Relearn int `json:"relearned" db:"relearned"`
 	// The number of filtered cards
-	Filter int `json:"filter" filter:"filter"`
+	Filter int `json:"filter" db:"filter"`
 }
 
 type TagCache map[string]int
 
+// MarkedTag is the tag added to the notes marked while studying
+const MarkedTag = "marked"
+
 // The structure representing the collection for the user
 type Collection struct {
 	// arbitrary number since there is only one row
@@ -288,6 +316,13 @@ type Collection struct {
 	// update sequence number: used for finding diffs when syncing.
 	USN     int      `json:"usn" db:"usn"`
 	Created UnixTime `json:"crt" db:"crt"`
+	// last modified time of the collection in milliseconds
+	Mod int64 `json:"mod" db:"mod"`
+	// schema modified time in milliseconds. A full sync is required when the schema
+	// on the client and server do not match
+	Scm int64 `json:"scm" db:"scm"`
+	// last sync time in milliseconds
+	LastSync int64 `json:"ls" db:"ls"`
 	// json object containing configuration options that are synced.
 	Conf      CollectionConf `json:"conf" db:"conf"`
 	NoteTypes NoteTypes      `json:"models" db:"models"`
@@ -312,6 +347,8 @@ const (
 	ReviewLogTypeReview
 	ReviewLogTypeRelearn
 	ReviewLogTypeCram
+	// the card was rescheduled by hand
+	ReviewLogTypeManual
 )
 
 type Ease int
@@ -367,6 +404,8 @@ type CollectionConf struct {
 	ActiveDecks    []ID          `json:"activeDecks"`
 	NewSpread      NewCardSpread `json:"newSpread"`
 	EstimateTimes  BoolVar       `json:"estTimes"`
+	// Show the cards in learning for more than a day before the reviews
+	DayLearnFirst bool `json:"dayLearnFirst"`
 }
 
 // Structure for deck
@@ -404,10 +443,94 @@ type Deck struct {
 	// Deck description
 	Desc     string       `json:"desc" db:"desc"`
 	Schedule DeckSchedule `json:"schedule"`
+	// The searches used to gather the cards of a filtered deck
+	Terms []FilterTerm `json:"terms,omitempty"`
+	// True when the answers given in a filtered deck reschedule the cards
+	Resched bool `json:"resched"`
+	// The limits used by the v3 scheduler instead of the limits of the deck options
+	ReviewLimit *int `json:"reviewLimit,omitempty"`
+	NewLimit    *int `json:"newLimit,omitempty"`
+	// The limits used by the v3 scheduler only on the day they were set
+	ReviewLimitToday *DayLimit `json:"reviewLimitToday,omitempty"`
+	NewLimitToday    *DayLimit `json:"newLimitToday,omitempty"`
+}
+
+// DayLimit is a limit of a deck which only applies on a day
+type DayLimit struct {
+	Limit int `json:"limit"`
+	// The number of days since the collection was created
+	Today int64 `json:"today"`
 }
 
 type Decks map[ID]*Deck
 
+// FilterOrder is the order in which the cards are gathered in a filtered deck
+type FilterOrder int
+
+const (
+	FilterOrderOldestSeen FilterOrder = iota
+	FilterOrderRandom
+	FilterOrderIntervalAsc
+	FilterOrderIntervalDesc
+	FilterOrderLapses
+	FilterOrderAdded
+	FilterOrderDue
+	FilterOrderAddedDesc
+	FilterOrderRelativeOverdue
+)
+
+// FilterOrders maps the names of the orders to their value
+var FilterOrders = map[string]FilterOrder{
+	"oldest-seen":      FilterOrderOldestSeen,
+	"random":           FilterOrderRandom,
+	"interval":         FilterOrderIntervalAsc,
+	"interval-desc":    FilterOrderIntervalDesc,
+	"lapses":           FilterOrderLapses,
+	"added":            FilterOrderAdded,
+	"due":              FilterOrderDue,
+	"added-desc":       FilterOrderAddedDesc,
+	"relative-overdue": FilterOrderRelativeOverdue,
+}
+
+// CustomStudyType is one of the options of the custom study of anki
+type CustomStudyType int
+
+const (
+	// Increase the number of new cards of today
+	CustomStudyExtendNew CustomStudyType = iota
+	// Increase the number of reviews of today
+	CustomStudyExtendReview
+	// Review the cards forgotten in the last days
+	CustomStudyForgotten
+	// Review the cards due in the next days
+	CustomStudyReviewAhead
+	// Preview the new cards added in the last days
+	CustomStudyPreviewNew
+	// Study the cards with tags and in a state
+	CustomStudyTags
+)
+
+// CustomStudy describes a custom study session of a deck
+type CustomStudy struct {
+	Type CustomStudyType
+	// The number of cards to add to the limits or the number of days to look at
+	Value int
+	// The tags of the cards to study. The tags starting with - are excluded
+	Tags []string
+	// The state of the cards to study with tags: new, due, review or all
+	CardState string
+	// The maximum number of cards to study with tags
+	Limit int
+}
+
+// FilterTerm is a search of a filtered deck.
+// It is stored by anki as a [search, limit, order] array
+type FilterTerm struct {
+	Search string
+	Limit  int
+	Order  FilterOrder
+}
+
 type LeechActionType int
 
 const (
@@ -454,7 +577,7 @@ type RevDeckConf struct {
 	// The new interval is multiplied by a random number between -fuzz and fuzz
 	Fuzz float64 `json:"fuzz"`
 	// Multiplication factor applied to the intervals Anki generates"
-	IvlFct *int64 `json:"ivlFct,omitempty"`
+	IvlFct *float64 `json:"ivlFct,omitempty"`
 	// The maximal interval for review
 	MaxIvl int64 `json:"maxIvl"`
 	// Numbers of cards to review per day
@@ -471,17 +594,17 @@ type LapseDeckConf struct {
 	// The number of lapses authorized before doing leechAction.
 	LeechFails int `json:"leechFails"`
 	// A lower limit to the new interval after a leech
-	MinInterval int64 `json:"minInterval"`
+	MinInterval int64 `json:"minInt"`
 	// Percent by which to multiply the current interval when a card goes has lapsed
-	Mult    int64 `json:"mult"`
-	Resched bool  `json:"resched"`
+	Mult    float64 `json:"mult"`
+	Resched bool    `json:"resched"`
 }
 
 // structure for deck options
 // See https://github.com/ankidroid/Anki-Android/wiki/Database-Structure#dconf-jsonobjects
 type DeckConfig struct {
 	ID ID `json:"id"`
-	// Whether the audio associated to a question should be
+	// Whether the audio associated to a question should be played when the question is shown
 	Autoplay bool `json:"autoplay"`
 	// Whether this deck is dynamic.
 	Dyn BoolVar `json:"dyn" db:"dyn"`
@@ -498,7 +621,7 @@ type DeckConfig struct {
 	// The configuration for new cards.
 	New NewDeckConf `json:"new"`
 	// Whether the audio associated to a question should be played when the answer is shown
-	Replayq bool `json:"relayq"`
+	Replayq bool `json:"replayq"`
 	// The configuration for review cards.
 	Rev RevDeckConf `json:"rev"`
 	// Whether timer should be shown
@@ -510,8 +633,40 @@ type DeckConfig struct {
 	USN          int       `json:"usn"`
 	Resched      bool      `db:"resched"`
 	PreviewDelay *UnixTime `db:"previewDelay"`
+	// How the v3 scheduler shows the new cards with the reviews
+	NewMix ReviewMix `json:"newMix"`
+	// How the v3 scheduler shows the cards in learning for more than a day with the reviews
+	InterdayLearningMix ReviewMix `json:"interdayLearningMix"`
+	// Whether the v3 scheduler shows new cards once the review limit is reached
+	NewCardsIgnoreReviewLimit bool `json:"newCardsIgnoreReviewLimit"`
+	// The parameters of FSRS fitted to the reviews of the decks using the options
+	FSRSWeights []float64 `json:"fsrsWeights,omitempty"`
+	// The probability to recall a card when it is due used by FSRS to compute the intervals
+	DesiredRetention float64 `json:"desiredRetention,omitempty"`
+}
+
+// FSRSOptimization is the result of fitting the parameters of FSRS to the reviews of decks
+type FSRSOptimization struct {
+	Parameters []float64
+	// The number of reviews used to measure the predictions
+	Reviews int
+	// The log loss of the predictions with the default and the fitted parameters
+	DefaultLoss float64
+	Loss        float64
+	// The names of the deck options saved with the parameters
+	Configs []string
 }
 
+// ReviewMix is the order of the new cards or the cards in learning for more than a day
+// relative to the reviews in the v3 scheduler
+type ReviewMix int
+
+const (
+	ReviewMixWithReviews ReviewMix = iota
+	ReviewMixAfterReviews
+	ReviewMixBeforeReviews
+)
+
 type SchedTimingToday struct {
 	DaysElapsed int64
 	NextDayAt   int64
@@ -0,0 +1,32 @@
+package models
+
+// ExportOptions describes what is included in a deck package (.apkg)
+type ExportOptions struct {
+	// Include the media files referenced by the exported notes
+	WithMedia bool
+	// Keep the review history and the due dates of the cards
+	// Otherwise the cards are exported as new cards
+	WithScheduling bool
+	// Include the images of the LaTeX of the notes rendered with latex and dvipng
+	// when they are missing from the media folder
+	WithLatex bool
+}
+
+// ExportResult counts what was written in a deck package
+type ExportResult struct {
+	Notes int `json:"notes" yaml:"notes"`
+	Cards int `json:"cards" yaml:"cards"`
+	Media int `json:"media" yaml:"media"`
+}
+
+// ImportResult counts what was added to the collection from a deck package
+type ImportResult struct {
+	// Notes added to the collection
+	Notes int `json:"notes" yaml:"notes"`
+	// Existing notes updated with a more recent version from the package
+	Updated int `json:"updated" yaml:"updated"`
+	// Notes skipped because the collection already has the same or a newer version
+	Duplicates int `json:"duplicates" yaml:"duplicates"`
+	Cards      int `json:"cards" yaml:"cards"`
+	Media      int `json:"media" yaml:"media"`
+}
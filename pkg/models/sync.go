@@ -0,0 +1,161 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// The version of the sync protocol used when talking to the sync server
+// See https://github.com/ankitects/anki/blob/2.1.28/pylib/anki/sync.py
+const SyncVersion = 10
+
+type SyncStatus string
+
+const (
+	// The local and remote collection have not been modified since the last sync
+	SyncNoChanges SyncStatus = "noChanges"
+	// The changes were successfully exchanged with the server
+	SyncSuccess SyncStatus = "success"
+	// The schema of one side was modified so the collection must be uploaded or downloaded in full
+	SyncFullSync SyncStatus = "fullSync"
+	// The server refused to continue the sync (ie: client is too old)
+	SyncAborted SyncStatus = "aborted"
+	// The local and remote collection do not match after exchanging changes
+	SyncSanityCheckFailed SyncStatus = "sanityCheckFailed"
+)
+
+type GraveType int
+
+const (
+	GraveTypeCard GraveType = iota
+	GraveTypeNote
+	GraveTypeDeck
+)
+
+// Graves are the ids of cards, notes and decks that were deleted since the last sync
+type Graves struct {
+	Cards []ID `json:"cards"`
+	Notes []ID `json:"notes"`
+	Decks []ID `json:"decks"`
+}
+
+// SyncMeta is the response of the `meta` sync request.
+// It describes the state of the collection on the server
+type SyncMeta struct {
+	// Last modification time of the collection in milliseconds
+	Mod int64 `json:"mod"`
+	// Last schema modification time of the collection in milliseconds
+	Scm int64 `json:"scm"`
+	// The update sequence number of the collection
+	USN int `json:"usn"`
+	// The current time on the server in seconds
+	ServerTime int64 `json:"ts"`
+	// The update sequence number of the media folder
+	MediaUSN int `json:"musn"`
+	// The name of the user logged in
+	User string `json:"uname"`
+	// Message the server wants to show to the user
+	Msg string `json:"msg"`
+	// False if the server refuses to continue the sync
+	Cont bool `json:"cont"`
+	// The shard the user collection lives on
+	HostNum int `json:"hostNum"`
+}
+
+// SyncDecks holds the decks and deck configurations exchanged during a sync.
+// The sync protocol serializes both lists as a two element array `[decks, dconf]`
+type SyncDecks struct {
+	Decks []*Deck
+	Confs []*DeckConfig
+}
+
+func (d SyncDecks) MarshalJSON() ([]byte, error) {
+	decks, confs := d.Decks, d.Confs
+	if decks == nil {
+		decks = []*Deck{}
+	}
+	if confs == nil {
+		confs = []*DeckConfig{}
+	}
+	return json.Marshal([]interface{}{decks, confs})
+}
+
+func (d *SyncDecks) UnmarshalJSON(src []byte) error {
+	var tmp []json.RawMessage
+	if err := json.Unmarshal(src, &tmp); err != nil {
+		return err
+	}
+	if len(tmp) != 2 {
+		return fmt.Errorf("expected decks and deck configs but got %d entries", len(tmp))
+	}
+	if err := json.Unmarshal(tmp[0], &d.Decks); err != nil {
+		return err
+	}
+	return json.Unmarshal(tmp[1], &d.Confs)
+}
+
+// SyncChanges are the changes made to the `col` table exchanged during a sync
+type SyncChanges struct {
+	Models []*NoteType `json:"models"`
+	Decks  SyncDecks   `json:"decks"`
+	Tags   []string    `json:"tags"`
+	// Only sent by the side that was modified last.
+	// The conf is kept as raw json so options unknown to go-anki are not lost
+	Conf json.RawMessage `json:"conf,omitempty"`
+	Crt  UnixTime        `json:"crt,omitempty"`
+}
+
+// SyncRow is a row of the revlog, cards or notes table with the columns in table order
+type SyncRow []interface{}
+
+// SyncChunk is a batch of rows exchanged during a sync
+type SyncChunk struct {
+	Done   bool      `json:"done"`
+	Revlog []SyncRow `json:"revlog,omitempty"`
+	Cards  []SyncRow `json:"cards,omitempty"`
+	Notes  []SyncRow `json:"notes,omitempty"`
+}
+
+// SanityCounts are the collection totals compared with the server after a sync
+type SanityCounts struct {
+	// New, learning and review counts. The server does not compare them anymore
+	// so they are always sent as zeros
+	Due    [3]int
+	Cards  int
+	Notes  int
+	Revlog int
+	Graves int
+	Models int
+	Decks  int
+	Confs  int
+}
+
+func (s SanityCounts) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{s.Due, s.Cards, s.Notes, s.Revlog, s.Graves, s.Models, s.Decks, s.Confs})
+}
+
+func (s *SanityCounts) UnmarshalJSON(src []byte) error {
+	var tmp []json.RawMessage
+	if err := json.Unmarshal(src, &tmp); err != nil {
+		return err
+	}
+	if len(tmp) != 8 {
+		return fmt.Errorf("expected 8 sanity counts but got %d", len(tmp))
+	}
+	if err := json.Unmarshal(tmp[0], &s.Due); err != nil {
+		return err
+	}
+	counts := []*int{&s.Cards, &s.Notes, &s.Revlog, &s.Graves, &s.Models, &s.Decks, &s.Confs}
+	for idx, cnt := range counts {
+		if err := json.Unmarshal(tmp[idx+1], cnt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type SanityCheckResult struct {
+	Status string        `json:"status"`
+	Client *SanityCounts `json:"c,omitempty"`
+	Server *SanityCounts `json:"s,omitempty"`
+}
@@ -185,6 +185,27 @@ func (b *BoolVar) UnmarshalJSON(src []byte) error {
 	}
 	return b.Scan(tmp)
 }
+
+func (f FilterTerm) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{f.Search, f.Limit, f.Order})
+}
+
+func (f *FilterTerm) UnmarshalJSON(src []byte) error {
+	var tmp []json.RawMessage
+	if err := json.Unmarshal(src, &tmp); err != nil {
+		return err
+	}
+	if len(tmp) != 3 {
+		return fmt.Errorf("expected filter term with 3 entries but got %d", len(tmp))
+	}
+	if err := json.Unmarshal(tmp[0], &f.Search); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(tmp[1], &f.Limit); err != nil {
+		return err
+	}
+	return json.Unmarshal(tmp[2], &f.Order)
+}
 func (f *NoteFields) Scan(src interface{}) error {
 	var tmp string
 	switch src.(type) {
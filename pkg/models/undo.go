@@ -0,0 +1,17 @@
+package models
+
+// UndoStep is an operation made on the collection with the statements reverting its changes
+type UndoStep struct {
+	// Name of the operation (ie: Delete Deck)
+	Name       string   `json:"name"`
+	Statements []string `json:"statements"`
+	// Stamp of the collection after the operation. The step can only be reverted
+	// when the collection was not modified since
+	Stamp string `json:"stamp"`
+}
+
+// UndoHistory are the operations that can be undone and redone, the last operation first
+type UndoHistory struct {
+	Undo []UndoStep `json:"undo"`
+	Redo []UndoStep `json:"redo"`
+}
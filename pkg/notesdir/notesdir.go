@@ -0,0 +1,355 @@
+// Package notesdir reads the notes written as Markdown (.md) or Org (.org) files in a directory.
+//
+// A file holds a single note. The settings of the note are set in the front matter of
+// a Markdown file or with keywords at the top of an Org file and each first level heading
+// starts a field named after the heading:
+//
+//	---
+//	type: Basic
+//	deck: Grammar
+//	tags: [verbs]
+//	---
+//	# Front
+//	to go
+//	# Back
+//	*went*
+package notesdir
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	ghtml "github.com/yuin/goldmark/renderer/html"
+	"gopkg.in/yaml.v2"
+)
+
+// ManifestFile keeps track of the notes synced from a directory
+const ManifestFile = ".anki-sync"
+
+var markdown = goldmark.New(goldmark.WithRendererOptions(ghtml.WithUnsafe()))
+
+// Note is a note read from a file
+type Note struct {
+	// The path of the file relative to the directory
+	Path string
+	Type string
+	Deck string
+	// The globally unique id of the note or empty when the note was never synced
+	GUID string
+	Tags []string
+	// The fields converted to html in the order of the headings
+	Fields []Field
+}
+
+type Field struct {
+	Name  string
+	Value string
+}
+
+type frontMatter struct {
+	Type string   `yaml:"type"`
+	Deck string   `yaml:"deck"`
+	GUID string   `yaml:"guid"`
+	Tags []string `yaml:"tags"`
+}
+
+// Manifest maps the globally unique id of the synced notes to the path of their file
+// so the notes of the deleted files can be found
+type Manifest struct {
+	Notes map[string]string `json:"notes"`
+}
+
+// Scan reads the notes of the Markdown and Org files of a directory and its subdirectories.
+// Hidden files and directories are skipped
+func Scan(dir string) (notes []Note, err error) {
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !isNoteFile(path) {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		note, err := Parse(filepath.ToSlash(rel), data)
+		if err != nil {
+			return err
+		}
+		notes = append(notes, note)
+		return nil
+	})
+	return
+}
+
+func isNoteFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown", ".org":
+		return true
+	}
+	return false
+}
+
+// Parse reads the note of a file. The format is chosen using the extension of the path
+func Parse(path string, data []byte) (note Note, err error) {
+	note.Path = path
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	if strings.ToLower(filepath.Ext(path)) == ".org" {
+		err = parseOrg(&note, lines)
+	} else {
+		err = parseMarkdown(&note, lines)
+	}
+	if err != nil {
+		return note, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(note.Fields) == 0 {
+		return note, fmt.Errorf("%s: no field found", path)
+	}
+	return
+}
+
+func parseMarkdown(note *Note, lines []string) error {
+	if len(lines) > 0 && strings.TrimSpace(lines[0]) == "---" {
+		end := frontMatterEnd(lines)
+		if end == -1 {
+			return fmt.Errorf("front matter is not closed")
+		}
+		var meta frontMatter
+		if err := yaml.Unmarshal([]byte(strings.Join(lines[1:end], "\n")), &meta); err != nil {
+			return fmt.Errorf("invalid front matter: %w", err)
+		}
+		note.Type, note.Deck, note.GUID, note.Tags = meta.Type, meta.Deck, meta.GUID, meta.Tags
+		lines = lines[end+1:]
+	}
+
+	fence := ""
+	return splitFields(note, lines, func(line string) (string, bool) {
+		trimmed := strings.TrimSpace(line)
+		// headings in code blocks are part of the field
+		for _, marker := range []string{"```", "~~~"} {
+			if strings.HasPrefix(trimmed, marker) {
+				if fence == "" {
+					fence = marker
+				} else if fence == marker {
+					fence = ""
+				}
+			}
+		}
+		if fence == "" && strings.HasPrefix(line, "# ") {
+			return strings.TrimSpace(line[2:]), true
+		}
+		return "", false
+	}, markdownToHTML)
+}
+
+func parseOrg(note *Note, lines []string) error {
+	// the keywords at the top of the file describe the note
+	for len(lines) > 0 && (strings.HasPrefix(lines[0], "#+") || strings.TrimSpace(lines[0]) == "") {
+		key, value, _ := strings.Cut(strings.TrimPrefix(lines[0], "#+"), ":")
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(key) {
+		case "type":
+			note.Type = value
+		case "deck":
+			note.Deck = value
+		case "guid":
+			note.GUID = value
+		case "tags", "filetags":
+			note.Tags = strings.FieldsFunc(value, func(r rune) bool { return r == ':' || r == ' ' })
+		}
+		lines = lines[1:]
+	}
+
+	inBlock := false
+	return splitFields(note, lines, func(line string) (string, bool) {
+		lower := strings.ToLower(strings.TrimSpace(line))
+		if strings.HasPrefix(lower, "#+begin_") {
+			inBlock = true
+		} else if strings.HasPrefix(lower, "#+end_") {
+			inBlock = false
+		}
+		if !inBlock && strings.HasPrefix(line, "* ") {
+			return strings.TrimSpace(line[2:]), true
+		}
+		return "", false
+	}, func(text string) string {
+		return strings.ReplaceAll(html.EscapeString(text), "\n", "<br>")
+	})
+}
+
+// splitFields starts a field on each heading found by the heading func
+// and converts the content of the fields with the toHTML func
+func splitFields(note *Note, lines []string, heading func(string) (string, bool), toHTML func(string) string) error {
+	var content []string
+	name := ""
+	flush := func() {
+		if name != "" {
+			note.Fields = append(note.Fields, Field{Name: name, Value: toHTML(strings.Trim(strings.Join(content, "\n"), "\n"))})
+		}
+		content = nil
+	}
+	for _, line := range lines {
+		if field, ok := heading(line); ok {
+			flush()
+			name = field
+			continue
+		}
+		if name == "" && strings.TrimSpace(line) != "" {
+			return fmt.Errorf("text found before the first field heading")
+		}
+		content = append(content, line)
+	}
+	flush()
+	return nil
+}
+
+func markdownToHTML(text string) string {
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(text), &buf); err != nil {
+		return html.EscapeString(text)
+	}
+	out := strings.TrimSpace(buf.String())
+	// a single paragraph is stored as text like the fields created by anki
+	if strings.HasPrefix(out, "<p>") && strings.HasSuffix(out, "</p>") && strings.Count(out, "<p>") == 1 {
+		out = strings.TrimSuffix(strings.TrimPrefix(out, "<p>"), "</p>")
+	}
+	return out
+}
+
+func frontMatterEnd(lines []string) int {
+	for idx := 1; idx < len(lines); idx++ {
+		if strings.TrimSpace(lines[idx]) == "---" {
+			return idx
+		}
+	}
+	return -1
+}
+
+// SetGUID writes the globally unique id of a note in the front matter of its file
+// (or the keywords of an Org file) so the next syncs update the note
+func SetGUID(dir string, path string, guid string) error {
+	fullPath := filepath.Join(dir, filepath.FromSlash(path))
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(string(data), "\n")
+	if strings.ToLower(filepath.Ext(path)) == ".org" {
+		lines = setOrgGUID(lines, guid)
+	} else {
+		lines = setMarkdownGUID(lines, guid)
+	}
+	return os.WriteFile(fullPath, []byte(strings.Join(lines, "\n")), info.Mode().Perm())
+}
+
+func setMarkdownGUID(lines []string, guid string) []string {
+	end := -1
+	if len(lines) > 0 && strings.TrimSpace(lines[0]) == "---" {
+		end = frontMatterEnd(lines)
+	}
+	// the ids may start with characters reserved by yaml
+	value, err := yaml.Marshal(guid)
+	if err != nil {
+		value = []byte(guid)
+	}
+	line := "guid: " + strings.TrimSpace(string(value))
+	if end == -1 {
+		return append([]string{"---", line, "---"}, lines...)
+	}
+	for idx := 1; idx < end; idx++ {
+		if strings.HasPrefix(lines[idx], "guid:") {
+			lines[idx] = line
+			return lines
+		}
+	}
+	return insert(lines, end, line)
+}
+
+func setOrgGUID(lines []string, guid string) []string {
+	last := -1
+	for idx, line := range lines {
+		if !strings.HasPrefix(line, "#+") {
+			break
+		}
+		if strings.HasPrefix(strings.ToLower(line), "#+guid:") {
+			lines[idx] = "#+GUID: " + guid
+			return lines
+		}
+		last = idx
+	}
+	return insert(lines, last+1, "#+GUID: "+guid)
+}
+
+func insert(lines []string, idx int, line string) []string {
+	return append(lines[:idx], append([]string{line}, lines[idx:]...)...)
+}
+
+// LoadManifest reads the manifest of a directory or returns an empty manifest when the directory was never synced
+func LoadManifest(dir string) (*Manifest, error) {
+	m := &Manifest{Notes: make(map[string]string)}
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ManifestFile, err)
+	}
+	if m.Notes == nil {
+		m.Notes = make(map[string]string)
+	}
+	return m, nil
+}
+
+// Save writes the manifest in the directory
+func (m *Manifest) Save(dir string) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	// the ids contain characters escaped for html by default
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, ManifestFile), buf.Bytes(), 0644)
+}
+
+// Removed returns the ids of the notes in the manifest that are not used by the notes, sorted
+func (m *Manifest) Removed(notes []Note) (guids []string) {
+	used := make(map[string]bool)
+	for _, note := range notes {
+		used[note.GUID] = true
+	}
+	for guid := range m.Notes {
+		if !used[guid] {
+			guids = append(guids, guid)
+		}
+	}
+	sort.Strings(guids)
+	return
+}
@@ -0,0 +1,110 @@
+package notesdir
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMarkdown(t *testing.T) {
+	content := "---\ntype: Basic\ndeck: Grammar\ntags: [verbs, irregular]\nguid: abc\n---\n" +
+		"# Front\nto **go**\n\n# Back\nwent\n\n## Examples\n```\n# not a field\n```\n"
+
+	note, err := Parse("go.md", []byte(content))
+
+	assert.NoError(t, err)
+	assert.Equal(t, Note{
+		Path: "go.md",
+		Type: "Basic",
+		Deck: "Grammar",
+		GUID: "abc",
+		Tags: []string{"verbs", "irregular"},
+		Fields: []Field{
+			{Name: "Front", Value: "to <strong>go</strong>"},
+			{Name: "Back", Value: "<p>went</p>\n<h2>Examples</h2>\n<pre><code># not a field\n</code></pre>"},
+		},
+	}, note)
+}
+
+func TestParseOrg(t *testing.T) {
+	content := "#+TYPE: Basic\n#+TAGS: :verbs:irregular:\n\n* Front\nto go & come\n** Examples\n* Back\nwent\n"
+
+	note, err := Parse("go.org", []byte(content))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Basic", note.Type)
+	assert.Equal(t, []string{"verbs", "irregular"}, note.Tags)
+	assert.Equal(t, []Field{
+		{Name: "Front", Value: "to go &amp; come<br>** Examples"},
+		{Name: "Back", Value: "went"},
+	}, note.Fields)
+}
+
+func TestParseInvalid(t *testing.T) {
+	_, err := Parse("a.md", []byte("---\ntype: Basic\n# Front\n"))
+	assert.EqualError(t, err, "a.md: front matter is not closed")
+
+	_, err = Parse("a.md", []byte("text\n# Front\n"))
+	assert.EqualError(t, err, "a.md: text found before the first field heading")
+
+	_, err = Parse("a.md", []byte("---\ntype: Basic\n---\n"))
+	assert.EqualError(t, err, "a.md: no field found")
+}
+
+func TestSetGUID(t *testing.T) {
+	tests := map[string]struct {
+		content  string
+		expected string
+	}{
+		"a.md":  {"# Front\nfront\n", "---\nguid: '`abc'\n---\n# Front\nfront\n"},
+		"b.md":  {"---\ntype: Basic\n---\n# Front\n", "---\ntype: Basic\nguid: '`abc'\n---\n# Front\n"},
+		"c.md":  {"---\nguid: old\n---\n# Front\n", "---\nguid: '`abc'\n---\n# Front\n"},
+		"d.org": {"#+TYPE: Basic\n\n* Front\n", "#+TYPE: Basic\n#+GUID: `abc\n\n* Front\n"},
+		"e.org": {"* Front\n", "#+GUID: `abc\n* Front\n"},
+	}
+	dir := t.TempDir()
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			assert.NoError(t, os.WriteFile(path, []byte(test.content), 0644))
+
+			assert.NoError(t, SetGUID(dir, name, "`abc"))
+
+			data, err := os.ReadFile(path)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, string(data))
+			note, err := Parse(name, data)
+			assert.NoError(t, err)
+			assert.Equal(t, "`abc", note.GUID)
+		})
+	}
+}
+
+func TestScanAndManifest(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "verbs"), 0755)
+	os.MkdirAll(filepath.Join(dir, ".git"), 0755)
+	os.WriteFile(filepath.Join(dir, "verbs", "go.md"), []byte("---\nguid: a\n---\n# Front\ngo\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "eat.org"), []byte("* Front\neat\n"), 0644)
+	os.WriteFile(filepath.Join(dir, ".git", "HEAD.md"), []byte("ignored"), 0644)
+	os.WriteFile(filepath.Join(dir, "README.txt"), []byte("ignored"), 0644)
+
+	notes, err := Scan(dir)
+
+	assert.NoError(t, err)
+	assert.Len(t, notes, 2)
+	assert.Equal(t, "eat.org", notes[0].Path)
+	assert.Equal(t, "verbs/go.md", notes[1].Path)
+
+	manifest, err := LoadManifest(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, manifest.Notes)
+	manifest.Notes["a"] = "verbs/go.md"
+	manifest.Notes["b"] = "deleted.md"
+	assert.NoError(t, manifest.Save(dir))
+	manifest, err = LoadManifest(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b"}, manifest.Removed(notes))
+}
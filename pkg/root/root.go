@@ -2,11 +2,19 @@ package root
 
 import (
 	"github.com/aerex/go-anki/pkg/anki"
+	backupCommand "github.com/aerex/go-anki/pkg/cmd/backup"
 	cardCommand "github.com/aerex/go-anki/pkg/cmd/card"
 	deckCommand "github.com/aerex/go-anki/pkg/cmd/deck"
 	deckConfigCommand "github.com/aerex/go-anki/pkg/cmd/deck-config"
+	exportCommand "github.com/aerex/go-anki/pkg/cmd/export"
+	fsrsCommand "github.com/aerex/go-anki/pkg/cmd/fsrs"
+	importCommand "github.com/aerex/go-anki/pkg/cmd/import"
+	mediaCommand "github.com/aerex/go-anki/pkg/cmd/media"
 	noteTypeCommand "github.com/aerex/go-anki/pkg/cmd/note-type"
+	notesCommand "github.com/aerex/go-anki/pkg/cmd/notes"
 	studyCommand "github.com/aerex/go-anki/pkg/cmd/study"
+	syncCommand "github.com/aerex/go-anki/pkg/cmd/sync"
+	undoCommand "github.com/aerex/go-anki/pkg/cmd/undo"
 	"github.com/spf13/cobra"
 )
 
@@ -29,6 +37,15 @@ func NewRootCmd(anki *anki.Anki) *cobra.Command {
 	root.AddCommand(deckConfigCommand.NewDeckConfigsCmd(anki, nil))
 	root.AddCommand(noteTypeCommand.NewNoteTypeCmd(anki))
 	root.AddCommand(studyCommand.NewStudyCmd(anki))
+	root.AddCommand(syncCommand.NewSyncCmd(anki, nil))
+	root.AddCommand(mediaCommand.NewMediaCmd(anki))
+	root.AddCommand(importCommand.NewImportCmd(anki, nil))
+	root.AddCommand(exportCommand.NewExportCmd(anki, nil))
+	root.AddCommand(backupCommand.NewBackupCmd(anki))
+	root.AddCommand(notesCommand.NewNotesCmd(anki))
+	root.AddCommand(fsrsCommand.NewFSRSCmd(anki))
+	root.AddCommand(undoCommand.NewUndoCmd(anki, nil))
+	root.AddCommand(undoCommand.NewRedoCmd(anki, nil))
 
 	return root
 }
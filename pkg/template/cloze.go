@@ -0,0 +1,169 @@
+package template
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// {{c1::, {{c2:: or {{c1,2:: opening a cloze deletion
+var REGEX_MATCH_CLOZE_OPEN = regexp.MustCompile(`\{\{c(\d+(?:,\d+)*)::`)
+
+// clozeNode is a text or a cloze deletion with its text and its nested clozes
+type clozeNode struct {
+	text     string
+	cloze    bool
+	ordinals []int
+	hint     string
+	children []clozeNode
+}
+
+func (n clozeNode) active(ord int) bool {
+	for _, ordinal := range n.ordinals {
+		if ordinal == ord {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClozes reads the clozes of a field like Anki: the clozes can be nested, the text after :: is the hint
+// and the clozes that are not closed are kept as text
+func parseClozes(text string) []clozeNode {
+	var nodes []clozeNode
+	var open []*clozeNode
+	add := func(node clozeNode) {
+		if len(open) > 0 {
+			parent := open[len(open)-1]
+			parent.children = append(parent.children, node)
+		} else {
+			nodes = append(nodes, node)
+		}
+	}
+	addText := func(text string) {
+		if text == "" {
+			return
+		}
+		if len(open) > 0 {
+			if idx := strings.Index(text, "::"); idx >= 0 {
+				open[len(open)-1].hint = text[idx+2:]
+				text = text[:idx]
+			}
+		}
+		add(clozeNode{text: text})
+	}
+
+	for text != "" {
+		loc := REGEX_MATCH_CLOZE_OPEN.FindStringSubmatchIndex(text)
+		end := strings.Index(text, "}}")
+		switch {
+		case loc != nil && (end < 0 || loc[0] < end):
+			addText(text[:loc[0]])
+			node := &clozeNode{cloze: true, text: text[loc[0]:loc[1]]}
+			for _, ordinal := range strings.Split(text[loc[2]:loc[3]], ",") {
+				ord, _ := strconv.Atoi(ordinal)
+				node.ordinals = append(node.ordinals, ord)
+			}
+			open = append(open, node)
+			text = text[loc[1]:]
+		case end >= 0:
+			addText(text[:end])
+			if len(open) == 0 {
+				addText("}}")
+			} else {
+				node := *open[len(open)-1]
+				open = open[:len(open)-1]
+				add(node)
+			}
+			text = text[end+2:]
+		default:
+			addText(text)
+			text = ""
+		}
+	}
+
+	for _, node := range open {
+		nodes = append(nodes, clozeNode{text: node.text})
+		nodes = append(nodes, node.children...)
+	}
+	return nodes
+}
+
+// ClozeOrdinals returns the ordinals of the clozes of a field (ie: 1 and 2 for {{c1,2::text}}), the nested
+// clozes included, in increasing order
+func ClozeOrdinals(text string) []int {
+	seen := make(map[int]bool)
+	var ords []int
+	var find func(nodes []clozeNode)
+	find = func(nodes []clozeNode) {
+		for _, node := range nodes {
+			if !node.cloze {
+				continue
+			}
+			for _, ord := range node.ordinals {
+				if !seen[ord] {
+					seen[ord] = true
+					ords = append(ords, ord)
+				}
+			}
+			find(node.children)
+		}
+	}
+	find(parseClozes(text))
+	sort.Ints(ords)
+	return ords
+}
+
+// RenderClozes shows the clozes of a field for the card of the ordinal (ie: 1 for {{c1::text}}). The clozes
+// of the card are hidden as [...], or as their [hint], on the question and revealed on the answer and are
+// passed to mark. The other clozes show their text
+func RenderClozes(text string, ord int, isAnswer bool, mark func(string) string) string {
+	var output strings.Builder
+	writeClozes(&output, parseClozes(text), ord, isAnswer, mark)
+	return output.String()
+}
+
+func writeClozes(output *strings.Builder, nodes []clozeNode, ord int, isAnswer bool, mark func(string) string) {
+	for _, node := range nodes {
+		switch {
+		case !node.cloze:
+			output.WriteString(node.text)
+		case node.active(ord) && !isAnswer:
+			hidden := "[...]"
+			if node.hint != "" {
+				hidden = "[" + node.hint + "]"
+			}
+			output.WriteString(mark(hidden))
+		case node.active(ord):
+			var revealed strings.Builder
+			// the clozes inside are already marked
+			writeClozes(&revealed, node.children, ord, isAnswer, func(text string) string { return text })
+			output.WriteString(mark(revealed.String()))
+		default:
+			writeClozes(output, node.children, ord, isAnswer, mark)
+		}
+	}
+}
+
+// ClozeOnly returns the text of the clozes of the card of the ordinal in the order they appear
+func ClozeOnly(text string, ord int) []string {
+	var clozes []string
+	var find func(nodes []clozeNode)
+	find = func(nodes []clozeNode) {
+		for _, node := range nodes {
+			if !node.cloze {
+				continue
+			}
+			if node.active(ord) {
+				var revealed strings.Builder
+				writeClozes(&revealed, node.children, ord, true, func(text string) string { return text })
+				clozes = append(clozes, revealed.String())
+				continue
+			}
+			find(node.children)
+		}
+	}
+	find(parseClozes(text))
+	return clozes
+}
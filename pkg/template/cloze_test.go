@@ -0,0 +1,105 @@
+package template
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderClozes(t *testing.T) {
+	mark := func(text string) string {
+		return fmt.Sprintf("<%s>", text)
+	}
+	tests := []struct {
+		name     string
+		text     string
+		ord      int
+		question string
+		answer   string
+	}{
+		{
+			name:     "Field with a cloze and a cloze with a hint",
+			text:     "{{c1::foo}} {{c2::bar::baz}}",
+			ord:      1,
+			question: "<[...]> bar",
+			answer:   "<foo> bar",
+		},
+		{
+			name:     "Field with a hint on the card",
+			text:     "{{c1::foo}} {{c2::bar::baz}}",
+			ord:      2,
+			question: "foo <[baz]>",
+			answer:   "foo <bar>",
+		},
+		{
+			name:     "Field with the same cloze twice",
+			text:     "{{c1::a}} {{c1::b}} {{c2::c}}",
+			ord:      1,
+			question: "<[...]> <[...]> c",
+			answer:   "<a> <b> c",
+		},
+		{
+			name:     "Field with a cloze hidden with its nested cloze",
+			text:     "foo {{c1::bar {{c2::baz}}}}",
+			ord:      1,
+			question: "foo <[...]>",
+			answer:   "foo <bar baz>",
+		},
+		{
+			name:     "Field with a nested cloze",
+			text:     "foo {{c1::bar {{c2::baz}}}}",
+			ord:      2,
+			question: "foo bar <[...]>",
+			answer:   "foo bar <baz>",
+		},
+		{
+			name:     "Field with a cloze of several cards",
+			text:     "{{c1,2::a}} {{c3::b}}",
+			ord:      2,
+			question: "<[...]> b",
+			answer:   "<a> b",
+		},
+		{
+			name:     "Field with a closing delimiter outside of the clozes",
+			text:     "{{c1::a}}}}",
+			ord:      1,
+			question: "<[...]>}}",
+			answer:   "<a>}}",
+		},
+		{
+			name:     "Field with a cloze not closed",
+			text:     "{{c1::a {{c2::b}}",
+			ord:      2,
+			question: "{{c1::a <[...]>",
+			answer:   "{{c1::a <b>",
+		},
+		{
+			name:     "Field without clozes",
+			text:     "text",
+			ord:      1,
+			question: "text",
+			answer:   "text",
+		},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.question, RenderClozes(tt.text, tt.ord, false, mark), tt.name)
+		assert.Equal(t, tt.answer, RenderClozes(tt.text, tt.ord, true, mark), tt.name)
+	}
+}
+
+func TestClozeOnly(t *testing.T) {
+	assert.Equal(t, []string{"a", "b"}, ClozeOnly("{{c1::a}} {{c2::x}} {{c1::b::hint}}", 1))
+	assert.Equal(t, []string{"bar baz"}, ClozeOnly("foo {{c1::bar {{c2::baz}}}}", 1))
+	assert.Equal(t, []string{"baz"}, ClozeOnly("foo {{c1::bar {{c2::baz}}}}", 2))
+	assert.Empty(t, ClozeOnly("{{c1::a}}", 2))
+}
+
+func TestClozeOrdinals(t *testing.T) {
+	assert.Equal(t, []int{1, 2, 3}, ClozeOrdinals("{{c3::a}} {{c1,2::b}} {{c1::c}}"))
+	assert.Equal(t, []int{1, 2}, ClozeOrdinals("foo {{c2::bar {{c1::baz}}}}"))
+	// the clozes that are not closed are text
+	assert.Empty(t, ClozeOrdinals("{{c1::a"))
+	assert.Empty(t, ClozeOrdinals("no clozes"))
+}
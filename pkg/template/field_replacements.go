@@ -2,12 +2,13 @@ package template
 
 import (
 	"fmt"
+	"html"
 	"regexp"
+	"strconv"
 	"strings"
 	"text/template"
 
 	"github.com/aerex/go-anki/internal/config"
-	"github.com/aerex/go-anki/internal/utils"
 	"github.com/aerex/go-anki/pkg/models"
 	"github.com/aerex/go-anki/third_party/kakasi"
 	"github.com/mgutz/ansi"
@@ -16,12 +17,15 @@ import (
 
 var (
 	REGEX_MATCH_TMPL_ARG_GROUPS = regexp.MustCompile(`([\w=,\.]+)[^\\h]`)
-	REGEX_MATCH_CLOZE_TAG       = regexp.MustCompile(`cloze:(\w+)`)
-	REGEX_MATCH_CLOZE_FILTER    = regexp.MustCompile(`(?si)\{\{(?P<tag>c)(?P<ord>\d)+::(?P<content>.*?)(::(?P<hint>.*?))?\}\}`)
+	// kanji[reading] with the space separating it from the previous word
+	REGEX_MATCH_FURIGANA = regexp.MustCompile(` ?([^ >]+?)\[(.+?)\]`)
 )
 
 var RENDER_LIST = "list"
 
+// RENDER_STUDY renders the cards as html for the study screen
+var RENDER_STUDY = "study"
+
 var RESET_COLOR = ansi.ColorCode("reset")
 
 var HINT_COLOR = ansi.ColorCode("25")
@@ -39,78 +43,75 @@ type FieldReplacmentOptions struct {
 	renderType  string
 }
 
-// FieldReplacement
+// FieldReplacement generates the go template of a field replacement (ie: Field) and its filters (ie: text:hint:Field).
+// The filters are applied from the nearest to the field and the filters that can not be rendered are ignored
 func FieldReplacement(opts FieldReplacmentOptions) (string, error) {
-	var output strings.Builder
-	var spVal string
-	var err error
-
-	filters := strings.Split(opts.tmplFmt, ":")
-	// Check for simple field replacement or special field replacement
-	if len(filters) == 1 {
-		field := filters[0]
-		raw, isField := opts.fieldMap[field]
-		if isField {
-			output.WriteString(fmt.Sprintf("{{.%s}}", raw))
-		} else if IsSpecialFields(field) {
-			// special fields will always reduce to a constant string
-			// so include handlebars if not a special field
-			spVal, err = SpecialFieldFilter(opts, field)
-			if err != nil {
-				return "", err
-			}
-			output.WriteString(fmt.Sprintf("%s ", spVal))
-		} else {
-			return "", fmt.Errorf("could not determine field type for %s", field)
+	node := newReplacementNode(opts.tmplFmt)
+	filters := node.Filters
+
+	// The answer typed in is compared to the field once the answer is shown
+	// so the filter is kept as [[type:Field]] for the study screen
+	if len(filters) > 0 && filters[len(filters)-1] == "type" {
+		if _, isField := opts.fieldMap[node.Field]; !isField {
+			return "", fmt.Errorf("could not determine field for %s", node.Field)
 		}
-		return output.String(), nil
+		return fmt.Sprintf("[[%s]]", opts.tmplFmt), nil
 	}
 
-	// Check for cloze deletion
-	if REGEX_MATCH_CLOZE_TAG.MatchString(opts.tmplFmt) {
-		clozeParts := REGEX_MATCH_CLOZE_TAG.FindStringSubmatch(opts.tmplFmt)
-		if len(clozeParts) < 1 {
-			return "", fmt.Errorf("could not find field from cloze tag %s", clozeParts)
-		}
-
-		raw, isField := opts.fieldMap[clozeParts[1]]
-		if !isField {
-			return "", fmt.Errorf("could not determine field for %s", clozeParts[1])
-		}
-
-		fieldValue := opts.readStruct.GetField(raw).String()
-		clozeFilter, err := ReplaceWithClozeFilter(fieldValue, opts.card.Ord, opts.isAnswer)
+	// Check for simple field replacement or special field replacement
+	var value string
+	if raw, isField := opts.fieldMap[node.Field]; isField {
+		value = "." + raw
+	} else if node.Field == "FrontSide" {
+		return SpecialFieldFilter(opts, node.Field)
+	} else if IsSpecialFields(node.Field) {
+		// special fields will always reduce to a constant string
+		spVal, err := SpecialFieldFilter(opts, node.Field)
 		if err != nil {
 			return "", err
 		}
-		output.WriteString(clozeFilter)
-		return output.String(), nil
+		if len(filters) == 0 {
+			return escapeText(spVal), nil
+		}
+		value = strconv.Quote(spVal)
+	} else if node.Field == "" && len(filters) > 0 {
+		// the filters without a field (ie: {{tts en_US:}}) have nothing to render
+		return "", nil
+	} else {
+		return "", fmt.Errorf("could not determine field type for %s", node.Field)
 	}
 
 	// Check for filter replacement
 	// Filters will be deliminated by a `:` where the field is placed.
-	// For instance, if filterA is applied to field_0 then the expected format will be
-	// {{filterA:field_0}}
-	output.WriteString("{{")
-	field := filters[len(filters)-1]
-	raw, isField := opts.fieldMap[field]
-	if !isField {
-		return "", fmt.Errorf("could not determine field")
-	}
-	for _, filter := range filters[0 : len(filters)-1] {
+	// For instance, if filterB and then filterA are applied to field_0 then the expected format will be
+	// {{filterA:filterB:field_0}} and the filters are called as {{filterA (filterB .Field_0)}}
+	known := FieldReplacementMap(nil, RENDER_LIST)
+	for _, filter := range filters {
 		filterWithArgs := strings.Split(filter, " ")
-		output.WriteString(fmt.Sprintf("%s .%s", filterWithArgs[0], raw))
-		if len(filterWithArgs) > 1 {
-			output.WriteString(fmt.Sprintf(" %s", WrapArgsInQuotes(filterWithArgs[1:])))
+		name := filterWithArgs[0]
+		if name == "cloze-only" {
+			name = "clozeOnly"
 		}
-
-		if len(filters) > 2 {
-			output.WriteString(" | ")
+		if _, isKnown := known[name]; !isKnown {
+			continue
+		}
+		if strings.Contains(value, " ") {
+			value = "(" + value + ")"
+		}
+		value = fmt.Sprintf("%s %s", name, value)
+		// the clozes shown depend on the card and on the side
+		switch name {
+		case "cloze":
+			value += fmt.Sprintf(" %d %t", opts.card.Ord+1, opts.isAnswer)
+		case "clozeOnly":
+			value += fmt.Sprintf(" %d", opts.card.Ord+1)
+		default:
+			if len(filterWithArgs) > 1 {
+				value += " " + WrapArgsInQuotes(filterWithArgs[1:])
+			}
 		}
 	}
-	output.WriteString("}}")
-
-	return output.String(), nil
+	return fmt.Sprintf("{{%s}}", value), nil
 }
 
 func IsSpecialFields(field string) bool {
@@ -137,32 +138,14 @@ func WrapArgsInQuotes(argList []string) string {
 	})
 }
 
-func ReplaceWithClozeFilter(value string, cardOrd int, isAnswer bool) (string, error) {
-	var err error = nil
-	result := REGEX_MATCH_CLOZE_FILTER.ReplaceAllStringFunc(value, func(repl string) string {
-		clozeValParts := REGEX_MATCH_CLOZE_FILTER.FindStringSubmatch(repl)
-		// c, digit , text
-		if len(clozeValParts) < 6 {
-			return ""
-		}
-		// cloze "cloze ord" "card ord" "content" "isAnswer"
-		return fmt.Sprintf("{{ cloze \"%s\" \"%d\" \"%s\" \"%d\" }}", clozeValParts[2], cardOrd+1, clozeValParts[3], utils.BoolToInt(isAnswer))
-	})
-
-	if result == "" {
-		err = fmt.Errorf("could not create cloze filter from %s", value)
-	}
-
-	return result, err
-
-}
-
 func SpecialFieldFilter(opts FieldReplacmentOptions, field string) (string, error) {
 	switch field {
 	case "Tags":
 		return opts.card.Note.StringTags, nil
 	case "Type":
 		return opts.card.Note.Model.Name, nil
+	case "Deck":
+		return opts.card.Deck.Name, nil
 	case "Subdeck":
 		d := strings.Split(opts.card.Deck.Name, "::")
 		return d[len(d)-1], nil
@@ -172,7 +155,7 @@ func SpecialFieldFilter(opts FieldReplacmentOptions, field string) (string, erro
 
 		if !opts.isFrontSide {
 			// generate the go template using front/question template
-			return ParseCardTemplate(TemplateParseOptions{
+			front, err := ParseCardTemplate(TemplateParseOptions{
 				IsAnswer:         false,
 				CardTemplateName: opts.cardTmpl.Name,
 				CardTemplate:     opts.cardTmpl,
@@ -181,6 +164,8 @@ func SpecialFieldFilter(opts FieldReplacmentOptions, field string) (string, erro
 				FieldMap:         opts.fieldMap,
 				isFrontSide:      true,
 			})
+			// the answer is only typed in on the front
+			return REGEX_MATCH_TYPE_ANSWER.ReplaceAllString(front, ""), err
 		}
 		return "", fmt.Errorf("{{FrontSide}} only valid in back/answer template")
 	}
@@ -201,31 +186,46 @@ func FieldReplacementMap(config *config.Config, renderType string) template.Func
 				field = strings.ReplaceAll(field, "]", "")
 				return fmt.Sprintf("Show Extra: %s %s %s", color, field, RESET_COLOR)
 			}
+			if renderType == RENDER_STUDY && field != "" {
+				return fmt.Sprintf("Show Extra: %s", field)
+			}
 			return ""
 		},
-		"cloze": func(args ...string) (string, error) {
-			if renderType == RENDER_LIST {
+		"cloze": func(field string, cardOrd int, isAnswer bool) (string, error) {
+			switch renderType {
+			case RENDER_LIST:
 				color := ansi.ColorCode("blue")
-				if len(args) < 3 {
-					return "", fmt.Errorf("cloze requires at least cloze ord, card ord and content")
-				}
-
-				clozeOrd := args[0]
-				cardOrd := args[1]
-				content := args[2]
-				isAnswer := args[3]
-				if clozeOrd == cardOrd && isAnswer == "0" {
-					content = "[...]"
-				}
 				if config.Color.Hint != "" {
 					color = ansi.ColorCode(config.Color.Hint) // blue underline
 				}
-				return fmt.Sprintf("%s %s %s", color, content, RESET_COLOR), nil
+				return RenderClozes(field, cardOrd, isAnswer, func(content string) string {
+					return fmt.Sprintf("%s %s %s", color, content, RESET_COLOR)
+				}), nil
+			case RENDER_STUDY:
+				return RenderClozes(field, cardOrd, isAnswer, func(content string) string {
+					return fmt.Sprintf(`<span class="cloze">%s</span>`, content)
+				}), nil
 			}
 			return "", fmt.Errorf("could not determine how to render filter for type %v", renderType)
 		},
+		"clozeOnly": func(field string, cardOrd int) string {
+			return strings.Join(ClozeOnly(field, cardOrd), ", ")
+		},
+		"text": func(field string) string {
+			return html.UnescapeString(ParsePolicy.Sanitize(field))
+		},
+		"kana": func(field string) string {
+			return replaceFurigana(field, "${2}")
+		},
+		"kanji": func(field string) string {
+			return replaceFurigana(field, "${1}")
+		},
+		// the text is shown since it can not be read aloud
+		"tts": func(field string, args ...string) string {
+			return field
+		},
 		"furigana": func(field string) (string, error) {
-			if renderType == RENDER_LIST {
+			if renderType == RENDER_LIST || renderType == RENDER_STUDY {
 				re := regexp.MustCompile(`[(.*)]`)
 				kanjiField := re.ReplaceAllString(field, "")
 				result, err := kakasi.Transform(kanjiField, kakasi.WithFurigana())
@@ -240,3 +240,16 @@ func FieldReplacementMap(config *config.Config, renderType string) template.Func
 		},
 	}
 }
+
+// replaceFurigana replaces the kanji with their readings (ie: 漢字[かんじ]) by the template.
+// The sounds (ie: [sound:file.mp3]) are kept
+func replaceFurigana(field string, tmpl string) string {
+	field = strings.ReplaceAll(field, "&nbsp;", " ")
+	return REGEX_MATCH_FURIGANA.ReplaceAllStringFunc(field, func(match string) string {
+		parts := REGEX_MATCH_FURIGANA.FindStringSubmatchIndex(match)
+		if strings.HasPrefix(match[parts[4]:parts[5]], "sound:") {
+			return match
+		}
+		return string(REGEX_MATCH_FURIGANA.ExpandString(nil, tmpl, match, parts))
+	})
+}
@@ -0,0 +1,351 @@
+package template
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"html"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/aerex/go-anki/pkg/models"
+)
+
+var (
+	// [latex]...[/latex], [$]...[/$] and [$$]...[/$$] rendered as images by Anki
+	REGEX_MATCH_LATEX = regexp.MustCompile(`(?si)\[latex\](.+?)\[/latex\]|\[\$\](.+?)\[/\$\]|\[\$\$\](.+?)\[/\$\$\]`)
+	// \(...\) and \[...\] rendered by MathJax in Anki
+	REGEX_MATCH_MATHJAX = regexp.MustCompile(`(?s)\\\((.+?)\\\)|\\\[(.+?)\\\]`)
+	// the commands reading or writing files are not compiled
+	REGEX_MATCH_UNSAFE_LATEX = regexp.MustCompile(`\\(?:write|openout|openin|input|include|immediate|catcode|newread|newwrite|read)\b`)
+	REGEX_MATCH_LATEX_BR     = regexp.MustCompile(`(?i)<br( /)?>`)
+)
+
+// LATEX_COMMANDS compile tmp.tex to tmp.png in the directory they are run in like Anki
+var LATEX_COMMANDS = [][]string{
+	{"latex", "-interaction=nonstopmode", "tmp.tex"},
+	{"dvipng", "-bg", "Transparent", "-D", "200", "-T", "tight", "tmp.dvi", "-o", "tmp.png"},
+}
+
+// the preamble and the postamble of the note types without them
+const (
+	DEFAULT_LATEX_PRE = "\\documentclass[12pt]{article}\n\\special{papersize=3in,5in}\n\\usepackage[utf8]{inputenc}\n" +
+		"\\usepackage{amssymb,amsmath}\n\\pagestyle{empty}\n\\setlength{\\parindent}{0in}\n\\begin{document}\n"
+	DEFAULT_LATEX_POST = "\\end{document}"
+)
+
+// Latex is a LaTeX expression of a field rendered as an image
+type Latex struct {
+	// the LaTeX compiled between the preamble and the postamble of the note type
+	Text string
+	// the image in the media folder (ie: latex-<sha1>.png)
+	File string
+}
+
+// ExtractLatex returns the LaTeX expressions of a field in the order they appear. [$]...[/$] is inline math
+// and [$$]...[/$$] is display math
+func ExtractLatex(field string) []Latex {
+	var expressions []Latex
+	for _, match := range REGEX_MATCH_LATEX.FindAllStringSubmatch(field, -1) {
+		var text string
+		switch {
+		case match[1] != "":
+			text = match[1]
+		case match[2] != "":
+			text = "$" + match[2] + "$"
+		default:
+			text = "\\begin{displaymath}" + match[3] + "\\end{displaymath}"
+		}
+		// the line breaks of the editor are kept
+		text = html.UnescapeString(ParsePolicy.Sanitize(REGEX_MATCH_LATEX_BR.ReplaceAllString(text, "\n")))
+		expressions = append(expressions, Latex{
+			Text: text,
+			File: fmt.Sprintf("latex-%x.png", sha1.Sum([]byte(text+"png"))),
+		})
+	}
+	return expressions
+}
+
+// RenderLatexImages creates the images of the LaTeX expressions of the field missing from the media folder
+// with the preamble and the postamble of the note type. It returns the images of the field
+func RenderLatexImages(field string, noteType models.NoteType, mediaDir string) ([]string, error) {
+	var images []string
+	for _, latex := range ExtractLatex(field) {
+		images = append(images, latex.File)
+		if _, err := os.Stat(filepath.Join(mediaDir, latex.File)); err == nil {
+			continue
+		}
+		if err := renderLatexImage(latex, noteType, mediaDir); err != nil {
+			return nil, err
+		}
+	}
+	return images, nil
+}
+
+func renderLatexImage(latex Latex, noteType models.NoteType, mediaDir string) error {
+	if cmd := REGEX_MATCH_UNSAFE_LATEX.FindString(latex.Text); cmd != "" {
+		return fmt.Errorf("could not render %s: the command %s is not allowed", latex.Text, cmd)
+	}
+	pre, post := noteType.LatexPre, noteType.LatexPost
+	if pre == "" {
+		pre, post = DEFAULT_LATEX_PRE, DEFAULT_LATEX_POST
+	}
+	tmp, err := os.MkdirTemp("", "go-anki-latex-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	if err := os.WriteFile(filepath.Join(tmp, "tmp.tex"), []byte(pre+"\n"+latex.Text+"\n"+post), 0600); err != nil {
+		return err
+	}
+	for _, args := range LATEX_COMMANDS {
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Dir = tmp
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("could not render %s with %s: %w\n%s", latex.Text, args[0], err, out)
+		}
+	}
+	image, err := os.ReadFile(filepath.Join(tmp, "tmp.png"))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(mediaDir, latex.File), image, 0644)
+}
+
+// LatexToUnicode shows the LaTeX and the MathJax of a card as text with the unicode math symbols
+// (ie: \(\alpha^2 \leq \frac{1}{2}\) as α² ≤ 1/2) for the terminal
+func LatexToUnicode(text string) string {
+	for _, re := range []*regexp.Regexp{REGEX_MATCH_LATEX, REGEX_MATCH_MATHJAX} {
+		text = re.ReplaceAllStringFunc(text, func(match string) string {
+			groups := re.FindStringSubmatch(match)
+			for _, group := range groups[1:] {
+				if group != "" {
+					return mathToUnicode(group)
+				}
+			}
+			return match
+		})
+	}
+	return text
+}
+
+func mathToUnicode(math string) string {
+	c := &mathConverter{src: []rune(html.UnescapeString(math))}
+	return strings.TrimSpace(c.convert(0))
+}
+
+// mathConverter reads the LaTeX from the start of src to its end
+type mathConverter struct {
+	src []rune
+	pos int
+}
+
+// convert converts the LaTeX until the end or the rune closing the group
+func (c *mathConverter) convert(stop rune) string {
+	var out strings.Builder
+	for c.pos < len(c.src) {
+		r := c.src[c.pos]
+		switch r {
+		case stop:
+			c.pos++
+			return out.String()
+		case '{':
+			c.pos++
+			out.WriteString(c.convert('}'))
+		case '\\':
+			out.WriteString(c.command())
+		case '^', '_':
+			c.pos++
+			out.WriteString(script(c.argument(), r == '^'))
+		case '$':
+			c.pos++
+		case '~':
+			c.pos++
+			out.WriteRune(' ')
+		default:
+			c.pos++
+			out.WriteRune(r)
+		}
+	}
+	return out.String()
+}
+
+// argument converts the group, the command or the rune following a command
+func (c *mathConverter) argument() string {
+	for c.pos < len(c.src) && unicode.IsSpace(c.src[c.pos]) {
+		c.pos++
+	}
+	if c.pos >= len(c.src) {
+		return ""
+	}
+	switch c.src[c.pos] {
+	case '{':
+		c.pos++
+		return c.convert('}')
+	case '\\':
+		return c.command()
+	}
+	c.pos++
+	return string(c.src[c.pos-1])
+}
+
+// command converts the command at the backslash and its arguments
+func (c *mathConverter) command() string {
+	c.pos++
+	start := c.pos
+	for c.pos < len(c.src) && unicode.IsLetter(c.src[c.pos]) {
+		c.pos++
+	}
+	if c.pos == start && c.pos < len(c.src) {
+		c.pos++
+	}
+	name := string(c.src[start:c.pos])
+
+	if symbol, exists := mathSymbols[name]; exists {
+		return symbol
+	}
+	if accent, exists := mathAccents[name]; exists {
+		var out strings.Builder
+		for _, r := range c.argument() {
+			out.WriteRune(r)
+			out.WriteString(accent)
+		}
+		return out.String()
+	}
+	switch name {
+	case "frac", "dfrac", "tfrac":
+		numerator := c.argument()
+		return group(numerator) + "/" + group(c.argument())
+	case "sqrt":
+		root := "√"
+		if c.pos < len(c.src) && c.src[c.pos] == '[' {
+			c.pos++
+			switch degree := c.convert(']'); degree {
+			case "3":
+				root = "∛"
+			case "4":
+				root = "∜"
+			default:
+				root = script(degree, true) + root
+			}
+		}
+		return root + group(c.argument())
+	case "text", "textrm", "textbf", "textit", "mbox", "mathrm", "mathbf", "mathit", "mathsf", "mathtt",
+		"mathcal", "boldsymbol", "operatorname":
+		return c.argument()
+	case "mathbb":
+		var out strings.Builder
+		for _, r := range c.argument() {
+			if double, exists := doubleStruck[r]; exists {
+				r = double
+			}
+			out.WriteRune(r)
+		}
+		return out.String()
+	case "left", "right":
+		// \left. and \right. have no delimiter
+		if c.pos < len(c.src) && c.src[c.pos] == '.' {
+			c.pos++
+		}
+		return ""
+	case "begin", "end":
+		c.argument()
+		return ""
+	case "big", "Big", "bigg", "Bigg", "bigl", "bigr", "Bigl", "Bigr", "displaystyle", "textstyle", "limits", "nolimits", "!":
+		return ""
+	case ",", ";", ":", " ", "quad", "qquad", "\\":
+		return " "
+	case "{", "}", "%", "$", "&", "_", "#":
+		return name
+	}
+	return "\\" + name
+}
+
+// group puts the text in parentheses when it is more than one character
+func group(text string) string {
+	if utf8.RuneCountInString(text) > 1 {
+		return "(" + text + ")"
+	}
+	return text
+}
+
+// script returns the text in superscript or subscript when all its characters have one
+func script(text string, superscript bool) string {
+	scripts, mark := subscripts, "_"
+	if superscript {
+		scripts, mark = superscripts, "^"
+	}
+	var out strings.Builder
+	for _, r := range text {
+		s, exists := scripts[r]
+		if !exists {
+			return mark + group(text)
+		}
+		out.WriteRune(s)
+	}
+	return out.String()
+}
+
+var superscripts = map[rune]rune{
+	'0': '⁰', '1': '¹', '2': '²', '3': '³', '4': '⁴', '5': '⁵', '6': '⁶', '7': '⁷', '8': '⁸', '9': '⁹',
+	'+': '⁺', '-': '⁻', '−': '⁻', '=': '⁼', '(': '⁽', ')': '⁾', '∘': '°', '′': '′', '*': '*',
+	'a': 'ᵃ', 'b': 'ᵇ', 'c': 'ᶜ', 'd': 'ᵈ', 'e': 'ᵉ', 'f': 'ᶠ', 'g': 'ᵍ', 'h': 'ʰ', 'i': 'ⁱ', 'j': 'ʲ',
+	'k': 'ᵏ', 'l': 'ˡ', 'm': 'ᵐ', 'n': 'ⁿ', 'o': 'ᵒ', 'p': 'ᵖ', 'r': 'ʳ', 's': 'ˢ', 't': 'ᵗ', 'u': 'ᵘ',
+	'v': 'ᵛ', 'w': 'ʷ', 'x': 'ˣ', 'y': 'ʸ', 'z': 'ᶻ', 'T': 'ᵀ',
+}
+
+var subscripts = map[rune]rune{
+	'0': '₀', '1': '₁', '2': '₂', '3': '₃', '4': '₄', '5': '₅', '6': '₆', '7': '₇', '8': '₈', '9': '₉',
+	'+': '₊', '-': '₋', '−': '₋', '=': '₌', '(': '₍', ')': '₎',
+	'a': 'ₐ', 'e': 'ₑ', 'h': 'ₕ', 'i': 'ᵢ', 'j': 'ⱼ', 'k': 'ₖ', 'l': 'ₗ', 'm': 'ₘ', 'n': 'ₙ', 'o': 'ₒ',
+	'p': 'ₚ', 'r': 'ᵣ', 's': 'ₛ', 't': 'ₜ', 'u': 'ᵤ', 'v': 'ᵥ', 'x': 'ₓ',
+}
+
+var doubleStruck = map[rune]rune{
+	'C': 'ℂ', 'H': 'ℍ', 'N': 'ℕ', 'P': 'ℙ', 'Q': 'ℚ', 'R': 'ℝ', 'Z': 'ℤ',
+}
+
+// the combining characters of the accents (ie: \vec{v} as v⃗)
+var mathAccents = map[string]string{
+	"vec": "\u20d7", "hat": "\u0302", "bar": "\u0304", "overline": "\u0305", "dot": "\u0307", "ddot": "\u0308", "tilde": "\u0303",
+}
+
+var mathSymbols = map[string]string{
+	// greek letters
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ϵ", "varepsilon": "ε", "zeta": "ζ", "eta": "η",
+	"theta": "θ", "vartheta": "ϑ", "iota": "ι", "kappa": "κ", "lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ", "pi": "π",
+	"varpi": "ϖ", "rho": "ρ", "varrho": "ϱ", "sigma": "σ", "varsigma": "ς", "tau": "τ", "upsilon": "υ", "phi": "ϕ",
+	"varphi": "φ", "chi": "χ", "psi": "ψ", "omega": "ω",
+	"Gamma": "Γ", "Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ", "Pi": "Π", "Sigma": "Σ", "Upsilon": "Υ",
+	"Phi": "Φ", "Psi": "Ψ", "Omega": "Ω",
+	// operators and relations
+	"times": "×", "cdot": "⋅", "div": "÷", "pm": "±", "mp": "∓", "ast": "∗", "star": "⋆", "circ": "∘", "bullet": "•",
+	"leq": "≤", "le": "≤", "geq": "≥", "ge": "≥", "neq": "≠", "ne": "≠", "approx": "≈", "equiv": "≡", "sim": "∼",
+	"simeq": "≃", "cong": "≅", "propto": "∝", "ll": "≪", "gg": "≫", "mid": "∣", "parallel": "∥", "perp": "⊥",
+	"sum": "∑", "prod": "∏", "coprod": "∐", "int": "∫", "iint": "∬", "iiint": "∭", "oint": "∮",
+	"partial": "∂", "nabla": "∇", "infty": "∞", "prime": "′", "degree": "°",
+	// arrows
+	"to": "→", "rightarrow": "→", "leftarrow": "←", "gets": "←", "leftrightarrow": "↔", "Rightarrow": "⇒",
+	"Leftarrow": "⇐", "Leftrightarrow": "⇔", "implies": "⟹", "iff": "⟺", "mapsto": "↦", "uparrow": "↑",
+	"downarrow": "↓", "longrightarrow": "⟶", "longleftarrow": "⟵",
+	// sets and logic
+	"in": "∈", "notin": "∉", "ni": "∋", "subset": "⊂", "subseteq": "⊆", "supset": "⊃", "supseteq": "⊇",
+	"cup": "∪", "cap": "∩", "setminus": "∖", "emptyset": "∅", "varnothing": "∅", "forall": "∀", "exists": "∃",
+	"nexists": "∄", "neg": "¬", "lnot": "¬", "land": "∧", "wedge": "∧", "lor": "∨", "vee": "∨", "oplus": "⊕",
+	"otimes": "⊗",
+	// delimiters and dots
+	"langle": "⟨", "rangle": "⟩", "lfloor": "⌊", "rfloor": "⌋", "lceil": "⌈", "rceil": "⌉", "vert": "|",
+	"Vert": "‖", "lbrace": "{", "rbrace": "}", "ldots": "…", "dots": "…", "cdots": "⋯", "vdots": "⋮",
+	"ddots": "⋱",
+	// letters
+	"hbar": "ℏ", "ell": "ℓ", "Re": "ℜ", "Im": "ℑ", "aleph": "ℵ", "angle": "∠", "triangle": "△",
+	// functions
+	"sin": "sin", "cos": "cos", "tan": "tan", "cot": "cot", "sec": "sec", "csc": "csc", "arcsin": "arcsin",
+	"arccos": "arccos", "arctan": "arctan", "sinh": "sinh", "cosh": "cosh", "tanh": "tanh", "log": "log",
+	"ln": "ln", "exp": "exp", "lim": "lim", "max": "max", "min": "min", "sup": "sup", "inf": "inf", "det": "det",
+	"gcd": "gcd", "deg": "deg", "dim": "dim", "ker": "ker", "arg": "arg", "mod": "mod", "bmod": "mod",
+}
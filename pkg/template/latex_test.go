@@ -0,0 +1,80 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatexToUnicode(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "Inline LaTeX", text: "Area: [$]\\pi r^2[/$]", want: "Area: π r²"},
+		{name: "Display LaTeX", text: "[$$]\\sum_{i=1}^{n} x_i[/$$]", want: "∑ᵢ₌₁ⁿ xᵢ"},
+		{name: "LaTeX block", text: "[latex]$\\alpha \\leq \\beta$[/latex]", want: "α ≤ β"},
+		{name: "MathJax inline", text: "\\(\\frac{1}{2} \\times 3\\)", want: "1/2 × 3"},
+		{name: "MathJax display", text: "\\[\\sqrt{x+1} \\to \\infty\\]", want: "√(x+1) → ∞"},
+		{name: "Fraction of groups", text: "\\(\\frac{a+b}{c}\\)", want: "(a+b)/c"},
+		{name: "Roots", text: "\\(\\sqrt[3]{8} = \\sqrt[n]{x}\\)", want: "∛8 = ⁿ√x"},
+		{name: "Script without unicode", text: "\\(x^{\\alpha}\\)", want: "x^α"},
+		{name: "Degrees", text: "\\(90^\\circ\\)", want: "90°"},
+		{name: "Text and sets", text: "\\(\\forall x \\in \\mathbb{R}, \\text{x real}\\)", want: "∀ x ∈ ℝ, x real"},
+		{name: "Delimiters", text: "\\(\\left\\{ x \\right.\\)", want: "{ x"},
+		{name: "Accents", text: "\\(\\vec{v}\\)", want: "v\u20d7"},
+		{name: "Unknown command", text: "\\(\\foo{x}\\)", want: "\\foox"},
+		{name: "Html entities", text: "\\(a &lt; b\\)", want: "a < b"},
+		{name: "Text without math", text: "[...] costs $5", want: "[...] costs $5"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, LatexToUnicode(tt.text), tt.name)
+	}
+}
+
+func TestExtractLatex(t *testing.T) {
+	latex := ExtractLatex("[$]x^2[/$] and [$$]\\sum_i x_i[/$$] and [latex]a<br>b[/latex]")
+
+	assert.Equal(t, []Latex{
+		{Text: "$x^2$", File: "latex-026326cda34d40679435c991e5a4711df27dff8f.png"},
+		{Text: "\\begin{displaymath}\\sum_i x_i\\end{displaymath}", File: "latex-995c2f9875df9d8dfc5b28dfaa51c4b713b81e54.png"},
+		{Text: "a\nb", File: "latex-6b9bd414ccfde0f18887bfa6c05fa9dcd9183f88.png"},
+	}, latex)
+}
+
+func TestRenderLatexImages(t *testing.T) {
+	mediaDir := t.TempDir()
+	runs := filepath.Join(t.TempDir(), "runs")
+	commands := LATEX_COMMANDS
+	t.Cleanup(func() { LATEX_COMMANDS = commands })
+	// the image is the document compiled
+	LATEX_COMMANDS = [][]string{{"sh", "-c", "cat tmp.tex > tmp.png && echo run >> " + runs}}
+	noteType := models.NoteType{LatexPre: "pre", LatexPost: "post"}
+
+	images, err := RenderLatexImages("[$]x^2[/$]", noteType, mediaDir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"latex-026326cda34d40679435c991e5a4711df27dff8f.png"}, images)
+	image, err := os.ReadFile(filepath.Join(mediaDir, images[0]))
+	assert.NoError(t, err)
+	assert.Equal(t, "pre\n$x^2$\npost", string(image))
+
+	// the images in the media folder are not rendered again
+	_, err = RenderLatexImages("[$]x^2[/$]", noteType, mediaDir)
+	assert.NoError(t, err)
+	out, err := os.ReadFile(runs)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(out), "run"))
+
+	_, err = RenderLatexImages("[latex]\\input{/etc/passwd}[/latex]", noteType, mediaDir)
+	assert.ErrorContains(t, err, "\\input is not allowed")
+
+	LATEX_COMMANDS = [][]string{{"false"}}
+	_, err = RenderLatexImages("[$]y[/$]", noteType, mediaDir)
+	assert.Error(t, err)
+}
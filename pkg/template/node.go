@@ -1,4 +1,48 @@
 package template
 
+import "strings"
+
+// Node is a part of an Anki template
 type Node interface {
 }
+
+// TextNode is the text outside of the tags
+type TextNode struct {
+	Text string
+}
+
+// ReplacementNode is a field replaced by its value once the filters are applied in order (ie: {{text:hint:Field}}
+// applies hint and then text). The field is empty when it is only used by the filters (ie: {{filter:}})
+type ReplacementNode struct {
+	Field   string
+	Filters []string
+}
+
+// ConditionalNode shows its children when the field is not empty (ie: {{#Field}}) or when the field
+// is empty once negated (ie: {{^Field}})
+type ConditionalNode struct {
+	Field    string
+	Negated  bool
+	Children []Node
+}
+
+func newReplacementNode(tag string) ReplacementNode {
+	parts := strings.Split(tag, ":")
+	node := ReplacementNode{Field: parts[len(parts)-1]}
+	// the filter nearest to the field is applied first and the excess colons are ignored
+	for idx := len(parts) - 2; idx >= 0; idx-- {
+		if filter := strings.TrimSpace(parts[idx]); filter != "" {
+			node.Filters = append(node.Filters, filter)
+		}
+	}
+	return node
+}
+
+// Tag returns the content of the tag of the replacement (ie: text:hint:Field)
+func (n ReplacementNode) Tag() string {
+	parts := make([]string, 0, len(n.Filters)+1)
+	for idx := len(n.Filters) - 1; idx >= 0; idx-- {
+		parts = append(parts, n.Filters[idx])
+	}
+	return strings.Join(append(parts, n.Field), ":")
+}
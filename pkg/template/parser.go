@@ -2,6 +2,7 @@ package template
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/aerex/go-anki/pkg/models"
@@ -16,13 +17,75 @@ type TemplateParseOptions struct {
 	ReadStruct       dynamicstruct.Reader
 	FieldMap         map[string]string
 
-	inTag       bool
 	isFrontSide bool
-	fieldTag    string
 }
 
+// a field with only spaces and line breaks is empty
+var REGEX_MATCH_EMPTY_FIELD = regexp.MustCompile(`(?is)^(?:[[:space:]]|</?(?:br|div) ?/?>)*$`)
+
+// Parse reads the text, the field replacements and the conditionals of an Anki template
+func Parse(tmpl string) ([]Node, error) {
+	nodes, err := parseNodes(NewTokenizer(tmpl), tmpl, "", false)
+	if err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// parseNodes reads the nodes until the end of the template or the end of the section of the conditional
+func parseNodes(tz *Tokenizer, tmpl string, section string, nested bool) ([]Node, error) {
+	var nodes []Node
+	for {
+		switch tt := tz.Next(); tt {
+		case EndOfBuffer:
+			if err := tz.Err(); err != nil {
+				return nil, err
+			}
+			if nested {
+				return nil, fmt.Errorf("missing \"{{/%s}}\" conditional end tag in template %s", section, tmpl)
+			}
+			return nodes, nil
+		case TextToken:
+			nodes = append(nodes, TextNode{Text: tz.Text()})
+		case FieldReplacementToken:
+			nodes = append(nodes, newReplacementNode(tz.Text()))
+		case OpenConditionalToken, OpenNegatedToken:
+			field := tz.Text()
+			children, err := parseNodes(tz, tmpl, field, true)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, ConditionalNode{Field: field, Negated: tt == OpenNegatedToken, Children: children})
+		case CloseConditionalToken:
+			if !nested {
+				return nil, fmt.Errorf("found \"{{/%s}}\" conditional end tag without its opening tag in template %s", tz.Text(), tmpl)
+			}
+			if tz.Text() != section {
+				return nil, fmt.Errorf("found \"{{/%s}}\" conditional end tag; expected \"{{/%s}}\"", tz.Text(), section)
+			}
+			return nodes, nil
+		}
+	}
+}
+
+// FieldIsEmpty checks if the value of a field only has spaces and line breaks
+func FieldIsEmpty(value string) bool {
+	return REGEX_MATCH_EMPTY_FIELD.MatchString(value)
+}
+
+// ParseCardTemplate generates the go template of a side of the card. The conditionals are resolved
+// with the values of the fields of the card
 func ParseCardTemplate(opts TemplateParseOptions) (string, error) {
-	var output strings.Builder
+	var tmplFmt string
+	if opts.IsAnswer {
+		tmplFmt = opts.CardTemplate.AnswerFormat
+	} else {
+		tmplFmt = opts.CardTemplate.QuestionFormat
+	}
+	nodes, err := Parse(tmplFmt)
+	if err != nil {
+		return "", err
+	}
 	frOpts := FieldReplacmentOptions{
 		card:        opts.Card,
 		isFrontSide: opts.isFrontSide,
@@ -31,57 +94,62 @@ func ParseCardTemplate(opts TemplateParseOptions) (string, error) {
 		cardTmpl:    opts.CardTemplate,
 		fieldMap:    opts.FieldMap,
 	}
-	var tmplFmt string
-	if opts.IsAnswer {
-		tmplFmt = opts.CardTemplate.AnswerFormat
-	} else {
-		tmplFmt = opts.CardTemplate.QuestionFormat
+	var output strings.Builder
+	if err := writeNodes(&output, nodes, frOpts); err != nil {
+		return "", err
 	}
-	token := NewTokenizer(tmplFmt)
-	for token.HasNext() {
-		tt := token.Next()
-		switch tt {
-		case EndOfBuffer:
-			// Exceeded the buffer
-			// so return what we have in output
-			return output.String(), nil
-		case TextToken:
-			if opts.inTag {
-				if _, err := ParseCardTemplate(opts); err != nil {
-					return "", err
-				}
-			}
-			output.WriteString(token.Text())
-		case FieldReplacementToken:
-			frOpts.tmplFmt = token.Text()
-			fieldReplTmpl, err := FieldReplacement(frOpts)
+	return output.String(), nil
+}
+
+func writeNodes(output *strings.Builder, nodes []Node, opts FieldReplacmentOptions) error {
+	for _, node := range nodes {
+		switch node := node.(type) {
+		case TextNode:
+			output.WriteString(escapeText(node.Text))
+		case ReplacementNode:
+			opts.tmplFmt = node.Tag()
+			fieldReplTmpl, err := FieldReplacement(opts)
 			if err != nil {
-				return "", err
+				return err
 			}
 			output.WriteString(fieldReplTmpl)
-		case OpenConditionalToken:
-			if field := opts.ReadStruct.GetField(token.Text()); field != nil {
-				opts.inTag = true
-				opts.fieldTag = token.Text()
-				condTmpl, err := ParseCardTemplate(opts)
-				if err != nil {
-					return "", err
-				}
-				output.WriteString(condTmpl)
-			}
-		case CloseConditionalToken:
-			if !opts.inTag {
-				return "", fmt.Errorf("missing closing \"{{\" in template %s", tmplFmt)
+		case ConditionalNode:
+			nonEmpty, err := fieldNonEmpty(opts, node.Field)
+			if err != nil {
+				return err
 			}
-			closeTagName := token.Text()
-			if closeTagName != opts.fieldTag {
-				return "", fmt.Errorf("found \"{{\\%s}}\" conditional end tag; expected \"{{\\%s}}\"", closeTagName, opts.fieldTag)
+			if nonEmpty != node.Negated {
+				if err := writeNodes(output, node.Children, opts); err != nil {
+					return err
+				}
 			}
-			opts.inTag = false
-			opts.fieldTag = ""
 		}
 	}
+	return nil
+}
 
-	return output.String(), nil
+// fieldNonEmpty checks if the field of a conditional has a value. The fields missing from the note are empty
+func fieldNonEmpty(opts FieldReplacmentOptions, field string) (bool, error) {
+	if raw, isField := opts.fieldMap[field]; isField {
+		if value := opts.readStruct.GetField(raw); value != nil {
+			return !FieldIsEmpty(value.String()), nil
+		}
+		return false, nil
+	}
+	if field == "FrontSide" {
+		return opts.isAnswer, nil
+	}
+	if IsSpecialFields(field) {
+		value, err := SpecialFieldFilter(opts, field)
+		if err != nil {
+			return false, err
+		}
+		return !FieldIsEmpty(value), nil
+	}
+	return false, nil
 }
 
+// escapeText keeps the text of the template from being read as a go template
+func escapeText(text string) string {
+	return strings.ReplaceAll(text, "{{", `{{"{{"}}`)
+}
@@ -65,19 +65,24 @@ func TestParseCardTemplate(t *testing.T) {
 			goTemplates:   []string{"tag_a,tag_b {{.Field_0}}", "<hr id=answer>\n\n{{.Field_1}}"},
 			ankiTemplates: []string{"{{Tags}} {{Front}}", "<hr id=answer>\n\n{{Back}}"},
 		},
+		{
+			name:          "Template keeping the spaces between the fields",
+			goTemplates:   []string{"{{.Field_0}} means  {{.Field_1}}", "<hr id=answer>\n\n {{.Field_1}}"},
+			ankiTemplates: []string{"{{Front}} means  {{Back}}", "<hr id=answer>\n\n {{Back}}"},
+		},
 		{
 			name:          "Template using Type special field on list card",
-			goTemplates:   []string{"Test ", "<hr id=answer>\n\n{{.Field_1}}"},
+			goTemplates:   []string{"Test", "<hr id=answer>\n\n{{.Field_1}}"},
 			ankiTemplates: []string{"{{Type}}", "<hr id=answer>\n\n{{Back}}"},
 		},
 		{
 			name:          "Template using Subdeck special field on list card",
-			goTemplates:   []string{"Vocab ", "<hr id=answer>\n\n{{.Field_1}}"},
+			goTemplates:   []string{"Vocab", "<hr id=answer>\n\n{{.Field_1}}"},
 			ankiTemplates: []string{"{{Subdeck}}", "<hr id=answer>\n\n{{Back}}"},
 		},
 		{
 			name:          "Template using Card special field on list card",
-			goTemplates:   []string{"Basic ", "<hr id=answer>\n\n{{.Field_1}}"},
+			goTemplates:   []string{"Basic", "<hr id=answer>\n\n{{.Field_1}}"},
 			ankiTemplates: []string{"{{Card}}", "<hr id=answer>\n\n{{Back}}"},
 		},
 		{
@@ -90,11 +95,26 @@ func TestParseCardTemplate(t *testing.T) {
 			goTemplates:   []string{"{{tts .Field_0 \"ja_JP\" \"voices=Apple_Otoya,Microsoft_Haruka\"}}", "{{tts .Field_1 \"fr_FR\" \"speed=0.8\"}}"},
 			ankiTemplates: []string{"{{tts ja_JP voices=Apple_Otoya,Microsoft_Haruka:Front}}", "{{tts fr_FR speed=0.8:Back}}"},
 		},
+		{
+			name:          "Template using type in the answer",
+			goTemplates:   []string{"{{.Field_0}}\n\n[[type:Back]]", "{{.Field_0}}\n\n\n\n<hr id=answer>\n\n[[type:Back]]"},
+			ankiTemplates: []string{"{{Front}}\n\n{{type:Back}}", "{{FrontSide}}\n\n<hr id=answer>\n\n{{type:Back}}"},
+		},
+		{
+			name:          "Template using type in the answer of a cloze",
+			goTemplates:   []string{"{{cloze .Cloze_1 1 false}}[[type:cloze:Cloze]]", "[[type:cloze:Cloze]]"},
+			ankiTemplates: []string{"{{cloze:Cloze}}{{type:cloze:Cloze}}", "{{type:cloze:Cloze}}"},
+		},
 		{
 			name:          "Template using cloze",
-			goTemplates:   []string{"{{ cloze \"1\" \"1\" \"hidden text\" \"0\" }}", "{{ cloze \"1\" \"1\" \"hidden text\" \"1\" }}"},
+			goTemplates:   []string{"{{cloze .Cloze_1 1 false}}", "{{cloze .Cloze_1 1 true}}"},
 			ankiTemplates: []string{"{{cloze:Cloze}}", "{{cloze:Cloze}}"},
 		},
+		{
+			name:          "Template using cloze with other filters",
+			goTemplates:   []string{"{{cloze (text .Cloze_1) 1 false}}", "{{clozeOnly .Cloze_1 1}}"},
+			ankiTemplates: []string{"{{cloze:text:Cloze}}", "{{cloze-only:Cloze}}"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -130,3 +150,83 @@ func TestParseCardTemplate(t *testing.T) {
 		}
 	}
 }
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		nodes    []Node
+		isError  bool
+	}{
+		{
+			name:     "Template with text, replacements and a conditional",
+			template: "foo {{bar}} {{#baz}} quux {{/baz}}",
+			nodes: []Node{
+				TextNode{Text: "foo "},
+				ReplacementNode{Field: "bar"},
+				TextNode{Text: " "},
+				ConditionalNode{Field: "baz", Children: []Node{TextNode{Text: " quux "}}},
+			},
+		},
+		{
+			name:     "Template with a negated conditional",
+			template: "{{^baz}}{{/baz}}",
+			nodes:    []Node{ConditionalNode{Field: "baz", Negated: true}},
+		},
+		{
+			name:     "Template with nested conditionals",
+			template: "{{^E}}1{{#F}}2{{/F}}{{/E}}",
+			nodes: []Node{
+				ConditionalNode{Field: "E", Negated: true, Children: []Node{
+					TextNode{Text: "1"},
+					ConditionalNode{Field: "F", Children: []Node{TextNode{Text: "2"}}},
+				}},
+			},
+		},
+		{
+			name:     "Template with filters applied from the nearest to the field",
+			template: "{{a:b:c}}",
+			nodes:    []Node{ReplacementNode{Field: "c", Filters: []string{"b", "a"}}},
+		},
+		{
+			name:     "Template with spaces around the tags",
+			template: "{{ # foo }}{{ bar }}{{ / foo }}",
+			nodes:    []Node{ConditionalNode{Field: "foo", Children: []Node{ReplacementNode{Field: "bar"}}}},
+		},
+		{
+			name:     "Template with a closing delimiter in the text",
+			template: "text }} more",
+			nodes:    []Node{TextNode{Text: "text }} more"}},
+		},
+		{
+			name:     "Template changing the delimiters",
+			template: "{{=<% %>=}}<%foo%> {{bar}}",
+			nodes:    []Node{ReplacementNode{Field: "foo"}, TextNode{Text: " {{bar}}"}},
+		},
+		{name: "Template with an unclosed conditional", template: "{{#foo}}", isError: true},
+		{name: "Template with a conditional end tag only", template: "{{/foo}}", isError: true},
+		{name: "Template with a mismatched conditional end tag", template: "{{#foo}}{{/bar}}", isError: true},
+		{name: "Template with an unclosed tag", template: "{{", isError: true},
+		{name: "Template with an unclosed tag after text", template: " {{", isError: true},
+		{name: "Template with an unclosed tag between text", template: " {{ ", isError: true},
+	}
+
+	for _, tt := range tests {
+		nodes, err := Parse(tt.template)
+		if tt.isError {
+			assert.Error(t, err, tt.name)
+			continue
+		}
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.nodes, nodes, tt.name)
+	}
+}
+
+func TestFieldIsEmpty(t *testing.T) {
+	for _, value := range []string{"", " ", "<BR>", "<div />", " <br/>\n<div></div>"} {
+		assert.True(t, FieldIsEmpty(value), value)
+	}
+	for _, value := range []string{"x", "<div>x</div>", "<img src=a.png>"} {
+		assert.False(t, FieldIsEmpty(value), value)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	"github.com/aerex/go-anki/internal/config"
+	"github.com/aerex/go-anki/internal/utils"
 	"github.com/microcosm-cc/bluemonday"
 	dynamicstruct "github.com/ompluscator/dynamic-struct"
 
@@ -18,7 +19,8 @@ import (
 
 var ParsePolicy = bluemonday.StrictPolicy()
 
-func RenderCard(config *config.Config, card models.Card, cardTmpl models.CardTemplate) (models.CardQA, error) {
+// RenderCard renders the question and the answer of the card for the list (RENDER_LIST) or the study screen (RENDER_STUDY)
+func RenderCard(config *config.Config, card models.Card, cardTmpl models.CardTemplate, renderType string) (models.CardQA, error) {
 	readStruct, fieldMap, cardErr := generateCardStruct(card)
 	if cardErr != nil {
 		return models.CardQA{}, cardErr
@@ -32,7 +34,7 @@ func RenderCard(config *config.Config, card models.Card, cardTmpl models.CardTem
 
 	var questionBuffer bytes.Buffer
 	tmplParseOpts.IsAnswer = false
-	err := templateFromCard(config, tmplParseOpts, &questionBuffer)
+	err := templateFromCard(config, tmplParseOpts, renderType, &questionBuffer)
 	if err != nil {
 		return models.CardQA{}, err
 	}
@@ -42,60 +44,71 @@ func RenderCard(config *config.Config, card models.Card, cardTmpl models.CardTem
 		answerOnly           string
 	)
 	tmplParseOpts.IsAnswer = true
-	err = templateFromCard(config, tmplParseOpts, &answerQuestionBuffer)
+	err = templateFromCard(config, tmplParseOpts, renderType, &answerQuestionBuffer)
 	if err != nil {
 		return models.CardQA{}, err
 	}
 
+	// the math is shown as text in the terminal
+	questionHTML := LatexToUnicode(questionBuffer.String())
+	answerHTML := LatexToUnicode(answerQuestionBuffer.String())
+
 	// When we see  <hr id=answer> it is assumed that the content afterwards
 	// is the answer so use that for answer format
-	if strings.Contains(answerQuestionBuffer.String(), "<hr id=answer>") {
-		parts := strings.SplitAfter(answerQuestionBuffer.String(), "<hr id=answer>")
+	if strings.Contains(answerHTML, "<hr id=answer>") {
+		parts := strings.SplitAfter(answerHTML, "<hr id=answer>")
 		if len(parts) > 1 {
 			answerOnly = parts[1]
 		}
 	}
 
+	// the answers typed in are only shown by the study screen
+	question := REGEX_MATCH_TYPE_ANSWER.ReplaceAllString(questionHTML, "")
+	answerOnly = REGEX_MATCH_TYPE_ANSWER.ReplaceAllString(answerOnly, "")
 	return models.CardQA{
 		Card:            card,
-		Question:        strings.TrimSpace(html.UnescapeString(ParsePolicy.Sanitize(questionBuffer.String()))),
-		QuestionBrowser: questionBuffer.String(),
+		Question:        strings.TrimSpace(html.UnescapeString(ParsePolicy.Sanitize(question))),
+		QuestionBrowser: questionHTML,
 		Answer:          strings.TrimSpace(html.UnescapeString(ParsePolicy.Sanitize(answerOnly))),
-		AnswerBrowser:   answerQuestionBuffer.String(),
+		AnswerBrowser:   answerHTML,
 	}, nil
 }
 
 func generateCardStruct(card models.Card) (dynamicstruct.Reader, map[string]string, error) {
-	jsonStr := strings.Builder{}
-	jsonStr.WriteString("{")
 	fieldStruct := dynamicstruct.NewStruct()
 	fieldMap := make(map[string]string)
+	values := make(map[string]string)
 
 	for idx, field := range card.Note.Model.Fields {
 		name := field.Name
-		value := card.Note.Fields[field.Ordinal]
 		fieldName := fmt.Sprintf("Field_%d", idx)
 		fieldMap[name] = fieldName
 		fieldStruct.AddField(fieldName, "", `json:"`+fieldName+`"`)
-		fmt.Fprintf(&jsonStr, `"%s": "%s"`, fieldName, html.UnescapeString(ParsePolicy.Sanitize(strings.ReplaceAll(value, "\"", "\\\""))))
-		if idx < len(card.Note.Fields)-1 {
-			jsonStr.WriteString(",")
+		// the fields missing from the note are empty
+		if field.Ordinal >= len(card.Note.Fields) {
+			continue
 		}
+		// the images are kept as [image:file] since the html tags are removed
+		value := utils.MEDIA_IMG_REGEX.ReplaceAllString(card.Note.Fields[field.Ordinal], "[image:${1}]")
+		values[fieldName] = html.UnescapeString(ParsePolicy.Sanitize(value))
+	}
+	jsonStr, err := json.Marshal(values)
+	if err != nil {
+		return nil, nil, err
 	}
-	jsonStr.WriteString("}")
 	instance := fieldStruct.Build().New()
-	if err := json.Unmarshal([]byte(jsonStr.String()), &instance); err != nil {
+	if err := json.Unmarshal(jsonStr, &instance); err != nil {
 		return nil, nil, err
 	}
 	return dynamicstruct.NewReader(instance), fieldMap, nil
 }
-func templateFromCard(config *config.Config, opts TemplateParseOptions, tmplOut *bytes.Buffer) error {
+func templateFromCard(config *config.Config, opts TemplateParseOptions, renderType string, tmplOut *bytes.Buffer) error {
 	tmplFmt, err := ParseCardTemplate(opts)
 	if err != nil {
 		return err
 	}
 
-	t, err := LoadString(tmplFmt, config, RENDER_LIST)
+	t, err := LoadString(tmplFmt, config, renderType)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,116 @@
+package template
+
+import (
+	"testing"
+
+	"github.com/aerex/go-anki/internal/config"
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/mgutz/ansi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderCard(t *testing.T) {
+	card := models.Card{
+		Note: models.Note{
+			Model: models.NoteType{
+				Name: "Basic",
+				Fields: []*models.CardField{
+					{Name: "F", Ordinal: 0},
+					{Name: "B", Ordinal: 1},
+					{Name: "E", Ordinal: 2},
+					{Name: "J", Ordinal: 3},
+				},
+			},
+			Fields: models.NoteFields{"f", "b", " ", "test first[second] third[fourth] [sound:a.mp3]"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		question string
+		isError  bool
+	}{
+		{name: "Template with fields", template: "{{B}}A{{F}}", question: "bAf"},
+		{name: "Template with a conditional on an empty field", template: "{{#E}}A{{/E}}", question: ""},
+		{name: "Template with a conditional on a field", template: "{{#F}}A{{/F}}", question: "A"},
+		{name: "Template with a negated conditional on an empty field", template: "{{^E}}A{{/E}}", question: "A"},
+		{name: "Template with a negated conditional on a field", template: "{{^F}}A{{/F}}", question: ""},
+		{name: "Template with a conditional on a missing field", template: "{{#E}}}{{^M}}A{{/M}}{{/E}}}", question: "}"},
+		{name: "Template with nested conditionals", template: "{{^E}}1{{#F}}2{{#B}}{{F}}{{/B}}{{/F}}{{/E}}", question: "12f"},
+		{name: "Template with unknown filters", template: "{{one:two:B}}", question: "b"},
+		{name: "Template with an empty filter", template: "{{one::text:B}}", question: "b"},
+		{name: "Template with the text filter", template: "{{text:B}}", question: "b"},
+		{name: "Template with a filter without a field", template: "{{filter:}}", question: ""},
+		{name: "Template with the kana filter", template: "{{kana:J}}", question: "testsecondfourth [sound:a.mp3]"},
+		{name: "Template with the kanji filter", template: "{{kanji:J}}", question: "testfirstthird [sound:a.mp3]"},
+		{name: "Template with chained filters", template: "{{text:kanji:J}}", question: "testfirstthird [sound:a.mp3]"},
+		{name: "Template with a missing field", template: "{{X}}", isError: true},
+		{name: "Template with filters on a missing field", template: "{{foo:text:X}}", isError: true},
+		{name: "Template with a mismatched conditional", template: "{{#F}}{{/B}}", isError: true},
+	}
+
+	for _, tt := range tests {
+		qa, err := RenderCard(&config.Config{}, card, models.CardTemplate{
+			Name:           "Card 1",
+			QuestionFormat: tt.template,
+			AnswerFormat:   "{{FrontSide}}<hr id=answer>{{B}}",
+		}, RENDER_LIST)
+		if tt.isError {
+			assert.Error(t, err, tt.name)
+			continue
+		}
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.question, qa.Question, tt.name)
+	}
+}
+
+func TestRenderClozeCard(t *testing.T) {
+	note := models.Note{
+		Model: models.NoteType{
+			Name: "Cloze",
+			Type: models.ClozeCardType,
+			Fields: []*models.CardField{
+				{Name: "Text", Ordinal: 0},
+				{Name: "Extra", Ordinal: 1},
+			},
+		},
+		Fields: models.NoteFields{"{{c1::Canberra::city}} is the capital of {{c2::Australia}}", "{{c1::extra}}"},
+	}
+	cardTmpl := models.CardTemplate{
+		Name:           "Cloze",
+		QuestionFormat: "{{cloze:Text}}",
+		AnswerFormat:   "{{cloze:Text}}<br>{{cloze-only:Text}}",
+	}
+
+	tests := []struct {
+		name     string
+		ord      int
+		question string
+		answer   string
+	}{
+		{
+			name:     "First card with a hint",
+			ord:      0,
+			question: `<span class="cloze">[city]</span> is the capital of Australia`,
+			answer:   `<span class="cloze">Canberra</span> is the capital of Australia<br>Canberra`,
+		},
+		{
+			name:     "Second card",
+			ord:      1,
+			question: `Canberra is the capital of <span class="cloze">[...]</span>`,
+			answer:   `Canberra is the capital of <span class="cloze">Australia</span><br>Australia`,
+		},
+	}
+
+	for _, tt := range tests {
+		qa, err := RenderCard(&config.Config{}, models.Card{Ord: tt.ord, Note: note}, cardTmpl, RENDER_STUDY)
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.question, qa.QuestionBrowser, tt.name)
+		assert.Equal(t, tt.answer, qa.AnswerBrowser, tt.name)
+	}
+
+	qa, err := RenderCard(&config.Config{}, models.Card{Note: note}, cardTmpl, RENDER_LIST)
+	assert.NoError(t, err)
+	assert.Equal(t, ansi.ColorCode("blue")+" [city] "+RESET_COLOR+" is the capital of Australia", qa.Question)
+}
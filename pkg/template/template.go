@@ -29,6 +29,10 @@ const (
 	CARD_LIST               = "card-list"
 	CREATE_CARD             = "create-card"
 	LIST_NOTE_TYPES         = "list-note-types"
+	LIST_MEDIA              = "list-media"
+	LIST_BACKUP             = "list-backup"
+	EDIT_NOTE               = "edit-note"
+	EDIT_TAGS               = "edit-tags"
 )
 
 //go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 . Template
@@ -55,7 +59,7 @@ func LoadString(tmpl string, config *config.Config, renderType string) (*templat
 		Funcs(FieldReplacementMap(config, renderType)).
 		Parse(tmpl)
 	if err != nil {
-		return nil, nil
+		return nil, err
 	}
 	return t, nil
 }
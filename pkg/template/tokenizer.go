@@ -1,9 +1,8 @@
 package template
 
 import (
+	"fmt"
 	"strings"
-
-	"github.com/google/gapid/core/math/sint"
 )
 
 type TokenType uint32
@@ -39,9 +38,11 @@ type Token struct {
 }
 
 type Tokenizer struct {
-	src   string
-	cur   int
-	inTag bool
+	src string
+	cur int
+	// the delimiters of the tags, changed with {{=<% %>=}}
+	open  string
+	close string
 	buf   offset
 	tt    TokenType
 	err   error
@@ -49,7 +50,9 @@ type Tokenizer struct {
 
 func NewTokenizer(src string) *Tokenizer {
 	return &Tokenizer{
-		src: src,
+		src:   src,
+		open:  OPENINGTAG,
+		close: CLOSINGTAG,
 	}
 }
 
@@ -59,105 +62,83 @@ func (tz *Tokenizer) Text() string {
 	}
 	return ""
 }
+
 func (tz *Tokenizer) HasNext() bool {
 	return tz.cur < len(tz.src)
 }
 
-func (tz *Tokenizer) Next() TokenType {
-	var skipWhiteSpaceCount int
-	if tz.err != nil {
-		tz.tt = EndOfBuffer
-		return tz.tt
-	}
+// Err returns the error that stopped the tokenizer (ie: a tag without its closing delimiter)
+func (tz *Tokenizer) Err() error {
+	return tz.err
+}
 
-	var char string
-	for tz.cur < len(tz.src) {
-		char = tz.src[tz.cur : tz.cur+1]
-		if char == " " {
-			// skip spaces
-			tz.cur = tz.cur + 1
-			if tz.inTag {
-				skipWhiteSpaceCount = skipWhiteSpaceCount + 1
+// Next reads the next token of the template. The text outside of the tags is kept as is
+// and the content of the tags is trimmed
+func (tz *Tokenizer) Next() TokenType {
+	for tz.err == nil && tz.cur < len(tz.src) {
+		idx := strings.Index(tz.src[tz.cur:], tz.open)
+		if idx != 0 {
+			// the text until the next tag or the end of the template
+			end := len(tz.src)
+			if idx > 0 {
+				end = tz.cur + idx
 			}
-			continue
+			tz.buf = offset{start: tz.cur, end: end}
+			tz.cur = end
+			tz.tt = TextToken
+			return tz.tt
 		}
-		if tz.src[tz.cur:tz.cur+2] == OPENINGTAG {
-			// consume opening tag `` and skip to next char
-			tz.inTag = true
-
-			// if the current char is `` then only consume one char
-			tz.cur = tz.cur + 2
-			if char != "{" {
-				tz.cur = tz.cur + 3
-			}
 
-			tz.buf.start = tz.cur
-			continue
+		start := tz.cur + len(tz.open)
+		idx = strings.Index(tz.src[start:], tz.close)
+		if idx < 0 {
+			tz.err = fmt.Errorf("missing closing %q of the tag %q in template %s", tz.close, tz.src[tz.cur:], tz.src)
+			break
 		}
-
-		if tz.src[tz.cur:tz.cur+2] == CLOSINGTAG {
-			tz.inTag = false
-			tz.buf.end = tz.cur - skipWhiteSpaceCount
-
-			tz.cur = tz.cur + 2
-			if char != "}" {
-				tz.cur = tz.cur + 3
+		tz.buf = offset{start: start, end: start + idx}
+		tz.cur = start + idx + len(tz.close)
+
+		// {{=<% %>=}} replaces the delimiters of the next tags
+		content := strings.TrimSpace(tz.src[tz.buf.start:tz.buf.end])
+		if len(content) > 1 && strings.HasPrefix(content, "=") && strings.HasSuffix(content, "=") {
+			delimiters := strings.Fields(content[1 : len(content)-1])
+			if len(delimiters) != 2 {
+				tz.err = fmt.Errorf("invalid delimiters %q in template %s", content, tz.src)
+				break
 			}
-
-			return tz.tt
+			tz.open, tz.close = delimiters[0], delimiters[1]
+			continue
 		}
-		var idx int
-		if tz.inTag {
-			leadingChar := tz.src[tz.cur : tz.cur+1]
-			switch leadingChar {
-			case "#":
-				tz.tt = OpenConditionalToken
-			case "/":
-				tz.tt = CloseConditionalToken
-			case "^":
-				tz.tt = OpenNegatedToken
-			default:
-				tz.tt = FieldReplacementToken
-			}
-			// read until the end of token
-			idx = strings.Index(tz.src[tz.cur:], CLOSINGTAG)
-
-			// buffer content starts after the leading character
-			// only if token in not a field replacement
-			if tz.tt != FieldReplacementToken {
-				tz.buf.start = tz.cur + 1
-			} else {
-				tz.buf.start = tz.cur
-			}
 
-			// fast forward to end of token
-			tz.cur = tz.cur + idx
-		} else {
-			tz.buf.start = tz.cur
-			// Use the next opening tag to determine the end of buffer
-			idx = strings.Index(tz.src[tz.cur:], OPENINGTAG)
-			if idx < 0 {
-				// if next open tag does not exist assume the end of buffer
-				// is at the end of source string
-				idx = len(tz.src)
-				// Make sure we don't get index out of bounds by binding the end
-				tz.buf.end = sint.Min(tz.cur+idx, idx)
-			} else {
-				tz.buf.end = tz.cur + idx
-			}
-			tz.tt = TextToken
-			tz.cur = tz.cur + idx
-
-			// If next position of the cursor exceeds the buffer
-			// we should return EndOfBuffer
-			if tz.buf.start > tz.buf.end {
-				tz.tt = EndOfBuffer
-			}
-			return tz.tt
+		tz.tt = FieldReplacementToken
+		switch {
+		case strings.HasPrefix(content, "#"):
+			tz.tt = OpenConditionalToken
+		case strings.HasPrefix(content, "/"):
+			tz.tt = CloseConditionalToken
+		case strings.HasPrefix(content, "^"):
+			tz.tt = OpenNegatedToken
 		}
+		tz.trimTag(tz.tt != FieldReplacementToken)
+		return tz.tt
 	}
 
 	tz.tt = EndOfBuffer
 	return tz.tt
+}
 
+// trimTag removes the spaces around the content of the tag and its leading character
+func (tz *Tokenizer) trimTag(leadingChar bool) {
+	for tz.buf.start < tz.buf.end && strings.ContainsRune(" \t\r\n", rune(tz.src[tz.buf.start])) {
+		tz.buf.start++
+	}
+	if leadingChar {
+		tz.buf.start++
+	}
+	for tz.buf.start < tz.buf.end && strings.ContainsRune(" \t\r\n", rune(tz.src[tz.buf.start])) {
+		tz.buf.start++
+	}
+	for tz.buf.end > tz.buf.start && strings.ContainsRune(" \t\r\n", rune(tz.src[tz.buf.end-1])) {
+		tz.buf.end--
+	}
 }
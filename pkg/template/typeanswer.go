@@ -0,0 +1,156 @@
+package template
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aerex/go-anki/internal/utils"
+	"github.com/aerex/go-anki/pkg/models"
+)
+
+// {{type:Field}}, {{type:nc:Field}} or {{type:cloze:Field}} once the card is rendered
+var REGEX_MATCH_TYPE_ANSWER = regexp.MustCompile(`\[\[type:(?:nc:)?(?:(cloze):)?([^\]]+)\]\]`)
+
+type DiffKind int
+
+const (
+	// the text typed in matches the expected text
+	DiffGood DiffKind = iota
+	// the text typed in is not expected
+	DiffBad
+	// the expected text was not typed in
+	DiffMissed
+)
+
+// DiffSegment is a part of the comparison between the answer typed in and the expected answer
+type DiffSegment struct {
+	Kind DiffKind
+	Text string
+}
+
+// TypeAnswer is the field of the note the answer is typed in for
+type TypeAnswer struct {
+	Field string
+	// the answer is the text of the clozes of the card
+	Cloze bool
+}
+
+// FindTypeAnswer returns the field to type in the answer for when the rendered question has one
+func FindTypeAnswer(question string) (TypeAnswer, bool) {
+	match := REGEX_MATCH_TYPE_ANSWER.FindStringSubmatch(question)
+	if match == nil {
+		return TypeAnswer{}, false
+	}
+	return TypeAnswer{Field: match[2], Cloze: match[1] != ""}, true
+}
+
+// Expected returns the answer expected for the card without its html
+func (t TypeAnswer) Expected(card models.Card) (string, error) {
+	var value string
+	found := false
+	for _, field := range card.Note.Model.Fields {
+		if field.Name == t.Field && field.Ordinal < len(card.Note.Fields) {
+			value, found = card.Note.Fields[field.Ordinal], true
+			break
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("could not find field %s to type in the answer for", t.Field)
+	}
+	if !t.Cloze {
+		return utils.StripHTMLAndMedia(value), nil
+	}
+	// the text of the clozes of the card, only once when they are all the same
+	var clozes []string
+	distinct := make(map[string]bool)
+	for _, cloze := range ClozeOnly(value, card.Ord+1) {
+		cloze = utils.StripHTMLAndMedia(cloze)
+		clozes = append(clozes, cloze)
+		distinct[cloze] = true
+	}
+	if len(distinct) == 1 {
+		return clozes[0], nil
+	}
+	return strings.Join(clozes, ", "), nil
+}
+
+// CompareAnswer compares the answer typed in with the expected answer character by character like Anki.
+// The given segments are the text typed in, good or bad, and the correct segments are the expected text,
+// good or missed. The html of the expected answer and the combining characters (ie: accents) are ignored
+func CompareAnswer(typed, expected string) (given []DiffSegment, correct []DiffSegment, err error) {
+	if typed, err = utils.NormalizeString(typed); err != nil {
+		return nil, nil, err
+	}
+	if expected, err = utils.NormalizeString(utils.StripHTMLAndMedia(expected)); err != nil {
+		return nil, nil, err
+	}
+	a, b := []rune(typed), []rune(expected)
+	var i, j int
+	for _, block := range matchingBlocks(a, b) {
+		given = appendSegment(given, DiffBad, a[i:block.a])
+		correct = appendSegment(correct, DiffMissed, b[j:block.b])
+		given = appendSegment(given, DiffGood, a[block.a:block.a+block.size])
+		correct = appendSegment(correct, DiffGood, b[block.b:block.b+block.size])
+		i, j = block.a+block.size, block.b+block.size
+	}
+	given = appendSegment(given, DiffBad, a[i:])
+	correct = appendSegment(correct, DiffMissed, b[j:])
+	return given, correct, nil
+}
+
+func appendSegment(segments []DiffSegment, kind DiffKind, text []rune) []DiffSegment {
+	if len(text) == 0 {
+		return segments
+	}
+	if len(segments) > 0 && segments[len(segments)-1].Kind == kind {
+		segments[len(segments)-1].Text += string(text)
+		return segments
+	}
+	return append(segments, DiffSegment{Kind: kind, Text: string(text)})
+}
+
+// match is a block of size runes matching at a in the first text and b in the second text
+type match struct {
+	a, b, size int
+}
+
+// matchingBlocks returns the blocks matching in a and b in order like the SequenceMatcher of python:
+// the longest block matching and the blocks matching before and after it
+func matchingBlocks(a, b []rune) []match {
+	var blocks []match
+	var find func(alo, ahi, blo, bhi int)
+	find = func(alo, ahi, blo, bhi int) {
+		block := longestMatch(a, b, alo, ahi, blo, bhi)
+		if block.size == 0 {
+			return
+		}
+		find(alo, block.a, blo, block.b)
+		blocks = append(blocks, block)
+		find(block.a+block.size, ahi, block.b+block.size, bhi)
+	}
+	find(0, len(a), 0, len(b))
+	return blocks
+}
+
+// longestMatch returns the first longest block matching in a[alo:ahi] and b[blo:bhi]
+func longestMatch(a, b []rune, alo, ahi, blo, bhi int) match {
+	best := match{a: alo, b: blo}
+	// the sizes of the blocks ending at the previous rune of a by rune of b
+	sizes := make([]int, bhi-blo+1)
+	for i := alo; i < ahi; i++ {
+		next := make([]int, bhi-blo+1)
+		for j := blo; j < bhi; j++ {
+			if a[i] != b[j] {
+				continue
+			}
+			size := sizes[j-blo] + 1
+			next[j-blo+1] = size
+			if size > best.size {
+				best = match{a: i - size + 1, b: j - size + 1, size: size}
+			}
+		}
+		sizes = next
+	}
+	return best
+}
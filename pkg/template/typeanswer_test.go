@@ -0,0 +1,97 @@
+package template
+
+import (
+	"testing"
+
+	"github.com/aerex/go-anki/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindTypeAnswer(t *testing.T) {
+	typeAnswer, found := FindTypeAnswer("{{.Field_0}}\n\n[[type:Back]]")
+	assert.True(t, found)
+	assert.Equal(t, TypeAnswer{Field: "Back"}, typeAnswer)
+
+	typeAnswer, found = FindTypeAnswer("[[type:cloze:Text]]")
+	assert.True(t, found)
+	assert.Equal(t, TypeAnswer{Field: "Text", Cloze: true}, typeAnswer)
+
+	typeAnswer, found = FindTypeAnswer("[[type:nc:Back]]")
+	assert.True(t, found)
+	assert.Equal(t, TypeAnswer{Field: "Back"}, typeAnswer)
+
+	_, found = FindTypeAnswer("{{.Field_0}}")
+	assert.False(t, found)
+}
+
+func TestExpected(t *testing.T) {
+	card := models.Card{
+		Ord: 1,
+		Note: models.Note{
+			Model: models.NoteType{
+				Fields: []*models.CardField{{Name: "Text", Ordinal: 0}, {Name: "Back", Ordinal: 1}},
+			},
+			Fields: models.NoteFields{
+				"{{c1::Paris}} is the capital of {{c2::France::country}}, {{c2::France}}",
+				"<div>la&nbsp;<b>tour</b> Eiffel</div><br>[sound:paris.mp3]",
+			},
+		},
+	}
+
+	expected, err := TypeAnswer{Field: "Back"}.Expected(card)
+	assert.NoError(t, err)
+	assert.Equal(t, "la tour Eiffel", expected)
+
+	// the clozes of the second card
+	expected, err = TypeAnswer{Field: "Text", Cloze: true}.Expected(card)
+	assert.NoError(t, err)
+	assert.Equal(t, "France", expected)
+
+	card.Note.Fields[0] = "{{c2::Paris}} is the capital of {{c2::France}}"
+	expected, err = TypeAnswer{Field: "Text", Cloze: true}.Expected(card)
+	assert.NoError(t, err)
+	assert.Equal(t, "Paris, France", expected)
+
+	_, err = TypeAnswer{Field: "Extra"}.Expected(card)
+	assert.Error(t, err)
+}
+
+func TestCompareAnswer(t *testing.T) {
+	tests := []struct {
+		typed    string
+		expected string
+		given    []DiffSegment
+		correct  []DiffSegment
+	}{
+		{
+			typed:    "cafe",
+			expected: "<b>café</b>",
+			given:    []DiffSegment{{DiffGood, "cafe"}},
+			correct:  []DiffSegment{{DiffGood, "cafe"}},
+		},
+		{
+			typed:    "helo wrld",
+			expected: "hello world",
+			given:    []DiffSegment{{DiffGood, "helo wrld"}},
+			correct: []DiffSegment{{DiffGood, "he"}, {DiffMissed, "l"}, {DiffGood, "lo w"}, {DiffMissed, "o"},
+				{DiffGood, "rld"}},
+		},
+		{
+			typed:    "kat",
+			expected: "cat",
+			given:    []DiffSegment{{DiffBad, "k"}, {DiffGood, "at"}},
+			correct:  []DiffSegment{{DiffMissed, "c"}, {DiffGood, "at"}},
+		},
+		{
+			typed:    "",
+			expected: "dog",
+			correct:  []DiffSegment{{DiffMissed, "dog"}},
+		},
+	}
+	for _, tt := range tests {
+		given, correct, err := CompareAnswer(tt.typed, tt.expected)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.given, given, tt.typed)
+		assert.Equal(t, tt.correct, correct, tt.typed)
+	}
+}
@@ -0,0 +1,231 @@
+// Package textimport reads the notes of delimited text files (.csv, .tsv, .txt)
+// including the header directives understood by the text importer of anki desktop
+// See https://docs.ankiweb.net/importing/text-files.html#file-headers
+package textimport
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The delimiters tried in order when the file does not set a separator
+var guessedDelimiters = []rune{'\t', '|', ';', ':', ',', ' '}
+
+var separatorNames = map[string]rune{
+	"comma":     ',',
+	"semicolon": ';',
+	"tab":       '\t',
+	"space":     ' ',
+	"pipe":      '|',
+	"colon":     ':',
+}
+
+// File is a parsed text file
+type File struct {
+	Delimiter rune
+	// The fields already contain html when true.
+	// Otherwise the fields are escaped before being added to notes
+	HTML bool
+	// Set by the #notetype, #deck and #tags directives
+	NoteType string
+	Deck     string
+	Tags     []string
+	// The names of the columns set by the #columns directive
+	Columns []string
+	// The 1-based index of the columns holding the note type, the deck and the tags.
+	// 0 when the file has no such column
+	NoteTypeColumn int
+	DeckColumn     int
+	TagsColumn     int
+	Rows           []Row
+}
+
+// Row is a line of the file split in columns
+type Row struct {
+	// The line of the row in the file
+	Line    int
+	Columns []string
+}
+
+// Column returns the value of a 1-based column or an empty string when the row is too short
+func (r Row) Column(idx int) string {
+	if idx < 1 || idx > len(r.Columns) {
+		return ""
+	}
+	return r.Columns[idx-1]
+}
+
+// Field converts the value of a column to the html stored in a note field
+func (f *File) Field(value string) string {
+	if f.HTML {
+		return value
+	}
+	value = html.EscapeString(value)
+	return strings.ReplaceAll(value, "\n", "<br>")
+}
+
+// IsSpecial reports if a 1-based column holds the note type, the deck or the tags
+func (f *File) IsSpecial(idx int) bool {
+	return idx == f.NoteTypeColumn || idx == f.DeckColumn || idx == f.TagsColumn
+}
+
+// Parse reads the header directives and the rows of a file.
+// The delimiter is guessed from the first row when the file has no #separator directive
+func Parse(r io.Reader) (*File, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("file is not encoded in utf-8")
+	}
+
+	f := &File{}
+	// the header is made of the lines starting with # at the top of the file
+	headerLines := 0
+	offset := 0
+	for offset < len(data) && data[offset] == '#' {
+		line := data[offset:]
+		if end := bytes.IndexByte(line, '\n'); end != -1 {
+			line = line[:end+1]
+		}
+		offset += len(line)
+		headerLines++
+		if err := f.directive(strings.TrimRight(string(line), "\r\n")); err != nil {
+			return nil, fmt.Errorf("line %d: %w", headerLines, err)
+		}
+	}
+	body := data[offset:]
+
+	if f.Delimiter == 0 {
+		f.Delimiter = guessDelimiter(body)
+	}
+	reader := csv.NewReader(bytes.NewReader(body))
+	reader.Comma = f.Delimiter
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		f.Rows = append(f.Rows, Row{Line: headerLines + line, Columns: record})
+	}
+	return f, nil
+}
+
+func (f *File) directive(line string) error {
+	key, value, found := strings.Cut(strings.TrimPrefix(line, "#"), ":")
+	if !found {
+		// a comment
+		return nil
+	}
+	key = strings.ToLower(strings.TrimSpace(key))
+	value = strings.TrimSpace(value)
+	var err error
+	switch key {
+	case "separator":
+		f.Delimiter, err = parseSeparator(value)
+	case "html":
+		f.HTML, err = strconv.ParseBool(value)
+	case "tags":
+		f.Tags = strings.Fields(value)
+	case "columns":
+		f.Columns = nil
+		// the columns are separated by the delimiter which may be set after this directive
+		for _, name := range strings.FieldsFunc(value, func(r rune) bool {
+			return r == '\t' || r == ',' || r == ';' || r == '|' || r == ':'
+		}) {
+			f.Columns = append(f.Columns, strings.TrimSpace(name))
+		}
+	case "notetype":
+		f.NoteType = value
+	case "deck":
+		f.Deck = value
+	case "notetype column":
+		f.NoteTypeColumn, err = parseColumn(value)
+	case "deck column":
+		f.DeckColumn, err = parseColumn(value)
+	case "tags column":
+		f.TagsColumn, err = parseColumn(value)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid #%s directive: %w", key, err)
+	}
+	return nil
+}
+
+func parseSeparator(value string) (rune, error) {
+	if sep, exists := separatorNames[strings.ToLower(value)]; exists {
+		return sep, nil
+	}
+	if utf8.RuneCountInString(value) == 1 {
+		r, _ := utf8.DecodeRuneInString(value)
+		if r != '"' && r != '\r' && r != '\n' {
+			return r, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported separator %q", value)
+}
+
+func parseColumn(value string) (int, error) {
+	idx, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if idx < 1 {
+		return 0, fmt.Errorf("columns start at 1")
+	}
+	return idx, nil
+}
+
+// guessDelimiter picks the first known delimiter found in the first row
+func guessDelimiter(body []byte) rune {
+	for _, line := range strings.Split(string(body), "\n") {
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, delim := range guessedDelimiters {
+			if strings.ContainsRune(line, delim) {
+				return delim
+			}
+		}
+		break
+	}
+	return '\t'
+}
+
+// ParseMapping reads a list of field=column pairs (ie: "Front=1,Back=2") where columns start at 1
+func ParseMapping(mapping string) (map[string]int, error) {
+	fields := make(map[string]int)
+	for _, pair := range strings.Split(mapping, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, value, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, fmt.Errorf("expected field=column but got %q", pair)
+		}
+		idx, err := parseColumn(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid column for field %s: %w", name, err)
+		}
+		fields[strings.TrimSpace(name)] = idx
+	}
+	return fields, nil
+}
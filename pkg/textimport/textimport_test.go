@@ -0,0 +1,84 @@
+package textimport
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGuessesDelimiter(t *testing.T) {
+	tests := map[string]struct {
+		content   string
+		delimiter rune
+	}{
+		"tab":       {"front\tback\n", '\t'},
+		"semicolon": {"front;back\n", ';'},
+		"comma":     {"front,back\n", ','},
+		"pipe":      {"a,b|c\n", '|'},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, err := Parse(strings.NewReader(test.content))
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.delimiter, f.Delimiter)
+			assert.Len(t, f.Rows, 1)
+		})
+	}
+}
+
+func TestParseDirectives(t *testing.T) {
+	content := "#separator:Semicolon\n" +
+		"#html:true\n" +
+		"# a comment\n" +
+		"#notetype:Basic\n" +
+		"#deck:Grammar\n" +
+		"#tags:verbs irregular\n" +
+		"#tags column:3\n" +
+		"#columns:Front;Back;Tags\n" +
+		"go, went;<b>aller</b>;french\n" +
+		"\n" +
+		"\"multi\nline\";back;\n"
+
+	f, err := Parse(strings.NewReader(content))
+
+	assert.NoError(t, err)
+	assert.Equal(t, ';', f.Delimiter)
+	assert.True(t, f.HTML)
+	assert.Equal(t, "Basic", f.NoteType)
+	assert.Equal(t, "Grammar", f.Deck)
+	assert.Equal(t, []string{"verbs", "irregular"}, f.Tags)
+	assert.Equal(t, 3, f.TagsColumn)
+	assert.Equal(t, []string{"Front", "Back", "Tags"}, f.Columns)
+	assert.Equal(t, []Row{
+		{Line: 9, Columns: []string{"go, went", "<b>aller</b>", "french"}},
+		{Line: 11, Columns: []string{"multi\nline", "back", ""}},
+	}, f.Rows)
+}
+
+func TestParseInvalidDirective(t *testing.T) {
+	_, err := Parse(strings.NewReader("#html:maybe\nfront\tback\n"))
+
+	assert.EqualError(t, err, "line 1: invalid #html directive: strconv.ParseBool: parsing \"maybe\": invalid syntax")
+}
+
+func TestField(t *testing.T) {
+	f := &File{}
+	assert.Equal(t, "a &lt; b<br>c", f.Field("a < b\nc"))
+
+	f.HTML = true
+	assert.Equal(t, "a <b>b</b>", f.Field("a <b>b</b>"))
+}
+
+func TestParseMapping(t *testing.T) {
+	mapping, err := ParseMapping("Front=1, Back = 3")
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"Front": 1, "Back": 3}, mapping)
+
+	_, err = ParseMapping("Front")
+	assert.EqualError(t, err, "expected field=column but got \"Front\"")
+	_, err = ParseMapping("Front=0")
+	assert.EqualError(t, err, "invalid column for field Front: columns start at 1")
+}
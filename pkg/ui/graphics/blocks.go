@@ -0,0 +1,68 @@
+package graphics
+
+import (
+	"image"
+	"image/color"
+)
+
+// asciiRamp are the characters drawing the pixels from the darkest to the lightest
+const asciiRamp = " .:-=+*#%@"
+
+// Cell is a character of the terminal drawing a part of an image.
+// A transparent color is the background of the terminal
+type Cell struct {
+	Rune rune
+	Fg   color.RGBA
+	Bg   color.RGBA
+}
+
+// HalfBlocks draws the image in cols x rows cells with the upper half block character.
+// Each cell draws two pixels, the upper one with the foreground color and the lower one with the background color
+func HalfBlocks(img image.Image, cols, rows int) [][]Cell {
+	scaled := Scale(img, cols, rows*2)
+	cells := make([][]Cell, rows)
+	for y := range cells {
+		cells[y] = make([]Cell, cols)
+		for x := range cells[y] {
+			cells[y][x] = Cell{Rune: '▀', Fg: opaque(scaled.RGBAAt(x, y*2)), Bg: opaque(scaled.RGBAAt(x, y*2+1))}
+		}
+	}
+	return cells
+}
+
+// ASCII draws the image in cols x rows characters chosen by the luminance of the pixels.
+// The transparent pixels are blank
+func ASCII(img image.Image, cols, rows int) []string {
+	scaled := Scale(img, cols, rows)
+	lines := make([]string, rows)
+	for y := range lines {
+		line := make([]byte, cols)
+		for x := range line {
+			pixel := scaled.RGBAAt(x, y)
+			if pixel.A < 128 {
+				line[x] = ' '
+				continue
+			}
+			gray := color.GrayModel.Convert(opaque(pixel)).(color.Gray).Y
+			line[x] = asciiRamp[int(gray)*(len(asciiRamp)-1)/255]
+		}
+		lines[y] = string(line)
+	}
+	return lines
+}
+
+// opaque removes the alpha of a pixel, a pixel mostly transparent becomes fully transparent
+func opaque(pixel color.RGBA) color.RGBA {
+	if pixel.A < 128 {
+		return color.RGBA{}
+	}
+	if pixel.A == 255 {
+		return pixel
+	}
+	return color.RGBA{
+		R: uint8(uint32(pixel.R) * 255 / uint32(pixel.A)),
+		G: uint8(uint32(pixel.G) * 255 / uint32(pixel.A)),
+		B: uint8(uint32(pixel.B) * 255 / uint32(pixel.A)),
+		A: 255,
+	}
+}
@@ -0,0 +1,103 @@
+package graphics
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"strings"
+)
+
+// Protocol is the way the images are drawn in the terminal
+type Protocol string
+
+const (
+	ProtocolNone      Protocol = "none"
+	ProtocolASCII     Protocol = "ascii"
+	ProtocolHalfBlock Protocol = "halfblock"
+	ProtocolSixel     Protocol = "sixel"
+	ProtocolKitty     Protocol = "kitty"
+)
+
+// The size in pixels of a cell of the terminal assumed to scale the images sent to the terminal
+const (
+	CellWidth  = 10
+	CellHeight = 20
+)
+
+// Detect returns the protocol set by name or guesses the best protocol supported by the terminal
+// from the environment when name is empty or auto
+func Detect(name string, getenv func(string) string) (Protocol, error) {
+	switch Protocol(strings.ToLower(name)) {
+	case ProtocolNone, ProtocolASCII, ProtocolHalfBlock, ProtocolSixel, ProtocolKitty:
+		return Protocol(strings.ToLower(name)), nil
+	case "", "auto":
+	default:
+		return ProtocolNone, fmt.Errorf("unknown image protocol %s, expected auto, kitty, sixel, halfblock, ascii or none", name)
+	}
+	term, program := getenv("TERM"), getenv("TERM_PROGRAM")
+	switch {
+	case term == "xterm-kitty" || getenv("KITTY_WINDOW_ID") != "" || program == "WezTerm" || program == "ghostty":
+		return ProtocolKitty, nil
+	case strings.Contains(term, "sixel") || strings.HasPrefix(term, "foot") || strings.HasPrefix(term, "mlterm") ||
+		strings.HasPrefix(term, "contour") || program == "iTerm.app":
+		return ProtocolSixel, nil
+	case getenv("COLORTERM") == "truecolor" || getenv("COLORTERM") == "24bit" || strings.Contains(term, "256color"):
+		return ProtocolHalfBlock, nil
+	}
+	return ProtocolASCII, nil
+}
+
+// Load decodes a png, jpeg or gif image
+func Load(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+// Fit returns the number of cells covered by the image scaled down to fit in cols x rows
+func Fit(img image.Image, cols, rows int) (int, int) {
+	bounds := img.Bounds()
+	if bounds.Empty() || cols <= 0 || rows <= 0 {
+		return 0, 0
+	}
+	scale := 1.0
+	width, height := float64(bounds.Dx())/CellWidth, float64(bounds.Dy())/CellHeight
+	if width > float64(cols) {
+		scale = float64(cols) / width
+	}
+	if height*scale > float64(rows) {
+		scale = float64(rows) / height
+	}
+	return max(1, int(width*scale+0.5)), max(1, int(height*scale+0.5))
+}
+
+// Scale resizes the image to width x height pixels by averaging the pixels covered by each pixel
+func Scale(img image.Image, width, height int) *image.RGBA {
+	bounds := img.Bounds()
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*bounds.Dy()/height)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := max(x0+1, bounds.Min.X+(x+1)*bounds.Dx()/width)
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a, n = r+pr, g+pg, b+pb, a+pa, n+1
+				}
+			}
+			scaled.SetRGBA(x, y, color.RGBA{R: uint8(r / n >> 8), G: uint8(g / n >> 8), B: uint8(b / n >> 8), A: uint8(a / n >> 8)})
+		}
+	}
+	return scaled
+}
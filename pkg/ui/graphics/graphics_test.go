@@ -0,0 +1,103 @@
+package graphics
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(name string) string { return vars[name] }
+}
+
+// checker returns an image with a white left half and a black right half
+func checker(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < width/2 {
+				img.SetRGBA(x, y, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+			} else {
+				img.SetRGBA(x, y, color.RGBA{A: 255})
+			}
+		}
+	}
+	return img
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name     string
+		vars     map[string]string
+		expected Protocol
+	}{
+		{"", map[string]string{"TERM": "xterm-kitty"}, ProtocolKitty},
+		{"auto", map[string]string{"TERM": "xterm-256color", "TERM_PROGRAM": "WezTerm"}, ProtocolKitty},
+		{"", map[string]string{"TERM": "foot"}, ProtocolSixel},
+		{"", map[string]string{"TERM": "xterm-256color"}, ProtocolHalfBlock},
+		{"", map[string]string{"TERM": "xterm", "COLORTERM": "truecolor"}, ProtocolHalfBlock},
+		{"", map[string]string{"TERM": "vt100"}, ProtocolASCII},
+		{"Sixel", map[string]string{"TERM": "xterm-kitty"}, ProtocolSixel},
+		{"none", nil, ProtocolNone},
+	}
+	for _, tt := range tests {
+		protocol, err := Detect(tt.name, env(tt.vars))
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expected, protocol, tt.vars)
+	}
+
+	_, err := Detect("braille", env(nil))
+	assert.Error(t, err)
+}
+
+func TestFit(t *testing.T) {
+	// 40x10 cells at its size
+	img := checker(400, 200)
+	cols, rows := Fit(img, 80, 20)
+	assert.Equal(t, 40, cols)
+	assert.Equal(t, 10, rows)
+
+	cols, rows = Fit(img, 20, 20)
+	assert.Equal(t, 20, cols)
+	assert.Equal(t, 5, rows)
+
+	cols, rows = Fit(img, 80, 5)
+	assert.Equal(t, 20, cols)
+	assert.Equal(t, 5, rows)
+}
+
+func TestHalfBlocksAndASCII(t *testing.T) {
+	img := checker(40, 40)
+
+	cells := HalfBlocks(img, 4, 2)
+	assert.Len(t, cells, 2)
+	assert.Equal(t, '▀', cells[0][0].Rune)
+	assert.Equal(t, color.RGBA{R: 255, G: 255, B: 255, A: 255}, cells[0][0].Fg)
+	assert.Equal(t, color.RGBA{A: 255}, cells[1][3].Bg)
+
+	assert.Equal(t, []string{"@@  ", "@@  "}, ASCII(img, 4, 2))
+}
+
+func TestEncodeSixel(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, EncodeSixel(&out, checker(40, 40), 2, 1))
+
+	sixel := out.String()
+	assert.True(t, strings.HasPrefix(sixel, "\x1bP0;1q\"1;1;20;20"))
+	assert.True(t, strings.HasSuffix(sixel, "-\x1b\\"))
+	// each full band of 6 rows ends with the black half drawn as a run of full sixels
+	assert.Equal(t, 3, strings.Count(sixel, "!10~-"))
+}
+
+func TestEncodeKitty(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, EncodeKitty(&out, checker(400, 400), 4, 2))
+
+	kitty := out.String()
+	assert.True(t, strings.HasPrefix(kitty, "\x1b_Ga=T,f=100,q=2,C=1,c=4,r=2,m="))
+	assert.True(t, strings.HasSuffix(kitty, "\x1b\\"))
+}
@@ -0,0 +1,44 @@
+package graphics
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+)
+
+// the size of the chunks of the base64 payload
+const kittyChunkSize = 4096
+
+// KittyDeleteAll removes the images shown in the terminal with the kitty graphics protocol
+const KittyDeleteAll = "\x1b_Ga=d,q=2\x1b\\"
+
+// EncodeKitty writes the image as a png shown in cols x rows cells at the cursor with the kitty graphics protocol.
+// The cursor does not move and the terminal does not answer to not interfere with the input
+// @see https://sw.kovidgoyal.net/kitty/graphics-protocol/
+func EncodeKitty(w io.Writer, img image.Image, cols, rows int) error {
+	var data bytes.Buffer
+	if err := png.Encode(&data, img); err != nil {
+		return err
+	}
+	payload := base64.StdEncoding.EncodeToString(data.Bytes())
+	for start := 0; start < len(payload); start += kittyChunkSize {
+		end := min(start+kittyChunkSize, len(payload))
+		more := 0
+		if end < len(payload) {
+			more = 1
+		}
+		var err error
+		if start == 0 {
+			_, err = fmt.Fprintf(w, "\x1b_Ga=T,f=100,q=2,C=1,c=%d,r=%d,m=%d;%s\x1b\\", cols, rows, more, payload[start:end])
+		} else {
+			_, err = fmt.Fprintf(w, "\x1b_Gm=%d;%s\x1b\\", more, payload[start:end])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package graphics
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"io"
+)
+
+// EncodeSixel writes the image scaled to cols x rows cells as a sixel sequence.
+// The colors are reduced to the web safe palette with dithering and the transparent pixels are left untouched
+// @see https://vt100.net/docs/vt3xx-gp/chapter14.html
+func EncodeSixel(w io.Writer, img image.Image, cols, rows int) error {
+	scaled := Scale(img, cols*CellWidth, rows*CellHeight)
+	bounds := scaled.Bounds()
+	colors := append(color.Palette{}, palette.WebSafe...)
+	paletted := image.NewPaletted(bounds, colors)
+	draw.FloydSteinberg.Draw(paletted, bounds, scaled, image.Point{})
+
+	out := bufio.NewWriter(w)
+	// 0;1 keeps the pixels that are not set and "1;1 is the aspect ratio of the pixels
+	fmt.Fprintf(out, "\x1bP0;1q\"1;1;%d;%d", bounds.Dx(), bounds.Dy())
+	for idx, c := range colors {
+		r, g, b, _ := c.RGBA()
+		fmt.Fprintf(out, "#%d;2;%d;%d;%d", idx, r*100/0xffff, g*100/0xffff, b*100/0xffff)
+	}
+	for top := 0; top < bounds.Dy(); top += 6 {
+		// the sixels of each color in the band of 6 rows
+		bands := make(map[int][]byte)
+		var order []int
+		for x := 0; x < bounds.Dx(); x++ {
+			for bit := 0; bit < 6 && top+bit < bounds.Dy(); bit++ {
+				if scaled.RGBAAt(x, top+bit).A < 128 {
+					continue
+				}
+				idx := int(paletted.ColorIndexAt(x, top+bit))
+				if bands[idx] == nil {
+					bands[idx] = make([]byte, bounds.Dx())
+					order = append(order, idx)
+				}
+				bands[idx][x] |= 1 << bit
+			}
+		}
+		for i, idx := range order {
+			if i > 0 {
+				// back to the start of the band
+				out.WriteByte('$')
+			}
+			fmt.Fprintf(out, "#%d", idx)
+			writeSixels(out, bands[idx])
+		}
+		out.WriteByte('-')
+	}
+	out.WriteString("\x1b\\")
+	return out.Flush()
+}
+
+// writeSixels writes the sixels of a color in a band with run-length encoding
+func writeSixels(out *bufio.Writer, sixels []byte) {
+	for x := 0; x < len(sixels); {
+		run := 1
+		for x+run < len(sixels) && sixels[x+run] == sixels[x] {
+			run++
+		}
+		char := sixels[x] + '?'
+		if run > 3 {
+			fmt.Fprintf(out, "!%d%c", run, char)
+		} else {
+			for i := 0; i < run; i++ {
+				out.WriteByte(char)
+			}
+		}
+		x += run
+	}
+}
@@ -0,0 +1,31 @@
+package screen
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+// the clozes are marked by characters kept by the conversion to markdown until they are colored
+const (
+	clozeStart = "\uE000"
+	clozeEnd   = "\uE001"
+)
+
+var (
+	clozeRe = regexp.MustCompile(`(?s)<span class="cloze">(.*?)</span>`)
+	// the brackets are escaped by the conversion to markdown
+	bracketReplacer = strings.NewReplacer(`\[`, "[", `\]`, "]")
+	clozeReplacer   = strings.NewReplacer(clozeStart, "[blue::b]", clozeEnd, "[-::-]")
+)
+
+// markClozes replaces the clozes of the html of a side of the card by the marks of markdownClozes
+func markClozes(text string) string {
+	return clozeRe.ReplaceAllString(text, clozeStart+"${1}"+clozeEnd)
+}
+
+// markdownClozes returns the markdown of a side of the card as the text of tview with the clozes in bold blue
+func markdownClozes(markdown string) string {
+	return clozeReplacer.Replace(tview.Escape(bracketReplacer.Replace(markdown)))
+}
@@ -0,0 +1,238 @@
+package screen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"path/filepath"
+	"regexp"
+
+	"github.com/aerex/go-anki/internal/utils"
+	"github.com/aerex/go-anki/pkg/ui/graphics"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+var (
+	hrRe = regexp.MustCompile(`(?i)<hr[^>]*>`)
+	// the images of the fields are rendered as [image:file]
+	imageRe = regexp.MustCompile(`(?i)\[image:([^\]]+)\]`)
+)
+
+// imagePlacement is an image written to the terminal with the kitty or the sixel protocol
+type imagePlacement struct {
+	file string
+	x    int
+	y    int
+	cols int
+	rows int
+}
+
+// cardMedia removes the images and the sounds from the html of a side of the card and returns
+// their files in the order they appear. The sounds are replaced by a note
+func cardMedia(text string) (string, []string, []string) {
+	text = utils.MEDIA_IMG_REGEX.ReplaceAllString(text, "[image:${1}]")
+	var images []string
+	for _, match := range imageRe.FindAllStringSubmatch(text, -1) {
+		images = append(images, html.UnescapeString(match[1]))
+	}
+	sounds := soundFiles(text)
+	text = imageRe.ReplaceAllString(text, "")
+	text = utils.MEDIA_SOUND_REGEX.ReplaceAllString(text, "♪")
+	return text, images, sounds
+}
+
+func soundFiles(text string) []string {
+	var sounds []string
+	for _, match := range utils.MEDIA_SOUND_REGEX.FindAllStringSubmatch(text, -1) {
+		sounds = append(sounds, html.UnescapeString(match[1]))
+	}
+	return sounds
+}
+
+// sounds returns the sounds of the question or the sounds of the answer without the question
+func (q *StudyView) sounds(answer bool) []string {
+	question := soundFiles(q.qa.QuestionBrowser)
+	if !answer {
+		return question
+	}
+	sounds := soundFiles(q.qa.AnswerBrowser)
+	// the answer usually starts with the question
+	if len(sounds) < len(question) {
+		return sounds
+	}
+	for idx, sound := range question {
+		if sounds[idx] != sound {
+			return sounds
+		}
+	}
+	return sounds[len(question):]
+}
+
+// playSounds stops the sounds playing and plays the files one after the other
+func (q *StudyView) playSounds(files []string) {
+	q.stopSounds()
+	if len(files) == 0 || q.media.Play == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	q.cancelSounds = cancel
+	go func() {
+		for _, file := range files {
+			if err := q.media.Play(ctx, filepath.Join(q.media.Dir, filepath.Base(file))); err != nil {
+				if ctx.Err() == nil {
+					q.Log.Error().Err(err).Msgf("failed to play %s", file)
+				}
+				return
+			}
+		}
+	}()
+}
+
+func (q *StudyView) stopSounds() {
+	if q.cancelSounds != nil {
+		q.cancelSounds()
+		q.cancelSounds = nil
+	}
+}
+
+// autoplay plays the sounds of the side shown when the deck plays them automatically
+func (q *StudyView) autoplay() {
+	if q.conf.Autoplay {
+		q.playSounds(q.sounds(q.showAnswer))
+	} else {
+		q.stopSounds()
+	}
+}
+
+// replay plays the sounds of the side shown again. The sounds of the question are played
+// before the sounds of the answer when the deck replays the question
+func (q *StudyView) replay() {
+	sounds := q.sounds(q.showAnswer)
+	if q.showAnswer && q.conf.Replayq {
+		sounds = append(q.sounds(false), sounds...)
+	}
+	q.playSounds(sounds)
+}
+
+// image returns the image decoded from the media folder or nil when it can not be shown
+func (q *StudyView) image(file string) image.Image {
+	if img, cached := q.images[file]; cached {
+		return img
+	}
+	var img image.Image
+	if !utils.REMOTE_MEDIA_REGEX.MatchString(file) {
+		var err error
+		if img, err = graphics.Load(filepath.Join(q.media.Dir, filepath.Base(file))); err != nil {
+			q.Log.Error().Err(err).Msgf("failed to load image %s", file)
+			img = nil
+		}
+	}
+	q.images[file] = img
+	return img
+}
+
+// drawImages draws the images side by side in the area. The images drawn by the terminal
+// are only placed and written once the screen is drawn
+func (q *StudyView) drawImages(screen tcell.Screen, files []string, x, y, width, height int) {
+	if len(files) == 0 || width <= 0 || height <= 0 {
+		return
+	}
+	slot := width / len(files)
+	for idx, file := range files {
+		left := x + idx*slot
+		img := q.image(file)
+		if img == nil || q.protocol == graphics.ProtocolNone {
+			tview.Print(screen, tview.Escape(fmt.Sprintf("[image: %s]", file)), left, y, slot, tview.AlignCenter, tcell.ColorGray)
+			continue
+		}
+		cols, rows := graphics.Fit(img, slot, height)
+		left += (slot - cols) / 2
+		switch q.protocol {
+		case graphics.ProtocolKitty, graphics.ProtocolSixel:
+			q.placements = append(q.placements, imagePlacement{file: file, x: left, y: y, cols: cols, rows: rows})
+		case graphics.ProtocolHalfBlock:
+			for row, cells := range graphics.HalfBlocks(img, cols, rows) {
+				for col, cell := range cells {
+					char, style := halfBlockStyle(cell)
+					screen.SetContent(left+col, y+row, char, nil, style)
+				}
+			}
+		case graphics.ProtocolASCII:
+			for row, line := range graphics.ASCII(img, cols, rows) {
+				for col, char := range line {
+					screen.SetContent(left+col, y+row, char, nil, tcell.StyleDefault)
+				}
+			}
+		}
+	}
+}
+
+// halfBlockStyle returns the character and the style of a cell drawn with half blocks.
+// The transparent halves show the background of the terminal
+func halfBlockStyle(cell graphics.Cell) (rune, tcell.Style) {
+	style := tcell.StyleDefault
+	switch {
+	case cell.Fg.A == 0 && cell.Bg.A == 0:
+		return ' ', style
+	case cell.Fg.A == 0:
+		return '▄', style.Foreground(tcellColor(cell.Bg))
+	case cell.Bg.A == 0:
+		return cell.Rune, style.Foreground(tcellColor(cell.Fg))
+	}
+	return cell.Rune, style.Foreground(tcellColor(cell.Fg)).Background(tcellColor(cell.Bg))
+}
+
+func tcellColor(c color.RGBA) tcell.Color {
+	return tcell.NewRGBColor(int32(c.R), int32(c.G), int32(c.B))
+}
+
+// placeImages writes the images placed by the last draw to the terminal once the screen is drawn.
+// The images are only written again when they change and the cells under them are locked so they
+// are not drawn over
+func (q *StudyView) placeImages(screen tcell.Screen) {
+	placements := q.placements
+	// the images would cover the dialogs and the summary
+	if name, _ := q.pages.GetFrontPage(); name != "study" {
+		placements = nil
+	}
+	key := fmt.Sprint(placements)
+	if key == q.placed {
+		return
+	}
+	for _, p := range q.drawn {
+		screen.LockRegion(p.x, p.y, p.cols, p.rows, false)
+	}
+	q.drawn, q.placed = nil, key
+	tty, ok := screen.Tty()
+	if !ok {
+		return
+	}
+	var out bytes.Buffer
+	if q.protocol == graphics.ProtocolKitty {
+		out.WriteString(graphics.KittyDeleteAll)
+	}
+	for _, p := range placements {
+		var encoded bytes.Buffer
+		var err error
+		if q.protocol == graphics.ProtocolKitty {
+			err = graphics.EncodeKitty(&encoded, q.images[p.file], p.cols, p.rows)
+		} else {
+			err = graphics.EncodeSixel(&encoded, q.images[p.file], p.cols, p.rows)
+		}
+		if err != nil {
+			q.Log.Error().Err(err).Msgf("failed to encode image %s", p.file)
+			continue
+		}
+		// the cursor is moved back where it was once the image is written
+		fmt.Fprintf(&out, "\x1b7\x1b[%d;%dH%s\x1b8", p.y+1, p.x+1, encoded.Bytes())
+		screen.LockRegion(p.x, p.y, p.cols, p.rows, true)
+		q.drawn = append(q.drawn, p)
+	}
+	if _, err := tty.Write(out.Bytes()); err != nil {
+		q.Log.Error().Err(err).Msg("failed to write the images to the terminal")
+	}
+}
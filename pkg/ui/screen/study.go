@@ -1,14 +1,20 @@
 package screen
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"image"
+	"os"
 	"strings"
+	"time"
 
 	md "github.com/JohannesKaufmann/html-to-markdown"
-	"github.com/PuerkitoBio/goquery"
 	"github.com/aerex/go-anki/api/sql/sqlite/services"
-	sched "github.com/aerex/go-anki/api/sql/sqlite/services/sched/v2"
+	"github.com/aerex/go-anki/api/sql/sqlite/services/sched"
 	"github.com/aerex/go-anki/pkg/models"
+	"github.com/aerex/go-anki/pkg/template"
+	"github.com/aerex/go-anki/pkg/ui/graphics"
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 	"github.com/rs/zerolog"
@@ -16,110 +22,155 @@ import (
 
 type QuestionAnswerView struct {
 	*tview.Box
-	ColService     services.ColService
-	DeckService    services.DeckService
-	SchedService   sched.SchedService
-	QAs            []*models.CardQA
-	Log            *zerolog.Logger
-	markdownRender *md.Converter
-	currentQA      int
-	showAnswerQA   map[int]bool
-	primatives     map[string]tview.Primitive
+	study *StudyView
+}
+
+// flagColors are the colors of the flags 1-7 of a card
+var flagColors = []string{"", "red", "orange", "green", "blue", "pink", "turquoise", "purple"}
+var flagNames = []string{"", "Red", "Orange", "Green", "Blue", "Pink", "Turquoise", "Purple"}
+
+// studyAction is an action of the session that can be undone
+type studyAction struct {
+	// the card shown again once the action is undone
+	card   models.ID
+	answer bool
+}
+
+// sessionAnswer is an answer given during the session
+type sessionAnswer struct {
+	ease models.Ease
+	// the time taken to answer in milliseconds
+	taken int64
 }
 
 type StudyView struct {
 	ColService     services.ColService
-	DeckService    services.DeckService
+	CardService    services.CardService
+	NoteService    services.NoteService
+	StatService    services.StatService
 	SchedService   sched.SchedService
-	QAs            []*models.CardQA
+	UndoService    *services.UndoService
 	Log            *zerolog.Logger
 	markdownRender *md.Converter
-	currentQA      int
-	primatives     map[string]tview.Primitive
-	showAnswerQA   map[int]bool
-	app            *tview.Application
+	render         func(models.Card) (models.CardQA, error)
+	edit           models.EditNoteFunc
+	media          models.StudyMedia
+	protocol       graphics.Protocol
+	// the images decoded by file, nil when the image can not be shown
+	images map[string]image.Image
+	// the images placed by the last draw, the images written to the terminal and their key
+	placements   []imagePlacement
+	drawn        []imagePlacement
+	placed       string
+	cancelSounds context.CancelFunc
+	// the card being studied and its question and answer
+	card       *models.Card
+	qa         models.CardQA
+	conf       models.DeckConfig
+	showAnswer bool
+	marked     bool
+	// the field of the answer to type in, the answer typed in and the answer expected
+	typeAnswer template.TypeAnswer
+	typing     bool
+	typed      string
+	expected   string
+	// the actions of the session that can be undone, the last action last
+	actions []studyAction
+	answers []sessionAnswer
+	// the next key sets the flag of the card
+	flagging   bool
+	primatives map[string]tview.Primitive
+	statsView  *tview.TextView
+	statusView *tview.TextView
+	timerView  *tview.TextView
+	easeView   *tview.Flex
+	typeInput  *tview.InputField
+	pages      *tview.Pages
+	app        *tview.Application
 }
 
-func NewQuestionAnswerView(QAs []*models.CardQA, log *zerolog.Logger,
-	ds services.DeckService, ss sched.SchedService, cs services.ColService, p map[string]tview.Primitive) *QuestionAnswerView {
+func NewQuestionAnswerView(study *StudyView) *QuestionAnswerView {
 	view := &QuestionAnswerView{
-		Box:            tview.NewBox(),
-		QAs:            QAs,
-		ColService:     cs,
-		SchedService:   ss,
-		DeckService:    ds,
-		markdownRender: md.NewConverter("", true, nil),
-		primatives:     p,
-		Log:            log,
-		showAnswerQA:   make(map[int]bool),
+		Box:   tview.NewBox(),
+		study: study,
 	}
-	p["QA"] = view
-	view.primatives = p
+	study.primatives["QA"] = view
 	return view
 }
 
-func NewStudyView(QAs []*models.CardQA, log *zerolog.Logger,
-	ds services.DeckService, ss sched.SchedService, cs services.ColService, p map[string]tview.Primitive) *StudyView {
+func NewStudyView(log *zerolog.Logger, render func(models.Card) (models.CardQA, error), edit models.EditNoteFunc,
+	media models.StudyMedia, protocol graphics.Protocol, ss sched.SchedService, cs services.ColService, cds services.CardService, ns services.NoteService,
+	sts services.StatService, us *services.UndoService, p map[string]tview.Primitive) *StudyView {
+	markdownRender := md.NewConverter("", true, nil)
 	return &StudyView{
-		QAs:            QAs,
 		ColService:     cs,
+		CardService:    cds,
+		NoteService:    ns,
+		StatService:    sts,
 		SchedService:   ss,
-		DeckService:    ds,
-		markdownRender: md.NewConverter("", true, nil),
+		UndoService:    us,
+		markdownRender: markdownRender,
+		render:         render,
+		edit:           edit,
+		media:          media,
+		protocol:       protocol,
+		images:         make(map[string]image.Image),
 		Log:            log,
 		app:            tview.NewApplication(),
 		primatives:     p,
-		showAnswerQA:   make(map[int]bool),
 	}
 }
 
 func (q *QuestionAnswerView) Draw(screen tcell.Screen) {
 	q.DrawForSubclass(screen, q)
 	x, y, width, height := q.GetInnerRect()
-	q.markdownRender.AddRules(md.Rule{
-		Filter: []string{"hr"},
-		Replacement: func(content string, sel *goquery.Selection, opt *md.Options) *string {
-			breakln := "\\hr"
-			return &breakln
-		},
-	})
 	var qaText string
-	if q.showAnswerQA[q.currentQA] {
-		qaText = q.QAs[q.currentQA].AnswerBrowser
+	if q.study.showAnswer {
+		qaText = q.study.qa.AnswerBrowser
 	} else {
-		qaText = q.QAs[q.currentQA].QuestionBrowser
+		qaText = q.study.qa.QuestionBrowser
 	}
 
-	q.Log.Debug().Msg(qaText)
+	q.study.Log.Debug().Msg(qaText)
 
-	markdownText, err := q.markdownRender.ConvertString(qaText)
-	if err != nil {
-		q.Log.Fatal().Err(err).Msgf("failed to convert html to markdown for %s", qaText)
-	}
-	parts := strings.Split(markdownText, "\\hr")
+	q.study.placements = nil
+	parts := hrRe.Split(qaText, -1)
 	if len(parts) > 1 {
-		tview.Print(screen, parts[0], x, y+height/4, width, tview.AlignCenter, tcell.ColorWhite)
+		q.drawPart(screen, parts[0], x, y+height/4, width, height/4)
 		hr := strings.Repeat(string(tview.Borders.Horizontal), (x+width)/2)
 		tview.Print(screen, hr, x, y+height/2, width, tview.AlignCenter, tcell.ColorWhite)
-		tview.Print(screen, parts[1], x, y+height/2+1, width, tview.AlignCenter, tcell.ColorWhite)
+		q.drawPart(screen, parts[1], x, y+height/2+1, width, height-height/2-1)
 	} else {
-		tview.Print(screen, markdownText, x, y+height/4, width, tview.AlignCenter, tcell.ColorWhite)
+		q.drawPart(screen, qaText, x, y+height/4, width, height-height/4)
+	}
+}
+
+// drawPart draws the text of a part of the card with the comparison of the answer typed in and its images below
+func (q *QuestionAnswerView) drawPart(screen tcell.Screen, text string, x, y, width, height int) {
+	text, images, _ := cardMedia(text)
+	// the answer is typed in below the card
+	typeAnswer := template.REGEX_MATCH_TYPE_ANSWER.MatchString(text)
+	text = template.REGEX_MATCH_TYPE_ANSWER.ReplaceAllString(text, "")
+	markdownText, err := q.study.markdownRender.ConvertString(markClozes(text))
+	if err != nil {
+		q.study.Log.Fatal().Err(err).Msgf("failed to convert html to markdown for %s", text)
+	}
+	tview.Print(screen, markdownClozes(markdownText), x, y, width, tview.AlignCenter, tcell.ColorWhite)
+	y, height = y+1, height-1
+	if typeAnswer && q.study.showAnswer && q.study.typing {
+		for _, line := range q.study.comparison() {
+			tview.Print(screen, line, x, y, width, tview.AlignCenter, tcell.ColorWhite)
+			y, height = y+1, height-1
+		}
 	}
+	q.study.drawImages(screen, images, x, y, width, height)
 }
 
 func (q *QuestionAnswerView) InputHandler() func(event *tcell.EventKey, setFocus func(p tview.Primitive)) {
 	return q.WrapInputHandler(func(event *tcell.EventKey, setFocus func(p tview.Primitive)) {
-		switch event.Rune() {
-		case 'u':
-			q.currentQA--
-			if q.currentQA < 0 {
-				q.currentQA = 0
-			}
-		}
 		switch event.Key() {
 		case tcell.KeyEnter:
-			q.showAnswerQA[q.currentQA] = true
-			setFocus(q.primatives["ease"])
+			q.study.revealAnswer()
 		}
 	})
 }
@@ -128,13 +179,14 @@ func (q *StudyView) btmNavBar() *tview.Flex {
 	view := tview.NewFlex()
 	q.primatives["btmNav"] = view
 	view.SetDirection(tview.FlexRowCSS)
-	editNoteBtn := tview.NewTextView().SetText("Edit Note")
-	editTags := tview.NewTextView().SetText("Edit Tags")
-	buryCard := tview.NewTextView().SetText("Bury")
-	suspend := tview.NewTextView().SetText("Suspend")
-	deleteBtn := tview.NewTextView().SetText("Delete")
-	markBtn := tview.NewTextView().SetText("Mark")
-	resche := tview.NewTextView().SetText("Reschedule")
+	editNoteBtn := tview.NewTextView().SetText("[e] Edit Note")
+	editTags := tview.NewTextView().SetText("[t] Edit Tags")
+	buryCard := tview.NewTextView().SetText("[-] Bury")
+	suspend := tview.NewTextView().SetText("[@] Suspend")
+	deleteBtn := tview.NewTextView().SetText("[Del] Delete")
+	markBtn := tview.NewTextView().SetText("[*] Mark")
+	flagBtn := tview.NewTextView().SetText("[f] Flag")
+	resche := tview.NewTextView().SetText("[D] Reschedule")
 
 	view.AddItem(editNoteBtn, 0, 1, false)
 	view.AddItem(editTags, 0, 1, false)
@@ -142,39 +194,81 @@ func (q *StudyView) btmNavBar() *tview.Flex {
 	view.AddItem(suspend, 0, 1, false)
 	view.AddItem(deleteBtn, 0, 1, false)
 	view.AddItem(markBtn, 0, 1, false)
+	view.AddItem(flagBtn, 0, 1, false)
 	view.AddItem(resche, 0, 1, false)
 
 	return view
 }
 
-func (q *StudyView) sessionInfo(deckName string, stats models.DeckStudyStats) *tview.Flex {
+func (q *StudyView) sessionInfo(deckName string) *tview.Flex {
 	view := tview.NewFlex()
 	q.primatives["session"] = view
 	view.SetDirection(tview.FlexColumnCSS)
 	deckNameView := tview.NewTextView().SetText(deckName).SetTextAlign(tview.AlignLeft)
 
-	// learn - blue; review - red; new - green
-	statsView := tview.NewTextView()
-	fmt.Fprintf(statsView, "[#0000ff]%d [#ff0000::u]%d[-:-:-] [#00ff00]%d", stats.Learning, stats.Review, stats.New)
-	statsView.SetTextAlign(tview.AlignLeft).SetDynamicColors(true)
+	q.statsView = tview.NewTextView()
+	q.statsView.SetTextAlign(tview.AlignLeft).SetDynamicColors(true)
+	q.updateStats()
 
 	view.AddItem(deckNameView, 1, 2, false)
-	view.AddItem(statsView, 1, 2, false)
+	view.AddItem(q.statsView, 1, 2, false)
 
 	return view
 }
 
+// updateStats shows the number of cards left in the queues of the scheduler
+func (q *StudyView) updateStats() {
+	stats := q.SchedService.Counts()
+	q.statsView.Clear()
+	// learn - blue; review - red; new - green
+	fmt.Fprintf(q.statsView, "[#0000ff]%d [#ff0000]%d [#00ff00]%d", stats.Learning, stats.Review, stats.New)
+}
+
 func (q *StudyView) rightNav() *tview.Flex {
 	view := tview.NewFlex()
 	q.primatives["rightNav"] = view
 	view.SetDirection(tview.FlexColumnCSS)
 
-	undo := tview.NewTextView().SetText(" [::u]U[-:-:-]ndo").SetTextAlign(tview.AlignRight).SetDynamicColors(true)
+	undo := tview.NewTextView().SetText(" [::u]U[-:-:-]ndo").SetTextAlign(tview.AlignRight).SetDynamicColors(true)
+	q.statusView = tview.NewTextView().SetTextAlign(tview.AlignRight).SetDynamicColors(true)
+	q.updateStatus()
+	q.timerView = tview.NewTextView().SetTextAlign(tview.AlignRight).SetDynamicColors(true)
+	q.updateTimer()
 	view.AddItem(undo, 0, 1, false)
+	view.AddItem(q.statusView, 0, 1, false)
+	view.AddItem(q.timerView, 0, 1, false)
 
 	return view
 }
 
+// updateStatus shows the flag of the card and whether its note is marked
+func (q *StudyView) updateStatus() {
+	q.statusView.Clear()
+	var status []string
+	if flag := q.card.Flags & 7; flag > 0 {
+		status = append(status, fmt.Sprintf("[%s]%s flag[-]", flagColors[flag], flagNames[flag]))
+	}
+	if q.marked {
+		status = append(status, "[yellow]Marked[-]")
+	}
+	fmt.Fprint(q.statusView, strings.Join(status, " "))
+}
+
+// updateTimer shows the time spent on the card when the timer is enabled in the deck config.
+// The timer stops at the max time recorded for an answer
+func (q *StudyView) updateTimer() {
+	q.timerView.Clear()
+	if !bool(q.conf.Timer) {
+		return
+	}
+	taken := sched.TimeTaken(*q.card, q.conf) / 1000
+	color := "white"
+	if q.conf.MaxTaken > 0 && taken >= q.conf.MaxTaken {
+		color = "red"
+	}
+	fmt.Fprintf(q.timerView, "[%s]%d:%02d[-]", color, taken/60, taken%60)
+}
+
 func (q *StudyView) easeButtonTimes(ease models.Ease) (string, error) {
 	conf, err := q.ColService.Conf()
 	if err != nil {
@@ -184,14 +278,13 @@ func (q *StudyView) easeButtonTimes(ease models.Ease) (string, error) {
 	if !conf.EstimateTimes {
 		return "", nil
 	}
-	qa := q.QAs[q.currentQA]
-	deckConfig, err := q.DeckService.Conf(qa.Card.DeckID)
+	deckConfig, err := q.SchedService.CardConf(*q.card)
 	if err != nil {
-		return "", fmt.Errorf("failed to retrieve deck config for %v", qa.Card.DeckID)
+		return "", fmt.Errorf("failed to retrieve deck config for %v", q.card.DeckID)
 	}
-	easeTimes, err := q.SchedService.NextIntervalString(qa.Card, ease, deckConfig)
+	easeTimes, err := q.SchedService.NextIntervalString(*q.card, ease, deckConfig)
 	if err != nil {
-		return "", fmt.Errorf("failed to get ease interval time for ease %d on card %d", ease, qa.Card.ID)
+		return "", fmt.Errorf("failed to get ease interval time for ease %d on card %d", ease, q.card.ID)
 	}
 	return easeTimes, nil
 }
@@ -204,74 +297,469 @@ func (q *StudyView) easeButton(cnt int, ease models.Ease, label string) *tview.T
 	return tview.NewTextView().SetText(fmt.Sprintf("[%d] %s %s", cnt, label, easeTime)).SetTextAlign(tview.AlignCenter)
 }
 
-func (q *StudyView) easeButtonsNav() *tview.Flex {
-	view := tview.NewFlex()
-	q.primatives["ease"] = view
-	view.SetDirection(tview.FlexRowCSS)
-	qa := q.QAs[q.currentQA]
-	cnt, err := q.SchedService.AnswerButtons(qa.Card)
+// answerEases returns the eases of the buttons shown for the card by key
+func (q *StudyView) answerEases() map[rune]models.Ease {
+	cnt, err := q.SchedService.AnswerButtons(*q.card)
 	if err != nil {
 		q.Log.Fatal().Err(err).Msgf("failed to retrieve num of buttons to show")
 	}
+	if cnt == 2 {
+		return map[rune]models.Ease{'1': models.ReviewEaseWrong, '2': models.ReviewEaseHard}
+	}
+	return map[rune]models.Ease{
+		'1': models.ReviewEaseWrong,
+		'2': models.ReviewEaseHard,
+		'3': models.ReviewEaseOK,
+		'4': models.ReviewEaseEasy,
+	}
+}
 
-	againBtn := q.easeButton(1, models.LearnEaseWrong, "Again").SetTextAlign(tview.AlignCenter)
-	goodBtn := q.easeButton(2, models.LearnEaseOK, "Good").SetTextAlign(tview.AlignCenter)
-	easyBtn := q.easeButton(3, models.LearnEaseEasy, "Easy").SetTextAlign(tview.AlignCenter)
-	hardBtn := q.easeButton(4, models.ReviewEaseHard, "Hard").SetTextAlign(tview.AlignCenter)
+// updateEaseButtons shows the buttons to answer the card once the answer is shown
+func (q *StudyView) updateEaseButtons() {
+	q.easeView.Clear()
+	if !q.showAnswer {
+		if q.typing {
+			q.easeView.AddItem(q.typeAnswerInput(), 0, 1, false)
+			return
+		}
+		q.easeView.AddItem(tview.NewTextView().SetText("[Enter] Show Answer").SetTextAlign(tview.AlignCenter), 0, 1, false)
+		return
+	}
+	eases := q.answerEases()
+	if len(eases) == 2 {
+		q.easeView.AddItem(q.easeButton(1, eases['1'], "Again"), 0, 1, false)
+		q.easeView.AddItem(q.easeButton(2, eases['2'], "Good"), 0, 1, false)
+		return
+	}
+	q.easeView.AddItem(q.easeButton(1, models.ReviewEaseWrong, "Again"), 0, 1, false)
+	q.easeView.AddItem(q.easeButton(2, models.ReviewEaseHard, "Hard"), 0, 1, false)
+	q.easeView.AddItem(q.easeButton(3, models.ReviewEaseOK, "Good"), 0, 1, false)
+	q.easeView.AddItem(q.easeButton(4, models.ReviewEaseEasy, "Easy"), 0, 1, false)
+}
 
-	view.AddItem(againBtn, 0, 1, false)
-	switch cnt {
-	case 2:
-		view.AddItem(goodBtn, 0, 1, false)
-	case 3:
-		view.AddItem(goodBtn, 0, 1, false)
-		view.AddItem(easyBtn, 0, 1, false)
-	default:
-		view.AddItem(goodBtn, 0, 1, false)
-		view.AddItem(easyBtn, 0, 1, false)
-		view.AddItem(hardBtn, 0, 1, false)
+func (q *StudyView) easeButtonsNav() *tview.Flex {
+	q.easeView = tview.NewFlex()
+	q.primatives["ease"] = q.easeView
+	q.easeView.SetDirection(tview.FlexRowCSS)
+	q.updateEaseButtons()
+
+	q.easeView.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		ease, exists := q.answerEases()[event.Rune()]
+		if !exists {
+			return event
+		}
+		answer := sessionAnswer{ease: ease, taken: sched.TimeTaken(*q.card, q.conf)}
+		actions := len(q.actions)
+		err := q.act("Answer Card", func() error {
+			return q.SchedService.AnswerCard(q.card, ease)
+		})
+		if err != nil {
+			q.Log.Fatal().Err(err).Msgf("failed to answer card %v", q.card.ID)
+		}
+		if len(q.actions) > actions {
+			q.actions[len(q.actions)-1].answer = true
+		}
+		q.answers = append(q.answers, answer)
+		q.showNext()
+		return nil
+	})
+	return q.easeView
+}
+
+// revealAnswer shows the answer of the card and the buttons to answer it
+func (q *StudyView) revealAnswer() {
+	q.showAnswer = true
+	q.autoplay()
+	q.updateEaseButtons()
+	q.app.SetFocus(q.primatives["ease"])
+}
+
+// cardFocus returns the primitive getting the keys while the card is shown:
+// the input to type in the answer until the answer is shown or the card
+func (q *StudyView) cardFocus() tview.Primitive {
+	if q.typing && !q.showAnswer {
+		return q.typeInput
 	}
+	return q.primatives["QA"]
+}
 
-	view.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		var err error
-		switch event.Rune() {
-		case '1':
-			err = q.SchedService.AnswerCard(qa.Card, models.LearnEaseWrong)
-		case '2':
-			err = q.SchedService.AnswerCard(qa.Card, models.LearnEaseOK)
-		case '3':
-			err = q.SchedService.AnswerCard(qa.Card, models.LearnEaseEasy)
-		case '4':
-			err = q.SchedService.AnswerCard(qa.Card, models.ReviewEaseEasy)
+// act runs an action on the card being studied and records it so it can be undone.
+// The action is only recorded when it changed the collection
+func (q *StudyView) act(name string, cb func() error) error {
+	recorded, err := q.UndoService.Do(name, cb)
+	if err != nil || !recorded {
+		return err
+	}
+	q.actions = append(q.actions, studyAction{card: q.card.ID})
+	return nil
+}
+
+// remove runs an action taking the card out of the queues of the scheduler and shows the next card
+func (q *StudyView) remove(name string, cb func() error) error {
+	if err := q.act(name, cb); err != nil {
+		return err
+	}
+	// the siblings of the card may have been removed too
+	if err := q.SchedService.Reset(); err != nil {
+		return err
+	}
+	q.showNext()
+	return nil
+}
+
+// showNext shows the next card or stops the session when there is no card left to study
+func (q *StudyView) showNext() {
+	more, err := q.nextCard()
+	if err != nil {
+		q.Log.Fatal().Err(err).Msgf("failed to get the next card")
+	}
+	if !more {
+		q.finish(true)
+		return
+	}
+	q.updateStats()
+	q.updateStatus()
+	q.updateTimer()
+	q.updateEaseButtons()
+	q.autoplay()
+	q.app.SetFocus(q.cardFocus())
+}
+
+// toggleMark adds the marked tag to the note of the card or removes it
+func (q *StudyView) toggleMark() error {
+	return q.act("Toggle Mark", func() (err error) {
+		q.marked, err = q.NoteService.ToggleMark(q.card.NoteID)
+		if err == nil {
+			q.updateStatus()
+		}
+		return
+	})
+}
+
+// setFlag sets the flag of the card or removes it when the card already has the flag
+func (q *StudyView) setFlag(flag int) error {
+	if q.card.Flags&7 == flag {
+		flag = 0
+	}
+	return q.act("Set Flag", func() error {
+		if err := q.CardService.SetFlag([]models.ID{q.card.ID}, flag); err != nil {
+			return err
+		}
+		q.card.Flags = q.card.Flags&^7 | flag
+		q.updateStatus()
+		return nil
+	})
+}
+
+// editNote suspends the session to edit the note of the card or only its tags in the editor
+// and shows the card again with the changes
+func (q *StudyView) editNote(tagsOnly bool) error {
+	var fields map[string]string
+	var tags []string
+	var changed bool
+	var err error
+	q.app.Suspend(func() {
+		fields, tags, changed, err = q.edit(*q.card, tagsOnly)
+	})
+	// the images are cleared by the editor
+	q.placed = ""
+	if err != nil || !changed {
+		return err
+	}
+	err = q.act("Edit Note", func() error {
+		_, err := q.NoteService.Update(q.card.NoteID, fields, tags)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	cards, err := q.CardService.Find(fmt.Sprintf("cid:%d", q.card.ID))
+	if err != nil {
+		return err
+	}
+	if len(cards) == 0 {
+		return fmt.Errorf("card %d no longer exists", q.card.ID)
+	}
+	// the card keeps its place in the session
+	q.card.Note = cards[0].Note
+	showAnswer := q.showAnswer
+	if err := q.show(q.card); err != nil {
+		return err
+	}
+	q.showAnswer = showAnswer
+	q.updateStatus()
+	return nil
+}
+
+// reschedule asks for the number of days until the card is due
+func (q *StudyView) reschedule() {
+	input := tview.NewInputField().SetLabel("Due in days (0, 3-7, 1!): ").SetFieldWidth(10)
+	input.SetBorder(true).SetTitle("Set Due Date")
+	input.SetDoneFunc(func(key tcell.Key) {
+		q.pages.RemovePage("reschedule")
+		q.app.SetFocus(q.cardFocus())
+		if key != tcell.KeyEnter {
+			return
 		}
+		days := input.GetText()
+		err := q.remove("Set Due Date", func() error {
+			return q.SchedService.SetDueDate([]models.ID{q.card.ID}, days)
+		})
 		if err != nil {
-			q.Log.Fatal().Err(err).Msgf("failed to answer card %v", qa.Card.ID)
+			q.Log.Error().Err(err).Msgf("failed to reschedule card %v", q.card.ID)
+		}
+	})
+	modal := tview.NewGrid().SetColumns(0, 44, 0).SetRows(0, 3, 0).AddItem(input, 1, 1, 1, 1, 0, 0, true)
+	q.pages.AddPage("reschedule", modal, true, true)
+	q.app.SetFocus(input)
+}
+
+// handleKey runs the actions of the keys that can be used at any time during the session
+func (q *StudyView) handleKey(event *tcell.EventKey) *tcell.EventKey {
+	if name, _ := q.pages.GetFrontPage(); name != "study" {
+		return event
+	}
+	// the keys are typed in the answer
+	if q.typeInput != nil && q.app.GetFocus() == q.typeInput {
+		return event
+	}
+	var err error
+	if q.flagging {
+		q.flagging = false
+		if event.Rune() < '0' || event.Rune() > '7' {
+			return nil
+		}
+		if err := q.setFlag(int(event.Rune() - '0')); err != nil {
+			q.Log.Error().Err(err).Msgf("failed to flag card %v", q.card.ID)
 		}
-		q.currentQA++
-		if q.currentQA > len(q.QAs) {
-			q.currentQA = len(q.QAs) - 1
+		return nil
+	}
+	if event.Key() == tcell.KeyDelete {
+		err = q.remove("Delete Note", func() error {
+			_, err := q.NoteService.Delete([]models.ID{q.card.NoteID})
+			return err
+		})
+		if err != nil {
+			q.Log.Error().Err(err).Msgf("failed to delete note %v", q.card.NoteID)
 		}
+		return nil
+	}
+	switch event.Rune() {
+	case 'u':
+		err = q.undo()
+	case '-':
+		err = q.remove("Bury Card", func() error {
+			return q.SchedService.BuryCards([]models.ID{q.card.ID})
+		})
+	case '=':
+		err = q.remove("Bury Note", func() error {
+			return q.SchedService.BuryNotes([]models.ID{q.card.NoteID})
+		})
+	case '@':
+		err = q.remove("Suspend Card", func() error {
+			return q.SchedService.SuspendCards([]models.ID{q.card.ID})
+		})
+	case '!':
+		err = q.remove("Suspend Note", func() error {
+			return q.SchedService.SuspendNotes([]models.ID{q.card.NoteID})
+		})
+	case '*':
+		err = q.toggleMark()
+	case 'e':
+		err = q.editNote(false)
+	case 't':
+		err = q.editNote(true)
+	case 'r':
+		q.replay()
+	case 'f':
+		q.flagging = true
+	case 'D':
+		q.reschedule()
+	case 'q':
+		q.finish(false)
+	default:
 		return event
+	}
+	if err != nil {
+		q.Log.Error().Err(err).Msgf("failed to change card %v", q.card.ID)
+	}
+	return nil
+}
+
+// undo reverts the last action of the session and shows its card again
+func (q *StudyView) undo() error {
+	if len(q.actions) == 0 {
+		return nil
+	}
+	if _, err := q.UndoService.Undo(); err != nil {
+		// the actions beyond the undo history can not be undone
+		if errors.Is(err, services.ErrNothingToUndo) {
+			q.actions = nil
+			return nil
+		}
+		return err
+	}
+	action := q.actions[len(q.actions)-1]
+	q.actions = q.actions[:len(q.actions)-1]
+	if action.answer {
+		q.answers = q.answers[:len(q.answers)-1]
+	}
+	card, err := q.SchedService.RestoreCard(action.card)
+	if err != nil {
+		return err
+	}
+	if err := q.show(card); err != nil {
+		return err
+	}
+	q.updateStats()
+	q.updateStatus()
+	q.updateTimer()
+	q.updateEaseButtons()
+	q.autoplay()
+	q.app.SetFocus(q.cardFocus())
+	return nil
+}
+
+// finish ends the session with a summary of the answers of the session and of the reviews of today
+func (q *StudyView) finish(done bool) {
+	q.stopSounds()
+	var summary strings.Builder
+	if done {
+		summary.WriteString("Congratulations! You have finished this deck for now.\n\n")
+	}
+	var taken int64
+	var again int
+	for _, answer := range q.answers {
+		taken += answer.taken
+		if answer.ease == models.ReviewEaseWrong {
+			again++
+		}
+	}
+	fmt.Fprintf(&summary, "Studied %d cards in %s this session", len(q.answers), formatDuration(taken/1000))
+	if len(q.answers) > 0 {
+		fmt.Fprintf(&summary, " (%.1fs/card)\nAgain: %d (%.0f%%)", float64(taken)/1000/float64(len(q.answers)),
+			again, 100*float64(again)/float64(len(q.answers)))
+	}
+	today, err := q.StatService.TodayStats()
+	if err != nil {
+		q.Log.Error().Err(err).Msg("failed to retrieve the stats of today")
+	} else {
+		fmt.Fprintf(&summary, "\n\nStudied %d cards in %s today\nAgain: %d\nLearn: %d Review: %d Relearn: %d Filtered: %d",
+			today.Cards, formatDuration(today.Time), today.Failed, today.Learning, today.Review, today.Relearn, today.Filter)
+	}
+	summary.WriteString("\n\nPress any key to exit")
+
+	view := tview.NewTextView().SetText(summary.String()).SetTextAlign(tview.AlignCenter)
+	view.SetBorder(true).SetTitle("Session Summary")
+	view.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		q.app.Stop()
+		return nil
 	})
-	return view
+	q.pages.AddPage("summary", view, true, true)
+	q.app.SetFocus(view)
+}
+
+// formatDuration formats a number of seconds as minutes and seconds
+func formatDuration(seconds int64) string {
+	if seconds < 60 {
+		return fmt.Sprintf("%ds", seconds)
+	}
+	return fmt.Sprintf("%dm %ds", seconds/60, seconds%60)
 }
 
-// StudyReview will create a terminal app for studying cards
-func StudyReview(log *zerolog.Logger, deckName string, cards []*models.CardQA, stats models.DeckStudyStats,
-	schedService sched.SchedService, deckService services.DeckService, colService services.ColService) error {
+// nextCard gets the next card from the scheduler and reports whether there is a card left to study
+func (q *StudyView) nextCard() (bool, error) {
+	card, err := q.SchedService.GetCard()
+	if err != nil || card == nil {
+		return false, err
+	}
+	return true, q.show(card)
+}
+
+// show renders the question of the card
+func (q *StudyView) show(card *models.Card) error {
+	qa, err := q.render(*card)
+	if err != nil {
+		return err
+	}
+	conf, err := q.SchedService.CardConf(*card)
+	if err != nil {
+		return err
+	}
+	q.typeAnswer, q.typing = template.FindTypeAnswer(qa.QuestionBrowser)
+	q.typed, q.expected = "", ""
+	if q.typing {
+		if q.expected, err = q.typeAnswer.Expected(*card); err != nil {
+			return err
+		}
+	}
+	q.card = card
+	q.qa = qa
+	q.conf = conf
+	q.showAnswer = false
+	q.marked = false
+	for _, tag := range strings.Fields(card.Note.StringTags) {
+		if strings.EqualFold(tag, models.MarkedTag) {
+			q.marked = true
+		}
+	}
+	return nil
+}
+
+// StudyReview will create a terminal app for studying the cards given by the scheduler one at a time
+func StudyReview(log *zerolog.Logger, deckName string, render func(models.Card) (models.CardQA, error), edit models.EditNoteFunc,
+	media models.StudyMedia, schedService sched.SchedService, colService services.ColService, cardService services.CardService,
+	noteService services.NoteService, statService services.StatService, undoService *services.UndoService) error {
+	protocol, err := graphics.Detect(media.Images, os.Getenv)
+	if err != nil {
+		return err
+	}
 	primatives := make(map[string]tview.Primitive)
-	app := NewStudyView(cards, log, deckService, schedService, colService, primatives)
+	app := NewStudyView(log, render, edit, media, protocol, schedService, colService, cardService, noteService, statService, undoService,
+		primatives)
+	more, err := app.nextCard()
+	if err != nil {
+		return err
+	}
+	if !more {
+		log.Info().Msgf("no cards to study today for deck %s", deckName)
+		return nil
+	}
 
-	qaView := NewQuestionAnswerView(cards, log, deckService, schedService, colService, primatives)
+	qaView := NewQuestionAnswerView(app)
 
 	container := tview.NewGrid().SetColumns(20, 0, 20).SetRows(3, 0, 3, 3)
-	container.AddItem(app.sessionInfo(deckName, stats), 0, 0, 1, 1, 0, 0, false)
+	container.AddItem(app.sessionInfo(deckName), 0, 0, 1, 1, 0, 0, false)
 	container.AddItem(app.rightNav(), 0, 2, 1, 1, 0, 0, false)
 	container.AddItem(app.easeButtonsNav(), 2, 1, 1, 1, 0, 0, false)
 	container.AddItem(qaView, 1, 0, 1, 3, 0, 0, true)
 	container.AddItem(app.btmNavBar(), 3, 1, 1, 1, 0, 0, false)
 
-	if err := app.app.SetRoot(container, true).SetFocus(container).Run(); err != nil {
+	app.pages = tview.NewPages().AddPage("study", container, true, true)
+	app.app.SetInputCapture(app.handleKey)
+	if protocol == graphics.ProtocolKitty || protocol == graphics.ProtocolSixel {
+		app.app.SetAfterDrawFunc(app.placeImages)
+	}
+	defer app.stopSounds()
+	app.autoplay()
+
+	// the timer is refreshed every second until the session ends
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				app.app.QueueUpdateDraw(app.updateTimer)
+			}
+		}
+	}()
+
+	if err := app.app.SetRoot(app.pages, true).SetFocus(app.cardFocus()).Run(); err != nil {
 		return err
 	}
 
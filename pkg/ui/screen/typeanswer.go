@@ -0,0 +1,54 @@
+package screen
+
+import (
+	"strings"
+
+	"github.com/aerex/go-anki/pkg/template"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// diffColors are the colors of the parts of the answer typed in like the colors of Anki
+var diffColors = map[template.DiffKind]string{
+	template.DiffGood:   "[black:green]",
+	template.DiffBad:    "[black:red]",
+	template.DiffMissed: "[black:gray]",
+}
+
+// typeAnswerInput returns the input to type in the answer of the card. The answer is shown once it is typed in
+func (q *StudyView) typeAnswerInput() *tview.InputField {
+	q.typeInput = tview.NewInputField().SetLabel("Type answer: ")
+	q.typeInput.SetDoneFunc(func(key tcell.Key) {
+		if key != tcell.KeyEnter {
+			return
+		}
+		q.typed = q.typeInput.GetText()
+		q.revealAnswer()
+	})
+	return q.typeInput
+}
+
+// comparison returns the lines comparing the answer typed in with the expected answer.
+// The expected answer is shown alone when nothing was typed in
+func (q *StudyView) comparison() []string {
+	if q.typed == "" {
+		return []string{tview.Escape(q.expected)}
+	}
+	given, correct, err := template.CompareAnswer(q.typed, q.expected)
+	if err != nil {
+		q.Log.Error().Err(err).Msgf("failed to compare the answer typed in for card %v", q.card.ID)
+		return []string{tview.Escape(q.expected)}
+	}
+	if len(given) == 1 && len(correct) == 1 && given[0].Kind == template.DiffGood && correct[0].Kind == template.DiffGood {
+		return []string{diffLine(given)}
+	}
+	return []string{diffLine(given), "↓", diffLine(correct)}
+}
+
+func diffLine(segments []template.DiffSegment) string {
+	var line strings.Builder
+	for _, segment := range segments {
+		line.WriteString(diffColors[segment.Kind] + tview.Escape(segment.Text) + "[-:-]")
+	}
+	return line.String()
+}